@@ -8,6 +8,7 @@ CGO_ENABLED=1
 GOOS=linux
 GOARCH=amd64
 go build -gcflags="all=-N -l" -v -ldflags "-extldflags \"-static\" -X main.version=${BUILD_VERSION} -X main.buildInfo=${BUILD_INFO}" -o /bin/f5-ipam-controller $REPOPATH/cmd/f5-ipam-controller
+go build -v -ldflags "-extldflags \"-static\" -X main.version=${BUILD_VERSION} -X main.buildInfo=${BUILD_INFO}" -o /bin/ipamctl $REPOPATH/cmd/ipamctl
 
 RUN_TESTS=${RUN_TESTS:-1}
 . $REPOPATH/build-tools/_build-lib.sh
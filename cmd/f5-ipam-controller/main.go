@@ -1,21 +1,31 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/F5Networks/f5-ipam-controller/pkg/controller"
+	"github.com/F5Networks/f5-ipam-controller/pkg/credentials"
+	"github.com/F5Networks/f5-ipam-controller/pkg/health"
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/client/clientset/versioned"
 	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/migration"
 	"github.com/F5Networks/f5-ipam-controller/pkg/orchestration"
+	"github.com/F5Networks/f5-ipam-controller/pkg/snapshot"
 	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
 	clog "github.com/F5Networks/f5-ipam-controller/pkg/vlogger/console"
+	"github.com/F5Networks/f5-ipam-controller/pkg/webhook"
 	flag "github.com/spf13/pflag"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
 )
 
 const (
@@ -32,12 +42,41 @@ var (
 	globalFlags    *flag.FlagSet
 	basicProvFlags *flag.FlagSet
 	ibFlags        *flag.FlagSet
+	nbFlags        *flag.FlagSet
+	piFlags        *flag.FlagSet
+	plFlags        *flag.FlagSet
+	rtFlags        *flag.FlagSet
 
 	// Global
-	logLevel   *string
-	orch       *string
-	provider   *string
-	namespaces *[]string
+	logLevel       *string
+	orch           *string
+	provider       *string
+	namespaces     *[]string
+	allNamespaces  *bool
+	namespaceLabel *string
+	ctlrClass      *string
+	ipamSelector   *string
+	orchModes      *[]string
+	lbClass        *string
+	gatewayClass   *string
+	manageCRD      *bool
+	migrateLegacy  *bool
+	migrateFrom    *string
+	migrateDryRun  *bool
+
+	// Snapshots
+	snapshotDir      *string
+	snapshotInterval *time.Duration
+	snapshotFormat   *string
+	snapshotRetain   *int
+	restoreSnapshot  *string
+
+	// Webhook
+	webhookPort     *int
+	webhookCertFile *string
+	webhookKeyFile  *string
+
+	healthPort *int
 
 	// Default Provider
 	iprange *string
@@ -53,6 +92,35 @@ var (
 	ibNetView    *string
 	credsDir     *string
 	sslInsecure  *bool
+	ibCluster    *string
+	ibExtraEAs   *string
+	ibCacheTTL   *time.Duration
+	ibGrids      *string
+
+	credsInterval *time.Duration
+
+	// NetBox
+	nbURL      *string
+	nbToken    *string
+	nbLabelMap *string
+	nbCACert   *string
+	nbInsecure *bool
+
+	// phpIPAM
+	piURL      *string
+	piAppID    *string
+	piUsername *string
+	piPassword *string
+	piLabelMap *string
+
+	// Plugin
+	plURL      *string
+	plToken    *string
+	plCACert   *string
+	plInsecure *bool
+
+	// Routing
+	rtLabelMap *string
 )
 
 func init() {
@@ -60,6 +128,10 @@ func init() {
 	globalFlags = flag.NewFlagSet("Global", flag.ContinueOnError)
 	basicProvFlags = flag.NewFlagSet("Default Provider", flag.ContinueOnError)
 	ibFlags = flag.NewFlagSet("Infoblox", flag.ContinueOnError)
+	nbFlags = flag.NewFlagSet("NetBox", flag.ContinueOnError)
+	piFlags = flag.NewFlagSet("phpIPAM", flag.ContinueOnError)
+	plFlags = flag.NewFlagSet("Plugin", flag.ContinueOnError)
+	rtFlags = flag.NewFlagSet("Routing", flag.ContinueOnError)
 
 	//Flag terminal wrapping
 	var err error
@@ -81,6 +153,59 @@ func init() {
 	namespaces = globalFlags.StringArray("namespace", []string{},
 		"Optional, Kubernetes namespace(s) to watch."+
 			"If left blank controller will watch only kube-system namespace")
+	allNamespaces = globalFlags.Bool("all-namespaces", false,
+		"Optional, when set to true, controller will watch all Kubernetes namespaces.")
+	namespaceLabel = globalFlags.String("namespace-label", "",
+		"Optional, used to watch namespaces that match the label selector. "+
+			"Namespaces are added and removed as they are created, labelled or deleted.")
+	ctlrClass = globalFlags.String("controller-class", "",
+		"Optional, process only the IPAM resources with the matching spec.controllerClass. "+
+			"If left blank controller will process only IPAM resources without a controller class")
+	ipamSelector = globalFlags.String("ipam-label-selector", "",
+		"Optional, process only the IPAM resources that match the label selector.")
+	orchModes = globalFlags.StringSlice("orchestration-mode", []string{orchestration.ModeIPAM},
+		"Optional, comma separated resources to allocate IP addresses for: ipam for IPAM resources, "+
+			"service for Services of type LoadBalancer, gateway for Gateways of the Gateway API.")
+	lbClass = globalFlags.String("load-balancer-class", "",
+		"Optional, with the service orchestration mode, process the Services of type LoadBalancer with this "+
+			"loadBalancerClass. If left blank controller will process the Services without loadBalancerClass "+
+			"that have the "+orchestration.IPAMLabelAnnotation+" annotation")
+	gatewayClass = globalFlags.String("gateway-class", "",
+		"Required with the gateway orchestration mode, process the Gateways of this GatewayClass "+
+			"that have no spec.addresses.")
+	manageCRD = globalFlags.Bool("manage-crd", false,
+		"Optional, when set to true, controller creates the IPAM CRD and updates its schema in place "+
+			"when the embedded schema is newer. Existing IPAM resources are preserved.")
+	migrateLegacy = globalFlags.Bool("migrate-legacy-crd", false,
+		"Optional, when set to true, controller migrates the legacy f5ipams resources to ipams resources "+
+			"along with their IP addresses, reports what was migrated and exits.")
+	migrateFrom = globalFlags.String("migrate-from-provider", "",
+		"Optional, IPAM provider to migrate the allocations from to the ipam-provider, keeping the IP address of "+
+			"every hostname/key. Arguments of both providers are required, controller reports the result and exits.")
+	migrateDryRun = globalFlags.Bool("migrate-dry-run", false,
+		"Optional, when set to true, migrate-from-provider only reports the changes and conflicts.")
+	snapshotDir = globalFlags.String("snapshot-dir", "",
+		"Optional, directory to write scheduled snapshots of the allocations to, for example a second mounted "+
+			"volume. If left blank scheduled snapshots are disabled")
+	snapshotInterval = globalFlags.Duration("snapshot-interval", time.Hour,
+		"Optional, interval between the scheduled snapshots.")
+	snapshotFormat = globalFlags.String("snapshot-format", snapshot.FormatJSON,
+		"Optional, format of the scheduled snapshots, json or csv.")
+	snapshotRetain = globalFlags.Int("snapshot-retain", 24,
+		"Optional, number of scheduled snapshots to keep, all of them are kept when it is 0.")
+	restoreSnapshot = globalFlags.String("restore-snapshot", "",
+		"Optional, snapshot file to restore the allocations from. The snapshot is validated against the "+
+			"configured IPAM labels before it is applied, controller reports the result and exits.")
+	webhookPort = globalFlags.Int("webhook-port", 0,
+		"Optional, port to serve the validating admission webhook for IPAM resources on. "+
+			"If left blank the webhook is disabled")
+	webhookCertFile = globalFlags.String("webhook-tls-cert", "",
+		"Optional, TLS certificate file of the validating admission webhook.")
+	webhookKeyFile = globalFlags.String("webhook-tls-key", "",
+		"Optional, TLS private key file of the validating admission webhook.")
+	healthPort = globalFlags.Int("health-port", 0,
+		"Optional, port to serve the /healthz liveness and /readyz readiness checks on. "+
+			"If left blank the health checks are disabled")
 	iprange = basicProvFlags.String("ip-range", "",
 		"Optional, the Default Provider needs iprange to build pools of IP Addresses")
 
@@ -103,10 +228,64 @@ func init() {
 	ibNetView = ibFlags.String("infoblox-netview", "",
 		"Required for allocation of IP addresses")
 	credsDir = ibFlags.String("credentials-directory", "",
-		"Optional, directory that contains the Infoblox username, password and/or wapi-port, grid-host "+
+		"Optional, directory that contains the Infoblox or phpIPAM username, password and/or wapi-port, grid-host "+
 			"files. To be used instead of username, password, and/or wapi-port, grid-host arguments.")
+	credsInterval = ibFlags.Duration("credentials-check-interval", 30*time.Second,
+		"Optional, interval between the checks of the credentials directory for changed credentials.")
 	sslInsecure = ibFlags.Bool("insecure", false,
-		"Optional, when set to true, enable insecure SSL communication to Infoblox.")
+		"Optional, when set to true, enable insecure SSL communication to Infoblox or phpIPAM.")
+	ibCluster = ibFlags.String("infoblox-cluster-name", "",
+		"Optional, name of the cluster written in the F5IPAMCluster extensible attribute of the Infoblox objects. "+
+			"Only the objects of this cluster are looked up and released.")
+	ibExtraEAs = ibFlags.String("infoblox-extra-eas", "",
+		"Optional, JSON of the extensible attributes to write on every allocation. "+
+			"Values can hold {cluster}, {namespace}, {name} and {reference}.")
+	ibCacheTTL = ibFlags.Duration("infoblox-cache-ttl", 10*time.Minute,
+		"Optional, how long the IP addresses looked up in Infoblox are cached. 0 disables the cache.")
+	ibGrids = ibFlags.String("infoblox-grids", "",
+		"Optional, JSON of the additional Infoblox grids that the labels can refer to with grid. "+
+			"Each grid has host, port, wapiVersion, username, sslVerify and credentialsDirectory, "+
+			"the password is read from the credentialsDirectory.")
+
+	// NetBox flags
+	nbURL = nbFlags.String("netbox-url", "",
+		"Required for netbox, the URL of NetBox, e.g. https://netbox.example.com")
+	nbToken = nbFlags.String("netbox-token", "",
+		"Required for netbox, the API token of NetBox.")
+	nbLabelMap = nbFlags.String("netbox-labels", "",
+		"Required for mapping the NetBox prefixes or IP ranges to IPAM labels")
+	nbCACert = nbFlags.String("netbox-ca-cert", "",
+		"Optional, certificate file to verify NetBox with. If left blank the system certificates are used")
+	nbInsecure = nbFlags.Bool("netbox-insecure", false,
+		"Optional, when set to true, enable insecure SSL communication to NetBox.")
+
+	// phpIPAM flags
+	piURL = piFlags.String("phpipam-url", "",
+		"Required for phpipam, the URL of phpIPAM, e.g. https://phpipam.example.com")
+	piAppID = piFlags.String("phpipam-app-id", "",
+		"Required for phpipam, the ID of the API application of phpIPAM.")
+	piUsername = piFlags.String("phpipam-username", "",
+		"Required for phpipam, the login username.")
+	piPassword = piFlags.String("phpipam-password", "",
+		"Required for phpipam, the login password.")
+	piLabelMap = piFlags.String("phpipam-labels", "",
+		"Required for mapping the phpIPAM subnet IDs to IPAM labels")
+
+	// Plugin flags
+	plURL = plFlags.String("plugin-url", "",
+		"Required for plugin, the URL of the IPAM provider plugin, e.g. https://ipam-plugin:8443")
+	plToken = plFlags.String("plugin-token", "",
+		"Optional, bearer token to send to the plugin.")
+	plCACert = plFlags.String("plugin-ca-cert", "",
+		"Optional, certificate file to verify the plugin with. If left blank the system certificates are used")
+	plInsecure = plFlags.Bool("plugin-insecure", false,
+		"Optional, when set to true, enable insecure SSL communication to the plugin.")
+
+	// Routing flags
+	rtLabelMap = rtFlags.String("routing-labels", "",
+		"Required for routing, JSON of the provider of each IPAM label, e.g. {\"Prod\":\"infoblox\",\"Test\":\"f5-ip-provider\"}, "+
+			"or of its provider chain, e.g. {\"Test\":{\"provider\":\"infoblox\",\"fallback\":\"f5-ip-provider\"}}. "+
+			"The labels are configured with the arguments of their providers")
 	globalFlags.Usage = func() {
 		_, _ = fmt.Fprintf(os.Stderr, "  Global:\n%s\n", globalFlags.FlagUsagesWrapped(width))
 	}
@@ -119,15 +298,39 @@ func init() {
 		_, _ = fmt.Fprintf(os.Stderr, "  Infoblox Provider:\n%s\n", ibFlags.FlagUsagesWrapped(width))
 	}
 
+	nbFlags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "  NetBox Provider:\n%s\n", nbFlags.FlagUsagesWrapped(width))
+	}
+
+	piFlags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "  phpIPAM Provider:\n%s\n", piFlags.FlagUsagesWrapped(width))
+	}
+
+	plFlags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "  Plugin Provider:\n%s\n", plFlags.FlagUsagesWrapped(width))
+	}
+
+	rtFlags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "  Routing Provider:\n%s\n", rtFlags.FlagUsagesWrapped(width))
+	}
+
 	flags.AddFlagSet(globalFlags)
 	flags.AddFlagSet(basicProvFlags)
 	flags.AddFlagSet(ibFlags)
+	flags.AddFlagSet(nbFlags)
+	flags.AddFlagSet(piFlags)
+	flags.AddFlagSet(plFlags)
+	flags.AddFlagSet(rtFlags)
 
 	flags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s\n", os.Args[0])
 		globalFlags.Usage()
 		basicProvFlags.Usage()
 		ibFlags.Usage()
+		nbFlags.Usage()
+		piFlags.Usage()
+		plFlags.Usage()
+		rtFlags.Usage()
 	}
 }
 
@@ -146,15 +349,56 @@ func verifyArgs() error {
 		return fmt.Errorf("orchestration is required")
 	}
 
+	if *allNamespaces && (len(*namespaces) > 0 || len(*namespaceLabel) > 0) {
+		return fmt.Errorf("all-namespaces cannot be used along with namespace or namespace-label")
+	}
+	if len(*namespaces) > 0 && len(*namespaceLabel) > 0 {
+		return fmt.Errorf("namespace and namespace-label cannot be used together")
+	}
+
+	for _, mode := range *orchModes {
+		switch mode {
+		case orchestration.ModeIPAM, orchestration.ModeService:
+		case orchestration.ModeGateway:
+			if len(*gatewayClass) == 0 {
+				return fmt.Errorf("gateway-class is required with the gateway orchestration-mode")
+			}
+		default:
+			return fmt.Errorf("unknown orchestration-mode %v, should be ipam, service or gateway", mode)
+		}
+	}
+
+	if *snapshotFormat != snapshot.FormatJSON && *snapshotFormat != snapshot.FormatCSV {
+		return fmt.Errorf("snapshot-format should be json or csv")
+	}
+	if len(*snapshotDir) > 0 && *snapshotInterval <= 0 {
+		return fmt.Errorf("snapshot-interval should be greater than zero")
+	}
+
+	if *webhookPort != 0 && (len(*webhookCertFile) == 0 || len(*webhookKeyFile) == 0) {
+		return fmt.Errorf("webhook-tls-cert and webhook-tls-key are required for the webhook")
+	}
+
 	*orch = strings.ToLower(*orch)
 	*provider = strings.ToLower(*provider)
-	if len(*iprange) == 0 && *provider == DefaultProvider {
+	*migrateFrom = strings.ToLower(*migrateFrom)
+	if len(*migrateFrom) > 0 && *migrateFrom == *provider {
+		return fmt.Errorf("migrate-from-provider should be different from ipam-provider")
+	}
+	if *provider == manager.RoutingProvider || *migrateFrom == manager.RoutingProvider {
+		if len(*rtLabelMap) == 0 {
+			return fmt.Errorf("missing Routing Labels")
+		} else if _, err := manager.ParseRoutingLabels(*rtLabelMap); err != nil {
+			return fmt.Errorf("invalid Routing Labels: %v", err)
+		}
+	}
+	if len(*iprange) == 0 && (*provider == DefaultProvider || isRouted(DefaultProvider)) {
 		return fmt.Errorf("IP Range not provider for Provider: %v", DefaultProvider)
 	}
 	*iprange = strings.Trim(*iprange, "\"")
 	*iprange = strings.Trim(*iprange, "'")
 
-	if *provider == manager.InfobloxProvider {
+	if usesProvider(manager.InfobloxProvider) {
 		if len(*credsDir) == 0 {
 			if len(*ibHost) == 0 || len(*ibVersion) == 0 {
 				return fmt.Errorf("missing required Infoblox parameter")
@@ -168,56 +412,433 @@ func verifyArgs() error {
 		}
 	}
 
+	if usesProvider(manager.NetBoxProvider) {
+		if len(*nbURL) == 0 || len(*nbToken) == 0 {
+			return fmt.Errorf("missing required NetBox parameter")
+		} else if len(*nbLabelMap) == 0 {
+			return fmt.Errorf("missing NetBox Labels")
+		}
+	}
+
+	if usesProvider(manager.PhpIPAMProvider) {
+		if len(*piURL) == 0 || len(*piAppID) == 0 {
+			return fmt.Errorf("missing required phpIPAM parameter")
+		} else if len(*credsDir) == 0 && (len(*piUsername) == 0 || len(*piPassword) == 0) {
+			return fmt.Errorf("missing phpIPAM credentials")
+		} else if len(*piLabelMap) == 0 {
+			return fmt.Errorf("missing phpIPAM Labels")
+		}
+	}
+
+	if usesProvider(manager.PluginProvider) && len(*plURL) == 0 {
+		return fmt.Errorf("missing required plugin parameter")
+	}
+
 	return nil
 }
 
+// usesProvider checks whether the provider is the ipam-provider, the migrate-from-provider or routed to
+func usesProvider(prov string) bool {
+	return *provider == prov || *migrateFrom == prov || isRouted(prov)
+}
+
+// isRouted checks whether a label of the routing provider is routed to the provider
+func isRouted(prov string) bool {
+	for _, routed := range getRoutedProviders() {
+		if routed == prov {
+			return true
+		}
+	}
+	return false
+}
+
+// getRoutedProviders returns the providers that the labels of the routing provider are routed to
+func getRoutedProviders() []string {
+	if *provider != manager.RoutingProvider && *migrateFrom != manager.RoutingProvider {
+		return nil
+	}
+	labels, err := manager.ParseRoutingLabels(*rtLabelMap)
+	if err != nil {
+		return nil
+	}
+	return manager.RoutedProviders(labels)
+}
+
 func getCredentials() error {
+	if len(*credsDir) > 0 && usesProvider(manager.PhpIPAMProvider) {
+		if err := getPhpIPAMCredentials(); err != nil {
+			return err
+		}
+		if !usesProvider(manager.InfobloxProvider) {
+			return nil
+		}
+	}
 	// Get infoblox credentials
 	if len(*credsDir) > 0 {
-		var username, password, infobloxURL, port, appendSlash string
-		var err error
-
-		if !strings.HasSuffix(*credsDir, "/") {
-			appendSlash = "/"
-		}
-		username = *credsDir + appendSlash + "username"
-		password = *credsDir + appendSlash + "password"
-		infobloxURL = *credsDir + appendSlash + "grid-host"
-		port = *credsDir + appendSlash + "wapi-port"
-
-		setField := func(field *string, filename, fieldType string) error {
-			fileBytes, readErr := ioutil.ReadFile(filename)
-			if readErr != nil {
-				log.Debugf("No %s in credentials directory, falling back to CLI argument", fieldType)
-				if len(*field) == 0 {
-					return fmt.Errorf("Infoblox %s not specified", fieldType)
-				}
-			} else {
-				*field = strings.TrimSpace(string(fileBytes))
+		creds, err := credentials.Read(*credsDir, currentCredentials())
+		if err != nil {
+			return err
+		}
+		setCredentials(creds)
+	}
+	return nil
+}
+
+// getPhpIPAMCredentials reads the phpIPAM username and password of the credentials directory, the grid-host
+// and wapi-port files replace the host and the port of the phpIPAM URL
+func getPhpIPAMCredentials() error {
+	// Only the username and password can be missing, the host and port default to the URL
+	creds, piAddr, err := credentials.ReadURL(*credsDir, *piURL, *piUsername, *piPassword)
+	if err != nil {
+		return fmt.Errorf("missing phpIPAM credentials in %v: %v", *credsDir, err)
+	}
+	*piUsername = creds.Username
+	*piPassword = creds.Password
+	*piURL = piAddr
+	return nil
+}
+
+// currentCredentials returns the Infoblox credentials of the arguments
+func currentCredentials() credentials.Credentials {
+	return credentials.Credentials{
+		Username: *ibUsername,
+		Password: *ibPassword,
+		Host:     *ibHost,
+		Port:     *ibPort,
+	}
+}
+
+func setCredentials(creds credentials.Credentials) {
+	*ibUsername = creds.Username
+	*ibPassword = creds.Password
+	*ibHost = creds.Host
+	*ibPort = creds.Port
+}
+
+// setPhpIPAMCredentials sets the phpIPAM arguments to the credentials that phpIPAM accepted
+func setPhpIPAMCredentials(creds credentials.Credentials) {
+	*piUsername = creds.Username
+	*piPassword = creds.Password
+	*piURL = creds.URL(*piURL)
+}
+
+// watchCredentials reconnects the manager to the Infoblox grids and phpIPAM when the files of their credentials
+// directories change
+func watchCredentials(mgr manager.Manager, stopCh <-chan struct{}) {
+	updater, ok := mgr.(manager.CredentialsUpdater)
+	if !ok {
+		return
+	}
+	events := orchestration.NewEventReporter()
+	if !usesProvider(manager.InfobloxProvider) {
+		if usesProvider(manager.PhpIPAMProvider) && len(*credsDir) > 0 {
+			defaults, err := credentials.URLDefaults(*piURL, *piUsername, *piPassword)
+			if err != nil {
+				log.Errorf("[CRED] Unable to watch the credentials of phpIPAM: %v", err)
+				return
 			}
-			return nil
+			watchGridCredentials(updater, events, "phpIPAM", manager.DefaultGrid, *credsDir, defaults,
+				"", setPhpIPAMCredentials, stopCh)
+		}
+		return
+	}
+	ibParams := getManagerParams(*provider).InfobloxParams
+	if len(*credsDir) > 0 {
+		// The labels routed to phpIPAM share the credentials directory with the default grid
+		target := "Infoblox grid " + manager.DefaultGrid
+		if usesProvider(manager.PhpIPAMProvider) {
+			target += " and phpIPAM"
+		}
+		watchGridCredentials(updater, events, target, manager.DefaultGrid, *credsDir, currentCredentials(),
+			ibParams.SslVerify, setCredentials, stopCh)
+	}
+	grids, err := manager.ParseGrids(*ibGrids, manager.GridParams{
+		Port:      ibParams.Port,
+		Version:   ibParams.Version,
+		SslVerify: ibParams.SslVerify,
+	})
+	if err != nil {
+		log.Errorf("[CRED] Unable to watch the credentials of the grids: %v", err)
+		return
+	}
+	for name, grid := range grids {
+		defaults := credentials.Credentials{
+			Username: grid.Username,
+			Password: grid.Password,
+			Host:     grid.Host,
+			Port:     grid.Port,
 		}
+		watchGridCredentials(updater, events, "Infoblox grid "+name, name, grid.CredentialsDirectory, defaults,
+			grid.SslVerify, nil, stopCh)
+	}
+}
 
-		err = setField(ibUsername, username, "username")
+// watchGridCredentials reconnects the manager to the grid when the files of the directory change, target
+// names the grid in the logs and events. applied is called with the credentials that the grid accepted
+func watchGridCredentials(
+	updater manager.CredentialsUpdater,
+	events *orchestration.EventReporter,
+	target, grid, dir string,
+	defaults credentials.Credentials,
+	sslVerify string,
+	applied func(credentials.Credentials),
+	stopCh <-chan struct{},
+) {
+	credentials.NewWatcher(credentials.WatcherParams{
+		Dir:      dir,
+		Interval: *credsInterval,
+		Defaults: defaults,
+		OnChange: func(creds credentials.Credentials) error {
+			log.Infof("[CRED] Credentials changed, reconnecting to %v at %v:%v", target, creds.Host, creds.Port)
+			params := manager.GridParams{
+				Host:      creds.Host,
+				Port:      creds.Port,
+				Username:  creds.Username,
+				Password:  creds.Password,
+				SslVerify: sslVerify,
+			}
+			err := updater.UpdateCredentials(grid, params)
+			if err != nil {
+				events.Report(orchestration.EventTypeWarning, "CredentialsRejected",
+					fmt.Sprintf("%v at %v:%v did not accept the changed credentials: %v",
+						target, creds.Host, creds.Port, err))
+				return err
+			}
+			if applied != nil {
+				applied(creds)
+			}
+			events.Report(orchestration.EventTypeNormal, "CredentialsUpdated",
+				fmt.Sprintf("Reconnected to %v at %v:%v with the changed credentials", target, creds.Host, creds.Port))
+			return nil
+		},
+	}).Start(stopCh)
+}
+
+// getIPAMLabels returns the IPAM labels configured for the provider, the plugins answer theirs to the manager
+func getIPAMLabels(mgr manager.Manager) ([]string, error) {
+	var labels []string
+	switch *provider {
+	case manager.F5IPAMProvider:
+		ipRangeMap := make(map[string]string)
+		if err := json.Unmarshal([]byte(*iprange), &ipRangeMap); err != nil {
+			return nil, err
+		}
+		for label := range ipRangeMap {
+			labels = append(labels, label)
+		}
+	case manager.InfobloxProvider:
+		ibLabels, err := manager.ParseLabels(*ibLabelMap)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		for label := range ibLabels {
+			labels = append(labels, label)
 		}
-		err = setField(ibPassword, password, "password")
+	case manager.NetBoxProvider:
+		nbLabels, err := manager.ParseNetBoxLabels(*nbLabelMap)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		for label := range nbLabels {
+			labels = append(labels, label)
 		}
-		err = setField(ibHost, infobloxURL, "grid-host")
+	case manager.PhpIPAMProvider:
+		piLabels, err := manager.ParsePhpIPAMLabels(*piLabelMap)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		err = setField(ibPort, port, "wapi-port")
+		for label := range piLabels {
+			labels = append(labels, label)
+		}
+	case manager.RoutingProvider:
+		rtLabels, err := manager.ParseRoutingLabels(*rtLabelMap)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		for label := range rtLabels {
+			labels = append(labels, label)
+		}
+	case manager.PluginProvider:
+		if plMgr, ok := mgr.(*manager.PluginManager); ok {
+			labels = append(labels, plMgr.Info().Labels...)
 		}
 	}
+	return labels, nil
+}
+
+// runLegacyMigration migrates the legacy f5ipams resources of the watched namespaces
+func runLegacyMigration(mgr manager.Manager) error {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	kubeCRClient, err := versioned.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	migrateNamespaces := *namespaces
+	if *allNamespaces || len(*namespaceLabel) > 0 {
+		migrateNamespaces = []string{""}
+	} else if len(migrateNamespaces) == 0 {
+		migrateNamespaces = []string{orchestration.DefaultNamespace}
+	}
+	report, err := migration.NewLegacyMigrator(migration.LegacyParams{
+		DynamicClient: dynamicClient,
+		KubeCRClient:  kubeCRClient,
+		Manager:       mgr,
+		Namespaces:    migrateNamespaces,
+	}).Run()
+	if report != nil {
+		report.Print(os.Stdout)
+	}
+	return err
+}
+
+// getManagerParams returns the manager parameters of the provider from the arguments, the routing
+// provider takes the parameters of the providers that its labels are routed to
+func getManagerParams(prov string) manager.Params {
+	mgrParams := manager.Params{
+		Provider: prov,
+	}
+	if prov == manager.RoutingProvider {
+		mgrParams.RoutingParams = manager.RoutingParams{LabelMap: *rtLabelMap}
+		for _, routed := range getRoutedProviders() {
+			setProviderParams(&mgrParams, routed)
+		}
+		return mgrParams
+	}
+	setProviderParams(&mgrParams, prov)
+	return mgrParams
+}
+
+// setProviderParams sets the manager parameters of the provider from the arguments
+func setProviderParams(mgrParams *manager.Params, prov string) {
+	switch prov {
+	case manager.F5IPAMProvider:
+		mgrParams.IPAMManagerParams = manager.IPAMManagerParams{Range: *iprange}
+	case manager.InfobloxProvider:
+		mgrParams.InfobloxParams = manager.InfobloxParams{
+			Host:        *ibHost,
+			Version:     *ibVersion,
+			Port:        *ibPort,
+			Username:    *ibUsername,
+			Password:    *ibPassword,
+			IbLabelMap:  *ibLabelMap,
+			NetView:     *ibNetView,
+			ClusterName: *ibCluster,
+			ExtraEAs:    *ibExtraEAs,
+			CacheTTL:    *ibCacheTTL,
+			// The controller starts while the grid is unreachable, the one-shot runs need it at once
+			RetryConnect: !isOneShotRun(),
+			Grids:        *ibGrids,
+		}
+		if !*sslInsecure {
+			// if orchestrator is kubernetes
+			if len(*credsDir) > 0 {
+				var appendSlash string
+				if !strings.HasSuffix(*credsDir, "/") {
+					appendSlash = "/"
+				}
+				mgrParams.SslVerify = *credsDir + appendSlash + "certificate"
+			} else {
+				log.Infof("[INIT] Error in fetching cert for infoblox")
+			}
+		} else {
+			mgrParams.SslVerify = "false"
+		}
+	case manager.NetBoxProvider:
+		mgrParams.NetBoxParams = manager.NetBoxParams{
+			URL:        *nbURL,
+			Token:      *nbToken,
+			LabelMap:   *nbLabelMap,
+			CACertFile: *nbCACert,
+			Insecure:   *nbInsecure,
+			// The controller starts while NetBox is unreachable, the one-shot runs need it at once
+			RetryConnect: !isOneShotRun(),
+		}
+	case manager.PhpIPAMProvider:
+		mgrParams.PhpIPAMParams = manager.PhpIPAMParams{
+			URL:      *piURL,
+			AppID:    *piAppID,
+			Username: *piUsername,
+			Password: *piPassword,
+			LabelMap: *piLabelMap,
+			Insecure: *sslInsecure,
+			// The controller starts while phpIPAM is unreachable, the one-shot runs need it at once
+			RetryConnect: !isOneShotRun(),
+		}
+		if !*sslInsecure && len(*credsDir) > 0 {
+			mgrParams.PhpIPAMParams.CACertFile = filepath.Join(*credsDir, credentials.CertificateFile)
+		}
+	case manager.PluginProvider:
+		mgrParams.PluginParams = manager.PluginParams{
+			URL:        *plURL,
+			Token:      *plToken,
+			CACertFile: *plCACert,
+			Insecure:   *plInsecure,
+		}
+	}
+}
+
+// runProviderMigration migrates the allocations of the migrate-from-provider to the manager
+func runProviderMigration(mgr manager.Manager) error {
+	// The allocations are only read from the source provider, its labels are left as they are
+	srcParams := getManagerParams(*migrateFrom)
+	srcParams.KeepLabels = true
+	srcMgr, err := manager.NewManager(srcParams)
+	if err != nil {
+		return err
+	}
+	source, ok := srcMgr.(manager.Inspector)
+	if !ok {
+		return fmt.Errorf("provider %v does not support listing allocations", *migrateFrom)
+	}
+	report, err := migration.NewProviderMigrator(migration.ProviderParams{
+		Source: source,
+		Target: mgr,
+		DryRun: *migrateDryRun,
+	}).Run()
+	if report != nil {
+		report.Print(os.Stdout)
+		if report.Failed > 0 {
+			return fmt.Errorf("unable to migrate %d allocations", report.Failed)
+		}
+	}
+	return err
+}
+
+// runRestore validates the snapshot against the configured IPAM labels and restores its allocations
+func runRestore(mgr manager.Manager) error {
+	insp, ok := mgr.(manager.Inspector)
+	if !ok {
+		return fmt.Errorf("provider %v does not support snapshots", *provider)
+	}
+	snap, err := snapshot.ReadFile(*restoreSnapshot)
+	if err != nil {
+		return err
+	}
+	if err = snap.Validate(insp.GetLabelUsage()); err != nil {
+		return err
+	}
+	failed := snap.Restore(mgr)
+	log.Infof("[INIT] Restored %d of %d allocations from %v",
+		len(snap.Allocations)-len(failed), len(snap.Allocations), *restoreSnapshot)
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to restore %d allocations", len(failed))
+	}
 	return nil
 }
 
+// isOneShotRun checks whether the controller runs a migration or restore and exits
+func isOneShotRun() bool {
+	return *migrateLegacy || len(*migrateFrom) > 0 || len(*restoreSnapshot) > 0
+}
+
 func main() {
 	err := flags.Parse(os.Args)
 	if nil != err {
@@ -242,47 +863,51 @@ func main() {
 	}
 	log.Infof("[INIT] Starting: F5 IPAM Controller - Version: %s, BuildInfo: %s", version, buildInfo)
 
-	orcr := orchestration.NewOrchestrator(*namespaces)
+	orcr := orchestration.NewOrchestrator(orchestration.Params{
+		Namespaces:         *namespaces,
+		WatchAllNamespaces: *allNamespaces,
+		NamespaceLabel:     *namespaceLabel,
+		ControllerClass:    *ctlrClass,
+		LabelSelector:      *ipamSelector,
+		ManageCRD:          *manageCRD,
+		Modes:              *orchModes,
+		LoadBalancerClass:  *lbClass,
+		GatewayClass:       *gatewayClass,
+	})
 	if orcr == nil {
-		log.Error("Unable to create IPAM Client")
+		log.Error("Unable to create Orchestrator")
 		os.Exit(1)
 	}
-	mgrParams := manager.Params{
-		Provider: *provider,
-	}
-	switch *provider {
-	case manager.F5IPAMProvider:
-		mgrParams.IPAMManagerParams = manager.IPAMManagerParams{Range: *iprange}
-	case manager.InfobloxProvider:
-		mgrParams.InfobloxParams = manager.InfobloxParams{
-			Host:       *ibHost,
-			Version:    *ibVersion,
-			Port:       *ibPort,
-			Username:   *ibUsername,
-			Password:   *ibPassword,
-			IbLabelMap: *ibLabelMap,
-			NetView:    *ibNetView,
-		}
-		if !*sslInsecure {
-			// if orchestrator is kubernetes
-			if len(*credsDir) > 0 {
-				var appendSlash string
-				if !strings.HasSuffix(*credsDir, "/") {
-					appendSlash = "/"
-				}
-				mgrParams.SslVerify = *credsDir + appendSlash + "certificate"
-			} else {
-				log.Infof("[INIT] Error in fetching cert for infoblox")
-			}
-		} else {
-			mgrParams.SslVerify = "false"
-		}
-	}
+	mgrParams := getManagerParams(*provider)
+	// A dry run must not change the labels of the target provider either
+	mgrParams.KeepLabels = len(*migrateFrom) > 0 && *migrateDryRun
 	mgr, err := manager.NewManager(mgrParams)
 	if err != nil {
 		log.Errorf("Unable to initialize manager: %v", err)
 		os.Exit(1)
 	}
+	if *migrateLegacy {
+		if err = runLegacyMigration(mgr); err != nil {
+			log.Errorf("Unable to migrate legacy resources: %v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if len(*migrateFrom) > 0 {
+		if err = runProviderMigration(mgr); err != nil {
+			log.Errorf("Unable to migrate allocations from %v: %v", *migrateFrom, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if len(*restoreSnapshot) > 0 {
+		if err = runRestore(mgr); err != nil {
+			log.Errorf("Unable to restore snapshot: %v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	stopCh := make(chan struct{})
 	ctlr := controller.NewController(
 		controller.Spec{
@@ -292,12 +917,62 @@ func main() {
 		},
 	)
 	ctlr.Start()
+	watchCredentials(mgr, stopCh)
+
+	if len(*snapshotDir) > 0 {
+		insp, ok := mgr.(manager.Inspector)
+		if !ok {
+			log.Errorf("Provider %v does not support snapshots", *provider)
+			os.Exit(1)
+		}
+		snapshot.NewScheduler(snapshot.SchedulerParams{
+			Inspector: insp,
+			Dir:       *snapshotDir,
+			Interval:  *snapshotInterval,
+			Format:    *snapshotFormat,
+			Retain:    *snapshotRetain,
+		}).Start(stopCh)
+	}
+
+	var wh *webhook.Webhook
+	if *webhookPort != 0 {
+		labels, err := getIPAMLabels(mgr)
+		if err != nil {
+			log.Errorf("Unable to read IPAM labels for webhook: %v", err)
+			os.Exit(1)
+		}
+		wh = webhook.NewWebhook(webhook.Params{
+			Port:            *webhookPort,
+			CertFile:        *webhookCertFile,
+			KeyFile:         *webhookKeyFile,
+			Labels:          labels,
+			ControllerClass: *ctlrClass,
+		})
+		wh.Start()
+	}
+
+	var hs *health.Server
+	if *healthPort != 0 {
+		hs = health.NewServer(health.Params{
+			Port: *healthPort,
+			Ready: func() bool {
+				return manager.IsReady(mgr)
+			},
+		})
+		hs.Start()
+	}
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-signals
 
 	ctlr.Stop()
+	if wh != nil {
+		wh.Stop()
+	}
+	if hs != nil {
+		hs.Stop()
+	}
 	log.Infof("Exiting - signal %v\n", sig)
 	close(stopCh)
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/plugin"
+	"github.com/F5Networks/f5-ipam-controller/pkg/plugin/reference"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	clog "github.com/F5Networks/f5-ipam-controller/pkg/vlogger/console"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	flags *flag.FlagSet
+
+	logLevel    *string
+	listenAddr  *string
+	iprange     *string
+	tokenFile   *string
+	tlsCertFile *string
+	tlsKeyFile  *string
+)
+
+func init() {
+	flags = flag.NewFlagSet("ipam-plugin-reference", flag.ContinueOnError)
+
+	logLevel = flags.String("log-level", "INFO", "Optional, logging level.")
+	listenAddr = flags.String("listen-address", ":8443", "Optional, address to serve the plugin API on.")
+	iprange = flags.String("ip-range", "",
+		"Required, JSON of the IP range of each IPAM label, e.g. {\"Dev\":\"10.1.0.10-10.1.0.50\"}")
+	tokenFile = flags.String("token-file", "",
+		"Optional, file of the bearer token that FIC sends. If left blank the requests are not authenticated")
+	tlsCertFile = flags.String("tls-cert", "",
+		"Optional, certificate file to serve HTTPS with. If left blank HTTP is served")
+	tlsKeyFile = flags.String("tls-key", "", "Optional, key file of the certificate.")
+
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage of %s\n%s", os.Args[0], flags.FlagUsages())
+	}
+}
+
+func main() {
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		os.Exit(1)
+	}
+	log.RegisterLogger(
+		log.LL_MIN_LEVEL, log.LL_MAX_LEVEL, clog.NewConsoleLogger())
+	if ll := log.NewLogLevel(*logLevel); nil != ll {
+		log.SetLogLevel(*ll)
+	} else {
+		fmt.Fprintf(os.Stderr, "Unknown log level requested: %v\n", *logLevel)
+		os.Exit(1)
+	}
+
+	mgr, err := reference.NewManager(strings.Trim(*iprange, "\"'"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid ip-range: %v\n", err)
+		flags.Usage()
+		os.Exit(1)
+	}
+	var token string
+	if len(*tokenFile) > 0 {
+		data, err := ioutil.ReadFile(*tokenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	handler := plugin.NewHandler(plugin.Params{
+		Name:    "reference",
+		Manager: mgr,
+		Token:   token,
+	})
+
+	log.Infof("[PLGN] Serving the reference plugin on %v", *listenAddr)
+	if len(*tlsCertFile) > 0 {
+		err = http.ListenAndServeTLS(*listenAddr, *tlsCertFile, *tlsKeyFile, handler)
+	} else {
+		err = http.ListenAndServe(*listenAddr, handler)
+	}
+	log.Errorf("[PLGN] Unable to serve the plugin API: %v", err)
+	os.Exit(1)
+}
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/credentials"
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/migration"
+	"github.com/F5Networks/f5-ipam-controller/pkg/orchestration"
+	"github.com/F5Networks/f5-ipam-controller/pkg/snapshot"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	clog "github.com/F5Networks/f5-ipam-controller/pkg/vlogger/console"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+var (
+	// To be set by build
+	version   string
+	buildInfo string
+
+	flags *flag.FlagSet
+
+	logLevel     *string
+	provider     *string
+	output       *string
+	ipamLabel    *string
+	format       *string
+	dryRun       *bool
+	printVersion *bool
+
+	// Default Provider
+	iprange *string
+	dbFile  *string
+
+	// Infoblox
+	ibHost      *string
+	ibVersion   *string
+	ibPort      *string
+	ibUsername  *string
+	ibPassword  *string
+	ibLabelMap  *string
+	ibNetView   *string
+	credsDir    *string
+	sslInsecure *bool
+	ibCluster   *string
+	ibExtraEAs  *string
+	ibGrids     *string
+
+	// NetBox
+	nbURL      *string
+	nbToken    *string
+	nbLabelMap *string
+	nbCACert   *string
+	nbInsecure *bool
+
+	// phpIPAM
+	piURL      *string
+	piAppID    *string
+	piUsername *string
+	piPassword *string
+	piLabelMap *string
+
+	// Plugin
+	plURL      *string
+	plToken    *string
+	plCACert   *string
+	plInsecure *bool
+
+	// Routing
+	rtLabelMap *string
+)
+
+const usage = `Usage: %s [flags] <command> [arguments]
+
+Commands:
+  labels                               list IPAM labels and their utilisation
+  list                                 list allocations, of the label given by --label
+  owner <ip>                           show the hostname/key that owns the IP address
+  reserve <label> <ip> <hostname|key>  reserve the IP address for the hostname/key
+  release <ip>                         release the IP address
+  move <ip> <new-ip>                   move the allocation of the IP address to the new IP address
+  export [file]                        write a snapshot of the labels and allocations to the file or stdout
+  import <file>                        validate the snapshot against the IPAM labels and restore its allocations
+  fallbacks                            list allocations of fallback providers, of the label given by --label
+  failback                             move allocations of fallback providers back to the provider of their label,
+                                       of the label given by --label
+
+Flags:
+%s`
+
+func init() {
+	flags = flag.NewFlagSet("ipamctl", flag.ContinueOnError)
+
+	logLevel = flags.String("log-level", "WARNING", "Optional, logging level.")
+	provider = flags.String("ipam-provider", manager.F5IPAMProvider,
+		"Optional, the IPAM system to interface with.")
+	output = flags.StringP("output", "o", outputTable, "Optional, output format, table or json.")
+	ipamLabel = flags.String("label", "", "Optional, IPAM label to list or fail back the allocations of.")
+	format = flags.String("format", "",
+		"Optional, snapshot format for export and import, json or csv. "+
+			"If left blank it is taken from the file extension, json by default")
+	dryRun = flags.Bool("dry-run", false, "Optional, when set to true, failback only reports the changes.")
+	printVersion = flags.Bool("version", false, "Optional, print version and exit.")
+
+	iprange = flags.String("ip-range", "",
+		"Optional, the IP ranges of the Default Provider to use, the labels in the IPAM DB file are never changed. "+
+			"If left blank all the labels in the IPAM DB file are used")
+	dbFile = flags.String("db-file", "",
+		"Optional, the IPAM DB file of the Default Provider. "+
+			"If left blank /app/ipamdb/cis_ipam.sqlite3 is used")
+
+	ibHost = flags.String("infoblox-grid-host", "",
+		"Required for infoblox, the grid manager host IP.")
+	ibVersion = flags.String("infoblox-wapi-version", "",
+		"Required for infoblox, the Web API version.")
+	ibPort = flags.String("infoblox-wapi-port", "443",
+		"Optional for infoblox, the Web API port.")
+	ibUsername = flags.String("infoblox-username", "",
+		"Required for infoblox, the login username.")
+	ibPassword = flags.String("infoblox-password", "",
+		"Required for infoblox, the login password.")
+	ibLabelMap = flags.String("infoblox-labels", "",
+		"Required for mapping the infoblox's dnsview and cidr to IPAM labels")
+	ibNetView = flags.String("infoblox-netview", "",
+		"Required for infoblox, the network view of the labels")
+	credsDir = flags.String("credentials-directory", "",
+		"Optional, directory that contains the Infoblox or phpIPAM username, password and/or wapi-port, grid-host "+
+			"and certificate files.")
+	sslInsecure = flags.Bool("insecure", false,
+		"Optional, when set to true, enable insecure SSL communication to Infoblox or phpIPAM.")
+	ibCluster = flags.String("infoblox-cluster-name", "",
+		"Optional for infoblox, only the objects of this cluster are listed and edited")
+	ibExtraEAs = flags.String("infoblox-extra-eas", "",
+		"Optional for infoblox, JSON of the extensible attributes to write on the reserved IP addresses")
+	ibGrids = flags.String("infoblox-grids", "",
+		"Optional for infoblox, JSON of the additional grids that the labels can refer to")
+
+	nbURL = flags.String("netbox-url", "",
+		"Required for netbox, the URL of NetBox.")
+	nbToken = flags.String("netbox-token", "",
+		"Required for netbox, the API token of NetBox.")
+	nbLabelMap = flags.String("netbox-labels", "",
+		"Required for mapping the NetBox prefixes or IP ranges to IPAM labels")
+	nbCACert = flags.String("netbox-ca-cert", "",
+		"Optional for netbox, certificate file to verify NetBox with.")
+	nbInsecure = flags.Bool("netbox-insecure", false,
+		"Optional, when set to true, enable insecure SSL communication to NetBox.")
+
+	piURL = flags.String("phpipam-url", "",
+		"Required for phpipam, the URL of phpIPAM.")
+	piAppID = flags.String("phpipam-app-id", "",
+		"Required for phpipam, the ID of the API application of phpIPAM.")
+	piUsername = flags.String("phpipam-username", "",
+		"Required for phpipam, the login username.")
+	piPassword = flags.String("phpipam-password", "",
+		"Required for phpipam, the login password.")
+	piLabelMap = flags.String("phpipam-labels", "",
+		"Required for mapping the phpIPAM subnet IDs to IPAM labels")
+
+	plURL = flags.String("plugin-url", "",
+		"Required for plugin, the URL of the IPAM provider plugin.")
+	plToken = flags.String("plugin-token", "",
+		"Optional for plugin, bearer token to send to the plugin.")
+	plCACert = flags.String("plugin-ca-cert", "",
+		"Optional for plugin, certificate file to verify the plugin with.")
+	plInsecure = flags.Bool("plugin-insecure", false,
+		"Optional, when set to true, enable insecure SSL communication to the plugin.")
+
+	rtLabelMap = flags.String("routing-labels", "",
+		"Required for routing, JSON of the provider or provider chain of each IPAM label.")
+
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, usage, os.Args[0], flags.FlagUsages())
+	}
+}
+
+// getCredentials reads the Infoblox credentials of the credentials directory
+func getCredentials() error {
+	if len(*credsDir) == 0 {
+		return nil
+	}
+	creds, err := credentials.Read(*credsDir, credentials.Credentials{
+		Username: *ibUsername,
+		Password: *ibPassword,
+		Host:     *ibHost,
+		Port:     *ibPort,
+	})
+	if err != nil {
+		return err
+	}
+	*ibUsername = creds.Username
+	*ibPassword = creds.Password
+	*ibHost = creds.Host
+	*ibPort = creds.Port
+	return nil
+}
+
+// getPhpIPAMCredentials reads the phpIPAM username and password of the credentials directory, the grid-host
+// and wapi-port files replace the host and the port of the phpIPAM URL
+func getPhpIPAMCredentials() error {
+	if len(*credsDir) == 0 {
+		return nil
+	}
+	creds, piAddr, err := credentials.ReadURL(*credsDir, *piURL, *piUsername, *piPassword)
+	if err != nil {
+		return fmt.Errorf("missing phpIPAM credentials in %v: %v", *credsDir, err)
+	}
+	*piUsername = creds.Username
+	*piPassword = creds.Password
+	*piURL = piAddr
+	return nil
+}
+
+func newManager() (manager.Manager, error) {
+	mgrParams := manager.Params{
+		Provider: strings.ToLower(*provider),
+	}
+	if mgrParams.Provider != manager.RoutingProvider {
+		if err := setProviderParams(&mgrParams, mgrParams.Provider); err != nil {
+			return nil, err
+		}
+		return manager.NewManager(mgrParams)
+	}
+	labels, err := manager.ParseRoutingLabels(*rtLabelMap)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routing-labels: %v", err)
+	}
+	mgrParams.RoutingParams = manager.RoutingParams{LabelMap: *rtLabelMap}
+	for _, prov := range manager.RoutedProviders(labels) {
+		if err = setProviderParams(&mgrParams, prov); err != nil {
+			return nil, err
+		}
+	}
+	return manager.NewManager(mgrParams)
+}
+
+// setProviderParams sets the manager parameters of the provider from the arguments
+func setProviderParams(mgrParams *manager.Params, prov string) error {
+	switch prov {
+	case manager.F5IPAMProvider:
+		// The labels of the DB are managed by the controller, ipamctl only uses them
+		mgrParams.IPAMManagerParams = manager.IPAMManagerParams{
+			Range:      strings.Trim(*iprange, "\"'"),
+			DBFile:     *dbFile,
+			KeepLabels: true,
+		}
+	case manager.InfobloxProvider:
+		if err := getCredentials(); err != nil {
+			return err
+		}
+		mgrParams.InfobloxParams = manager.InfobloxParams{
+			Host:        *ibHost,
+			Version:     *ibVersion,
+			Port:        *ibPort,
+			Username:    *ibUsername,
+			Password:    *ibPassword,
+			IbLabelMap:  *ibLabelMap,
+			NetView:     *ibNetView,
+			SslVerify:   "true",
+			ClusterName: *ibCluster,
+			ExtraEAs:    *ibExtraEAs,
+			Grids:       *ibGrids,
+		}
+		if *sslInsecure {
+			mgrParams.SslVerify = "false"
+		} else if len(*credsDir) > 0 {
+			mgrParams.SslVerify = filepath.Join(*credsDir, "certificate")
+		}
+	case manager.NetBoxProvider:
+		mgrParams.NetBoxParams = manager.NetBoxParams{
+			URL:        *nbURL,
+			Token:      *nbToken,
+			LabelMap:   *nbLabelMap,
+			CACertFile: *nbCACert,
+			Insecure:   *nbInsecure,
+		}
+	case manager.PhpIPAMProvider:
+		if err := getPhpIPAMCredentials(); err != nil {
+			return err
+		}
+		mgrParams.PhpIPAMParams = manager.PhpIPAMParams{
+			URL:      *piURL,
+			AppID:    *piAppID,
+			Username: *piUsername,
+			Password: *piPassword,
+			LabelMap: *piLabelMap,
+			Insecure: *sslInsecure,
+		}
+		if !*sslInsecure && len(*credsDir) > 0 {
+			mgrParams.PhpIPAMParams.CACertFile = filepath.Join(*credsDir, credentials.CertificateFile)
+		}
+	case manager.PluginProvider:
+		mgrParams.PluginParams = manager.PluginParams{
+			URL:        *plURL,
+			Token:      *plToken,
+			CACertFile: *plCACert,
+			Insecure:   *plInsecure,
+		}
+	}
+	return nil
+}
+
+// findAllocation returns the allocation of the IP address
+func findAllocation(insp manager.Inspector, ip string) (manager.Allocation, bool) {
+	for _, alloc := range insp.GetAllocations("") {
+		if alloc.IPAddr == ip {
+			return alloc, true
+		}
+	}
+	return manager.Allocation{}, false
+}
+
+func releaseAllocation(mgr manager.Manager, insp manager.Inspector, alloc manager.Allocation) error {
+	err := manager.RemoveIPAddress(mgr, alloc.Request(ipamspec.DELETE))
+	if err != nil {
+		return fmt.Errorf("unable to release IP address %v: %v", alloc.IPAddr, err)
+	}
+	if _, found := findAllocation(insp, alloc.IPAddr); found {
+		return fmt.Errorf("unable to release IP address %v", alloc.IPAddr)
+	}
+	return nil
+}
+
+func reserveAllocation(mgr manager.Manager, alloc manager.Allocation) error {
+	ok := mgr.ReserveIPAddress(alloc.Request(ipamspec.CREATE))
+	if !ok {
+		return fmt.Errorf("unable to reserve IP address %v for %v in label %v",
+			alloc.IPAddr, alloc.Reference, alloc.IPAMLabel)
+	}
+	return nil
+}
+
+func printLabels(out io.Writer, usage []manager.LabelUsage) error {
+	if *output == outputJSON {
+		if usage == nil {
+			usage = []manager.LabelUsage{}
+		}
+		return printJSON(out, usage)
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "LABEL\tRANGE\tTOTAL\tALLOCATED\tAVAILABLE")
+	for _, lu := range usage {
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n",
+			lu.IPAMLabel, lu.Range, lu.Total, lu.Allocated, lu.Total-lu.Allocated)
+	}
+	return w.Flush()
+}
+
+func printAllocations(out io.Writer, allocations []manager.Allocation) error {
+	if *output == outputJSON {
+		if allocations == nil {
+			allocations = []manager.Allocation{}
+		}
+		return printJSON(out, allocations)
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "LABEL\tIP ADDRESS\tREFERENCE")
+	for _, alloc := range allocations {
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%v\n", alloc.IPAMLabel, alloc.IPAddr, alloc.Reference)
+	}
+	return w.Flush()
+}
+
+func printJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func run(out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("command is required")
+	}
+	cmd, args := args[0], args[1:]
+
+	// Minimum and maximum number of arguments of the commands
+	nargs := map[string][2]int{
+		"labels":    {0, 0},
+		"list":      {0, 0},
+		"owner":     {1, 1},
+		"reserve":   {3, 3},
+		"release":   {1, 1},
+		"move":      {2, 2},
+		"export":    {0, 1},
+		"import":    {1, 1},
+		"fallbacks": {0, 0},
+		"failback":  {0, 0},
+	}
+	n, ok := nargs[cmd]
+	if !ok {
+		return fmt.Errorf("unknown command: %v", cmd)
+	}
+	if len(args) < n[0] || len(args) > n[1] {
+		return fmt.Errorf("%v expects %d argument(s)", cmd, n[1])
+	}
+
+	mgr, err := newManager()
+	if err != nil {
+		return fmt.Errorf("unable to initialize manager: %v", err)
+	}
+	insp, ok := mgr.(manager.Inspector)
+	if !ok {
+		return fmt.Errorf("provider %v does not support listing allocations", *provider)
+	}
+
+	switch cmd {
+	case "labels":
+		return printLabels(out, insp.GetLabelUsage())
+	case "list":
+		return printAllocations(out, insp.GetAllocations(*ipamLabel))
+	case "owner":
+		alloc, found := findAllocation(insp, args[0])
+		if !found {
+			return fmt.Errorf("IP address %v is not allocated", args[0])
+		}
+		return printAllocations(out, []manager.Allocation{alloc})
+	case "reserve":
+		alloc := manager.NewAllocation(args[0], args[1], args[2])
+		if err = reserveAllocation(mgr, alloc); err != nil {
+			return err
+		}
+		return printAllocations(out, []manager.Allocation{alloc})
+	case "release":
+		alloc, found := findAllocation(insp, args[0])
+		if !found {
+			return fmt.Errorf("IP address %v is not allocated", args[0])
+		}
+		if err = releaseAllocation(mgr, insp, alloc); err != nil {
+			return err
+		}
+		return printAllocations(out, []manager.Allocation{alloc})
+	case "move":
+		alloc, found := findAllocation(insp, args[0])
+		if !found {
+			return fmt.Errorf("IP address %v is not allocated", args[0])
+		}
+		// The reference can hold only one IP address, so the old one is released first
+		// and reserved again when the new one can not be reserved
+		if err = releaseAllocation(mgr, insp, alloc); err != nil {
+			return err
+		}
+		moved := alloc
+		moved.IPAddr = args[1]
+		if err = reserveAllocation(mgr, moved); err != nil {
+			if rbErr := reserveAllocation(mgr, alloc); rbErr != nil {
+				return fmt.Errorf("%v, %v", err, rbErr)
+			}
+			return err
+		}
+		return printAllocations(out, []manager.Allocation{moved})
+	case "export":
+		snap := snapshot.New(insp)
+		if len(args) == 0 {
+			return snap.Write(out, snapshotFormat(""))
+		}
+		return writeSnapshot(snap, args[0])
+	case "import":
+		snap, err := readSnapshot(args[0])
+		if err != nil {
+			return err
+		}
+		if err = snap.Validate(insp.GetLabelUsage()); err != nil {
+			return err
+		}
+		failed := snap.Restore(mgr)
+		if err = printAllocations(out, snap.Allocations); err != nil {
+			return err
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("unable to restore %d of %d allocations", len(failed), len(snap.Allocations))
+		}
+	case "fallbacks", "failback":
+		router, ok := mgr.(*manager.RoutingManager)
+		if !ok {
+			return fmt.Errorf("provider %v has no fallback providers", *provider)
+		}
+		if cmd == "fallbacks" {
+			return printAllocations(out, router.GetFallbackAllocations(*ipamLabel))
+		}
+		params := migration.FailbackParams{
+			Router:    router,
+			IPAMLabel: *ipamLabel,
+			DryRun:    *dryRun,
+		}
+		// The resources are pointed to the new IP addresses before the fallback ones are released
+		if !*dryRun {
+			updater, err := orchestration.NewStatusUpdater()
+			if err != nil {
+				return fmt.Errorf("failback updates the status of the resources, run it in the FIC pod: %v", err)
+			}
+			params.StatusUpdater = updater
+		}
+		report, err := migration.NewFailbackMigrator(params).Run()
+		if err != nil {
+			return err
+		}
+		if *output == outputJSON {
+			err = printJSON(out, report)
+		} else {
+			report.Print(out)
+		}
+		if err == nil && report.Failed > 0 {
+			err = fmt.Errorf("unable to fail back %d allocations", report.Failed)
+		}
+		return err
+	}
+	return nil
+}
+
+// snapshotFormat returns the format given with --format or the format of the file extension
+func snapshotFormat(filename string) string {
+	if *format != "" {
+		return *format
+	}
+	return snapshot.FormatOf(filename)
+}
+
+func writeSnapshot(snap *snapshot.Snapshot, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = snap.Write(file, snapshotFormat(filename)); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func readSnapshot(filename string) (*snapshot.Snapshot, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return snapshot.Read(file, snapshotFormat(filename))
+}
+
+func main() {
+	err := flags.Parse(os.Args[1:])
+	if nil != err {
+		os.Exit(1)
+	}
+
+	if *printVersion {
+		fmt.Printf("Version: %s\nBuild: %s\n", version, buildInfo)
+		os.Exit(0)
+	}
+
+	log.RegisterLogger(
+		log.LL_MIN_LEVEL, log.LL_MAX_LEVEL, clog.NewConsoleLogger())
+	if ll := log.NewLogLevel(*logLevel); nil != ll {
+		log.SetLogLevel(*ll)
+	} else {
+		fmt.Fprintf(os.Stderr, "Unknown log level requested: %v\n", *logLevel)
+		os.Exit(1)
+	}
+	if *output != outputTable && *output != outputJSON {
+		fmt.Fprintf(os.Stderr, "Unknown output format requested: %v\n", *output)
+		os.Exit(1)
+	}
+
+	if err = run(os.Stdout, flags.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		if len(flags.Args()) == 0 {
+			flags.Usage()
+		}
+		os.Exit(1)
+	}
+}
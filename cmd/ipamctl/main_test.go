@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestIPAMCtl(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ipamctl Suite")
+}
+
+var _ = Describe("ipamctl", func() {
+	var dir string
+	var out *bytes.Buffer
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "ipamctl")
+		Expect(err).NotTo(HaveOccurred())
+		*dbFile = filepath.Join(dir, "ipam.sqlite3")
+		Expect(ioutil.WriteFile(*dbFile, nil, 0600)).To(Succeed())
+		// The controller creates the labels of the DB
+		_, err = manager.NewIPAMManager(manager.IPAMManagerParams{
+			Range:  `{"Dev":"10.1.1.1-10.1.1.3", "Test":"10.1.2.1-10.1.2.3"}`,
+			DBFile: *dbFile,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		*provider = manager.F5IPAMProvider
+		*iprange = ""
+		*output = outputTable
+		*ipamLabel = ""
+		out = &bytes.Buffer{}
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	It("validates the command and its arguments", func() {
+		Expect(run(out, nil)).To(MatchError("command is required"))
+		Expect(run(out, []string{"unknown"})).To(MatchError("unknown command: unknown"))
+		Expect(run(out, []string{"reserve", "Dev"})).To(MatchError("reserve expects 3 argument(s)"))
+	})
+
+	It("lists the labels and edits the allocations", func() {
+		Expect(run(out, []string{"labels"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("Dev"))
+		Expect(out.String()).To(ContainSubstring("Test"))
+
+		Expect(run(out, []string{"reserve", "Dev", "10.1.1.2", "default/svc"})).To(Succeed())
+		out.Reset()
+		Expect(run(out, []string{"owner", "10.1.1.2"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("default/svc"))
+
+		Expect(run(out, []string{"move", "10.1.1.2", "10.1.1.3"})).To(Succeed())
+		Expect(run(out, []string{"owner", "10.1.1.2"})).To(MatchError("IP address 10.1.1.2 is not allocated"))
+		out.Reset()
+		*output = outputJSON
+		*ipamLabel = "Dev"
+		Expect(run(out, []string{"list"})).To(Succeed())
+		Expect(out.String()).To(MatchJSON(`[{"ipamLabel":"Dev","ip":"10.1.1.3","reference":"default/svc"}]`))
+
+		Expect(run(out, []string{"release", "10.1.1.3"})).To(Succeed())
+		Expect(run(out, []string{"release", "10.1.1.3"})).To(MatchError("IP address 10.1.1.3 is not allocated"))
+	})
+
+	It("does not change the labels of the DB", func() {
+		*iprange = `{"Dev":"10.1.1.1-10.1.1.3", "Prod":"10.1.3.1-10.1.3.3"}`
+		*output = outputJSON
+		Expect(run(out, []string{"labels"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring(`"Dev"`))
+		Expect(out.String()).NotTo(ContainSubstring(`"Prod"`))
+		Expect(out.String()).NotTo(ContainSubstring(`"Test"`))
+
+		*iprange = ""
+		out.Reset()
+		Expect(run(out, []string{"labels"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring(`"Test"`))
+		Expect(out.String()).NotTo(ContainSubstring(`"Prod"`))
+	})
+
+	It("reads the credentials of the credentials directory", func() {
+		defer func() { *credsDir = "" }()
+		*credsDir = dir
+		Expect(ioutil.WriteFile(filepath.Join(dir, "username"), []byte("admin\n"), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "password"), []byte("secret"), 0600)).To(Succeed())
+		*ibHost = "10.1.1.1"
+		Expect(getCredentials()).To(Succeed())
+		Expect(*ibUsername).To(Equal("admin"))
+		Expect(*ibPassword).To(Equal("secret"))
+		Expect(*ibPort).To(Equal("443"))
+
+		*piURL = "https://phpipam.example.com/api"
+		Expect(ioutil.WriteFile(filepath.Join(dir, "wapi-port"), []byte("8443"), 0600)).To(Succeed())
+		Expect(getPhpIPAMCredentials()).To(Succeed())
+		Expect(*piUsername).To(Equal("admin"))
+		Expect(*piURL).To(Equal("https://phpipam.example.com:8443/api"))
+	})
+})
@@ -20,7 +20,19 @@ import (
 	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
 	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
 	"github.com/F5Networks/f5-ipam-controller/pkg/orchestration"
+	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
 	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	"sync"
+	"time"
+)
+
+var (
+	// requeueBackoff is the delay before a failed request is processed again, it doubles on every failure
+	requeueBackoff    = time.Second
+	requeueMaxBackoff = 5 * time.Minute
+	// failureAttempts is the number of failed attempts of a create after which its failure is answered,
+	// so that the resource reports it. The create is still retried and its success answered later on
+	failureAttempts = 5
 )
 
 type Spec struct {
@@ -33,72 +45,247 @@ type Controller struct {
 	Spec
 	reqChan  chan ipamspec.IPAMRequest
 	respChan chan ipamspec.IPAMResponse
+	// pending holds the requeued requests, and attempts their failures, by resource
+	pending     map[string]*requeuedRequest
+	attempts    map[string]int
+	requeueChan chan *requeuedRequest
+	mutex       sync.Mutex
+}
+
+type requeuedRequest struct {
+	req   ipamspec.IPAMRequest
+	timer *time.Timer
 }
 
 func NewController(spec Spec) *Controller {
 	ctlr := &Controller{
-		Spec:     spec,
-		reqChan:  make(chan ipamspec.IPAMRequest),
-		respChan: make(chan ipamspec.IPAMResponse),
+		Spec:        spec,
+		reqChan:     make(chan ipamspec.IPAMRequest),
+		respChan:    make(chan ipamspec.IPAMResponse),
+		pending:     make(map[string]*requeuedRequest),
+		attempts:    make(map[string]int),
+		requeueChan: make(chan *requeuedRequest),
 	}
 
 	return ctlr
 }
 
 func (ctlr *Controller) runController() {
-	for req := range ctlr.reqChan {
-		switch req.Operation {
-		case ipamspec.CREATE:
-
-			sendResponse := func(request ipamspec.IPAMRequest, ipAddr string) {
-				resp := ipamspec.IPAMResponse{
-					Request: request,
-					IPAddr:  ipAddr,
-					Status:  true,
-				}
-				ctlr.respChan <- resp
+	for {
+		select {
+		case req := <-ctlr.reqChan:
+			// The latest request of a resource replaces its requeued one
+			ctlr.cancelRequeue(req)
+			ctlr.processRequest(req)
+		case requeued := <-ctlr.requeueChan:
+			// Requeued requests replaced in the meantime are dropped
+			if ctlr.popRequeued(requeued) {
+				ctlr.processRequest(requeued.req)
+			}
+		}
+	}
+}
+
+func (ctlr *Controller) processRequest(req ipamspec.IPAMRequest) {
+	// The requests that fail however often they are retried are answered with a failure
+	if req.Operation == ipamspec.CREATE {
+		if err := manager.ValidateRequest(ctlr.Manager, req); err != nil {
+			log.Errorf("[CORE] Invalid Request: %v, Error: %v", req.String(), err)
+			ctlr.forget(req)
+			go ctlr.sendFailure(req)
+			return
+		}
+	}
+	if !manager.IsLabelReady(ctlr.Manager, req.IPAMLabel) {
+		log.Debugf("[CORE] Manager is not ready for label %v, Request: %v", req.IPAMLabel, req.String())
+		ctlr.requeue(req)
+		return
+	}
+	switch req.Operation {
+	case ipamspec.CREATE:
+
+		sendResponse := func(request ipamspec.IPAMRequest, ipAddr string) {
+			resp := ipamspec.IPAMResponse{
+				Request: request,
+				IPAddr:  ipAddr,
+				Status:  true,
 			}
+			ctlr.respChan <- resp
+		}
 
-			ipAddr := ctlr.Manager.GetIPAddress(req)
-			if ipAddr != "" {
-				go sendResponse(req, ipAddr)
+		// The hostname/key is looked up without the IP address requested for it. When the provider
+		// can not tell whether it holds one, the request is retried instead of allocating another one
+		lookupReq := req
+		lookupReq.IPAddr = ""
+		ipAddr, err := manager.LookupIPAddress(ctlr.Manager, lookupReq)
+		if err != nil {
+			log.Errorf("[CORE] Unable to get IP Address of Request: %v, Error: %v", req.String(), err)
+			ctlr.requeueFailure(req)
+			break
+		}
+		if ipAddr != "" {
+			ctlr.forget(req)
+			if req.IPAddr != "" && ipAddr != req.IPAddr {
+				log.Errorf("[CORE] Unable to reserve requested IP: %v, already holding IP: %v for Request: %v",
+					req.IPAddr, ipAddr, req.String())
+				go ctlr.sendFailure(req)
 				break
 			}
+			go sendResponse(req, ipAddr)
+			break
+		}
 
-			ipAddr = ctlr.Manager.AllocateNextIPAddress(req)
-			if ipAddr != "" {
-				log.Debugf("[CORE] Allocated IP: %v for Request: %v", ipAddr, req.String())
-				// A Record Support is disabled
-				//req.IPAddr = ipAddr
-				//ok := ctlr.Manager.CreateARecord(req)
-				//if !ok {
-				//	req.IPAddr = ipAddr
-				//	ctlr.Manager.ReleaseIPAddress(req)
-				//	log.Errorf("[CORE] Unable to Create A Record with hostname: %v", req.HostName)
-				//	log.Infof("[CORE] Releasing Allocated IP: %v", ipAddr)
-				//
-				//	break
-				//}
-				go sendResponse(req, ipAddr)
+		if req.IPAddr != "" {
+			if ctlr.Manager.ReserveIPAddress(req) {
+				ipAddr = req.IPAddr
+			} else {
+				log.Errorf("[CORE] Unable to reserve requested IP: %v for Request: %v", req.IPAddr, req.String())
 			}
-		case ipamspec.DELETE:
-			ipAddr := ctlr.Manager.GetIPAddress(req)
-			if ipAddr != "" {
-				req.IPAddr = ipAddr
-				ctlr.Manager.ReleaseIPAddress(req)
-				// A Record Support is disabled
-				//ctlr.Manager.DeleteARecord(req)
+		} else {
+			ipAddr = ctlr.Manager.AllocateNextIPAddress(req)
+		}
+		if ipAddr != "" {
+			log.Debugf("[CORE] Allocated IP: %v for Request: %v", ipAddr, req.String())
+			if ctlr.isDNSEnabled(req) {
+				dnsReq := req
+				dnsReq.IPAddr = ipAddr
+				ok := ctlr.Manager.CreateARecord(dnsReq)
+				if !ok {
+					ctlr.Manager.ReleaseIPAddress(dnsReq)
+					log.Errorf("[CORE] Unable to Create A Record with hostname: %v", req.HostName)
+					log.Infof("[CORE] Releasing Allocated IP: %v", ipAddr)
+					ctlr.requeueFailure(req)
+					break
+				}
 			}
-			go func(request ipamspec.IPAMRequest) {
-				resp := ipamspec.IPAMResponse{
-					Request: request,
-					IPAddr:  "",
-					Status:  true,
+			ctlr.forget(req)
+			go sendResponse(req, ipAddr)
+			break
+		}
+		ctlr.requeueFailure(req)
+	case ipamspec.DELETE:
+		// The deletes that fail are retried, so that the IP addresses are not leaked
+		ipAddr, err := manager.LookupIPAddress(ctlr.Manager, req)
+		if err != nil {
+			log.Errorf("[CORE] Unable to get IP Address of Request: %v, Error: %v", req.String(), err)
+			ctlr.requeue(req)
+			break
+		}
+		if ipAddr != "" {
+			req.IPAddr = ipAddr
+			if ctlr.hasDNSRecords(req) {
+				if err = manager.RemoveARecord(ctlr.Manager, req); err != nil {
+					log.Errorf("[CORE] Unable to Delete A Record of Request: %v, Error: %v", req.String(), err)
+					ctlr.requeue(req)
+					break
 				}
-				ctlr.respChan <- resp
-			}(req)
+			}
+			if err = manager.RemoveIPAddress(ctlr.Manager, req); err != nil {
+				log.Errorf("[CORE] Unable to Release IP Address of Request: %v, Error: %v", req.String(), err)
+				ctlr.requeue(req)
+				break
+			}
 		}
+		ctlr.forget(req)
+		go func(request ipamspec.IPAMRequest) {
+			resp := ipamspec.IPAMResponse{
+				Request: request,
+				IPAddr:  "",
+				Status:  true,
+			}
+			ctlr.respChan <- resp
+		}(req)
+	}
+}
+
+// sendFailure answers the request with a failure
+func (ctlr *Controller) sendFailure(req ipamspec.IPAMRequest) {
+	ctlr.respChan <- ipamspec.IPAMResponse{Request: req, Status: false}
+}
+
+// requeueFailure requeues the create that failed, and answers it with a failure once it has failed
+// failureAttempts times in a row
+func (ctlr *Controller) requeueFailure(req ipamspec.IPAMRequest) {
+	if ctlr.requeue(req) == failureAttempts {
+		go ctlr.sendFailure(req)
+	}
+}
+
+// requeue processes the request again after a backoff that grows with its failures, it returns
+// the number of failures of the request
+func (ctlr *Controller) requeue(req ipamspec.IPAMRequest) int {
+	ctlr.mutex.Lock()
+	defer ctlr.mutex.Unlock()
+	id := requestID(req)
+	delay := utils.Backoff(ctlr.attempts[id], requeueBackoff, requeueMaxBackoff)
+	ctlr.attempts[id]++
+	requeued := &requeuedRequest{req: req}
+	requeued.timer = time.AfterFunc(delay, func() {
+		select {
+		case ctlr.requeueChan <- requeued:
+		case <-ctlr.StopCh:
+		}
+	})
+	if previous, ok := ctlr.pending[id]; ok {
+		previous.timer.Stop()
+	}
+	ctlr.pending[id] = requeued
+	log.Infof("[CORE] Requeued Request in %v: %v", delay, req.String())
+	return ctlr.attempts[id]
+}
+
+// cancelRequeue stops the requeued request of the resource
+func (ctlr *Controller) cancelRequeue(req ipamspec.IPAMRequest) {
+	ctlr.mutex.Lock()
+	defer ctlr.mutex.Unlock()
+	id := requestID(req)
+	if requeued, ok := ctlr.pending[id]; ok {
+		requeued.timer.Stop()
+		delete(ctlr.pending, id)
+	}
+}
+
+// popRequeued removes the requeued request, it reports false when the request was replaced
+func (ctlr *Controller) popRequeued(requeued *requeuedRequest) bool {
+	ctlr.mutex.Lock()
+	defer ctlr.mutex.Unlock()
+	id := requestID(requeued.req)
+	if ctlr.pending[id] != requeued {
+		return false
+	}
+	delete(ctlr.pending, id)
+	return true
+}
+
+// forget resets the failures of the resource once its request is processed
+func (ctlr *Controller) forget(req ipamspec.IPAMRequest) {
+	ctlr.mutex.Lock()
+	defer ctlr.mutex.Unlock()
+	delete(ctlr.attempts, requestID(req))
+}
+
+// requestID identifies the resource of the request
+func requestID(req ipamspec.IPAMRequest) string {
+	return req.IPAMLabel + "/" + req.HostName + "/" + req.Key
+}
+
+// isDNSEnabled checks whether DNS records are managed for the hostname of the request
+func (ctlr *Controller) isDNSEnabled(req ipamspec.IPAMRequest) bool {
+	if req.HostName == "" {
+		return false
+	}
+	registrar, ok := ctlr.Manager.(manager.DNSRegistrar)
+	return ok && registrar.IsDNSEnabled(req.IPAMLabel)
+}
+
+// hasDNSRecords checks whether DNS records can exist for the hostname of the request,
+// they are deleted even when DNS is no longer enabled for the IPAM label
+func (ctlr *Controller) hasDNSRecords(req ipamspec.IPAMRequest) bool {
+	if req.HostName == "" {
+		return false
 	}
+	_, ok := ctlr.Manager.(manager.DNSRegistrar)
+	return ok
 }
 
 func (ctlr *Controller) Start() {
@@ -7,6 +7,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"testing"
+	"time"
 )
 
 func TestController(t *testing.T) {
@@ -43,14 +44,227 @@ var _ = Describe("Static IP Provider", func() {
 		ctlr.reqChan <- ipamspec.IPAMRequest{Metadata: "", Operation: ipamspec.CREATE, HostName: "", IPAddr: "", Key: "Test", IPAMLabel: "Dev"}
 		tmp3 := <-ctlr.respChan
 		Expect(tmp3.IPAddr).To(Equal("1.2.3.4"), "Should get previous ip address only")
-		// Fail A record Creation
-		//mgr.SkipRecord(true)
-		//ctlr.reqChan <- ipamspec.IPAMRequest{"", ipamspec.CREATE, "example.com", "", "", "Dev", "", ""}
-		//tmp4 := <-ctlr.respChan
-		//Expect(tmp4.IPAddr).To(Equal(""), "A record should not be created and ipaddress should be released")
+	})
+	It("should reserve the requested ip address", func() {
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "bar.com", IPAddr: "10.1.1.1", IPAMLabel: "Dev"}
+		tmp := <-ctlr.respChan
+		Expect(tmp.Status).To(BeTrue())
+		Expect(tmp.IPAddr).To(Equal("10.1.1.1"), "Should get the requested ip address")
+		// The key holds another ip address
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.CREATE, Key: "Test", IPAddr: "10.1.1.1", IPAMLabel: "Dev"}
+		tmp = <-ctlr.respChan
+		Expect(tmp.Status).To(BeFalse())
+		Expect(tmp.IPAddr).To(BeEmpty())
 	})
 	It("check orch", func() {
 		ctlr.Stop()
 		Expect(mockorch.StopCalled).To(BeTrue())
 	})
 })
+
+var _ = Describe("DNS records", func() {
+	mockData := mock.MockData{
+		IPList:     []string{"1.2.3.4", "2.3.4.5"},
+		DNSEnabled: true,
+	}
+	mgr, _ := mock.NewMockIPAMManager(mockData)
+	orcr := &mockorch.MockOrch{
+		ReqChan:  make(chan ipamspec.IPAMRequest),
+		RespChan: make(chan ipamspec.IPAMResponse),
+	}
+	ctlr := NewController(Spec{
+		Orchestrator: orcr,
+		Manager:      mgr,
+		StopCh:       make(chan struct{}),
+	})
+	It("should release the ip address when the A record is not created", func() {
+		ctlr.Start()
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "foo.com", IPAMLabel: "Dev"}
+		tmp := <-ctlr.respChan
+		Expect(tmp.IPAddr).To(Equal("1.2.3.4"))
+		// Fail A record Creation
+		mgr.SkipRecord(true)
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "example.com", IPAMLabel: "Dev"}
+		Consistently(ctlr.respChan).ShouldNot(Receive(), "A record should not be created and ipaddress should be released")
+		mgr.SkipRecord(false)
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "example.com", IPAMLabel: "Dev"}
+		tmp = <-ctlr.respChan
+		Expect(tmp.IPAddr).To(Equal("2.3.4.5"), "Should get the released ip address")
+		ctlr.Stop()
+	})
+})
+
+var _ = Describe("DNS records of disabled labels", func() {
+	mgr, _ := mock.NewMockIPAMManager(mock.MockData{IPList: []string{"1.2.3.4"}})
+	orcr := &mockorch.MockOrch{
+		ReqChan:  make(chan ipamspec.IPAMRequest),
+		RespChan: make(chan ipamspec.IPAMResponse),
+	}
+	ctlr := NewController(Spec{
+		Orchestrator: orcr,
+		Manager:      mgr,
+		StopCh:       make(chan struct{}),
+	})
+	It("should delete the A records created before DNS was disabled", func() {
+		ctlr.Start()
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.DELETE, HostName: "foo.com", IPAddr: "1.2.3.4", IPAMLabel: "Dev"}
+		tmp := <-ctlr.respChan
+		Expect(tmp.Status).To(BeTrue())
+		Expect(mgr.DeletedARecords()).To(ConsistOf("foo.com"))
+		ctlr.Stop()
+	})
+})
+
+var _ = Describe("Requeue", func() {
+	mockData := mock.MockData{
+		IPList:   []string{"1.2.3.4", "2.3.4.5"},
+		NotReady: true,
+	}
+	mgr, _ := mock.NewMockIPAMManager(mockData)
+	orcr := &mockorch.MockOrch{
+		ReqChan:  make(chan ipamspec.IPAMRequest),
+		RespChan: make(chan ipamspec.IPAMResponse),
+	}
+	ctlr := NewController(Spec{
+		Orchestrator: orcr,
+		Manager:      mgr,
+		StopCh:       make(chan struct{}),
+	})
+	It("should requeue the requests until the manager is ready", func() {
+		requeueBackoff = 10 * time.Millisecond
+		defer func() { requeueBackoff = time.Second }()
+		ctlr.Start()
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "foo.com", IPAMLabel: "Dev"}
+		Consistently(ctlr.respChan).ShouldNot(Receive(), "Request should not be processed while the manager is not ready")
+		mgr.SetReady(true)
+		var resp ipamspec.IPAMResponse
+		Eventually(ctlr.respChan, time.Second).Should(Receive(&resp))
+		Expect(resp.IPAddr).To(Equal("1.2.3.4"))
+		// A failed request is requeued
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.CREATE, IPAMLabel: "Dev"}
+		Consistently(ctlr.respChan).ShouldNot(Receive())
+		ctlr.mutex.Lock()
+		Expect(ctlr.attempts).To(HaveKey("Dev//"))
+		ctlr.mutex.Unlock()
+		// The delete of the resource replaces its requeued request
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.DELETE, IPAMLabel: "Dev", IPAddr: "1.2.3.4"}
+		Eventually(ctlr.respChan).Should(Receive(&resp))
+		Expect(resp.Request.Operation).To(Equal(ipamspec.DELETE))
+		Consistently(ctlr.respChan).ShouldNot(Receive())
+		ctlr.mutex.Lock()
+		Expect(ctlr.pending).To(BeEmpty())
+		ctlr.mutex.Unlock()
+		ctlr.Stop()
+	})
+})
+
+var _ = Describe("Failures", func() {
+	mockData := mock.MockData{
+		IPList:      []string{"1.2.3.4", "2.3.4.5"},
+		Labels:      []string{"Dev"},
+		FailRelease: true,
+	}
+	mgr, _ := mock.NewMockIPAMManager(mockData)
+	orcr := &mockorch.MockOrch{
+		ReqChan:  make(chan ipamspec.IPAMRequest),
+		RespChan: make(chan ipamspec.IPAMResponse),
+	}
+	ctlr := NewController(Spec{
+		Orchestrator: orcr,
+		Manager:      mgr,
+		StopCh:       make(chan struct{}),
+	})
+	It("should answer the invalid requests with a failure and retry the failed deletes", func() {
+		requeueBackoff = 10 * time.Millisecond
+		defer func() { requeueBackoff = time.Second }()
+		ctlr.Start()
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "foo.com", IPAMLabel: "unknown"}
+		var resp ipamspec.IPAMResponse
+		Eventually(ctlr.respChan).Should(Receive(&resp))
+		Expect(resp.Status).To(BeFalse())
+		ctlr.mutex.Lock()
+		Expect(ctlr.pending).To(BeEmpty())
+		ctlr.mutex.Unlock()
+
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.DELETE, HostName: "foo.com", IPAddr: "1.2.3.4", IPAMLabel: "Dev"}
+		Consistently(ctlr.respChan).ShouldNot(Receive(), "The delete should be retried until the IP address is released")
+		ctlr.mutex.Lock()
+		Expect(ctlr.attempts).To(HaveKey("Dev/foo.com/"))
+		ctlr.mutex.Unlock()
+		mgr.SetFailRelease(false)
+		Eventually(ctlr.respChan, time.Second).Should(Receive(&resp))
+		Expect(resp.Request.Operation).To(Equal(ipamspec.DELETE))
+		Expect(resp.Status).To(BeTrue())
+		ctlr.Stop()
+	})
+})
+
+var _ = Describe("Lookup failures", func() {
+	mockData := mock.MockData{
+		IPList:     []string{"1.2.3.4", "2.3.4.5"},
+		FailLookup: true,
+	}
+	mgr, _ := mock.NewMockIPAMManager(mockData)
+	orcr := &mockorch.MockOrch{
+		ReqChan:  make(chan ipamspec.IPAMRequest),
+		RespChan: make(chan ipamspec.IPAMResponse),
+	}
+	ctlr := NewController(Spec{
+		Orchestrator: orcr,
+		Manager:      mgr,
+		StopCh:       make(chan struct{}),
+	})
+	It("should retry the creates whose IP address can not be looked up instead of allocating", func() {
+		requeueBackoff = 10 * time.Millisecond
+		defer func() { requeueBackoff = time.Second }()
+		ctlr.Start()
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "foo.com", IPAMLabel: "Dev"}
+		// The failure is answered once the create has failed failureAttempts times
+		var resp ipamspec.IPAMResponse
+		Eventually(ctlr.respChan, time.Second).Should(Receive(&resp))
+		Expect(resp.Status).To(BeFalse())
+		ctlr.mutex.Lock()
+		Expect(ctlr.attempts).To(HaveKeyWithValue("Dev/foo.com/", failureAttempts))
+		Expect(ctlr.pending).To(HaveKey("Dev/foo.com/"))
+		ctlr.mutex.Unlock()
+		// The create is still retried, and its success answered
+		mgr.SetFailLookup(false)
+		Eventually(ctlr.respChan, 2*time.Second).Should(Receive(&resp))
+		Expect(resp.Status).To(BeTrue())
+		// No IP address was allocated while the lookups failed
+		Expect(resp.IPAddr).To(Equal("1.2.3.4"))
+		ctlr.Stop()
+	})
+})
+
+var _ = Describe("Labels that are not ready", func() {
+	mockData := mock.MockData{
+		IPList:         []string{"1.2.3.4", "2.3.4.5"},
+		NotReadyLabels: []string{"Lab"},
+	}
+	mgr, _ := mock.NewMockIPAMManager(mockData)
+	orcr := &mockorch.MockOrch{
+		ReqChan:  make(chan ipamspec.IPAMRequest),
+		RespChan: make(chan ipamspec.IPAMResponse),
+	}
+	ctlr := NewController(Spec{
+		Orchestrator: orcr,
+		Manager:      mgr,
+		StopCh:       make(chan struct{}),
+	})
+	It("should requeue only the requests of the labels that are not ready", func() {
+		requeueBackoff = 10 * time.Millisecond
+		defer func() { requeueBackoff = time.Second }()
+		ctlr.Start()
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "lab.com", IPAMLabel: "Lab"}
+		ctlr.reqChan <- ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "dev.com", IPAMLabel: "Dev"}
+		var resp ipamspec.IPAMResponse
+		Eventually(ctlr.respChan, time.Second).Should(Receive(&resp))
+		Expect(resp.Request.HostName).To(Equal("dev.com"))
+		Consistently(ctlr.respChan).ShouldNot(Receive())
+		ctlr.mutex.Lock()
+		Expect(ctlr.pending).To(HaveLen(1))
+		ctlr.mutex.Unlock()
+		ctlr.Stop()
+	})
+})
@@ -0,0 +1,194 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package credentials
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+const (
+	UsernameFile    = "username"
+	PasswordFile    = "password"
+	HostFile        = "grid-host"
+	PortFile        = "wapi-port"
+	CertificateFile = "certificate"
+)
+
+// Credentials of the Infoblox grid
+type Credentials struct {
+	Username string
+	Password string
+	Host     string
+	Port     string
+}
+
+// Read returns the credentials of the directory, the fields without a file keep the value of defaults
+func Read(dir string, defaults Credentials) (Credentials, error) {
+	creds := defaults
+	fields := []struct {
+		value    *string
+		filename string
+	}{
+		{&creds.Username, UsernameFile},
+		{&creds.Password, PasswordFile},
+		{&creds.Host, HostFile},
+		{&creds.Port, PortFile},
+	}
+	for _, field := range fields {
+		fileBytes, err := ioutil.ReadFile(filepath.Join(dir, field.filename))
+		if err != nil {
+			log.Debugf("No %s in credentials directory, falling back to CLI argument", field.filename)
+			if len(*field.value) == 0 {
+				return creds, fmt.Errorf("Infoblox %s not specified", field.filename)
+			}
+			continue
+		}
+		*field.value = strings.TrimSpace(string(fileBytes))
+	}
+	return creds, nil
+}
+
+// URLDefaults returns the credentials of a service given by URL, the host and the port of the URL
+// are the defaults of the grid-host and wapi-port files
+func URLDefaults(rawURL, username, password string) (Credentials, error) {
+	addr, err := url.Parse(rawURL)
+	if err != nil {
+		return Credentials{}, err
+	}
+	port := addr.Port()
+	if len(port) == 0 {
+		port = "443"
+		if addr.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return Credentials{
+		Username: username,
+		Password: password,
+		Host:     addr.Hostname(),
+		Port:     port,
+	}, nil
+}
+
+// URL returns the URL with the host and the port of the credentials
+func (creds Credentials) URL(rawURL string) string {
+	addr, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	defaults, _ := URLDefaults(rawURL, "", "")
+	if creds.Host == defaults.Host && creds.Port == defaults.Port {
+		return rawURL
+	}
+	addr.Host = net.JoinHostPort(creds.Host, creds.Port)
+	return addr.String()
+}
+
+// ReadURL returns the credentials of the directory for a service given by URL, along with
+// the URL that the grid-host and wapi-port files apply to
+func ReadURL(dir, rawURL, username, password string) (Credentials, string, error) {
+	defaults, err := URLDefaults(rawURL, username, password)
+	if err != nil {
+		return Credentials{}, rawURL, fmt.Errorf("invalid URL %v: %v", rawURL, err)
+	}
+	creds, err := Read(dir, defaults)
+	if err != nil {
+		return creds, rawURL, err
+	}
+	return creds, creds.URL(rawURL), nil
+}
+
+// checksum returns the checksum of the files of the directory, a missing file counts as empty
+func checksum(dir string) string {
+	hash := sha256.New()
+	for _, filename := range []string{UsernameFile, PasswordFile, HostFile, PortFile, CertificateFile} {
+		fileBytes, _ := ioutil.ReadFile(filepath.Join(dir, filename))
+		_, _ = fmt.Fprintf(hash, "%s:%d:", filename, len(fileBytes))
+		_, _ = hash.Write(fileBytes)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// WatcherParams defines the parameters of the credentials Watcher
+type WatcherParams struct {
+	// Dir is the credentials directory
+	Dir string
+	// Interval between the checks of the directory
+	Interval time.Duration
+	// Defaults are the credentials of the arguments, used for the files that do not exist
+	Defaults Credentials
+	// OnChange applies the changed credentials, they are applied again on the next check when it fails
+	OnChange func(Credentials) error
+}
+
+// Watcher checks the credentials directory for changes, e.g. when the mounted Secret is rotated
+type Watcher struct {
+	WatcherParams
+	applied string
+}
+
+func NewWatcher(params WatcherParams) *Watcher {
+	return &Watcher{
+		WatcherParams: params,
+		applied:       checksum(params.Dir),
+	}
+}
+
+// Start checks the directory every Interval until stopCh is closed
+func (w *Watcher) Start(stopCh <-chan struct{}) {
+	log.Infof("[CRED] Watching credentials directory %v every %v", w.Dir, w.Interval)
+	go func() {
+		ticker := time.NewTicker(w.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.check()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// check applies the credentials when the files changed since they were last applied
+func (w *Watcher) check() bool {
+	sum := checksum(w.Dir)
+	if sum == w.applied {
+		return false
+	}
+	creds, err := Read(w.Dir, w.Defaults)
+	if err != nil {
+		log.Errorf("[CRED] Unable to read credentials directory %v: %v", w.Dir, err)
+		return false
+	}
+	if err = w.OnChange(creds); err != nil {
+		log.Errorf("[CRED] Unable to apply the changed credentials, retrying in %v: %v", w.Interval, err)
+		return false
+	}
+	w.applied = sum
+	return true
+}
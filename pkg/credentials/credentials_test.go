@@ -0,0 +1,88 @@
+package credentials
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCredentials(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Credentials Suite")
+}
+
+var _ = Describe("Credentials", func() {
+	var dir string
+
+	write := func(filename, content string) {
+		Expect(ioutil.WriteFile(filepath.Join(dir, filename), []byte(content), 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "credentials")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	It("reads the files and falls back to the defaults", func() {
+		write(UsernameFile, "admin\n")
+		write(PasswordFile, "secret")
+		creds, err := Read(dir, Credentials{Host: "10.1.1.1", Port: "443"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds).To(Equal(Credentials{Username: "admin", Password: "secret", Host: "10.1.1.1", Port: "443"}))
+		_, err = Read(dir, Credentials{Host: "10.1.1.1"})
+		Expect(err).To(MatchError("Infoblox wapi-port not specified"))
+	})
+	It("reads the credentials of a service given by URL", func() {
+		write(UsernameFile, "admin")
+		write(PasswordFile, "secret")
+		creds, svcURL, err := ReadURL(dir, "https://ipam.example.com/api", "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds).To(Equal(Credentials{Username: "admin", Password: "secret", Host: "ipam.example.com", Port: "443"}))
+		Expect(svcURL).To(Equal("https://ipam.example.com/api"))
+		write(HostFile, "10.1.1.1")
+		write(PortFile, "8443")
+		_, svcURL, err = ReadURL(dir, "https://ipam.example.com/api", "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(svcURL).To(Equal("https://10.1.1.1:8443/api"))
+		_, _, err = ReadURL(dir, "://invalid", "", "")
+		Expect(err).To(HaveOccurred())
+	})
+	It("applies the changed credentials until they are accepted", func() {
+		write(UsernameFile, "admin")
+		write(PasswordFile, "secret")
+		var applied []Credentials
+		accept := false
+		w := NewWatcher(WatcherParams{
+			Dir:      dir,
+			Defaults: Credentials{Host: "10.1.1.1", Port: "443"},
+			OnChange: func(creds Credentials) error {
+				if !accept {
+					return errors.New("not accepted")
+				}
+				applied = append(applied, creds)
+				return nil
+			},
+		})
+		Expect(w.check()).To(BeFalse())
+		// The rotation is half done, the grid does not accept the password yet
+		write(PasswordFile, "rotated")
+		Expect(w.check()).To(BeFalse())
+		accept = true
+		Expect(w.check()).To(BeTrue())
+		Expect(applied).To(Equal([]Credentials{{Username: "admin", Password: "rotated", Host: "10.1.1.1", Port: "443"}}))
+		Expect(w.check()).To(BeFalse())
+		// A changed certificate is applied as well
+		write(CertificateFile, "-----BEGIN CERTIFICATE-----")
+		Expect(w.check()).To(BeTrue())
+		Expect(applied).To(HaveLen(2))
+	})
+})
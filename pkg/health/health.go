@@ -0,0 +1,88 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+const (
+	// LivenessPath always reports the controller as alive
+	LivenessPath = "/healthz"
+	// ReadinessPath reports whether the controller can serve requests
+	ReadinessPath = "/readyz"
+)
+
+// Params defines the parameters of the health server
+type Params struct {
+	// Port to serve the health checks on
+	Port int
+	// Ready reports whether the controller can serve requests
+	Ready func() bool
+}
+
+// Server serves the liveness and readiness checks of the controller
+type Server struct {
+	server *http.Server
+	ready  func() bool
+}
+
+func NewServer(params Params) *Server {
+	srv := &Server{ready: params.Ready}
+	mux := http.NewServeMux()
+	mux.HandleFunc(LivenessPath, srv.serveLiveness)
+	mux.HandleFunc(ReadinessPath, srv.serveReadiness)
+	srv.server = &http.Server{
+		Addr:    fmt.Sprintf(":%d", params.Port),
+		Handler: mux,
+	}
+	return srv
+}
+
+// Start serves the health checks in the background
+func (srv *Server) Start() {
+	go func() {
+		log.Infof("[HLTH] Serving health checks on %v", srv.server.Addr)
+		err := srv.server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("[HLTH] Unable to serve health checks: %v", err)
+		}
+	}()
+}
+
+func (srv *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = srv.server.Shutdown(ctx)
+}
+
+func (srv *Server) serveLiveness(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (srv *Server) serveReadiness(w http.ResponseWriter, r *http.Request) {
+	if srv.ready != nil && !srv.ready() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = w.Write([]byte("ok"))
+}
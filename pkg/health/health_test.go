@@ -0,0 +1,35 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestHealth(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Health Suite")
+}
+
+var _ = Describe("Health Server", func() {
+	ready := false
+	srv := NewServer(Params{Ready: func() bool { return ready }})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	It("reports the controller as alive", func() {
+		Expect(get(LivenessPath).Code).To(Equal(http.StatusOK))
+	})
+	It("reports the controller as not ready until the manager is ready", func() {
+		Expect(get(ReadinessPath).Code).To(Equal(http.StatusServiceUnavailable))
+		ready = true
+		Expect(get(ReadinessPath).Code).To(Equal(http.StatusOK))
+	})
+})
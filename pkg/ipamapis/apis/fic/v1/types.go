@@ -35,6 +35,9 @@ type IPAM struct {
 
 type IPAMSpec struct {
 	HostSpecs []*HostSpec `json:"hostSpecs,omitempty"`
+	// ControllerClass selects the IPAM controller instance that reconciles
+	// this resource, instances ignore the resources of other classes
+	ControllerClass string `json:"controllerClass,omitempty"`
 }
 
 type HostSpec struct {
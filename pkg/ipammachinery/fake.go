@@ -13,7 +13,10 @@ func NewFakeIPAMClient(
 	restClient rest.Interface,
 ) *IPAMClient {
 
-	ipamCli := &IPAMClient{}
+	ipamCli := &IPAMClient{
+		namespaces:    make(map[string]bool),
+		ipamInformers: make(map[string]*IPAMInformer),
+	}
 
 	ipamCli.kubeCRClient = kubeCRClient
 	if kubeCRClient == nil {
@@ -22,7 +22,9 @@ import (
 
 	ficInfV1 "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/client/informers/externalversions/fic/v1"
 	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	coreV1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreInfV1 "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -47,6 +49,22 @@ func (ipamInfr *IPAMInformer) stop() {
 	close(ipamInfr.stopCh)
 }
 
+// start the namespace informer
+func (nsInfr *NSInformer) start() {
+	log.Infof("Starting Namespace Informer")
+	go nsInfr.nsInformer.Run(nsInfr.stopCh)
+
+	cache.WaitForNamedCacheSync(
+		"F5 IPAMClient Namespace Controller",
+		nsInfr.stopCh,
+		nsInfr.nsInformer.HasSynced,
+	)
+}
+
+func (nsInfr *NSInformer) stop() {
+	close(nsInfr.stopCh)
+}
+
 func (ipamCli *IPAMClient) watchingAllNamespaces() bool {
 	if 0 == len(ipamCli.ipamInformers) {
 		// Not watching any namespaces.
@@ -60,6 +78,9 @@ func (ipamCli *IPAMClient) addNamespacedInformer(
 	namespace string,
 	eventHandlers *cache.ResourceEventHandlerFuncs,
 ) error {
+	ipamCli.informersLock.Lock()
+	defer ipamCli.informersLock.Unlock()
+
 	if ipamCli.watchingAllNamespaces() {
 		return fmt.Errorf(
 			"Cannot add additional namespaces when already watching all.")
@@ -76,15 +97,35 @@ func (ipamCli *IPAMClient) addNamespacedInformer(
 	crInf = ipamCli.newNamespacedInformer(namespace)
 	ipamCli.addEventHandlers(crInf, eventHandlers)
 	ipamCli.ipamInformers[namespace] = crInf
+	// Informers added after the client has started are started right away,
+	// the rest are started along with the client
+	if ipamCli.started {
+		go crInf.start()
+	}
 	return nil
 }
 
+func (ipamCli *IPAMClient) removeNamespacedInformer(namespace string) {
+	ipamCli.informersLock.Lock()
+	defer ipamCli.informersLock.Unlock()
+
+	crInf, found := ipamCli.ipamInformers[namespace]
+	if !found {
+		return
+	}
+	log.Debugf("[ipam] Removing Informers for Namespace %v", namespace)
+	if ipamCli.started {
+		crInf.stop()
+	}
+	delete(ipamCli.ipamInformers, namespace)
+}
+
 func (ipamCli *IPAMClient) newNamespacedInformer(
 	namespace string,
 ) *IPAMInformer {
 	log.Debugf("[ipam] Creating Informers for Namespace %v", namespace)
-	everything := func(options *metav1.ListOptions) {
-		options.LabelSelector = ""
+	labelSelector := func(options *metav1.ListOptions) {
+		options.LabelSelector = ipamCli.labelSelector
 	}
 
 	resyncPeriod := 0 * time.Second
@@ -100,7 +141,7 @@ func (ipamCli *IPAMClient) newNamespacedInformer(
 		namespace,
 		resyncPeriod,
 		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
-		everything,
+		labelSelector,
 	)
 
 	return ipamInf
@@ -120,9 +161,71 @@ func (ipamCli *IPAMClient) addEventHandlers(
 func (ipamCli *IPAMClient) getNamespacedInformer(
 	namespace string,
 ) (*IPAMInformer, bool) {
+	ipamCli.informersLock.Lock()
+	defer ipamCli.informersLock.Unlock()
+
 	if ipamCli.watchingAllNamespaces() {
 		namespace = ""
 	}
 	ipamInf, found := ipamCli.ipamInformers[namespace]
 	return ipamInf, found
 }
+
+// newNamespaceInformer creates an informer for the namespaces matching the
+// given label selector, IPAM informers follow the namespaces it reports
+func (ipamCli *IPAMClient) newNamespaceInformer(
+	namespaceLabel string,
+) *NSInformer {
+	log.Debugf("[ipam] Creating Namespace Informer for label %v", namespaceLabel)
+	nsLabelSelector := func(options *metav1.ListOptions) {
+		options.LabelSelector = namespaceLabel
+	}
+
+	resyncPeriod := 0 * time.Second
+
+	nsInf := &NSInformer{
+		stopCh: make(chan struct{}),
+	}
+	nsInf.nsInformer = coreInfV1.NewFilteredNamespaceInformer(
+		ipamCli.kubeClient,
+		resyncPeriod,
+		cache.Indexers{},
+		nsLabelSelector,
+	)
+	nsInf.nsInformer.AddEventHandler(
+		&cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { ipamCli.enqueueNamespace(obj) },
+			DeleteFunc: func(obj interface{}) { ipamCli.enqueueDeletedNamespace(obj) },
+		},
+	)
+
+	return nsInf
+}
+
+// enqueueNamespace starts watching IPAM resources of a namespace that got
+// created or labelled to match the namespace label
+func (ipamCli *IPAMClient) enqueueNamespace(obj interface{}) {
+	ns, ok := obj.(*coreV1.Namespace)
+	if !ok {
+		return
+	}
+	log.Debugf("[ipam] Namespace %v matches label %v", ns.Name, ipamCli.namespaceLabel)
+	if err := ipamCli.addNamespacedInformer(ns.Name, ipamCli.eventHandlers); err != nil {
+		log.Errorf("Unable to setup informer for namespace: %v, Error:%v", ns.Name, err)
+	}
+}
+
+// enqueueDeletedNamespace stops watching IPAM resources of a namespace that
+// got deleted or no longer matches the namespace label.
+// Allocations of the namespace are left untouched.
+func (ipamCli *IPAMClient) enqueueDeletedNamespace(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	ns, ok := obj.(*coreV1.Namespace)
+	if !ok {
+		return
+	}
+	log.Debugf("[ipam] Namespace %v no longer matches label %v", ns.Name, ipamCli.namespaceLabel)
+	ipamCli.removeNamespacedInformer(ns.Name)
+}
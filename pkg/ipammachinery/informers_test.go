@@ -0,0 +1,46 @@
+package ipammachinery
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestIPAMMachinery(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "IPAM Machinery Suite")
+}
+
+var _ = Describe("Namespace Informers", func() {
+	var ipamCli *IPAMClient
+
+	BeforeEach(func() {
+		ipamCli = NewFakeIPAMClient(nil, k8sfake.NewSimpleClientset(), nil)
+		ipamCli.eventHandlers = &cache.ResourceEventHandlerFuncs{}
+		ipamCli.namespaceLabel = "ipam=true"
+	})
+
+	It("adds and removes informers as namespaces match the label", func() {
+		ns := &coreV1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: "dev"}}
+		ipamCli.enqueueNamespace(ns)
+		_, found := ipamCli.getNamespacedInformer("dev")
+		Expect(found).To(BeTrue())
+
+		ipamCli.enqueueDeletedNamespace(cache.DeletedFinalStateUnknown{Key: "dev", Obj: ns})
+		_, found = ipamCli.getNamespacedInformer("dev")
+		Expect(found).To(BeFalse())
+	})
+
+	It("does not mix all namespaces with specific namespaces", func() {
+		Expect(ipamCli.addNamespacedInformer("", ipamCli.eventHandlers)).To(Succeed())
+		Expect(ipamCli.addNamespacedInformer("dev", ipamCli.eventHandlers)).NotTo(Succeed())
+		inf, found := ipamCli.getNamespacedInformer("dev")
+		Expect(found).To(BeTrue())
+		Expect(inf.namespace).To(Equal(""))
+	})
+})
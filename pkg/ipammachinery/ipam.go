@@ -19,6 +19,7 @@ package ipammachinery
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	"github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/client/clientset/versioned"
 	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
@@ -43,14 +44,22 @@ const (
 	FullCRDName      string = CRDPlural + "." + CRDGroup
 	HostnamePattern  string = "^(([a-zA-Z0-9\\*]|[a-zA-Z0-9][a-zA-Z0-9\\-]*[a-zA-Z0-9])\\.)*([A-Za-z0-9]|[A-Za-z0-9][A-Za-z0-9\\-]*[A-Za-z0-9])$"
 	IPAddressPattern string = "^(([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])|(([0-9a-fA-F]{1,4}:){7,7}[0-9a-fA-F]{1,4}|([0-9a-fA-F]{1,4}:){1,7}:|([0-9a-fA-F]{1,4}:){1,6}:[0-9a-fA-F]{1,4}|([0-9a-fA-F]{1,4}:){1,5}(:[0-9a-fA-F]{1,4}){1,2}|([0-9a-fA-F]{1,4}:){1,4}(:[0-9a-fA-F]{1,4}){1,3}|([0-9a-fA-F]{1,4}:){1,3}(:[0-9a-fA-F]{1,4}){1,4}|([0-9a-fA-F]{1,4}:){1,2}(:[0-9a-fA-F]{1,4}){1,5}|[0-9a-fA-F]{1,4}:((:[0-9a-fA-F]{1,4}){1,6})|:((:[0-9a-fA-F]{1,4}){1,7}|:)|fe80:(:[0-9a-fA-F]{0,4}){0,4}%[0-9a-zA-Z]{1,}|::(ffff(:0{1,4}){0,1}:){0,1}((25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])\\.){3,3}(25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])|([0-9a-fA-F]{1,4}:){1,4}:((25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])\\.){3,3}(25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9]))$"
+
+	// CRDSchemaVersion is bumped whenever the embedded IPAM schema changes,
+	// so that existing CRDs get updated in place
+	CRDSchemaVersion           = 2
+	CRDSchemaVersionAnnotation = CRDGroup + "/schema-version"
 )
 
 // NewIPAM creates a new IPAMClient Instance.
 func NewIPAMClient(params Params) *IPAMClient {
 
 	ipamCli := &IPAMClient{
-		namespaces:    make(map[string]bool),
-		ipamInformers: make(map[string]*IPAMInformer),
+		namespaces:     make(map[string]bool),
+		ipamInformers:  make(map[string]*IPAMInformer),
+		eventHandlers:  params.EventHandlers,
+		namespaceLabel: params.NamespaceLabel,
+		labelSelector:  params.LabelSelector,
 	}
 	for _, ns := range params.Namespaces {
 		ipamCli.namespaces[ns] = true
@@ -95,6 +104,11 @@ func (ipamCli *IPAMClient) setupClients(config *rest.Config) error {
 }
 
 func (ipamCli *IPAMClient) setupInformersWithEventHandlers(eventHandlers *cache.ResourceEventHandlerFuncs) error {
+	if ipamCli.namespaceLabel != "" {
+		// Namespaced informers are added and removed by the namespace informer
+		ipamCli.nsInformer = ipamCli.newNamespaceInformer(ipamCli.namespaceLabel)
+		return nil
+	}
 	for ns, _ := range ipamCli.namespaces {
 		if err := ipamCli.addNamespacedInformer(ns, eventHandlers); err != nil {
 			log.Errorf("Unable to setup informer for namespace: %v, Error:%v", "default", err)
@@ -107,26 +121,135 @@ func (ipamCli *IPAMClient) setupInformersWithEventHandlers(eventHandlers *cache.
 
 // Start the Custom Resource Manager
 func (ipamCli *IPAMClient) Start() {
+	if ipamCli.nsInformer != nil {
+		// Populates the IPAM informers for the namespaces that already exist
+		ipamCli.nsInformer.start()
+	}
+
+	ipamCli.informersLock.Lock()
+	ipamCli.started = true
+	var informers []*IPAMInformer
 	for _, inf := range ipamCli.ipamInformers {
+		informers = append(informers, inf)
+	}
+	ipamCli.informersLock.Unlock()
+
+	for _, inf := range informers {
 		inf.start()
 	}
 }
 
 func (ipamCli *IPAMClient) Stop() {
+	if ipamCli.nsInformer != nil {
+		ipamCli.nsInformer.stop()
+	}
+
+	ipamCli.informersLock.Lock()
+	defer ipamCli.informersLock.Unlock()
 	for _, inf := range ipamCli.ipamInformers {
 		inf.stop()
 	}
+	ipamCli.started = false
 }
 
-// RegisterCRD creates schema of IPAM and registers it with Kubernetes/Openshift
+// RegisterCRD creates schema of IPAM and registers it with Kubernetes/Openshift.
+// An existing CRD with an older schema is updated in place, so that the
+// IPAM resources are preserved. CRDs without the schema version annotation
+// were created by someone else, CIS for instance, and are left alone.
 func RegisterCRD(clientset extClient.Interface) error {
+	crdClient := clientset.ApiextensionsV1().CustomResourceDefinitions()
+	for i := 0; i < MAX_RETRIES; i++ {
+		crd, err := crdClient.Get(context.TODO(), FullCRDName, meta_v1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = crdClient.Create(context.TODO(), newIPAMCRD(), meta_v1.CreateOptions{})
+			if err == nil {
+				log.Infof("[ipam] Created CRD: %v with schema version: %v", FullCRDName, CRDSchemaVersion)
+				return nil
+			}
+			if apierrors.IsAlreadyExists(err) {
+				continue
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if !ownsCRD(crd) {
+			log.Warningf("[ipam] CRD: %v was not created by the controller, skipping the schema update. "+
+				"Annotate it with %v=0 to let the controller manage it", FullCRDName, CRDSchemaVersionAnnotation)
+			return nil
+		}
+
+		schemaVersion := crdSchemaVersion(crd)
+		if schemaVersion >= CRDSchemaVersion {
+			log.Debugf("[ipam] CRD: %v is up to date with schema version: %v", FullCRDName, schemaVersion)
+			return nil
+		}
+		updateIPAMCRD(crd)
+		_, err = crdClient.Update(context.TODO(), crd, meta_v1.UpdateOptions{})
+		if err == nil {
+			log.Infof("[ipam] Updated CRD: %v from schema version: %v to %v",
+				FullCRDName, schemaVersion, CRDSchemaVersion)
+			return nil
+		}
+		// Try again with the latest CRD on conflicts
+		if !apierrors.IsConflict(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("unable to register CRD: %v, too many conflicts", FullCRDName)
+}
+
+// ownsCRD checks whether the CRD was registered by the controller
+func ownsCRD(crd *apiextensionv1.CustomResourceDefinition) bool {
+	_, ok := crd.Annotations[CRDSchemaVersionAnnotation]
+	return ok
+}
+
+// crdSchemaVersion returns the schema version the CRD was registered with,
+// CRDs that were not registered by the controller are at version 0
+func crdSchemaVersion(crd *apiextensionv1.CustomResourceDefinition) int {
+	version, err := strconv.Atoi(crd.Annotations[CRDSchemaVersionAnnotation])
+	if err != nil {
+		return 0
+	}
+	return version
+}
+
+// updateIPAMCRD replaces the schema of the served version with the embedded one,
+// other versions and the storage version are left as they are
+func updateIPAMCRD(crd *apiextensionv1.CustomResourceDefinition) {
+	if crd.Annotations == nil {
+		crd.Annotations = make(map[string]string)
+	}
+	crd.Annotations[CRDSchemaVersionAnnotation] = strconv.Itoa(CRDSchemaVersion)
+
+	for i, version := range crd.Spec.Versions {
+		if version.Name == CRDVersion {
+			crd.Spec.Versions[i].Schema = ipamCRSchemaValidation()
+			crd.Spec.Versions[i].Subresources = ipamCRSubresources()
+			return
+		}
+	}
+	crd.Spec.Versions = append(crd.Spec.Versions, apiextensionv1.CustomResourceDefinitionVersion{
+		Name:         CRDVersion,
+		Served:       true,
+		Storage:      len(crd.Spec.Versions) == 0,
+		Schema:       ipamCRSchemaValidation(),
+		Subresources: ipamCRSubresources(),
+	})
+}
+
+func newIPAMCRD() *apiextensionv1.CustomResourceDefinition {
 	var CRDVersions = []apiextensionv1.CustomResourceDefinitionVersion{
 		{Name: CRDVersion, Served: true, Storage: true, Schema: ipamCRSchemaValidation(), Subresources: ipamCRSubresources()},
 	}
-	crd := &apiextensionv1.CustomResourceDefinition{
+	return &apiextensionv1.CustomResourceDefinition{
 		ObjectMeta: meta_v1.ObjectMeta{
-			Name:          FullCRDName,
-			ManagedFields: []meta_v1.ManagedFieldsEntry{{Manager: F5IPAMCtlr}},
+			Name: FullCRDName,
+			Annotations: map[string]string{
+				CRDSchemaVersionAnnotation: strconv.Itoa(CRDSchemaVersion),
+			},
 		},
 
 		Spec: apiextensionv1.CustomResourceDefinitionSpec{
@@ -134,16 +257,13 @@ func RegisterCRD(clientset extClient.Interface) error {
 			Versions: CRDVersions,
 			Scope:    apiextensionv1.NamespaceScoped,
 			Names: apiextensionv1.CustomResourceDefinitionNames{
-				Plural: CRDPlural,
-				Kind:   F5ipam,
+				Plural:   CRDPlural,
+				Singular: "ipam",
+				Kind:     F5ipam,
+				ListKind: F5ipam + "List",
 			},
 		},
 	}
-	_, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Create(context.TODO(), crd, meta_v1.CreateOptions{})
-	if err != nil && apierrors.IsAlreadyExists(err) {
-		return nil
-	}
-	return err
 }
 
 func ipamCRSchemaValidation() *apiextensionv1.CustomResourceValidation {
@@ -163,6 +283,7 @@ func ipamCRSchemaValidation() *apiextensionv1.CustomResourceValidation {
 							},
 						},
 					},
+					"controllerClass": {Type: "string", Format: "string"},
 				},
 			},
 			"status": {
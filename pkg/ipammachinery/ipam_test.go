@@ -0,0 +1,63 @@
+package ipammachinery
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apiextensionv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	extFake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Register CRD", func() {
+	getCRD := func(cli *extFake.Clientset) *apiextensionv1.CustomResourceDefinition {
+		crd, err := cli.ApiextensionsV1().CustomResourceDefinitions().Get(
+			context.TODO(), FullCRDName, metaV1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return crd
+	}
+
+	It("creates the CRD when it does not exist", func() {
+		cli := extFake.NewSimpleClientset()
+		Expect(RegisterCRD(cli)).To(Succeed())
+		crd := getCRD(cli)
+		Expect(crdSchemaVersion(crd)).To(Equal(CRDSchemaVersion))
+		Expect(crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties).
+			To(HaveKey("controllerClass"))
+	})
+
+	It("updates an older CRD in place", func() {
+		oldCRD := newIPAMCRD()
+		oldCRD.Annotations[CRDSchemaVersionAnnotation] = "0"
+		oldCRD.Spec.Versions[0].Schema = &apiextensionv1.CustomResourceValidation{
+			OpenAPIV3Schema: &apiextensionv1.JSONSchemaProps{Type: "object"},
+		}
+		cli := extFake.NewSimpleClientset(oldCRD)
+		Expect(RegisterCRD(cli)).To(Succeed())
+		crd := getCRD(cli)
+		Expect(crdSchemaVersion(crd)).To(Equal(CRDSchemaVersion))
+		Expect(crd.Spec.Versions).To(HaveLen(1))
+		Expect(crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties).To(HaveKey("spec"))
+	})
+
+	It("leaves a CRD that it does not own alone", func() {
+		foreignCRD := newIPAMCRD()
+		foreignCRD.Annotations = nil
+		foreignCRD.Spec.Versions[0].Schema = nil
+		cli := extFake.NewSimpleClientset(foreignCRD)
+		Expect(RegisterCRD(cli)).To(Succeed())
+		crd := getCRD(cli)
+		Expect(crd.Annotations).NotTo(HaveKey(CRDSchemaVersionAnnotation))
+		Expect(crd.Spec.Versions[0].Schema).To(BeNil())
+	})
+
+	It("leaves a newer CRD alone", func() {
+		newCRD := newIPAMCRD()
+		newCRD.Annotations[CRDSchemaVersionAnnotation] = "100"
+		newCRD.Spec.Versions[0].Schema = nil
+		cli := extFake.NewSimpleClientset(newCRD)
+		Expect(RegisterCRD(cli)).To(Succeed())
+		Expect(getCRD(cli).Spec.Versions[0].Schema).To(BeNil())
+	})
+})
@@ -17,6 +17,8 @@
 package ipammachinery
 
 import (
+	"sync"
+
 	"github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/client/clientset/versioned"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -32,12 +34,25 @@ type (
 		ipamInformers map[string]*IPAMInformer
 		namespaces    map[string]bool
 		stopCh        chan interface{}
+		// informersLock guards ipamInformers and started, as namespaces
+		// can be added or removed by the namespace informer at runtime
+		informersLock  sync.Mutex
+		started        bool
+		eventHandlers  *cache.ResourceEventHandlerFuncs
+		namespaceLabel string
+		labelSelector  string
+		nsInformer     *NSInformer
 	}
 	// Params defines parameters
 	Params struct {
 		Config        *rest.Config
 		EventHandlers *cache.ResourceEventHandlerFuncs
 		Namespaces    []string
+		// NamespaceLabel is a label selector, when set the namespaces to watch
+		// are discovered from the cluster instead of Namespaces
+		NamespaceLabel string
+		// LabelSelector restricts the IPAM resources to watch
+		LabelSelector string
 	}
 	// CRInformer defines the structure of Custom Resource Informer
 	IPAMInformer struct {
@@ -45,4 +60,9 @@ type (
 		stopCh       chan struct{}
 		ipamInformer cache.SharedIndexInformer
 	}
+	// NSInformer defines the structure of Namespace Informer
+	NSInformer struct {
+		stopCh     chan struct{}
+		nsInformer cache.SharedIndexInformer
+	}
 )
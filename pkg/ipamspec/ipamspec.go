@@ -32,6 +32,12 @@ type IPAMRequest struct {
 	IPAMLabel string
 }
 
+// ResourceMetadata is implemented by the Metadata of the requests that come from an IPAM resource
+type ResourceMetadata interface {
+	GetName() string
+	GetNamespace() string
+}
+
 type IPAMResponse struct {
 	Request IPAMRequest
 	IPAddr  string
@@ -0,0 +1,74 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+var (
+	// connectBackoff is the delay between the attempts to connect to the provider, it doubles on every attempt
+	connectBackoff    = 5 * time.Second
+	connectMaxBackoff = 5 * time.Minute
+)
+
+// retryConnect calls connect with exponential backoff until it succeeds, or fails with an error that
+// transient does not report, e.g. a label whose network is not found
+func retryConnect(provider string, connect func() error, transient func(error) bool) {
+	for attempt := 0; ; attempt++ {
+		time.Sleep(utils.Backoff(attempt, connectBackoff, connectMaxBackoff))
+		err := connect()
+		if err == nil {
+			log.Infof("[IPMG] Connected to %v", provider)
+			return
+		}
+		if !transient(err) {
+			log.Errorf("[IPMG] Unable to connect to %v, not retrying as the configuration is invalid, Error: %v",
+				provider, err)
+			return
+		}
+		log.Errorf("[IPMG] Unable to connect to %v, Error: %v", provider, err)
+	}
+}
+
+// isConnectionError checks whether the request failed to reach the provider or to get its response.
+// The certificate and TLS errors are not, they persist until the configuration changes
+func isConnectionError(err error) bool {
+	if isTLSError(err) {
+		return false
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// isTLSError checks whether the TLS handshake with the provider failed, e.g. on its certificate
+func isTLSError(err error) bool {
+	var verificationErr *tls.CertificateVerificationError
+	var recordHeaderErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &verificationErr) || errors.As(err, &recordHeaderErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
@@ -0,0 +1,24 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+// CredentialsUpdater is implemented by the managers whose provider credentials can change at runtime
+type CredentialsUpdater interface {
+	// UpdateCredentials reconnects to the grid, the DefaultGrid when it is empty, with the host, port,
+	// username, password and certificate of the params, the current connection is kept when they are not accepted
+	UpdateCredentials(grid string, params GridParams) error
+}
@@ -19,15 +19,22 @@ package manager
 import (
 	"fmt"
 	"net"
+	"sort"
 	"strings"
 
 	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
 	"github.com/F5Networks/f5-ipam-controller/pkg/provider"
+	"github.com/F5Networks/f5-ipam-controller/pkg/provider/sqlite"
+	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
 	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
 )
 
 type IPAMManagerParams struct {
-	Range string
+	Range  string
+	DBFile string
+	// KeepLabels does not apply the Range to the labels of the DB, for the tools that
+	// must not change them
+	KeepLabels bool
 }
 
 type providerHandler struct {
@@ -39,7 +46,7 @@ type IPAMManager struct {
 }
 
 func NewIPAMManager(params IPAMManagerParams) (*IPAMManager, error) {
-	provParams := provider.Params{Range: params.Range}
+	provParams := provider.Params{Range: params.Range, DBFile: params.DBFile, KeepLabels: params.KeepLabels}
 	prov := provider.NewProvider(provParams)
 	if prov == nil {
 		return nil, fmt.Errorf("[IPMG] Unable to create Provider")
@@ -109,6 +116,29 @@ func (ipMgr *IPAMManager) AllocateNextIPAddress(req ipamspec.IPAMRequest) string
 	return ipMgr.provider.AllocateNextIPAddress(req.IPAMLabel, ref)
 }
 
+// ReserveIPAddress method reserves the IP address given in the request
+func (ipMgr *IPAMManager) ReserveIPAddress(req ipamspec.IPAMRequest) bool {
+	if req.IPAMLabel == "" || (req.HostName == "" && req.Key == "") || !utils.IsIPAddr(req.IPAddr) {
+		log.Errorf("[IPMG] Invalid request to reserve IPAddress: %v", req.String())
+		return false
+	}
+	ref := req.HostName
+
+	if ref == "" {
+		ref = req.Key
+	}
+	return ipMgr.provider.ReserveAddr(req.IPAMLabel, req.IPAddr, ref)
+}
+
+// ValidateRequest method checks the IPAM label and the IP address of the request
+func (ipMgr *IPAMManager) ValidateRequest(req ipamspec.IPAMRequest) error {
+	ipRange, ok := ipMgr.provider.GetLabelMap()[req.IPAMLabel]
+	if !ok {
+		return fmt.Errorf("unknown IPAM label %v", req.IPAMLabel)
+	}
+	return validateIPAddress(req, ipRange)
+}
+
 // ReleaseIPAddress method releases an IP address
 func (ipMgr *IPAMManager) ReleaseIPAddress(req ipamspec.IPAMRequest) {
 	if !isIPV4Addr(req.IPAddr) {
@@ -118,6 +148,38 @@ func (ipMgr *IPAMManager) ReleaseIPAddress(req ipamspec.IPAMRequest) {
 	ipMgr.provider.ReleaseAddr(req.IPAddr)
 }
 
+// GetLabelUsage method gets the IPAM labels along with their utilisation
+func (ipMgr *IPAMManager) GetLabelUsage() []LabelUsage {
+	var usage []LabelUsage
+	for ipamLabel, ipRange := range ipMgr.provider.GetLabelMap() {
+		lu := LabelUsage{IPAMLabel: ipamLabel, Range: ipRange}
+		for _, rec := range ipMgr.provider.GetIPRecords(ipamLabel) {
+			lu.Total++
+			if rec.Status == sqlite.ALLOCATED {
+				lu.Allocated++
+			}
+		}
+		usage = append(usage, lu)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].IPAMLabel < usage[j].IPAMLabel
+	})
+	return usage
+}
+
+// GetAllocations method gets the allocations of the IPAM label
+func (ipMgr *IPAMManager) GetAllocations(ipamLabel string) []Allocation {
+	var allocations []Allocation
+	for _, rec := range ipMgr.provider.GetIPRecords(ipamLabel) {
+		if rec.Status != sqlite.ALLOCATED {
+			continue
+		}
+		allocations = append(allocations, NewAllocation(rec.IPAMLabel, rec.IPAddr, rec.Reference))
+	}
+	sortAllocations(allocations)
+	return allocations
+}
+
 func isIPV4Addr(ipAddr string) bool {
 	if ipAddr == "" {
 		return false
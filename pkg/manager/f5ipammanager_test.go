@@ -2,6 +2,7 @@ package manager
 
 import (
 	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/provider/sqlite"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -111,6 +112,35 @@ var _ = Describe("Static IP Provider", func() {
 		ipMgr.ReleaseIPAddress(request)
 		Expect(len(recordData)).To(BeEquivalentTo(0))
 	})
+	It("Testing ReserveIPAddress function", func() {
+		// without a reference or a valid ip address reservation should fail
+		request := ipamspec.IPAMRequest{Metadata: "", Operation: ipamspec.CREATE, HostName: "", IPAddr: "10.0.0.9", Key: "", IPAMLabel: "dev"}
+		Expect(ipMgr.ReserveIPAddress(request)).To(BeFalse())
+		request.HostName = "foo.com"
+		request.IPAddr = "invalid"
+		Expect(ipMgr.ReserveIPAddress(request)).To(BeFalse())
+		request.IPAddr = "10.0.0.9"
+		Expect(ipMgr.ReserveIPAddress(request)).To(BeTrue())
+		Expect(recordData["foo.com"].ipaddress).To(Equal("10.0.0.9"))
+		delete(recordData, "foo.com")
+	})
+	It("Testing GetLabelUsage and GetAllocations functions", func() {
+		Expect(ipMgr.GetLabelUsage()).To(Equal([]LabelUsage{
+			{IPAMLabel: "dev", Range: "10.0.0.1-10.0.0.3", Total: 3, Allocated: 2},
+			{IPAMLabel: "test", Range: "10.0.1.1-10.0.1.1", Total: 1, Allocated: 0},
+		}))
+		Expect(ipMgr.GetAllocations("test")).To(BeEmpty())
+		Expect(ipMgr.GetAllocations("")).To(Equal([]Allocation{
+			{IPAMLabel: "dev", IPAddr: "10.0.0.1", Reference: "foo.com", HostName: true},
+			{IPAMLabel: "dev", IPAddr: "10.0.0.3", Reference: "default/no-hostname"},
+		}))
+		// The keys namespace/name are told apart from the hostnames
+		allocations := ipMgr.GetAllocations("dev")
+		Expect(allocations[0].Request(ipamspec.DELETE)).To(Equal(ipamspec.IPAMRequest{
+			Operation: ipamspec.DELETE, HostName: "foo.com", IPAddr: "10.0.0.1", IPAMLabel: "dev"}))
+		Expect(allocations[1].Request(ipamspec.DELETE)).To(Equal(ipamspec.IPAMRequest{
+			Operation: ipamspec.DELETE, Key: "default/no-hostname", IPAddr: "10.0.0.3", IPAMLabel: "dev"}))
+	})
 
 })
 
@@ -140,6 +170,32 @@ func (manager providerHandler) AllocateNextIPAddress(ipamLabel, reference string
 	return ipAddresses[ipindex]
 }
 
+func (manager providerHandler) ReserveAddr(ipamLabel, ipAddr, reference string) bool {
+	recordData[reference] = mockRecord{ipamLabel, reference, ipAddr}
+	return true
+}
+
+func (manager providerHandler) GetLabelMap() map[string]string {
+	return map[string]string{"dev": "10.0.0.1-10.0.0.3", "test": "10.0.1.1-10.0.1.1"}
+}
+
+func (manager providerHandler) GetIPRecords(ipamLabel string) []sqlite.IPRecord {
+	records := []sqlite.IPRecord{
+		// The database sorts the IP addresses as text
+		{IPAddr: "10.0.0.3", Status: sqlite.ALLOCATED, IPAMLabel: "dev", Reference: "default/no-hostname"},
+		{IPAddr: "10.0.0.1", Status: sqlite.ALLOCATED, IPAMLabel: "dev", Reference: "foo.com"},
+		{IPAddr: "10.0.0.2", Status: sqlite.AVAILABLE, IPAMLabel: "dev", Reference: "random"},
+		{IPAddr: "10.0.1.1", Status: sqlite.AVAILABLE, IPAMLabel: "test", Reference: "random"},
+	}
+	var result []sqlite.IPRecord
+	for _, rec := range records {
+		if ipamLabel == "" || rec.IPAMLabel == ipamLabel {
+			result = append(result, rec)
+		}
+	}
+	return result
+}
+
 func (manager providerHandler) ReleaseAddr(ipAddr string) {
 	for k, v := range recordData {
 		if v.ipaddress == ipAddr {
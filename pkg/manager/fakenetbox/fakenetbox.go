@@ -0,0 +1,507 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fakenetbox is a fake NetBox REST API on httptest, to test the NetBox provider without NetBox
+package fakenetbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultToken is the API token that the server accepts when Params has none
+const DefaultToken = "0123456789abcdef0123456789abcdef01234567"
+
+// Object is a NetBox object by its JSON fields
+type Object map[string]interface{}
+
+// Params defines the parameters of the fake NetBox API
+type Params struct {
+	// Token is the API token, DefaultToken when it is empty
+	Token string
+}
+
+// Server is a fake NetBox API that holds the tags, prefixes, IP ranges and IP addresses in memory.
+// It implements their lists with filters and paging, the available-ips of the prefixes and IP ranges,
+// and the error bodies of NetBox
+type Server struct {
+	*httptest.Server
+	token string
+
+	mutex    sync.Mutex
+	objects  map[string][]Object
+	nextID   int
+	failures []failure
+}
+
+// failure makes the next count requests of the method and path fail with the status
+type failure struct {
+	method string
+	path   string
+	status int
+	count  int
+}
+
+// apiError is an error response of NetBox
+type apiError struct {
+	status int
+	body   interface{}
+}
+
+func NewServer(params Params) *Server {
+	srv := &Server{
+		token:   params.Token,
+		objects: make(map[string][]Object),
+	}
+	if srv.token == "" {
+		srv.token = DefaultToken
+	}
+	srv.Server = httptest.NewTLSServer(http.HandlerFunc(srv.serveAPI))
+	return srv
+}
+
+// WriteCertificate writes the certificate of the server in PEM to the file, to verify the server with it
+func (srv *Server) WriteCertificate(filename string) error {
+	var buf bytes.Buffer
+	if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0600)
+}
+
+// AddPrefix adds the prefix, e.g. 10.1.0.0/24, and returns its ID
+func (srv *Server) AddPrefix(prefix string) int {
+	return srv.AddObject("ipam/prefixes", Object{"prefix": prefix})
+}
+
+// AddRange adds the IP range of the addresses with their prefix length, e.g. 10.1.0.10/24, and returns its ID
+func (srv *Server) AddRange(startAddress, endAddress string) int {
+	return srv.AddObject("ipam/ip-ranges", Object{"start_address": startAddress, "end_address": endAddress})
+}
+
+// AddObject stores the object of the path, e.g. ipam/ip-addresses, as it is and returns its ID
+func (srv *Server) AddObject(path string, obj Object) int {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.store(path, copyObject(obj))
+}
+
+// Objects returns a copy of the objects of the path, e.g. ipam/ip-addresses
+func (srv *Server) Objects(path string) []Object {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	var objects []Object
+	for _, obj := range srv.objects[path] {
+		objects = append(objects, copyObject(obj))
+	}
+	return objects
+}
+
+// Fail makes the next count requests of the method for the path, e.g. extras/tags, fail with the status
+func (srv *Server) Fail(method, path string, status, count int) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	srv.failures = append(srv.failures, failure{method: method, path: path, status: status, count: count})
+}
+
+func (srv *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Token "+srv.token {
+		writeError(w, &apiError{http.StatusForbidden, Object{"detail": "Invalid token"}})
+		return
+	}
+	// The path is /api/<app>/<model>/, /api/<app>/<model>/<id>/ or /api/<app>/<model>/<id>/available-ips/
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/"), "/")
+	if len(parts) < 2 {
+		writeError(w, &apiError{http.StatusNotFound, Object{"detail": "Not found."}})
+		return
+	}
+	path := parts[0] + "/" + parts[1]
+	id := 0
+	if len(parts) > 2 {
+		var err error
+		if id, err = strconv.Atoi(parts[2]); err != nil {
+			writeError(w, &apiError{http.StatusNotFound, Object{"detail": "Not found."}})
+			return
+		}
+	}
+	var body Object
+	data, _ := ioutil.ReadAll(r.Body)
+	if len(bytes.TrimSpace(data)) != 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			writeError(w, &apiError{http.StatusBadRequest, Object{"detail": "JSON parse error - " + err.Error()}})
+			return
+		}
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	if status := srv.popFailure(r.Method, path); status != 0 {
+		writeError(w, &apiError{status, Object{"detail": "Injected failure"}})
+		return
+	}
+	var res interface{}
+	var apiErr *apiError
+	status := http.StatusOK
+	switch {
+	case len(parts) == 4 && parts[3] == "available-ips" && r.Method == http.MethodPost:
+		res, apiErr = srv.allocate(path, id, body)
+		status = http.StatusCreated
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		res, apiErr = srv.list(path, r)
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		res, apiErr = srv.create(path, body)
+		status = http.StatusCreated
+	case len(parts) == 3 && r.Method == http.MethodGet:
+		if res = srv.find(path, id); res == nil {
+			apiErr = &apiError{http.StatusNotFound, Object{"detail": "Not found."}}
+		}
+	case len(parts) == 3 && r.Method == http.MethodDelete:
+		apiErr = srv.delete(path, id)
+		status = http.StatusNoContent
+	default:
+		apiErr = &apiError{http.StatusMethodNotAllowed, Object{"detail": fmt.Sprintf("Method \"%s\" not allowed.", r.Method)}}
+	}
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if status != http.StatusNoContent {
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
+
+// list returns a page of the objects of the path that match the filters of the query
+func (srv *Server) list(path string, r *http.Request) (interface{}, *apiError) {
+	query := r.URL.Query()
+	var results []Object
+	for _, obj := range srv.objects[path] {
+		if matches(obj, query) {
+			results = append(results, obj)
+		}
+	}
+	count := len(results)
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	if offset > len(results) {
+		offset = len(results)
+	}
+	results = results[offset:]
+	var next interface{}
+	if len(results) > limit {
+		results = results[:limit]
+		nextQuery := r.URL.Query()
+		nextQuery.Set("offset", strconv.Itoa(offset+limit))
+		next = srv.URL + r.URL.Path + "?" + nextQuery.Encode()
+	}
+	if results == nil {
+		results = []Object{}
+	}
+	return Object{"count": count, "next": next, "previous": nil, "results": results}, nil
+}
+
+// create stores the object of the body, the IP addresses of the tags that do not exist are rejected
+func (srv *Server) create(path string, obj Object) (interface{}, *apiError) {
+	if obj == nil {
+		obj = Object{}
+	}
+	delete(obj, "id")
+	switch path {
+	case "extras/tags":
+		for _, field := range []string{"name", "slug"} {
+			if str(obj[field]) == "" {
+				return nil, &apiError{http.StatusBadRequest, Object{field: []string{"This field is required."}}}
+			}
+			if srv.findBy(path, field, str(obj[field])) != nil {
+				return nil, &apiError{http.StatusBadRequest,
+					Object{field: []string{fmt.Sprintf("tag with this %s already exists.", field)}}}
+			}
+		}
+	case "ipam/ip-addresses":
+		ip, _, err := net.ParseCIDR(str(obj["address"]))
+		if err != nil {
+			return nil, &apiError{http.StatusBadRequest, Object{"address": []string{"Enter a valid IPv4 or IPv6 address with CIDR mask."}}}
+		}
+		if srv.isUsed(ip) {
+			return nil, &apiError{http.StatusBadRequest,
+				Object{"address": []string{fmt.Sprintf("Duplicate IP address found in global table: %s", obj["address"])}}}
+		}
+		if apiErr := srv.resolveTags(obj); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+	srv.store(path, obj)
+	return obj, nil
+}
+
+// allocate creates an IP address of the body with the first available IP address of the prefix or IP range
+func (srv *Server) allocate(path string, id int, obj Object) (interface{}, *apiError) {
+	parent := srv.find(path, id)
+	if parent == nil || (path != "ipam/prefixes" && path != "ipam/ip-ranges") {
+		return nil, &apiError{http.StatusNotFound, Object{"detail": "Not found."}}
+	}
+	var first, last net.IP
+	var prefixLength string
+	if path == "ipam/prefixes" {
+		_, network, err := net.ParseCIDR(str(parent["prefix"]))
+		if err != nil {
+			return nil, &apiError{http.StatusInternalServerError, Object{"detail": err.Error()}}
+		}
+		first, last = hostBounds(network)
+		prefixLength = strings.Split(str(parent["prefix"]), "/")[1]
+	} else {
+		start, network, err := net.ParseCIDR(str(parent["start_address"]))
+		end, _, err2 := net.ParseCIDR(str(parent["end_address"]))
+		if err != nil || err2 != nil {
+			return nil, &apiError{http.StatusInternalServerError, Object{"detail": "invalid IP range"}}
+		}
+		first, last = start.To16(), end.To16()
+		ones, _ := network.Mask.Size()
+		prefixLength = strconv.Itoa(ones)
+	}
+	if obj == nil {
+		obj = Object{}
+	}
+	for ip := first; bytes.Compare(ip, last) <= 0; ip = nextIP(ip) {
+		if srv.isUsed(ip) {
+			if ip.Equal(last) {
+				break
+			}
+			continue
+		}
+		obj["address"] = ip.String() + "/" + prefixLength
+		return srv.create("ipam/ip-addresses", obj)
+	}
+	return nil, &apiError{http.StatusConflict, Object{
+		"detail": "An insufficient number of IP addresses are available within " + srv.parentName(path, parent) + " (1 requested, 0 available)",
+	}}
+}
+
+func (srv *Server) parentName(path string, parent Object) string {
+	if path == "ipam/prefixes" {
+		return "prefix " + str(parent["prefix"])
+	}
+	return "IP range " + str(parent["start_address"]) + "-" + str(parent["end_address"])
+}
+
+// resolveTags replaces the tags of the object, referred to by their slug or name, with the tags
+func (srv *Server) resolveTags(obj Object) *apiError {
+	refs, _ := obj["tags"].([]interface{})
+	var tags []interface{}
+	for _, item := range refs {
+		ref, _ := item.(map[string]interface{})
+		var tag Object
+		switch {
+		case str(ref["slug"]) != "":
+			tag = srv.findBy("extras/tags", "slug", str(ref["slug"]))
+		case str(ref["name"]) != "":
+			tag = srv.findBy("extras/tags", "name", str(ref["name"]))
+		}
+		if tag == nil {
+			return &apiError{http.StatusBadRequest, Object{"tags": []string{
+				fmt.Sprintf("Related object not found using the provided attributes: %v", ref)}}}
+		}
+		tags = append(tags, map[string]interface{}{"id": tag["id"], "name": tag["name"], "slug": tag["slug"]})
+	}
+	obj["tags"] = tags
+	if status := str(obj["status"]); status != "" {
+		obj["status"] = map[string]interface{}{"value": status, "label": strings.ToUpper(status[:1]) + status[1:]}
+	}
+	return nil
+}
+
+// isUsed checks whether an IP address object holds the IP address
+func (srv *Server) isUsed(ip net.IP) bool {
+	for _, obj := range srv.objects["ipam/ip-addresses"] {
+		if addr, _, err := net.ParseCIDR(str(obj["address"])); err == nil && addr.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (srv *Server) delete(path string, id int) *apiError {
+	objects := srv.objects[path]
+	for i := range objects {
+		if objects[i]["id"] == float64(id) {
+			srv.objects[path] = append(objects[:i], objects[i+1:]...)
+			return nil
+		}
+	}
+	return &apiError{http.StatusNotFound, Object{"detail": "Not found."}}
+}
+
+// store assigns an ID and a URL to the object and stores it
+func (srv *Server) store(path string, obj Object) int {
+	srv.nextID++
+	// The IDs are float64, as they are decoded from JSON
+	obj["id"] = float64(srv.nextID)
+	obj["url"] = fmt.Sprintf("%s/api/%s/%d/", srv.URL, path, srv.nextID)
+	srv.objects[path] = append(srv.objects[path], obj)
+	return srv.nextID
+}
+
+func (srv *Server) find(path string, id int) Object {
+	for _, obj := range srv.objects[path] {
+		if obj["id"] == float64(id) {
+			return obj
+		}
+	}
+	return nil
+}
+
+func (srv *Server) findBy(path, field, value string) Object {
+	for _, obj := range srv.objects[path] {
+		if str(obj[field]) == value {
+			return obj
+		}
+	}
+	return nil
+}
+
+// matches checks whether the object matches the filters of the query, the addresses match without
+// their prefix length, parent matches the addresses in the prefix and tag matches the slug of a tag
+func matches(obj Object, query map[string][]string) bool {
+	for field, values := range query {
+		value := values[0]
+		switch field {
+		case "limit", "offset", "brief":
+			continue
+		case "tag":
+			if !hasTag(obj, value) {
+				return false
+			}
+		case "parent":
+			ip, _, err := net.ParseCIDR(str(obj["address"]))
+			_, network, err2 := net.ParseCIDR(value)
+			if err != nil || err2 != nil || !network.Contains(ip) {
+				return false
+			}
+		case "address", "start_address", "end_address":
+			if strings.Split(str(obj[field]), "/")[0] != strings.Split(value, "/")[0] {
+				return false
+			}
+		default:
+			if str(obj[field]) != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func hasTag(obj Object, slug string) bool {
+	tags, _ := obj["tags"].([]interface{})
+	for _, item := range tags {
+		if tag, ok := item.(map[string]interface{}); ok && str(tag["slug"]) == slug {
+			return true
+		}
+	}
+	return false
+}
+
+func copyObject(obj Object) Object {
+	data, _ := json.Marshal(obj)
+	var res Object
+	_ = json.Unmarshal(data, &res)
+	return res
+}
+
+func writeError(w http.ResponseWriter, apiErr *apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.status)
+	_ = json.NewEncoder(w).Encode(apiErr.body)
+}
+
+func str(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// hostBounds returns the first and the last host address of the prefix
+func hostBounds(network *net.IPNet) (net.IP, net.IP) {
+	first := network.IP.To16()
+	last := make(net.IP, len(first))
+	mask := network.Mask
+	if len(mask) == net.IPv4len {
+		mask = append(net.CIDRMask(96, 128)[:12], mask...)
+	}
+	for i := range first {
+		last[i] = first[i] | ^mask[i]
+	}
+	ones, bits := network.Mask.Size()
+	switch {
+	case bits-ones <= 1:
+		return first, last
+	case network.IP.To4() != nil:
+		// The network and the broadcast addresses are not available
+		return nextIP(first), prevIP(last)
+	}
+	// The Subnet-Router anycast address is not available
+	return nextIP(first), last
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i]++; next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+func prevIP(ip net.IP) net.IP {
+	prev := make(net.IP, len(ip))
+	copy(prev, ip)
+	for i := len(prev) - 1; i >= 0; i-- {
+		if prev[i]--; prev[i] != 0xff {
+			break
+		}
+	}
+	return prev
+}
+
+// popFailure returns the status of the failure of the request, 0 when it does not fail
+func (srv *Server) popFailure(method, path string) int {
+	for i, f := range srv.failures {
+		if f.method == method && f.path == path {
+			if f.count--; f.count == 0 {
+				srv.failures = append(srv.failures[:i], srv.failures[i+1:]...)
+			} else {
+				srv.failures[i] = f
+			}
+			return f.status
+		}
+	}
+	return 0
+}
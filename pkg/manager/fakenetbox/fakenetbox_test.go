@@ -0,0 +1,212 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fakenetbox_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/fakenetbox"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestFakeNetBox(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fake NetBox Suite")
+}
+
+type resource struct {
+	name, namespace string
+}
+
+func (rsc resource) GetName() string      { return rsc.name }
+func (rsc resource) GetNamespace() string { return rsc.namespace }
+
+var _ = Describe("NetBox provider against the fake NetBox API", func() {
+	var srv *fakenetbox.Server
+	var certDir string
+
+	params := func(labels string) manager.NetBoxParams {
+		return manager.NetBoxParams{
+			URL:        srv.URL,
+			Token:      fakenetbox.DefaultToken,
+			LabelMap:   labels,
+			CACertFile: filepath.Join(certDir, "ca.crt"),
+		}
+	}
+
+	BeforeEach(func() {
+		srv = fakenetbox.NewServer(fakenetbox.Params{})
+		var err error
+		certDir, err = ioutil.TempDir("", "fakenetbox")
+		Expect(err).To(BeNil())
+		Expect(srv.WriteCertificate(filepath.Join(certDir, "ca.crt"))).To(Succeed())
+		srv.AddPrefix("172.16.4.0/29")
+		srv.AddRange("172.16.5.10/24", "172.16.5.11/24")
+	})
+
+	AfterEach(func() {
+		srv.Close()
+		_ = os.RemoveAll(certDir)
+	})
+
+	It("Parses the labels", func() {
+		labels, err := manager.ParseNetBoxLabels(`{"Dev": {"prefix": "172.16.4.0/29"}, "Test": {"range": "172.16.5.10-172.16.5.11"}}`)
+		Expect(err).To(BeNil())
+		Expect(labels).To(HaveKeyWithValue("Dev", manager.NBConfig{Prefix: "172.16.4.0/29"}))
+		_, err = manager.ParseNetBoxLabels(`{"Dev": {"prefix": "172.16.4.0/29", "range": "172.16.5.10-172.16.5.11"}}`)
+		Expect(err).To(MatchError("exactly one of prefix and range is required for label Dev"))
+		_, err = manager.ParseNetBoxLabels(`{"Dev": {"prefix": "172.16.4.0"}}`)
+		Expect(err).To(MatchError("invalid prefix 172.16.4.0 for label Dev"))
+		_, err = manager.ParseNetBoxLabels(`{"Dev": {"range": "172.16.5.10"}}`)
+		Expect(err).To(MatchError("invalid range 172.16.5.10 for label Dev"))
+	})
+
+	It("Connects with the token and creates the tag", func() {
+		_, err := manager.NewNetBoxManager(params(`{"Dev": {"prefix": "172.16.4.0/29"}}`))
+		Expect(err).To(BeNil())
+		Expect(srv.Objects("extras/tags")).To(ConsistOf(HaveKeyWithValue("slug", manager.NetBoxTag)))
+
+		// The tag that exists is not created again
+		_, err = manager.NewNetBoxManager(params(`{"Dev": {"prefix": "172.16.4.0/29"}}`))
+		Expect(err).To(BeNil())
+		Expect(srv.Objects("extras/tags")).To(HaveLen(1))
+
+		nbParams := params(`{"Dev": {"prefix": "172.16.4.0/29"}}`)
+		nbParams.Token = "wrong"
+		_, err = manager.NewNetBoxManager(nbParams)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("403"))
+
+		_, err = manager.NewNetBoxManager(params(`{"Dev": {"prefix": "172.16.6.0/24"}}`))
+		Expect(err).To(MatchError("found 0 prefixes 172.16.6.0/24, expected one for label Dev"))
+	})
+
+	It("Starts while NetBox is unavailable and fails at once on the errors of the configuration", func() {
+		nbParams := params(`{"Dev": {"prefix": "172.16.4.0/29"}}`)
+		nbParams.RetryConnect = true
+		srv.Fail(http.MethodGet, "extras/tags", http.StatusServiceUnavailable, 1)
+		nbMgr, err := manager.NewNetBoxManager(nbParams)
+		Expect(err).To(BeNil())
+		Expect(nbMgr.IsReady()).To(BeFalse())
+		Expect(nbMgr.AllocateNextIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Dev"})).To(BeEmpty())
+
+		nbParams.Token = "wrong"
+		_, err = manager.NewNetBoxManager(nbParams)
+		Expect(err).To(HaveOccurred())
+		nbParams = params(`{"Dev": {"prefix": "172.16.6.0/24"}}`)
+		nbParams.RetryConnect = true
+		_, err = manager.NewNetBoxManager(nbParams)
+		Expect(err).To(MatchError("found 0 prefixes 172.16.6.0/24, expected one for label Dev"))
+
+		nbMgr, err = manager.NewNetBoxManager(params(`{"Dev": {"prefix": "172.16.4.0/29"}}`))
+		Expect(err).To(BeNil())
+		Expect(nbMgr.IsReady()).To(BeTrue())
+	})
+
+	It("Allocates, looks up and releases IP addresses of a prefix", func() {
+		nbMgr, err := manager.NewNetBoxManager(params(`{"Dev": {"prefix": "172.16.4.0/29"}}`))
+		Expect(err).To(BeNil())
+
+		req := ipamspec.IPAMRequest{
+			HostName:  "foo.com",
+			IPAMLabel: "Dev",
+			Metadata:  resource{name: "foo", namespace: "default"},
+		}
+		Expect(nbMgr.AllocateNextIPAddress(req)).To(Equal("172.16.4.1"))
+		addrs := srv.Objects("ipam/ip-addresses")
+		Expect(addrs).To(HaveLen(1))
+		Expect(addrs[0]).To(HaveKeyWithValue("address", "172.16.4.1/29"))
+		Expect(addrs[0]).To(HaveKeyWithValue("dns_name", "foo.com"))
+		Expect(addrs[0]).To(HaveKeyWithValue("description", "foo.com"))
+		Expect(addrs[0]).To(HaveKeyWithValue("comments", "Allocated by the F5 IPAM Controller to default/foo"))
+
+		Expect(nbMgr.GetIPAddress(req)).To(Equal("172.16.4.1"))
+		keyReq := ipamspec.IPAMRequest{Key: "default/bar_svc", IPAMLabel: "Dev"}
+		Expect(nbMgr.GetIPAddress(keyReq)).To(BeEmpty())
+		Expect(nbMgr.AllocateNextIPAddress(keyReq)).To(Equal("172.16.4.2"))
+		Expect(nbMgr.GetIPAddress(keyReq)).To(Equal("172.16.4.2"))
+		Expect(nbMgr.GetAllocations("Dev")).To(Equal([]manager.Allocation{
+			{IPAMLabel: "Dev", IPAddr: "172.16.4.1", Reference: "foo.com", HostName: true},
+			{IPAMLabel: "Dev", IPAddr: "172.16.4.2", Reference: "default/bar_svc"},
+		}))
+
+		// The IP addresses that FIC did not create are neither found nor released
+		srv.AddObject("ipam/ip-addresses", fakenetbox.Object{"address": "172.16.4.3/29", "description": "baz.com"})
+		Expect(nbMgr.GetIPAddress(ipamspec.IPAMRequest{HostName: "baz.com", IPAMLabel: "Dev"})).To(BeEmpty())
+		nbMgr.ReleaseIPAddress(ipamspec.IPAMRequest{IPAddr: "172.16.4.3", IPAMLabel: "Dev"})
+		Expect(srv.Objects("ipam/ip-addresses")).To(HaveLen(3))
+		Expect(nbMgr.ReserveIPAddress(ipamspec.IPAMRequest{HostName: "baz.com", IPAddr: "172.16.4.3", IPAMLabel: "Dev"})).To(BeFalse())
+
+		nbMgr.ReleaseIPAddress(ipamspec.IPAMRequest{IPAddr: "172.16.4.1", IPAMLabel: "Dev"})
+		Expect(srv.Objects("ipam/ip-addresses")).To(HaveLen(2))
+		Expect(nbMgr.GetIPAddress(req)).To(BeEmpty())
+
+		// The released IP address is reserved again, then the prefix is full
+		Expect(nbMgr.ReserveIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAddr: "172.16.4.1", IPAMLabel: "Dev"})).To(BeTrue())
+		Expect(nbMgr.GetIPAddress(req)).To(Equal("172.16.4.1"))
+		Expect(nbMgr.ReserveIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAddr: "172.16.5.1", IPAMLabel: "Dev"})).To(BeFalse())
+		for i := 4; i <= 6; i++ {
+			req.HostName = fmt.Sprintf("host%d.com", i)
+			Expect(nbMgr.AllocateNextIPAddress(req)).To(Equal(fmt.Sprintf("172.16.4.%d", i)))
+		}
+		req.HostName = "full.com"
+		Expect(nbMgr.AllocateNextIPAddress(req)).To(BeEmpty())
+		Expect(nbMgr.GetLabelUsage()).To(Equal([]manager.LabelUsage{
+			{IPAMLabel: "Dev", Range: "172.16.4.0/29", Total: 6, Allocated: 5},
+		}))
+	})
+
+	It("Allocates the IP addresses of an IP range", func() {
+		nbMgr, err := manager.NewNetBoxManager(params(`{"Test": {"range": "172.16.5.10-172.16.5.11"}}`))
+		Expect(err).To(BeNil())
+		req := ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Test"}
+		Expect(nbMgr.AllocateNextIPAddress(req)).To(Equal("172.16.5.10"))
+		Expect(srv.Objects("ipam/ip-addresses")[0]).To(HaveKeyWithValue("address", "172.16.5.10/24"))
+		Expect(nbMgr.ReserveIPAddress(ipamspec.IPAMRequest{HostName: "bar.com", IPAddr: "172.16.5.11", IPAMLabel: "Test"})).To(BeTrue())
+		Expect(srv.Objects("ipam/ip-addresses")[1]).To(HaveKeyWithValue("address", "172.16.5.11/24"))
+		req.HostName = "full.com"
+		Expect(nbMgr.AllocateNextIPAddress(req)).To(BeEmpty())
+		Expect(nbMgr.GetAllocations("")).To(HaveLen(2))
+	})
+
+	It("Lists more IP addresses than a page", func() {
+		srv.AddPrefix("10.1.0.0/16")
+		nbMgr, err := manager.NewNetBoxManager(params(`{"Big": {"prefix": "10.1.0.0/16"}}`))
+		Expect(err).To(BeNil())
+		tag := map[string]interface{}{"slug": manager.NetBoxTag, "name": manager.NetBoxTag}
+		for i := 0; i < 1200; i++ {
+			srv.AddObject("ipam/ip-addresses", fakenetbox.Object{
+				"address":     fmt.Sprintf("10.1.%d.%d/16", i/250, i%250+1),
+				"description": fmt.Sprintf("host%d.com", i),
+				"tags":        []interface{}{tag},
+			})
+		}
+		allocations := nbMgr.GetAllocations("Big")
+		Expect(allocations).To(HaveLen(1200))
+		// The allocations are in the order of their IP addresses
+		Expect(allocations[1].IPAddr).To(Equal("10.1.0.2"))
+		Expect(allocations[1199].IPAddr).To(Equal("10.1.4.200"))
+	})
+})
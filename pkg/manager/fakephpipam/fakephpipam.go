@@ -0,0 +1,425 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fakephpipam is a fake phpIPAM REST API on httptest, to test the phpIPAM provider without phpIPAM
+package fakephpipam
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultAppID is the API application that the server accepts when Params has none
+	DefaultAppID = "fic"
+	// DefaultUsername and DefaultPassword are the credentials that the server accepts when Params has none
+	DefaultUsername = "admin"
+	DefaultPassword = "ipamadmin"
+)
+
+// Object is a phpIPAM object by its JSON fields, phpIPAM sends the IDs as strings
+type Object map[string]interface{}
+
+// Params defines the parameters of the fake phpIPAM API
+type Params struct {
+	AppID    string
+	Username string
+	Password string
+}
+
+// Server is a fake phpIPAM API that holds the subnets and addresses in memory. It implements the
+// authentication with tokens, the first free address of the subnets, the searches of the addresses
+// and the response envelope of phpIPAM
+type Server struct {
+	*httptest.Server
+	appID    string
+	username string
+	password string
+
+	mutex    sync.Mutex
+	tokens   map[string]bool
+	logins   int
+	objects  map[string][]Object
+	nextID   int
+	failures []failure
+}
+
+// failure makes the next count requests of the method to the controller fail with the code
+type failure struct {
+	method     string
+	controller string
+	code       int
+	count      int
+}
+
+// apiError is an error response of phpIPAM
+type apiError struct {
+	code    int
+	message string
+}
+
+func NewServer(params Params) *Server {
+	srv := &Server{
+		appID:    params.AppID,
+		username: params.Username,
+		password: params.Password,
+		tokens:   make(map[string]bool),
+		objects:  make(map[string][]Object),
+	}
+	if srv.appID == "" {
+		srv.appID = DefaultAppID
+	}
+	if srv.username == "" {
+		srv.username = DefaultUsername
+	}
+	if srv.password == "" {
+		srv.password = DefaultPassword
+	}
+	srv.Server = httptest.NewTLSServer(http.HandlerFunc(srv.serveAPI))
+	return srv
+}
+
+// WriteCertificate writes the certificate of the server in PEM to the file, to verify the server with it
+func (srv *Server) WriteCertificate(filename string) error {
+	var buf bytes.Buffer
+	if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0600)
+}
+
+// AddSubnet adds the subnet, e.g. 10.1.0.0/24, and returns its ID
+func (srv *Server) AddSubnet(cidr string) int {
+	parts := strings.Split(cidr, "/")
+	return srv.AddObject("subnets", Object{"subnet": parts[0], "mask": parts[1]})
+}
+
+// AddObject stores the object of the controller, subnets or addresses, as it is and returns its ID
+func (srv *Server) AddObject(controller string, obj Object) int {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.store(controller, copyObject(obj))
+}
+
+// Objects returns a copy of the objects of the controller, subnets or addresses
+func (srv *Server) Objects(controller string) []Object {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	var objects []Object
+	for _, obj := range srv.objects[controller] {
+		objects = append(objects, copyObject(obj))
+	}
+	return objects
+}
+
+// ExpireTokens expires the tokens that the server issued, as phpIPAM does after a while without requests
+func (srv *Server) ExpireTokens() {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	srv.tokens = make(map[string]bool)
+}
+
+// Logins returns the number of successful authentications
+func (srv *Server) Logins() int {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.logins
+}
+
+// SetCredentials changes the username and password that the server accepts, the tokens that it issued stay valid
+func (srv *Server) SetCredentials(username, password string) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	srv.username = username
+	srv.password = password
+}
+
+// Fail makes the next count requests of the method to the controller, e.g. user or subnets, fail with the code
+func (srv *Server) Fail(method, controller string, code, count int) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	srv.failures = append(srv.failures, failure{method: method, controller: controller, code: code, count: count})
+}
+
+func (srv *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	// The path is /api/<app>/<controller>/ followed by the ID or the method of the controller, the
+	// arguments may hold encoded slashes
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i := range parts {
+		parts[i], _ = url.PathUnescape(parts[i])
+	}
+	if len(parts) < 3 || parts[0] != "api" {
+		writeResponse(w, nil, &apiError{http.StatusBadRequest, "Invalid request"}, "")
+		return
+	}
+	if parts[1] != srv.appID {
+		writeResponse(w, nil, &apiError{http.StatusBadRequest, "Invalid application id"}, "")
+		return
+	}
+	controller, args := parts[2], parts[3:]
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	if code := srv.popFailure(r.Method, controller); code != 0 {
+		writeResponse(w, nil, &apiError{code, "Injected failure"}, "")
+		return
+	}
+	if controller == "user" && r.Method == http.MethodPost {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != srv.username || password != srv.password {
+			writeResponse(w, nil, &apiError{http.StatusInternalServerError, "Invalid username or password"}, "")
+			return
+		}
+		srv.logins++
+		token := fmt.Sprintf("token%d", srv.logins)
+		srv.tokens[token] = true
+		writeResponse(w, Object{"token": token, "expires": "2099-01-01 00:00:00"}, nil, "")
+		return
+	}
+	if token := r.Header.Get("token"); token == "" || !srv.tokens[token] {
+		writeResponse(w, nil, &apiError{http.StatusForbidden, "Token invalid"}, "")
+		return
+	}
+	var body Object
+	data, _ := ioutil.ReadAll(r.Body)
+	if len(bytes.TrimSpace(data)) != 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			writeResponse(w, nil, &apiError{http.StatusBadRequest, "Invalid JSON"}, "")
+			return
+		}
+	}
+
+	var res interface{}
+	var apiErr *apiError
+	var id string
+	switch {
+	case controller == "subnets" && len(args) == 1 && r.Method == http.MethodGet:
+		if subnet := srv.find("subnets", args[0]); subnet != nil {
+			res = subnet
+		} else {
+			apiErr = &apiError{http.StatusNotFound, "Invalid Id"}
+		}
+	case controller == "subnets" && len(args) == 2 && args[1] == "addresses" && r.Method == http.MethodGet:
+		res, apiErr = srv.search("subnetId", args[0], "No addresses found")
+	case controller == "addresses" && len(args) == 2 && args[0] == "first_free" && r.Method == http.MethodPost:
+		res, id, apiErr = srv.firstFree(args[1], body)
+	case controller == "addresses" && len(args) == 0 && r.Method == http.MethodPost:
+		id, apiErr = srv.create(body)
+	case controller == "addresses" && len(args) == 2 && args[0] == "search_hostname" && r.Method == http.MethodGet:
+		res, apiErr = srv.search("hostname", args[1], "Address not found")
+	case controller == "addresses" && len(args) == 2 && args[0] == "search" && r.Method == http.MethodGet:
+		res, apiErr = srv.search("ip", args[1], "Address not found")
+	case controller == "addresses" && len(args) == 1 && r.Method == http.MethodDelete:
+		apiErr = srv.delete(args[0])
+	default:
+		apiErr = &apiError{http.StatusBadRequest, "Invalid method"}
+	}
+	writeResponse(w, res, apiErr, id)
+}
+
+// popFailure returns the code of the failure of the request, 0 when it does not fail
+func (srv *Server) popFailure(method, controller string) int {
+	for i, f := range srv.failures {
+		if f.method == method && f.controller == controller {
+			if f.count--; f.count == 0 {
+				srv.failures = append(srv.failures[:i], srv.failures[i+1:]...)
+			} else {
+				srv.failures[i] = f
+			}
+			return f.code
+		}
+	}
+	return 0
+}
+
+// search returns the addresses with the value of the field, phpIPAM answers not found when there are none
+func (srv *Server) search(field, value, notFound string) (interface{}, *apiError) {
+	var addrs []Object
+	for _, obj := range srv.objects["addresses"] {
+		if str(obj[field]) == value {
+			addrs = append(addrs, obj)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, &apiError{http.StatusNotFound, notFound}
+	}
+	return addrs, nil
+}
+
+// firstFree creates an address of the body with the first free address of the subnet
+func (srv *Server) firstFree(subnetID string, obj Object) (interface{}, string, *apiError) {
+	subnet := srv.find("subnets", subnetID)
+	if subnet == nil {
+		return nil, "", &apiError{http.StatusNotFound, "Invalid subnet Id"}
+	}
+	_, network, err := net.ParseCIDR(str(subnet["subnet"]) + "/" + str(subnet["mask"]))
+	if err != nil {
+		return nil, "", &apiError{http.StatusInternalServerError, err.Error()}
+	}
+	first, last := hostBounds(network)
+	for ip := first; bytes.Compare(ip, last) <= 0; ip = nextIP(ip) {
+		if srv.isUsed(ip.String()) {
+			if ip.Equal(last) {
+				break
+			}
+			continue
+		}
+		if obj == nil {
+			obj = Object{}
+		}
+		obj["subnetId"] = subnetID
+		obj["ip"] = ip.String()
+		id, apiErr := srv.create(obj)
+		return ip.String(), id, apiErr
+	}
+	return nil, "", &apiError{http.StatusNotFound, "No free addresses found"}
+}
+
+// create stores the address of the body, the addresses that exist are rejected
+func (srv *Server) create(obj Object) (string, *apiError) {
+	if obj == nil || str(obj["subnetId"]) == "" || str(obj["ip"]) == "" {
+		return "", &apiError{http.StatusBadRequest, "Subnet ID and IP address are required"}
+	}
+	delete(obj, "id")
+	subnet := srv.find("subnets", str(obj["subnetId"]))
+	if subnet == nil {
+		return "", &apiError{http.StatusNotFound, "Invalid subnet Id"}
+	}
+	_, network, _ := net.ParseCIDR(str(subnet["subnet"]) + "/" + str(subnet["mask"]))
+	ip := net.ParseIP(str(obj["ip"]))
+	if ip == nil || network == nil || !network.Contains(ip) {
+		return "", &apiError{http.StatusBadRequest, "IP address not in selected subnet"}
+	}
+	if srv.isUsed(ip.String()) {
+		return "", &apiError{http.StatusConflict, "IP address already exists"}
+	}
+	return strconv.Itoa(srv.store("addresses", obj)), nil
+}
+
+func (srv *Server) delete(id string) *apiError {
+	objects := srv.objects["addresses"]
+	for i := range objects {
+		if str(objects[i]["id"]) == id {
+			srv.objects["addresses"] = append(objects[:i], objects[i+1:]...)
+			return nil
+		}
+	}
+	return &apiError{http.StatusNotFound, "Address does not exist"}
+}
+
+func (srv *Server) isUsed(ip string) bool {
+	for _, obj := range srv.objects["addresses"] {
+		if str(obj["ip"]) == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// store assigns an ID to the object and stores it, the IDs and the subnet IDs are strings as in phpIPAM
+func (srv *Server) store(controller string, obj Object) int {
+	srv.nextID++
+	obj["id"] = strconv.Itoa(srv.nextID)
+	if subnetID, ok := obj["subnetId"]; ok {
+		obj["subnetId"] = str(subnetID)
+	}
+	srv.objects[controller] = append(srv.objects[controller], obj)
+	return srv.nextID
+}
+
+func (srv *Server) find(controller, id string) Object {
+	for _, obj := range srv.objects[controller] {
+		if str(obj["id"]) == id {
+			return obj
+		}
+	}
+	return nil
+}
+
+// writeResponse writes the envelope of phpIPAM with the data, or the error
+func writeResponse(w http.ResponseWriter, data interface{}, apiErr *apiError, id string) {
+	envelope := Object{"code": http.StatusOK, "success": true, "data": data, "time": 0.01}
+	if apiErr != nil {
+		envelope = Object{"code": apiErr.code, "success": false, "message": apiErr.message, "time": 0.01}
+	} else if id != "" {
+		envelope["code"] = http.StatusCreated
+		envelope["id"] = id
+		envelope["message"] = "Address created"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(envelope["code"].(int))
+	_ = json.NewEncoder(w).Encode(envelope)
+}
+
+func copyObject(obj Object) Object {
+	data, _ := json.Marshal(obj)
+	var res Object
+	_ = json.Unmarshal(data, &res)
+	return res
+}
+
+func str(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// hostBounds returns the first and the last host address of the subnet
+func hostBounds(network *net.IPNet) (net.IP, net.IP) {
+	first := network.IP.To4()
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^network.Mask[i]
+	}
+	if ones, bits := network.Mask.Size(); bits-ones <= 1 {
+		return first, last
+	}
+	// The network and the broadcast addresses are not available
+	return nextIP(first), prevIP(last)
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i]++; next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+func prevIP(ip net.IP) net.IP {
+	prev := make(net.IP, len(ip))
+	copy(prev, ip)
+	for i := len(prev) - 1; i >= 0; i-- {
+		if prev[i]--; prev[i] != 0xff {
+			break
+		}
+	}
+	return prev
+}
@@ -0,0 +1,239 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fakephpipam_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/fakephpipam"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestFakePhpIPAM(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fake phpIPAM Suite")
+}
+
+type resource struct {
+	name, namespace string
+}
+
+func (rsc resource) GetName() string      { return rsc.name }
+func (rsc resource) GetNamespace() string { return rsc.namespace }
+
+var _ = Describe("phpIPAM provider against the fake phpIPAM API", func() {
+	var srv *fakephpipam.Server
+	var certDir string
+	var devID, testID int
+
+	params := func(labels string) manager.PhpIPAMParams {
+		return manager.PhpIPAMParams{
+			URL:        srv.URL,
+			AppID:      fakephpipam.DefaultAppID,
+			Username:   fakephpipam.DefaultUsername,
+			Password:   fakephpipam.DefaultPassword,
+			LabelMap:   labels,
+			CACertFile: filepath.Join(certDir, "ca.crt"),
+		}
+	}
+
+	BeforeEach(func() {
+		srv = fakephpipam.NewServer(fakephpipam.Params{})
+		var err error
+		certDir, err = ioutil.TempDir("", "fakephpipam")
+		Expect(err).To(BeNil())
+		Expect(srv.WriteCertificate(filepath.Join(certDir, "ca.crt"))).To(Succeed())
+		devID = srv.AddSubnet("172.16.4.0/29")
+		testID = srv.AddSubnet("172.16.5.0/30")
+	})
+
+	AfterEach(func() {
+		srv.Close()
+		_ = os.RemoveAll(certDir)
+	})
+
+	It("Parses the labels", func() {
+		labels, err := manager.ParsePhpIPAMLabels(`{"Dev": {"subnetId": 7}}`)
+		Expect(err).To(BeNil())
+		Expect(labels).To(HaveKeyWithValue("Dev", manager.PIConfig{SubnetID: 7}))
+		_, err = manager.ParsePhpIPAMLabels(`{"Dev": {}}`)
+		Expect(err).To(MatchError("subnetId is required for label Dev"))
+		_, err = manager.ParsePhpIPAMLabels(`{"Dev": {"subnetId": "7"}}`)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Authenticates and finds the subnets", func() {
+		_, err := manager.NewPhpIPAMManager(params(fmt.Sprintf(`{"Dev": {"subnetId": %d}}`, devID)))
+		Expect(err).To(BeNil())
+		Expect(srv.Logins()).To(Equal(1))
+
+		piParams := params(fmt.Sprintf(`{"Dev": {"subnetId": %d}}`, devID))
+		piParams.Password = "wrong"
+		_, err = manager.NewPhpIPAMManager(piParams)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Invalid username or password"))
+
+		_, err = manager.NewPhpIPAMManager(params(`{"Dev": {"subnetId": 99}}`))
+		Expect(err).To(MatchError("phpIPAM request error: GET /api/fic/subnets/99/: 404 Invalid Id for label Dev"))
+	})
+
+	It("Starts while phpIPAM is unavailable and fails at once on the errors of the configuration", func() {
+		piParams := params(fmt.Sprintf(`{"Dev": {"subnetId": %d}}`, devID))
+		piParams.RetryConnect = true
+		srv.Fail(http.MethodPost, "user", http.StatusServiceUnavailable, 1)
+		piMgr, err := manager.NewPhpIPAMManager(piParams)
+		Expect(err).To(BeNil())
+		Expect(piMgr.IsReady()).To(BeFalse())
+		Expect(piMgr.AllocateNextIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Dev"})).To(BeEmpty())
+		Expect(piMgr.ReserveIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAddr: "172.16.4.1", IPAMLabel: "Dev"})).To(BeFalse())
+		// The range of the label is checked once the subnet is found
+		Expect(piMgr.ValidateRequest(ipamspec.IPAMRequest{IPAddr: "10.0.0.1", IPAMLabel: "Dev"})).To(Succeed())
+		Expect(piMgr.ValidateRequest(ipamspec.IPAMRequest{IPAddr: "10.0.0", IPAMLabel: "Dev"})).To(HaveOccurred())
+
+		// phpIPAM rejects the username and password with 500, which is not retried
+		piParams.Password = "wrong"
+		_, err = manager.NewPhpIPAMManager(piParams)
+		Expect(err).To(HaveOccurred())
+		piParams = params(`{"Dev": {"subnetId": 99}}`)
+		piParams.RetryConnect = true
+		_, err = manager.NewPhpIPAMManager(piParams)
+		Expect(err).To(MatchError("phpIPAM request error: GET /api/fic/subnets/99/: 404 Invalid Id for label Dev"))
+
+		piMgr, err = manager.NewPhpIPAMManager(params(fmt.Sprintf(`{"Dev": {"subnetId": %d}}`, devID)))
+		Expect(err).To(BeNil())
+		Expect(piMgr.IsReady()).To(BeTrue())
+		Expect(piMgr.ValidateRequest(ipamspec.IPAMRequest{IPAddr: "10.0.0.1", IPAMLabel: "Dev"})).To(HaveOccurred())
+	})
+
+	It("Authenticates with the changed credentials", func() {
+		piMgr, err := manager.NewPhpIPAMManager(params(fmt.Sprintf(`{"Dev": {"subnetId": %d}}`, devID)))
+		Expect(err).To(BeNil())
+		addr, err := url.Parse(srv.URL)
+		Expect(err).To(BeNil())
+		creds := manager.GridParams{
+			Host:     addr.Hostname(),
+			Port:     addr.Port(),
+			Username: fakephpipam.DefaultUsername,
+			Password: "changed",
+		}
+
+		// The current client is kept when phpIPAM does not accept the credentials
+		Expect(piMgr.UpdateCredentials(manager.DefaultGrid, creds)).NotTo(Succeed())
+		srv.SetCredentials(fakephpipam.DefaultUsername, "changed")
+		Expect(piMgr.AllocateNextIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Dev"})).To(Equal("172.16.4.1"))
+
+		// The credentials of the other grids belong to Infoblox
+		Expect(piMgr.UpdateCredentials("lab", manager.GridParams{})).To(Succeed())
+		Expect(piMgr.UpdateCredentials("", creds)).To(Succeed())
+		srv.ExpireTokens()
+		Expect(piMgr.AllocateNextIPAddress(ipamspec.IPAMRequest{HostName: "bar.com", IPAMLabel: "Dev"})).To(Equal("172.16.4.2"))
+		Expect(srv.Logins()).To(Equal(3))
+	})
+
+	It("Sorts the allocations by IP address", func() {
+		wideID := srv.AddSubnet("172.16.8.0/24")
+		piMgr, err := manager.NewPhpIPAMManager(params(fmt.Sprintf(`{"Wide": {"subnetId": %d}}`, wideID)))
+		Expect(err).To(BeNil())
+		for _, ip := range []string{"172.16.8.10", "172.16.8.9", "172.16.8.100"} {
+			Expect(piMgr.ReserveIPAddress(ipamspec.IPAMRequest{HostName: ip + ".com", IPAddr: ip, IPAMLabel: "Wide"})).To(BeTrue())
+		}
+		var ips []string
+		for _, alloc := range piMgr.GetAllocations("Wide") {
+			ips = append(ips, alloc.IPAddr)
+		}
+		Expect(ips).To(Equal([]string{"172.16.8.9", "172.16.8.10", "172.16.8.100"}))
+	})
+
+	It("Allocates, looks up and releases IP addresses", func() {
+		piMgr, err := manager.NewPhpIPAMManager(params(fmt.Sprintf(`{"Dev": {"subnetId": %d}}`, devID)))
+		Expect(err).To(BeNil())
+
+		req := ipamspec.IPAMRequest{
+			HostName:  "foo.com",
+			IPAMLabel: "Dev",
+			Metadata:  resource{name: "foo", namespace: "default"},
+		}
+		Expect(piMgr.GetIPAddress(req)).To(BeEmpty())
+		Expect(piMgr.AllocateNextIPAddress(req)).To(Equal("172.16.4.1"))
+		addrs := srv.Objects("addresses")
+		Expect(addrs).To(HaveLen(1))
+		Expect(addrs[0]).To(HaveKeyWithValue("hostname", "foo.com"))
+		Expect(addrs[0]).To(HaveKeyWithValue("owner", manager.PhpIPAMOwner))
+		Expect(addrs[0]).To(HaveKeyWithValue("description", "Allocated by the F5 IPAM Controller to default/foo"))
+		Expect(piMgr.GetIPAddress(req)).To(Equal("172.16.4.1"))
+
+		keyReq := ipamspec.IPAMRequest{Key: "default/bar_svc", IPAMLabel: "Dev"}
+		Expect(piMgr.AllocateNextIPAddress(keyReq)).To(Equal("172.16.4.2"))
+		Expect(piMgr.GetIPAddress(keyReq)).To(Equal("172.16.4.2"))
+		Expect(piMgr.GetAllocations("Dev")).To(Equal([]manager.Allocation{
+			{IPAMLabel: "Dev", IPAddr: "172.16.4.1", Reference: "foo.com", HostName: true},
+			{IPAMLabel: "Dev", IPAddr: "172.16.4.2", Reference: "default/bar_svc"},
+		}))
+
+		// The addresses that FIC did not create are neither found nor released
+		srv.AddObject("addresses", fakephpipam.Object{"subnetId": devID, "ip": "172.16.4.3", "hostname": "baz.com"})
+		Expect(piMgr.GetIPAddress(ipamspec.IPAMRequest{HostName: "baz.com", IPAMLabel: "Dev"})).To(BeEmpty())
+		piMgr.ReleaseIPAddress(ipamspec.IPAMRequest{IPAddr: "172.16.4.3", IPAMLabel: "Dev"})
+		Expect(srv.Objects("addresses")).To(HaveLen(3))
+		Expect(piMgr.ReserveIPAddress(ipamspec.IPAMRequest{HostName: "baz.com", IPAddr: "172.16.4.3", IPAMLabel: "Dev"})).To(BeFalse())
+
+		piMgr.ReleaseIPAddress(ipamspec.IPAMRequest{IPAddr: "172.16.4.1", IPAMLabel: "Dev"})
+		Expect(srv.Objects("addresses")).To(HaveLen(2))
+		Expect(piMgr.GetIPAddress(req)).To(BeEmpty())
+
+		// The released IP address is reserved again, then the subnet is full
+		Expect(piMgr.ReserveIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAddr: "172.16.4.1", IPAMLabel: "Dev"})).To(BeTrue())
+		Expect(piMgr.GetIPAddress(req)).To(Equal("172.16.4.1"))
+		Expect(piMgr.ReserveIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAddr: "172.16.5.1", IPAMLabel: "Dev"})).To(BeFalse())
+		for i := 4; i <= 6; i++ {
+			req.HostName = fmt.Sprintf("host%d.com", i)
+			Expect(piMgr.AllocateNextIPAddress(req)).To(Equal(fmt.Sprintf("172.16.4.%d", i)))
+		}
+		req.HostName = "full.com"
+		Expect(piMgr.AllocateNextIPAddress(req)).To(BeEmpty())
+		Expect(piMgr.GetLabelUsage()).To(Equal([]manager.LabelUsage{
+			{IPAMLabel: "Dev", Range: "172.16.4.0/29", Total: 6, Allocated: 5},
+		}))
+	})
+
+	It("Scopes the addresses to the subnet of the label", func() {
+		piMgr, err := manager.NewPhpIPAMManager(params(fmt.Sprintf(`{"Dev": {"subnetId": %d}, "Test": {"subnetId": %d}}`, devID, testID)))
+		Expect(err).To(BeNil())
+		Expect(piMgr.AllocateNextIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Test"})).To(Equal("172.16.5.1"))
+		Expect(piMgr.GetIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Dev"})).To(BeEmpty())
+		Expect(piMgr.GetIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Test"})).To(Equal("172.16.5.1"))
+		Expect(piMgr.GetAllocations("")).To(HaveLen(1))
+	})
+
+	It("Authenticates again when the token expires", func() {
+		piMgr, err := manager.NewPhpIPAMManager(params(fmt.Sprintf(`{"Dev": {"subnetId": %d}}`, devID)))
+		Expect(err).To(BeNil())
+		srv.ExpireTokens()
+		Expect(piMgr.AllocateNextIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Dev"})).To(Equal("172.16.4.1"))
+		Expect(srv.Logins()).To(Equal(2))
+		Expect(srv.Objects("addresses")).To(HaveLen(1))
+	})
+})
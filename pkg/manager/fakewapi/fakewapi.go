@@ -0,0 +1,780 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fakewapi is a fake Infoblox WAPI server on httptest, to test the Infoblox provider without a grid
+package fakewapi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultUsername and DefaultPassword are the credentials the server accepts when Params has none
+	DefaultUsername = "admin"
+	DefaultPassword = "infoblox"
+	// DefaultView is the network view and the DNS view that the server starts with
+	DefaultView = "default"
+
+	// maxResults is the number of objects that a search returns at most without paging
+	maxResults = 1000
+	// nextAvailableIP is the function that allocates the next available IP address of a network or range
+	nextAvailableIP = "func:nextavailableip:"
+)
+
+// objectTypes are the WAPI objects that the server implements
+var objectTypes = map[string]bool{
+	"userprofile":            true,
+	"extensibleattributedef": true,
+	"networkview":            true,
+	"view":                   true,
+	"network":                true,
+	"networkcontainer":       true,
+	"range":                  true,
+	"ipv6network":            true,
+	"fixedaddress":           true,
+	"ipv6fixedaddress":       true,
+	"record:a":               true,
+	"record:ptr":             true,
+	"record:host":            true,
+}
+
+// Object is a WAPI object by its JSON fields, the extensible attributes are in extattrs as in WAPI
+type Object map[string]interface{}
+
+// Params defines the parameters of the fake WAPI server
+type Params struct {
+	// Username and Password of the basic authentication, DefaultUsername and DefaultPassword when empty
+	Username string
+	Password string
+}
+
+// Server is a fake WAPI server that holds the objects in memory. It implements the searches, including the
+// extensible attribute searches and paging, the next available IP address function and the error bodies of
+// WAPI for the objects that the Infoblox provider uses
+type Server struct {
+	*httptest.Server
+	username string
+	password string
+
+	mutex    sync.Mutex
+	objects  map[string][]Object
+	pages    map[string][]Object
+	nextID   int
+	failures []failure
+	requests map[string]int
+}
+
+// failure makes the next count requests of the method and object type fail with the status
+type failure struct {
+	method  string
+	objType string
+	status  int
+	count   int
+}
+
+// apiError is an error response of WAPI
+type apiError struct {
+	status int
+	name   string
+	text   string
+}
+
+func NewServer(params Params) *Server {
+	srv := &Server{
+		username: params.Username,
+		password: params.Password,
+		objects:  make(map[string][]Object),
+		pages:    make(map[string][]Object),
+		requests: make(map[string]int),
+	}
+	if srv.username == "" {
+		srv.username = DefaultUsername
+	}
+	if srv.password == "" {
+		srv.password = DefaultPassword
+	}
+	srv.AddObject("userprofile", Object{"name": srv.username})
+	srv.AddObject("networkview", Object{"name": DefaultView})
+	srv.AddObject("view", Object{"name": DefaultView, "network_view": DefaultView})
+	srv.Server = httptest.NewTLSServer(http.HandlerFunc(srv.serveWAPI))
+	return srv
+}
+
+// Host returns the host of the grid to connect to
+func (srv *Server) Host() string {
+	host, _, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	return host
+}
+
+// Port returns the WAPI port of the grid
+func (srv *Server) Port() string {
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	return port
+}
+
+// WriteCertificate writes the certificate of the server in PEM to the file, to verify the server with it
+func (srv *Server) WriteCertificate(filename string) error {
+	var buf bytes.Buffer
+	if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0600)
+}
+
+// AddObject stores the object of the type as it is and returns its reference
+func (srv *Server) AddObject(objType string, obj Object) string {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	// The fields are stored as they are decoded from JSON, as the posted objects are
+	return srv.store(objType, copyObject(obj))
+}
+
+// AddNetworkView adds the network view
+func (srv *Server) AddNetworkView(name string) string {
+	return srv.AddObject("networkview", Object{"name": name})
+}
+
+// AddDNSView adds the DNS view in the network view
+func (srv *Server) AddDNSView(name, netView string) string {
+	return srv.AddObject("view", Object{"name": name, "network_view": netView})
+}
+
+// AddNetworkContainer adds the network container in the network view and in its parent network container
+func (srv *Server) AddNetworkContainer(netView, cidr string) string {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.store("networkcontainer", Object{"network": cidr, "network_view": netView,
+		"network_container": srv.containerOf(netView, cidr)})
+}
+
+// AddNetwork adds the network, an ipv6network for IPv6, in the network view and in its network container
+func (srv *Server) AddNetwork(netView, cidr string) string {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	objType := "network"
+	if isIPv6(cidr) {
+		objType = "ipv6network"
+	}
+	return srv.store(objType, Object{"network": cidr, "network_view": netView,
+		"network_container": srv.containerOf(netView, cidr)})
+}
+
+// containerOf returns the innermost network container of the network view that holds the network, / without one
+func (srv *Server) containerOf(netView, cidr string) string {
+	container, prefixLen := "/", -1
+	_, network, _ := net.ParseCIDR(cidr)
+	for _, obj := range srv.objects["networkcontainer"] {
+		_, parent, err := net.ParseCIDR(str(obj["network"]))
+		if err != nil || network == nil || str(obj["network_view"]) != netView || str(obj["network"]) == cidr {
+			continue
+		}
+		ones, _ := parent.Mask.Size()
+		networkOnes, _ := network.Mask.Size()
+		if parent.Contains(network.IP) && ones < networkOnes && ones > prefixLen {
+			container, prefixLen = str(obj["network"]), ones
+		}
+	}
+	return container
+}
+
+// AddRange adds the range in the network view
+func (srv *Server) AddRange(netView, startAddr, endAddr string) string {
+	return srv.AddObject("range", Object{"start_addr": startAddr, "end_addr": endAddr, "network_view": netView})
+}
+
+// Objects returns a copy of the objects of the type
+func (srv *Server) Objects(objType string) []Object {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	var objects []Object
+	for _, obj := range srv.objects[objType] {
+		objects = append(objects, copyObject(obj))
+	}
+	return objects
+}
+
+// Requests returns the number of requests of the method, e.g. GET, for the object type
+func (srv *Server) Requests(method, objType string) int {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.requests[method+" "+objType]
+}
+
+// Fail makes the next count requests of the method for the object type fail with the status
+func (srv *Server) Fail(method, objType string, status, count int) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	srv.failures = append(srv.failures, failure{method: method, objType: objType, status: status, count: count})
+}
+
+func (srv *Server) serveWAPI(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok || username != srv.username || password != srv.password {
+		http.Error(w, "Authorization Required", http.StatusUnauthorized)
+		return
+	}
+	// The path is /wapi/v<version>/<object type> or /wapi/v<version>/<reference>
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/wapi/"), "/", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "v") {
+		writeError(w, &apiError{http.StatusBadRequest, "AdmConProtoError", "Invalid WAPI path " + r.URL.Path})
+		return
+	}
+	objType := strings.SplitN(parts[1], "/", 2)[0]
+	var ref string
+	if strings.Contains(parts[1], "/") {
+		ref = parts[1]
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	srv.requests[r.Method+" "+objType]++
+	if status := srv.popFailure(r.Method, objType); status != 0 {
+		writeError(w, &apiError{status, "AdmConProtoError", "Injected failure"})
+		return
+	}
+	if !objectTypes[objType] {
+		writeError(w, &apiError{http.StatusBadRequest, "AdmConProtoError", fmt.Sprintf("Unknown object type (%s)", objType)})
+		return
+	}
+	var body Object
+	data, _ := ioutil.ReadAll(r.Body)
+	if len(bytes.TrimSpace(data)) != 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			writeError(w, &apiError{http.StatusBadRequest, "AdmConProtoError", "Invalid JSON: " + err.Error()})
+			return
+		}
+	}
+
+	var res interface{}
+	var apiErr *apiError
+	switch {
+	case r.Method == http.MethodGet && ref != "":
+		res, apiErr = srv.getRef(ref, r.URL.Query())
+	case r.Method == http.MethodGet:
+		res, apiErr = srv.search(objType, body, r.URL.Query())
+	case r.Method == http.MethodPost && ref == "":
+		res, apiErr = srv.create(objType, body)
+	case r.Method == http.MethodDelete && ref != "":
+		res, apiErr = srv.delete(ref)
+	default:
+		apiErr = &apiError{http.StatusBadRequest, "AdmConProtoError", "Unsupported request " + r.Method + " " + r.URL.Path}
+	}
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPost {
+		w.WriteHeader(http.StatusCreated)
+	}
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (srv *Server) popFailure(method, objType string) int {
+	for i, f := range srv.failures {
+		if f.method == method && f.objType == objType {
+			if f.count--; f.count == 0 {
+				srv.failures = append(srv.failures[:i], srv.failures[i+1:]...)
+			} else {
+				srv.failures[i] = f
+			}
+			return f.status
+		}
+	}
+	return 0
+}
+
+// getRef returns the object of the reference
+func (srv *Server) getRef(ref string, query url.Values) (interface{}, *apiError) {
+	obj, _ := srv.find(ref)
+	if obj == nil {
+		return nil, notFound(ref)
+	}
+	return project(obj, query.Get("_return_fields")), nil
+}
+
+// search returns the objects matching the fields of the body, a page of them with _paging
+func (srv *Server) search(objType string, body Object, query url.Values) (interface{}, *apiError) {
+	var results []Object
+	if pageID := query.Get("_page_id"); pageID != "" {
+		var ok bool
+		if results, ok = srv.pages[pageID]; !ok {
+			return nil, &apiError{http.StatusBadRequest, "AdmConProtoError", "Page id " + pageID + " is not valid"}
+		}
+		delete(srv.pages, pageID)
+	} else {
+		for _, obj := range srv.objects[objType] {
+			if matches(obj, body) {
+				results = append(results, obj)
+			}
+		}
+	}
+
+	var projected []Object
+	if query.Get("_paging") != "1" {
+		if len(results) > maxResults {
+			return nil, &apiError{http.StatusBadRequest, "AdmConProtoError",
+				fmt.Sprintf("Result set too large (> %d)", maxResults)}
+		}
+		for _, obj := range results {
+			projected = append(projected, project(obj, query.Get("_return_fields")))
+		}
+		if projected == nil {
+			return []Object{}, nil
+		}
+		return projected, nil
+	}
+
+	if query.Get("_return_as_object") != "1" {
+		return nil, &apiError{http.StatusBadRequest, "AdmConProtoError", "_paging requires _return_as_object"}
+	}
+	pageSize, _ := strconv.Atoi(query.Get("_max_results"))
+	if pageSize <= 0 || pageSize > maxResults {
+		pageSize = maxResults
+	}
+	page := Object{}
+	if len(results) > pageSize {
+		srv.nextID++
+		nextPageID := fmt.Sprintf("page%d", srv.nextID)
+		srv.pages[nextPageID] = results[pageSize:]
+		page["next_page_id"] = nextPageID
+		results = results[:pageSize]
+	}
+	for _, obj := range results {
+		projected = append(projected, project(obj, query.Get("_return_fields")))
+	}
+	if projected == nil {
+		projected = []Object{}
+	}
+	page["result"] = projected
+	return page, nil
+}
+
+// create stores the object of the body and returns its reference
+func (srv *Server) create(objType string, obj Object) (interface{}, *apiError) {
+	if obj == nil {
+		obj = Object{}
+	}
+	delete(obj, "_ref")
+	var apiErr *apiError
+	switch objType {
+	case "fixedaddress", "ipv6fixedaddress":
+		apiErr = srv.createFixedAddress(objType, obj)
+	case "record:host":
+		apiErr = srv.createHostRecord(obj)
+	case "record:a", "record:ptr":
+		apiErr = srv.createRecord(objType, obj)
+	case "extensibleattributedef":
+		if str(obj["name"]) == "" {
+			return nil, missingField("name")
+		}
+		if srv.findBy(objType, "name", str(obj["name"])) != nil {
+			return nil, &apiError{http.StatusBadRequest, "AdmConDataError",
+				fmt.Sprintf("The extensible attribute definition %s already exists", obj["name"])}
+		}
+	}
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return srv.store(objType, obj), nil
+}
+
+func (srv *Server) createFixedAddress(objType string, obj Object) *apiError {
+	addrField := "ipv4addr"
+	if objType == "ipv6fixedaddress" {
+		addrField = "ipv6addr"
+		if str(obj["duid"]) == "" {
+			return missingField("duid")
+		}
+	} else if str(obj["mac"]) == "" {
+		return missingField("mac")
+	}
+	netView := setDefault(obj, "network_view", DefaultView)
+	ipAddr, apiErr := srv.resolveAddress(str(obj[addrField]), netView, addrField)
+	if apiErr != nil {
+		return apiErr
+	}
+	network := srv.networkOf(netView, ipAddr)
+	if network == "" {
+		return &apiError{http.StatusBadRequest, "AdmConDataError",
+			fmt.Sprintf("IP address %s is not in a network of network view %s", ipAddr, netView)}
+	}
+	obj[addrField] = ipAddr
+	obj["network"] = network
+	return nil
+}
+
+func (srv *Server) createHostRecord(obj Object) *apiError {
+	name := str(obj["name"])
+	if name == "" {
+		return missingField("name")
+	}
+	addrs, _ := obj["ipv4addrs"].([]interface{})
+	if len(addrs) == 0 {
+		return missingField("ipv4addrs")
+	}
+	netView := setDefault(obj, "network_view", DefaultView)
+	view := setDefault(obj, "view", DefaultView)
+	for _, item := range addrs {
+		addr, ok := item.(map[string]interface{})
+		if !ok {
+			return &apiError{http.StatusBadRequest, "AdmConProtoError", "Invalid ipv4addrs"}
+		}
+		ipAddr, apiErr := srv.resolveAddress(str(addr["ipv4addr"]), netView, "ipv4addr")
+		if apiErr != nil {
+			return apiErr
+		}
+		addr["ipv4addr"] = ipAddr
+		addr["host"] = name
+		addr["_ref"] = fmt.Sprintf("record:host_ipv4addr/%s:%s/%s", srv.newID("record:host_ipv4addr"), ipAddr, name)
+		delete(addr, "mac")
+	}
+	obj["ipv4addrs"] = addrs
+	if view != DefaultView && srv.findBy("view", "name", view) == nil {
+		return notFound("view " + view)
+	}
+	return nil
+}
+
+func (srv *Server) createRecord(objType string, obj Object) *apiError {
+	view := setDefault(obj, "view", DefaultView)
+	if srv.findBy("view", "name", view) == nil {
+		return notFound("view " + view)
+	}
+	if objType == "record:a" && str(obj["name"]) == "" {
+		return missingField("name")
+	}
+	if objType == "record:ptr" && str(obj["ptrdname"]) == "" {
+		return missingField("ptrdname")
+	}
+	if net.ParseIP(str(obj["ipv4addr"])) == nil {
+		return &apiError{http.StatusBadRequest, "AdmConDataError", fmt.Sprintf("Invalid ipv4addr %v", obj["ipv4addr"])}
+	}
+	return nil
+}
+
+// resolveAddress returns the IP address, or the next available IP address of the network or range of the function
+func (srv *Server) resolveAddress(value, netView, addrField string) (string, *apiError) {
+	if !strings.HasPrefix(value, nextAvailableIP) {
+		if net.ParseIP(value) == nil {
+			return "", &apiError{http.StatusBadRequest, "AdmConDataError", fmt.Sprintf("Invalid %s %s", addrField, value)}
+		}
+		if srv.isUsed(netView, value) {
+			return "", &apiError{http.StatusBadRequest, "AdmConDataError",
+				fmt.Sprintf("The IP address %s is already used in network view %s", value, netView)}
+		}
+		return value, nil
+	}
+	args := strings.Split(strings.TrimPrefix(value, nextAvailableIP), ",")
+	if len(args) > 1 && args[1] != "" {
+		netView = args[1]
+	}
+	target := args[0]
+	var first, last net.IP
+	if bounds := strings.Split(target, "-"); len(bounds) == 2 {
+		rng := srv.findBy("range", "start_addr", bounds[0])
+		if rng == nil || str(rng["end_addr"]) != bounds[1] || str(rng["network_view"]) != netView {
+			return "", notFound("range " + target)
+		}
+		first, last = net.ParseIP(bounds[0]), net.ParseIP(bounds[1])
+	} else {
+		if srv.findNetwork(netView, target) == nil {
+			return "", notFound("network " + target)
+		}
+		_, network, _ := net.ParseCIDR(target)
+		first, last = hostBounds(network)
+	}
+	if first == nil || last == nil {
+		return "", &apiError{http.StatusBadRequest, "AdmConDataError", "Invalid " + target}
+	}
+	for ip := first; bytes.Compare(ip, last) <= 0; ip = nextIP(ip) {
+		if !srv.isUsed(netView, ip.String()) {
+			return ip.String(), nil
+		}
+		if ip.Equal(last) {
+			break
+		}
+	}
+	return "", &apiError{http.StatusBadRequest, "AdmConDataError",
+		fmt.Sprintf("Cannot find 1 available IP address(es) within network %s", target)}
+}
+
+// isUsed checks whether a fixed address or a host record holds the IP address in the network view
+func (srv *Server) isUsed(netView, ipAddr string) bool {
+	ip := net.ParseIP(ipAddr)
+	for _, objType := range []string{"fixedaddress", "ipv6fixedaddress"} {
+		for _, obj := range srv.objects[objType] {
+			addr := net.ParseIP(str(obj["ipv4addr"]) + str(obj["ipv6addr"]))
+			if str(obj["network_view"]) == netView && addr.Equal(ip) {
+				return true
+			}
+		}
+	}
+	for _, obj := range srv.objects["record:host"] {
+		if str(obj["network_view"]) != netView {
+			continue
+		}
+		addrs, _ := obj["ipv4addrs"].([]interface{})
+		for _, item := range addrs {
+			if addr, ok := item.(map[string]interface{}); ok && net.ParseIP(str(addr["ipv4addr"])).Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// networkOf returns the network of the network view that the IP address is in
+func (srv *Server) networkOf(netView, ipAddr string) string {
+	ip := net.ParseIP(ipAddr)
+	for _, objType := range []string{"network", "ipv6network"} {
+		for _, obj := range srv.objects[objType] {
+			_, network, err := net.ParseCIDR(str(obj["network"]))
+			if err == nil && str(obj["network_view"]) == netView && network.Contains(ip) {
+				return str(obj["network"])
+			}
+		}
+	}
+	return ""
+}
+
+func (srv *Server) findNetwork(netView, cidr string) Object {
+	for _, objType := range []string{"network", "ipv6network"} {
+		for _, obj := range srv.objects[objType] {
+			if str(obj["network"]) == cidr && str(obj["network_view"]) == netView {
+				return obj
+			}
+		}
+	}
+	return nil
+}
+
+func (srv *Server) delete(ref string) (interface{}, *apiError) {
+	obj, objType := srv.find(ref)
+	if obj == nil {
+		return nil, notFound(ref)
+	}
+	objects := srv.objects[objType]
+	for i := range objects {
+		if str(objects[i]["_ref"]) == ref {
+			srv.objects[objType] = append(objects[:i], objects[i+1:]...)
+			break
+		}
+	}
+	return ref, nil
+}
+
+// store assigns a reference to the object, e.g. fixedaddress/ZG5z:10.1.1.1/default, and stores it
+func (srv *Server) store(objType string, obj Object) string {
+	var name string
+	for _, field := range []string{"ipv4addr", "ipv6addr", "name", "ptrdname", "network", "start_addr"} {
+		if name = str(obj[field]); name != "" {
+			break
+		}
+	}
+	// The colons of the IPv6 addresses are escaped in the references
+	ref := fmt.Sprintf("%s/%s:%s", objType, srv.newID(objType), strings.ReplaceAll(name, ":", "%3A"))
+	if view := str(obj["view"]); view != "" {
+		ref += "/" + view
+	} else if netView := str(obj["network_view"]); netView != "" {
+		ref += "/" + netView
+	}
+	obj["_ref"] = ref
+	srv.objects[objType] = append(srv.objects[objType], obj)
+	return ref
+}
+
+func (srv *Server) newID(objType string) string {
+	srv.nextID++
+	return hex.EncodeToString([]byte(fmt.Sprintf("%s$%d", objType, srv.nextID)))
+}
+
+func (srv *Server) find(ref string) (Object, string) {
+	objType := strings.SplitN(ref, "/", 2)[0]
+	for _, obj := range srv.objects[objType] {
+		if str(obj["_ref"]) == ref {
+			return obj, objType
+		}
+	}
+	return nil, objType
+}
+
+func (srv *Server) findBy(objType, field, value string) Object {
+	for _, obj := range srv.objects[objType] {
+		if str(obj[field]) == value {
+			return obj
+		}
+	}
+	return nil
+}
+
+// matches checks whether the object has the scalar fields, and the *<name> extensible attributes, of the search.
+// contains_address matches the networks that hold the IP address
+func matches(obj, search Object) bool {
+	for field, value := range search {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}, nil:
+			continue
+		}
+		if strings.HasPrefix(field, "*") {
+			eas, _ := obj["extattrs"].(map[string]interface{})
+			ea, _ := eas[strings.TrimPrefix(field, "*")].(map[string]interface{})
+			if ea == nil || fmt.Sprint(ea["value"]) != fmt.Sprint(value) {
+				return false
+			}
+			continue
+		}
+		if field == "contains_address" {
+			_, network, err := net.ParseCIDR(str(obj["network"]))
+			if err != nil || !network.Contains(net.ParseIP(str(value))) {
+				return false
+			}
+			continue
+		}
+		if addrs, ok := obj["ipv4addrs"].([]interface{}); ok && field == "ipv4addr" {
+			if !hostHasAddress(addrs, str(value)) {
+				return false
+			}
+			continue
+		}
+		if _, ok := obj[field]; !ok || fmt.Sprint(obj[field]) != fmt.Sprint(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func hostHasAddress(addrs []interface{}, ipAddr string) bool {
+	for _, item := range addrs {
+		if addr, ok := item.(map[string]interface{}); ok && str(addr["ipv4addr"]) == ipAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// project returns the reference and the return fields of the object, all its fields without return fields
+func project(obj Object, returnFields string) Object {
+	if returnFields == "" {
+		return copyObject(obj)
+	}
+	res := Object{"_ref": obj["_ref"]}
+	for _, field := range strings.Split(returnFields, ",") {
+		if value, ok := obj[field]; ok {
+			res[field] = value
+		}
+	}
+	return res
+}
+
+func copyObject(obj Object) Object {
+	data, _ := json.Marshal(obj)
+	var res Object
+	_ = json.Unmarshal(data, &res)
+	return res
+}
+
+func writeError(w http.ResponseWriter, apiErr *apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.status)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"Error": apiErr.name + ": " + apiErr.text,
+		"code":  "Client.Ibap.Data",
+		"text":  apiErr.text,
+	})
+}
+
+func notFound(what string) *apiError {
+	return &apiError{http.StatusNotFound, "AdmConDataNotFoundError", fmt.Sprintf("Reference %s not found", what)}
+}
+
+func missingField(field string) *apiError {
+	return &apiError{http.StatusBadRequest, "AdmConProtoError", "Required field missing: " + field}
+}
+
+func setDefault(obj Object, field, value string) string {
+	if str(obj[field]) == "" {
+		obj[field] = value
+	}
+	return str(obj[field])
+}
+
+func str(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func isIPv6(cidr string) bool {
+	ip, _, err := net.ParseCIDR(cidr)
+	return err == nil && ip.To4() == nil
+}
+
+// hostBounds returns the first and the last host address of the network
+func hostBounds(network *net.IPNet) (net.IP, net.IP) {
+	if network == nil {
+		return nil, nil
+	}
+	first := network.IP.To16()
+	last := make(net.IP, len(first))
+	mask := network.Mask
+	if len(mask) == net.IPv4len {
+		mask = append(net.CIDRMask(96, 128)[:12], mask...)
+	}
+	for i := range first {
+		last[i] = first[i] | ^mask[i]
+	}
+	if network.IP.To4() != nil {
+		// The network and the broadcast addresses are not allocated
+		return nextIP(first), prevIP(last)
+	}
+	return nextIP(first), last
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i]++; next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+func prevIP(ip net.IP) net.IP {
+	prev := make(net.IP, len(ip))
+	copy(prev, ip)
+	for i := len(prev) - 1; i >= 0; i-- {
+		if prev[i]--; prev[i] != 0xff {
+			break
+		}
+	}
+	return prev
+}
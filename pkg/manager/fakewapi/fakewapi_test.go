@@ -0,0 +1,267 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fakewapi_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/fakewapi"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestFakeWAPI(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fake WAPI Suite")
+}
+
+var _ = Describe("Infoblox provider against the fake WAPI server", func() {
+	var srv *fakewapi.Server
+	var certDir string
+
+	params := func(labels string) manager.InfobloxParams {
+		return manager.InfobloxParams{
+			Host:        srv.Host(),
+			Port:        srv.Port(),
+			Version:     "2.5",
+			Username:    fakewapi.DefaultUsername,
+			Password:    fakewapi.DefaultPassword,
+			IbLabelMap:  labels,
+			NetView:     fakewapi.DefaultView,
+			SslVerify:   filepath.Join(certDir, "ca.crt"),
+			ClusterName: "east",
+		}
+	}
+
+	BeforeEach(func() {
+		srv = fakewapi.NewServer(fakewapi.Params{})
+		var err error
+		certDir, err = ioutil.TempDir("", "fakewapi")
+		Expect(err).To(BeNil())
+		Expect(srv.WriteCertificate(filepath.Join(certDir, "ca.crt"))).To(Succeed())
+		srv.AddNetwork(fakewapi.DefaultView, "172.16.4.0/29")
+		srv.AddNetwork(fakewapi.DefaultView, "172.16.5.0/24")
+	})
+
+	AfterEach(func() {
+		srv.Close()
+		_ = os.RemoveAll(certDir)
+	})
+
+	It("Connects with the certificate of the grid and creates the EA definitions", func() {
+		_, err := manager.NewInfobloxManager(params(`{"Dev": {"cidr": "172.16.4.0/29"}}`))
+		Expect(err).To(BeNil())
+		var names []interface{}
+		for _, eaDef := range srv.Objects("extensibleattributedef") {
+			names = append(names, eaDef["name"])
+		}
+		Expect(names).To(ConsistOf(manager.EAKey, manager.ClusterEAKey))
+
+		// The EA definitions that exist are not created again
+		_, err = manager.NewInfobloxManager(params(`{"Dev": {"cidr": "172.16.4.0/29"}}`))
+		Expect(err).To(BeNil())
+		Expect(srv.Objects("extensibleattributedef")).To(HaveLen(2))
+	})
+
+	It("Fails to connect with the wrong password", func() {
+		ibParams := params(`{"Dev": {"cidr": "172.16.4.0/29"}}`)
+		ibParams.Password = "wrong"
+		_, err := manager.NewInfobloxManager(ibParams)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("401"))
+	})
+
+	It("Fails to connect at once on the errors of the configuration and the certificate", func() {
+		// A network that does not exist is not retried
+		ibParams := params(`{"Dev": {"cidr": "172.16.9.0/24"}}`)
+		ibParams.RetryConnect = true
+		_, err := manager.NewInfobloxManager(ibParams)
+		Expect(err).To(HaveOccurred())
+
+		// Nor is a certificate that is not valid for the host
+		ibParams = params(`{"Dev": {"cidr": "172.16.4.0/29"}}`)
+		ibParams.RetryConnect = true
+		ibParams.Host = "localhost"
+		_, err = manager.NewInfobloxManager(ibParams)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("certificate"))
+	})
+
+	It("Allocates, looks up and releases fixed addresses", func() {
+		infMgr, err := manager.NewInfobloxManager(params(`{"Dev": {"cidr": "172.16.4.0/29"}}`))
+		Expect(err).To(BeNil())
+
+		req := ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Dev"}
+		Expect(infMgr.AllocateNextIPAddress(req)).To(Equal("172.16.4.1"))
+		req.HostName = "bar.com"
+		Expect(infMgr.AllocateNextIPAddress(req)).To(Equal("172.16.4.2"))
+		fixedAddresses := srv.Objects("fixedaddress")
+		Expect(fixedAddresses).To(HaveLen(2))
+		Expect(fixedAddresses[0]["network"]).To(Equal("172.16.4.0/29"))
+		Expect(fixedAddresses[0]["extattrs"]).To(HaveKeyWithValue(manager.ClusterEAKey,
+			HaveKeyWithValue("value", "east")))
+
+		infMgr, err = manager.NewInfobloxManager(params(`{"Dev": {"cidr": "172.16.4.0/29"}}`))
+		Expect(err).To(BeNil())
+		Expect(infMgr.GetIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Dev"})).To(Equal("172.16.4.1"))
+		Expect(infMgr.GetAllocations("Dev")).To(HaveLen(2))
+
+		// The fixed addresses of other clusters are neither found nor released
+		other := params(`{"Dev": {"cidr": "172.16.4.0/29"}}`)
+		other.ClusterName = "west"
+		otherMgr, err := manager.NewInfobloxManager(other)
+		Expect(err).To(BeNil())
+		Expect(otherMgr.GetIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Dev"})).To(BeEmpty())
+		otherMgr.ReleaseIPAddress(ipamspec.IPAMRequest{IPAddr: "172.16.4.1", IPAMLabel: "Dev"})
+		Expect(srv.Objects("fixedaddress")).To(HaveLen(2))
+
+		infMgr.ReleaseIPAddress(ipamspec.IPAMRequest{IPAddr: "172.16.4.1", IPAMLabel: "Dev"})
+		Expect(srv.Objects("fixedaddress")).To(HaveLen(1))
+		Expect(infMgr.GetIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Dev"})).To(BeEmpty())
+
+		// The released IP address is allocated again, then the network is full
+		Expect(infMgr.ReserveIPAddress(ipamspec.IPAMRequest{HostName: "foo.com", IPAddr: "172.16.4.1", IPAMLabel: "Dev"})).To(BeTrue())
+		Expect(infMgr.ReserveIPAddress(ipamspec.IPAMRequest{HostName: "baz.com", IPAddr: "172.16.4.1", IPAMLabel: "Dev"})).To(BeFalse())
+		for i := 3; i <= 6; i++ {
+			req.HostName = fmt.Sprintf("host%d.com", i)
+			Expect(infMgr.AllocateNextIPAddress(req)).To(Equal(fmt.Sprintf("172.16.4.%d", i)))
+		}
+		req.HostName = "full.com"
+		Expect(infMgr.AllocateNextIPAddress(req)).To(BeEmpty())
+	})
+
+	It("Pages the searches of more than 1000 objects", func() {
+		infMgr, err := manager.NewInfobloxManager(params(`{"Test": {"cidr": "172.16.5.0/24"}}`))
+		Expect(err).To(BeNil())
+		ea := fakewapi.Object{
+			manager.EAKey:        map[string]interface{}{"value": manager.EAVal},
+			manager.ClusterEAKey: map[string]interface{}{"value": "east"},
+		}
+		for i := 0; i < 1200; i++ {
+			srv.AddObject("fixedaddress", fakewapi.Object{
+				"ipv4addr":     fmt.Sprintf("172.16.5.%d", i%250+1),
+				"name":         fmt.Sprintf("host%d.com", i),
+				"network":      "172.16.5.0/24",
+				"network_view": fakewapi.DefaultView,
+				"mac":          "00:00:00:00:00:00",
+				"extattrs":     ea,
+			})
+		}
+		allocations := infMgr.GetAllocations("Test")
+		Expect(allocations).To(HaveLen(1200))
+		Expect(srv.Requests(http.MethodGet, "fixedaddress")).To(Equal(2))
+		// The allocations are in the order of their IP addresses
+		Expect(allocations[5].IPAddr).To(Equal("172.16.5.2"))
+	})
+
+	It("Allocates host records", func() {
+		infMgr, err := manager.NewInfobloxManager(params(`{"Dev": {"cidr": "172.16.4.0/29", "mode": "host"}}`))
+		Expect(err).To(BeNil())
+		req := ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Dev"}
+		Expect(infMgr.AllocateNextIPAddress(req)).To(Equal("172.16.4.1"))
+		Expect(srv.Objects("record:host")).To(HaveLen(1))
+		Expect(infMgr.GetAllocations("Dev")).To(ConsistOf(manager.Allocation{
+			IPAMLabel: "Dev", IPAddr: "172.16.4.1", Reference: "foo.com", HostName: true,
+		}))
+		infMgr.ReleaseIPAddress(ipamspec.IPAMRequest{IPAddr: "172.16.4.1", IPAMLabel: "Dev"})
+		Expect(srv.Objects("record:host")).To(BeEmpty())
+	})
+
+	It("Creates and deletes the A and PTR records", func() {
+		infMgr, err := manager.NewInfobloxManager(params(
+			`{"Dev": {"cidr": "172.16.4.0/29", "dnsView": "default", "dns": true, "ptr": true}}`))
+		Expect(err).To(BeNil())
+		req := ipamspec.IPAMRequest{HostName: "foo.com", IPAddr: "172.16.4.1", IPAMLabel: "Dev"}
+		Expect(infMgr.CreateARecord(req)).To(BeTrue())
+		Expect(srv.Objects("record:a")).To(HaveLen(1))
+		Expect(srv.Objects("record:ptr")).To(HaveLen(1))
+		infMgr.DeleteARecord(req)
+		Expect(srv.Objects("record:a")).To(BeEmpty())
+		Expect(srv.Objects("record:ptr")).To(BeEmpty())
+
+		// The A record is not created in a DNS view that does not exist
+		_, err = manager.NewInfobloxManager(params(`{"Dev": {"cidr": "172.16.4.0/29", "dnsView": "internal", "dns": true}}`))
+		Expect(err).To(MatchError("grid default: dnsView internal not found for label Dev"))
+	})
+
+	It("Allocates IPv6 fixed addresses", func() {
+		srv.AddNetwork(fakewapi.DefaultView, "2001:db8::/120")
+		infMgr, err := manager.NewInfobloxManager(params(`{"V6": {"cidr": "2001:db8::/120"}}`))
+		Expect(err).To(BeNil())
+		req := ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "V6"}
+		Expect(infMgr.AllocateNextIPAddress(req)).To(Equal("2001:db8::1"))
+		Expect(srv.Objects("ipv6fixedaddress")).To(HaveLen(1))
+		Expect(infMgr.GetAllocations("V6")).To(HaveLen(1))
+		infMgr.ReleaseIPAddress(ipamspec.IPAMRequest{IPAddr: "2001:db8::1", IPAMLabel: "V6"})
+		Expect(srv.Objects("ipv6fixedaddress")).To(BeEmpty())
+	})
+
+	It("Allocates from the networks of a network view and a range", func() {
+		srv.AddNetworkView("lab")
+		srv.AddNetwork("lab", "10.10.0.0/24")
+		srv.AddRange("lab", "10.10.0.100", "10.10.0.101")
+		infMgr, err := manager.NewInfobloxManager(params(
+			`{"Lab": {"range": "10.10.0.100-10.10.0.101", "netView": "lab"}}`))
+		Expect(err).To(BeNil())
+		req := ipamspec.IPAMRequest{HostName: "foo.com", IPAMLabel: "Lab"}
+		Expect(infMgr.AllocateNextIPAddress(req)).To(Equal("10.10.0.100"))
+		Expect(srv.Objects("fixedaddress")[0]["network_view"]).To(Equal("lab"))
+		req.HostName = "bar.com"
+		req.IPAddr = "10.10.0.101"
+		Expect(infMgr.ReserveIPAddress(req)).To(BeTrue())
+		Expect(srv.Objects("fixedaddress")[1]["network"]).To(Equal("10.10.0.0/24"))
+		infMgr.ReleaseIPAddress(req)
+		Expect(srv.Objects("fixedaddress")).To(HaveLen(1))
+
+		_, err = manager.NewInfobloxManager(params(`{"Lab": {"cidr": "10.10.0.0/24", "netView": "missing"}}`))
+		Expect(err).To(MatchError("grid default: network view missing not found"))
+	})
+
+	It("Allocates from the networks of nested network containers", func() {
+		srv.AddNetworkContainer(fakewapi.DefaultView, "10.20.0.0/16")
+		srv.AddNetworkContainer(fakewapi.DefaultView, "10.20.4.0/22")
+		srv.AddNetwork(fakewapi.DefaultView, "10.20.1.0/30")
+		srv.AddNetwork(fakewapi.DefaultView, "10.20.4.0/30")
+		infMgr, err := manager.NewInfobloxManager(params(`{"Dev": {"networkContainer": "10.20.0.0/16"}}`))
+		Expect(err).To(BeNil())
+		for i, ipAddr := range []string{"10.20.1.1", "10.20.1.2", "10.20.4.1"} {
+			req := ipamspec.IPAMRequest{HostName: fmt.Sprintf("host%d.com", i), IPAMLabel: "Dev"}
+			Expect(infMgr.AllocateNextIPAddress(req)).To(Equal(ipAddr))
+		}
+		req := ipamspec.IPAMRequest{HostName: "foo.com", IPAddr: "10.20.4.2", IPAMLabel: "Dev"}
+		Expect(infMgr.ReserveIPAddress(req)).To(BeTrue())
+		Expect(srv.Objects("fixedaddress")[3]["network"]).To(Equal("10.20.4.0/30"))
+		infMgr.ReleaseIPAddress(req)
+		Expect(srv.Objects("fixedaddress")).To(HaveLen(3))
+	})
+
+	It("Retries the searches that the grid fails", func() {
+		infMgr, err := manager.NewInfobloxManager(params(`{"Dev": {"cidr": "172.16.4.0/29"}}`))
+		Expect(err).To(BeNil())
+		srv.Fail(http.MethodGet, "fixedaddress", http.StatusServiceUnavailable, 1)
+		Expect(infMgr.GetAllocations("Dev")).To(BeEmpty())
+		Expect(srv.Requests(http.MethodGet, "fixedaddress")).To(Equal(2))
+		Expect(infMgr.IsReady()).To(BeTrue())
+	})
+})
@@ -0,0 +1,186 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	ibxclient "github.com/infobloxopen/infoblox-go-client"
+	"sync"
+	"time"
+)
+
+// ipCache caches the IP addresses allocated to the hostnames/keys of the IPAM labels
+// A nil ipCache caches nothing
+type ipCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[string]map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	ipAddr string
+	expiry time.Time
+}
+
+func newIPCache(ttl time.Duration) *ipCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &ipCache{
+		ttl:     ttl,
+		entries: make(map[string]map[string]cacheEntry),
+	}
+}
+
+// get returns the IP address of the hostname/key in the label, when it is cached and not expired
+func (c *ipCache) get(ipamLabel, name string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.entries[ipamLabel][name]
+	if !ok || time.Now().After(entry.expiry) {
+		return "", false
+	}
+	return entry.ipAddr, true
+}
+
+// add caches the IP address of the hostname/key in the label
+func (c *ipCache) add(ipamLabel, name, ipAddr string) {
+	if c == nil || name == "" || ipAddr == "" {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.entries[ipamLabel]; !ok {
+		c.entries[ipamLabel] = make(map[string]cacheEntry)
+	}
+	c.entries[ipamLabel][name] = cacheEntry{ipAddr: ipAddr, expiry: time.Now().Add(c.ttl)}
+}
+
+// remove removes the IP address from the label
+func (c *ipCache) remove(ipamLabel, ipAddr string) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	for name, entry := range c.entries[ipamLabel] {
+		if entry.ipAddr == ipAddr {
+			delete(c.entries[ipamLabel], name)
+		}
+	}
+}
+
+// len returns the number of cached IP addresses
+func (c *ipCache) len() int {
+	if c == nil {
+		return 0
+	}
+	c.Lock()
+	defer c.Unlock()
+	count := 0
+	for _, names := range c.entries {
+		count += len(names)
+	}
+	return count
+}
+
+// warmCache caches the IP addresses of the fixed addresses and host records of this cluster in the labels of the grid
+func (infMgr *InfobloxManager) warmCache(grid string) {
+	if infMgr.cache == nil {
+		return
+	}
+	// The labels on the same grid, network view and IP version are warmed with the same searches
+	type labelGroup struct {
+		grid    string
+		netView string
+		ipv6    bool
+	}
+	groups := make(map[labelGroup][]string)
+	for ipamLabel, label := range infMgr.IBLabels {
+		if gridName(label) != grid {
+			continue
+		}
+		key := labelGroup{gridName(label), infMgr.netView(label), isIPv6Label(label)}
+		groups[key] = append(groups[key], ipamLabel)
+	}
+	for _, ipamLabels := range groups {
+		infMgr.warmLabels(ipamLabels)
+	}
+	log.Infof("[IPMG] Cached %v IP Addresses", infMgr.cache.len())
+}
+
+// warmLabels caches the IP addresses of the labels, which share their grid, network view and IP version
+func (infMgr *InfobloxManager) warmLabels(ipamLabels []string) {
+	first := infMgr.IBLabels[ipamLabels[0]]
+	grid := infMgr.grid(first)
+	var hostRecords []managedHostRecord
+
+	fixedAddressSearch := &managedFixedAddress{
+		eaSearch:    ibxclient.EASearch(infMgr.scopeEA()),
+		NetviewName: infMgr.netView(first),
+	}
+	fixedAddresses, err := infMgr.searchFixedAddressObjects(first, fixedAddressSearch)
+	if err != nil {
+		log.Errorf("[IPMG] Unable to warm the cache with Fixed Addresses, Error: %v", err)
+		return
+	}
+	if infMgr.hasHostRecordLabels(ipamLabels) {
+		hostRecordSearch := &managedHostRecord{
+			eaSearch:    ibxclient.EASearch(infMgr.scopeEA()),
+			NetworkView: infMgr.netView(first),
+		}
+		if err := grid.searchObjects(hostRecordSearch, &hostRecords); err != nil {
+			log.Errorf("[IPMG] Unable to warm the cache with Host Records, Error: %v", err)
+			return
+		}
+	}
+
+	for _, ipamLabel := range ipamLabels {
+		label := infMgr.IBLabels[ipamLabel]
+		if label.Mode == HostRecordMode {
+			for _, hostRecord := range hostRecords {
+				if !infMgr.isOwned(hostRecord.Ea) {
+					continue
+				}
+				for _, addr := range hostRecord.Ipv4Addrs {
+					if utils.IsIPInRange(addr.Ipv4Addr, labelRange(label)) {
+						infMgr.cache.add(ipamLabel, hostRecord.Name, addr.Ipv4Addr)
+					}
+				}
+			}
+			continue
+		}
+		for _, fixedAddress := range fixedAddresses {
+			if infMgr.isOwned(fixedAddress.Ea) && utils.IsIPInRange(fixedAddress.IPAddress, labelRange(label)) {
+				infMgr.cache.add(ipamLabel, fixedAddress.Name, fixedAddress.IPAddress)
+			}
+		}
+	}
+}
+
+func (infMgr *InfobloxManager) hasHostRecordLabels(ipamLabels []string) bool {
+	for _, ipamLabel := range ipamLabels {
+		if infMgr.IBLabels[ipamLabel].Mode == HostRecordMode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/credentials"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	ibxclient "github.com/infobloxopen/infoblox-go-client"
+)
+
+// DefaultGrid is the grid of the host, port and credentials arguments, used by the labels without a grid
+const DefaultGrid = "default"
+
+// GridParams defines the connection to an Infoblox grid
+type GridParams struct {
+	Host     string `json:"host,omitempty"`
+	Port     string `json:"port,omitempty"`
+	Version  string `json:"wapiVersion,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// SslVerify is the certificate of the grid, or false to skip the verification
+	SslVerify string `json:"sslVerify,omitempty"`
+	// CredentialsDirectory holds the username, password, grid-host, wapi-port and certificate files of the grid
+	CredentialsDirectory string `json:"credentialsDirectory,omitempty"`
+}
+
+// infobloxGrid is the connection to an Infoblox grid
+type infobloxGrid struct {
+	name    string
+	breaker *circuitBreaker
+	// connected is set once the extensible attributes and the labels are validated on the grid
+	connected int32
+	// mutex guards ibConnector and ibObjMgr, which are replaced when the credentials change
+	mutex       sync.RWMutex
+	ibConnector *ConnectorHandler
+	ibObjMgr    *ObjMgrHandler
+}
+
+func newInfobloxGrid(name string, params GridParams) *infobloxGrid {
+	grid := &infobloxGrid{
+		name:    name,
+		breaker: &circuitBreaker{},
+	}
+	grid.ibConnector, grid.ibObjMgr = newConnector(params, grid.breaker)
+	return grid
+}
+
+// newConnector creates the connector of the grid, it is validated on connect so that it can be created
+// while the grid is unreachable
+func newConnector(params GridParams, breaker *circuitBreaker) (*ConnectorHandler, *ObjMgrHandler) {
+	hostConfig := ibxclient.HostConfig{
+		Host:     params.Host,
+		Version:  params.Version,
+		Port:     params.Port,
+		Username: params.Username,
+		Password: params.Password,
+	}
+	// TransportConfig params: sslVerify, httpRequestsTimeout, httpPoolConnections
+	// These are the common values
+	transportConfig := ibxclient.NewTransportConfig(params.SslVerify, 20, 10)
+	connector := &ibxclient.Connector{
+		HostConfig:      hostConfig,
+		TransportConfig: transportConfig,
+		RequestBuilder:  &pagingRequestBuilder{},
+		Requestor:       &resilientRequestor{HttpRequestor: &ibxclient.WapiHttpRequestor{}, breaker: breaker},
+	}
+	connector.RequestBuilder.Init(hostConfig)
+	connector.Requestor.Init(transportConfig)
+	objMgr := ibxclient.NewObjectManager(connector, "F5IPAM", "0")
+
+	objMgr.OmitCloudAttrs = true
+	return &ConnectorHandler{connector}, &ObjMgrHandler{objMgr}
+}
+
+// isReady checks whether the grid is connected and reachable
+func (grid *infobloxGrid) isReady() bool {
+	return atomic.LoadInt32(&grid.connected) == 1 && !grid.breaker.isOpen()
+}
+
+func (grid *infobloxGrid) connector() *ConnectorHandler {
+	grid.mutex.RLock()
+	defer grid.mutex.RUnlock()
+	return grid.ibConnector
+}
+
+func (grid *infobloxGrid) objMgr() *ObjMgrHandler {
+	grid.mutex.RLock()
+	defer grid.mutex.RUnlock()
+	return grid.ibObjMgr
+}
+
+// updateCredentials connects to the grid with the params, the current connection is kept when
+// the grid does not accept them
+func (grid *infobloxGrid) updateCredentials(params GridParams) error {
+	params.Version = grid.connector().HostConfig.Version
+	connector, objMgr := newConnector(params, grid.breaker)
+	if err := ibxclient.ValidateConnector(connector.Connector); err != nil {
+		return err
+	}
+	grid.mutex.Lock()
+	grid.ibConnector = connector
+	grid.ibObjMgr = objMgr
+	grid.mutex.Unlock()
+	log.Infof("[IPMG] Connected to Infoblox grid %v at %v:%v as %v", grid.name, params.Host, params.Port, params.Username)
+	return nil
+}
+
+// ParseGrids parses the grids of the labels. The password of a grid is read from its credentials directory,
+// so that it is not on the command line. The other fields that are not set, nor read from the credentials
+// directory, are taken from defaults, except for the host and the username
+func ParseGrids(params string, defaults GridParams) (map[string]GridParams, error) {
+	grids := make(map[string]GridParams)
+	if params == "" {
+		return grids, nil
+	}
+	err := json.Unmarshal([]byte(params), &grids)
+	if err != nil {
+		return nil, err
+	}
+	for name, grid := range grids {
+		if name == "" || name == DefaultGrid {
+			return nil, fmt.Errorf("invalid grid name %q", name)
+		}
+		if grid.Password != "" {
+			return nil, fmt.Errorf("password of grid %v must be in the password file of its credentialsDirectory", name)
+		}
+		if grid.CredentialsDirectory == "" {
+			return nil, fmt.Errorf("credentialsDirectory is required for grid %v", name)
+		}
+		if grid.Port == "" {
+			grid.Port = defaults.Port
+		}
+		if grid.Version == "" {
+			grid.Version = defaults.Version
+		}
+		creds, err := credentials.Read(grid.CredentialsDirectory, credentials.Credentials{
+			Username: grid.Username,
+			Host:     grid.Host,
+			Port:     grid.Port,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%v for grid %v", err, name)
+		}
+		grid.Username, grid.Password, grid.Host, grid.Port = creds.Username, creds.Password, creds.Host, creds.Port
+		certificate := filepath.Join(grid.CredentialsDirectory, credentials.CertificateFile)
+		if _, err := os.Stat(certificate); grid.SslVerify == "" && err == nil {
+			grid.SslVerify = certificate
+		}
+		if grid.SslVerify == "" {
+			grid.SslVerify = defaults.SslVerify
+		}
+		if grid.Host == "" || grid.Username == "" || grid.Password == "" {
+			return nil, fmt.Errorf("host, username and password are required for grid %v", name)
+		}
+		grids[name] = grid
+	}
+	return grids, nil
+}
+
+// getGridNames returns the names of the grids of the manager in order
+func (infMgr *InfobloxManager) getGridNames() []string {
+	var names []string
+	for name := range infMgr.grids {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// gridName returns the name of the grid of the label
+func gridName(label IBConfig) string {
+	if label.Grid == "" {
+		return DefaultGrid
+	}
+	return label.Grid
+}
+
+// grid returns the connection to the grid of the label
+func (infMgr *InfobloxManager) grid(label IBConfig) *infobloxGrid {
+	return infMgr.grids[gridName(label)]
+}
+
+// netView returns the network view of the label
+func (infMgr *InfobloxManager) netView(label IBConfig) string {
+	if label.NetView == "" {
+		return infMgr.NetView
+	}
+	return label.NetView
+}
@@ -17,18 +17,42 @@
 package manager
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
 	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
 	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
 	ibxclient "github.com/infobloxopen/infoblox-go-client"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	EAKey = "F5IPAM"
 	EAVal = "managed"
+	// ClusterEAKey holds the cluster name, the objects of a cluster are scoped by it
+	ClusterEAKey = "F5IPAMCluster"
+	// ReferenceEAKey holds the hostname/key of the host records, as their names are DNS names
+	ReferenceEAKey = "F5IPAMReference"
+
+	// FixedAddressMode allocates the IP addresses as fixed addresses
+	FixedAddressMode = "fixedaddress"
+	// HostRecordMode allocates the IP addresses as host records
+	HostRecordMode = "host"
 )
 
+// invalidDNSChars are the characters that the labels of DNS names do not allow
+var invalidDNSChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
 type InfobloxParams struct {
 	Host       string
 	Version    string
@@ -38,6 +62,17 @@ type InfobloxParams struct {
 	IbLabelMap string
 	NetView    string
 	SslVerify  string
+	// ClusterName is written in the ClusterEAKey of the objects, and scopes the lookups and releases
+	ClusterName string
+	// ExtraEAs are the extensible attributes written on every allocation, as JSON of name and value.
+	// The values can hold {cluster}, {namespace}, {name} and {reference} of the request
+	ExtraEAs string
+	// CacheTTL is how long the IP addresses of the hostnames/keys are cached, 0 disables the cache
+	CacheTTL time.Duration
+	// RetryConnect keeps connecting to the grid in the background instead of failing when it is unreachable
+	RetryConnect bool
+	// Grids is the JSON of the grids, other than the default grid, that the labels can refer to
+	Grids string
 }
 
 type ObjMgrHandler struct {
@@ -49,77 +84,216 @@ type ConnectorHandler struct {
 }
 
 type InfobloxManager struct {
-	connector *ConnectorHandler
-	objMgr    *ObjMgrHandler
-	ea        ibxclient.EA
-	NetView   string
-	IBLabels  map[string]IBConfig
+	// grids holds the connections by grid name, the DefaultGrid included
+	grids    map[string]*infobloxGrid
+	ea       ibxclient.EA
+	NetView  string
+	IBLabels map[string]IBConfig
+	// ClusterName scopes the objects of the manager to this cluster, all objects when it is empty
+	ClusterName string
+	extraEAs    map[string]string
+	cache       *ipCache
 }
 
 type IBConfig struct {
 	DNSView string `json:"dnsView,omitempty"`
-	CIDR    string `json:"cidr"`
+	CIDR    string `json:"cidr,omitempty"`
+	// CIDRs are the networks to allocate from in order, instead of CIDR
+	CIDRs []string `json:"cidrs,omitempty"`
+	// NetworkContainer allocates from the networks of the network container in order, instead of CIDR
+	NetworkContainer string `json:"networkContainer,omitempty"`
+	// Range allocates from the range object, e.g. 172.16.4.10-172.16.4.50, instead of CIDR
+	Range string `json:"range,omitempty"`
+	// DNS creates an A record in the DNSView for each IP address allocated to a hostname
+	DNS bool `json:"dns,omitempty"`
+	// PTR creates a PTR record along with the A record
+	PTR bool `json:"ptr,omitempty"`
+	// Mode is the object type that holds the IP addresses, fixedaddress or host
+	Mode string `json:"mode,omitempty"`
+	// NetView is the network view of the label, the network view of the manager when it is empty
+	NetView string `json:"netView,omitempty"`
+	// Grid is the name of the grid of the label, the DefaultGrid when it is empty
+	Grid string `json:"grid,omitempty"`
 }
 
 func NewInfobloxManager(params InfobloxParams) (*InfobloxManager, error) {
-	hostConfig := ibxclient.HostConfig{
-		Host:     params.Host,
-		Version:  params.Version,
-		Port:     params.Port,
-		Username: params.Username,
-		Password: params.Password,
-	}
-
 	labels, err := ParseLabels(params.IbLabelMap)
 	if err != nil {
 		return nil, err
 	}
 
-	// TransportConfig params: sslVerify, httpRequestsTimeout, httpPoolConnections
-	// These are the common values
-	transportConfig := ibxclient.NewTransportConfig(params.SslVerify, 20, 10)
-	requestBuilder := &ibxclient.WapiRequestBuilder{}
-	requestor := &ibxclient.WapiHttpRequestor{}
-	connector, err := ibxclient.NewConnector(hostConfig, transportConfig, requestBuilder, requestor)
+	extraEAs, err := ParseExtraEAs(params.ExtraEAs)
 	if err != nil {
 		return nil, err
 	}
-	objMgr := ibxclient.NewObjectManager(connector, "F5IPAM", "0")
-
-	objMgr.OmitCloudAttrs = true
 
-	// Create an Extensible Attribute for resource tracking
-	if eaDef, _ := objMgr.GetEADefinition(EAKey); eaDef == nil {
-		eaDef := ibxclient.EADefinition{
-			Name:    EAKey,
-			Type:    "STRING",
-			Comment: "Managed by the F5 IPAM Controller",
+	defaultGrid := GridParams{
+		Host:      params.Host,
+		Port:      params.Port,
+		Version:   params.Version,
+		Username:  params.Username,
+		Password:  params.Password,
+		SslVerify: params.SslVerify,
+	}
+	gridParams, err := ParseGrids(params.Grids, defaultGrid)
+	if err != nil {
+		return nil, err
+	}
+	grids := map[string]*infobloxGrid{DefaultGrid: newInfobloxGrid(DefaultGrid, defaultGrid)}
+	for name, grid := range gridParams {
+		grids[name] = newInfobloxGrid(name, grid)
+	}
+	for name, label := range labels {
+		if _, ok := grids[gridName(label)]; !ok {
+			return nil, fmt.Errorf("grid %v not found for label %v", label.Grid, name)
 		}
-		_, err = objMgr.CreateEADefinition(eaDef)
-		if err != nil {
+	}
+
+	ibMgr := &InfobloxManager{
+		grids:       grids,
+		ea:          ibxclient.EA{EAKey: EAVal},
+		IBLabels:    labels,
+		NetView:     params.NetView,
+		ClusterName: params.ClusterName,
+		extraEAs:    extraEAs,
+		cache:       newIPCache(params.CacheTTL),
+	}
+	err = ibMgr.connect()
+	if err != nil {
+		// Only an unreachable grid is retried, the errors of the configuration fail at once
+		if !params.RetryConnect || !isTransient(err) {
 			return nil, err
 		}
+		log.Errorf("[IPMG] Unable to connect to Infoblox, retrying in the background, Error: %v", err)
+		go retryConnect("Infoblox", ibMgr.connect, isTransient)
 	}
+	return ibMgr, nil
+}
 
-	ibMgr := &InfobloxManager{
-		connector: &ConnectorHandler{connector},
-		objMgr:    &ObjMgrHandler{objMgr},
-		ea:        ibxclient.EA{EAKey: EAVal},
-		IBLabels:  labels,
-		NetView:   params.NetView,
+// UpdateCredentials connects to the grid with the host, port, username, password and certificate of the params.
+// The current connection is kept when the grid does not accept them
+func (infMgr *InfobloxManager) UpdateCredentials(grid string, params GridParams) error {
+	if grid == "" {
+		grid = DefaultGrid
+	}
+	ibGrid, ok := infMgr.grids[grid]
+	if !ok {
+		return fmt.Errorf("grid %v not found", grid)
+	}
+	return ibGrid.updateCredentials(params)
+}
+
+// connect connects to the grids that are not connected yet. A grid that is unreachable does not keep
+// the other grids from connecting, the errors that retrying does not fix are returned at once
+func (infMgr *InfobloxManager) connect() error {
+	var connectErr error
+	for _, name := range infMgr.getGridNames() {
+		grid := infMgr.grids[name]
+		if atomic.LoadInt32(&grid.connected) == 1 {
+			continue
+		}
+		if err := infMgr.connectGrid(grid); err != nil {
+			if !isTransient(err) {
+				return fmt.Errorf("grid %v: %w", name, err)
+			}
+			if connectErr == nil {
+				connectErr = fmt.Errorf("grid %v: %w", name, err)
+			}
+		}
 	}
-	_, err = ibMgr.objMgr.GetNetworkView(ibMgr.NetView)
+	return connectErr
+}
+
+// connectGrid validates the connection to the grid, creates the Extensible Attributes for resource tracking
+// and validates the network views and the labels of the grid
+func (infMgr *InfobloxManager) connectGrid(grid *infobloxGrid) error {
+	err := ibxclient.ValidateConnector(grid.connector().Connector)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	eaDefs := map[string]string{EAKey: "Managed by the F5 IPAM Controller"}
+	if infMgr.ClusterName != "" {
+		eaDefs[ClusterEAKey] = "Cluster of the F5 IPAM Controller"
+	}
+	for _, label := range infMgr.IBLabels {
+		if gridName(label) == grid.name && label.Mode == HostRecordMode {
+			eaDefs[ReferenceEAKey] = "Hostname or key of the F5 IPAM Controller"
+		}
+	}
+	for name := range infMgr.extraEAs {
+		eaDefs[name] = "Set by the F5 IPAM Controller"
+	}
+	for name, comment := range eaDefs {
+		if eaDef, _ := grid.objMgr().GetEADefinition(name); eaDef == nil {
+			eaDef := ibxclient.EADefinition{
+				Name:    name,
+				Type:    "STRING",
+				Comment: comment,
+			}
+			_, err = grid.objMgr().CreateEADefinition(eaDef)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = infMgr.validateNetViews(grid); err != nil {
+		return err
 	}
 	// Validating that dnsView, CIDR exist on infoblox Server
-	for _, parameter := range labels {
-		result, err := ibMgr.validateIPAMLabels(parameter.DNSView, parameter.CIDR)
+	for name, parameter := range infMgr.IBLabels {
+		if gridName(parameter) != grid.name {
+			continue
+		}
+		result, err := infMgr.validateIPAMLabels(parameter)
 		if !result {
-			return nil, err
+			return fmt.Errorf("%w for label %v", err, name)
 		}
 	}
-	return ibMgr, nil
+	infMgr.warmCache(grid.name)
+	atomic.StoreInt32(&grid.connected, 1)
+	return nil
+}
+
+// validateNetViews validates that the network views of the labels of the grid exist on it
+func (infMgr *InfobloxManager) validateNetViews(grid *infobloxGrid) error {
+	netViews := make(map[string]bool)
+	if grid.name == DefaultGrid {
+		netViews[infMgr.NetView] = true
+	}
+	for _, label := range infMgr.IBLabels {
+		if gridName(label) == grid.name {
+			netViews[infMgr.netView(label)] = true
+		}
+	}
+	for netView := range netViews {
+		ibNetView, err := grid.objMgr().GetNetworkView(netView)
+		if err != nil {
+			return err
+		}
+		if ibNetView == nil {
+			return fmt.Errorf("network view %v not found", netView)
+		}
+	}
+	return nil
+}
+
+// IsReady checks whether the manager is connected to a grid that is reachable, the labels of the grids
+// that are not are checked by IsLabelReady
+func (infMgr *InfobloxManager) IsReady() bool {
+	for _, grid := range infMgr.grids {
+		if grid.isReady() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLabelReady checks whether the manager is connected to the grid of the label and the grid is reachable
+func (infMgr *InfobloxManager) IsLabelReady(ipamLabel string) bool {
+	label, ok := infMgr.IBLabels[ipamLabel]
+	return ok && infMgr.grid(label).isReady()
 }
 
 func ParseLabels(params string) (map[string]IBConfig, error) {
@@ -129,15 +303,117 @@ func ParseLabels(params string) (map[string]IBConfig, error) {
 		return nil, err
 	}
 	for label, ibParam := range ibLabelMap {
-		// DNSView is being disabled
-		// The below line can be removed when DNSView support is enabled
-		ibParam.DNSView = ""
-
+		if ibParam.PTR && !ibParam.DNS {
+			return nil, fmt.Errorf("ptr requires dns to be enabled for label %v", label)
+		}
+		if err = validateLabelRange(ibParam); err != nil {
+			return nil, fmt.Errorf("%v for label %v", err, label)
+		}
+		switch ibParam.Mode {
+		case "":
+			ibParam.Mode = FixedAddressMode
+		case FixedAddressMode, HostRecordMode:
+		default:
+			return nil, fmt.Errorf("invalid mode %v for label %v", ibParam.Mode, label)
+		}
+		if isIPv6Label(ibParam) {
+			switch {
+			case ibParam.Range != "" || ibParam.NetworkContainer != "":
+				return nil, fmt.Errorf("IPv6 requires cidr or cidrs for label %v", label)
+			case ibParam.Mode != FixedAddressMode:
+				return nil, fmt.Errorf("IPv6 requires mode %v for label %v", FixedAddressMode, label)
+			case ibParam.DNS:
+				return nil, fmt.Errorf("dns is not supported for IPv6 label %v", label)
+			}
+		}
+		// DNSView is used only when DNS records are enabled for the label,
+		// the records left from when they were enabled are searched in every view
+		if !ibParam.DNS {
+			ibParam.DNSView = ""
+		} else if ibParam.DNSView == "" {
+			ibParam.DNSView = "default"
+		}
 		ibLabelMap[label] = ibParam
 	}
 	return ibLabelMap, nil
 }
 
+// ParseExtraEAs parses the extensible attributes to write on every allocation
+func ParseExtraEAs(params string) (map[string]string, error) {
+	extraEAs := make(map[string]string)
+	if params == "" {
+		return extraEAs, nil
+	}
+	err := json.Unmarshal([]byte(params), &extraEAs)
+	if err != nil {
+		return nil, err
+	}
+	for name := range extraEAs {
+		if name == EAKey || name == ClusterEAKey || name == ReferenceEAKey {
+			return nil, fmt.Errorf("extensible attribute %v is set by the controller", name)
+		}
+	}
+	return extraEAs, nil
+}
+
+// objectEA returns the extensible attributes of the objects created for the request
+func (infMgr *InfobloxManager) objectEA(req ipamspec.IPAMRequest, name string) ibxclient.EA {
+	ea := ibxclient.EA{}
+	for k, v := range infMgr.ea {
+		ea[k] = v
+	}
+	if infMgr.ClusterName != "" {
+		ea[ClusterEAKey] = infMgr.ClusterName
+	}
+	var rscName, rscNamespace string
+	if meta, ok := req.Metadata.(ipamspec.ResourceMetadata); ok {
+		rscName, rscNamespace = meta.GetName(), meta.GetNamespace()
+	}
+	replacer := strings.NewReplacer(
+		"{cluster}", infMgr.ClusterName,
+		"{namespace}", rscNamespace,
+		"{name}", rscName,
+		"{reference}", name,
+	)
+	for k, v := range infMgr.extraEAs {
+		// Infoblox does not accept empty values
+		if val := replacer.Replace(v); val != "" {
+			ea[k] = val
+		}
+	}
+	return ea
+}
+
+// allocationEA returns the extensible attributes of the fixed address, or the host record, of the
+// request. Host records keep the hostname/key of the request in ReferenceEAKey
+func (infMgr *InfobloxManager) allocationEA(label IBConfig, req ipamspec.IPAMRequest) ibxclient.EA {
+	ref := objectReference(label, req)
+	ea := infMgr.objectEA(req, ref)
+	if label.Mode == HostRecordMode {
+		ea[ReferenceEAKey] = ref
+	}
+	return ea
+}
+
+// scopeEA returns the extensible attributes that the objects of this cluster carry
+func (infMgr *InfobloxManager) scopeEA() ibxclient.EA {
+	ea := ibxclient.EA{EAKey: EAVal}
+	if infMgr.ClusterName != "" {
+		ea[ClusterEAKey] = infMgr.ClusterName
+	}
+	return ea
+}
+
+// isOwned checks whether the object with the extensible attributes belongs to this cluster
+func (infMgr *InfobloxManager) isOwned(ea ibxclient.EA) bool {
+	for k, v := range infMgr.scopeEA() {
+		if val, ok := ea[k]; !ok || val != v {
+			return false
+		}
+	}
+	return true
+}
+
 // CreateARecord Creates an A record
 func (infMgr *InfobloxManager) CreateARecord(req ipamspec.IPAMRequest) bool {
 	if req.IPAddr == "" || req.HostName == "" {
@@ -154,30 +430,84 @@ func (infMgr *InfobloxManager) CreateARecord(req ipamspec.IPAMRequest) bool {
 		return false
 	}
 
-	_, err := infMgr.objMgr.CreateARecord(
-		infMgr.NetView,
+	recA, err := infMgr.grid(label).objMgr().CreateARecord(
+		infMgr.netView(label),
 		label.DNSView,
 		req.HostName,
 		label.CIDR,
 		req.IPAddr,
-		infMgr.ea,
+		infMgr.objectEA(req, req.HostName),
 	)
 	if err != nil {
 		log.Errorf("[IPMG] Unable to Create 'A' Record. Error: %v", err)
 		return false
 	}
 
+	if label.PTR {
+		_, err = infMgr.grid(label).objMgr().CreatePTRRecord(
+			infMgr.netView(label),
+			label.DNSView,
+			req.HostName,
+			label.CIDR,
+			req.IPAddr,
+			infMgr.objectEA(req, req.HostName),
+		)
+		if err != nil {
+			log.Errorf("[IPMG] Unable to Create 'PTR' Record. Error: %v", err)
+			if _, err = infMgr.grid(label).objMgr().DeleteARecord(recA.Ref); err != nil {
+				log.Errorf("[IPMG] Unable to Delete 'A' Record of %v. Error: %v", req.HostName, err)
+			}
+			return false
+		}
+	}
+
 	return true
 }
 
-// DeleteARecord Deletes an A record and releases the IP address
+// DeleteARecord Deletes the A record, and the PTR record, of the hostname
 func (infMgr *InfobloxManager) DeleteARecord(req ipamspec.IPAMRequest) {
-	res := infMgr.getARecords(req)
+	if err := infMgr.RemoveARecord(req); err != nil {
+		log.Errorf("[IPMG] Unable to Delete DNS Records of %v. Error: %v", req.HostName, err)
+	}
+}
+
+// RemoveARecord Deletes the A record, and the PTR record, of the hostname, the failures of the grid are returned
+// The records are searched in every DNS view once DNS is disabled for the label
+func (infMgr *InfobloxManager) RemoveARecord(req ipamspec.IPAMRequest) error {
+	label, ok := infMgr.IBLabels[req.IPAMLabel]
+	if !ok {
+		return nil
+	}
+	recordsA, err := infMgr.getARecords(req)
+	if err != nil {
+		return err
+	}
+	for _, recA := range recordsA {
+		if req.IPAddr != "" && recA.Ipv4Addr != req.IPAddr {
+			continue
+		}
+		if _, err = infMgr.grid(label).objMgr().DeleteARecord(recA.Ref); err != nil {
+			return fmt.Errorf("unable to delete 'A' record %v: %v", recA.Ref, err)
+		}
+	}
 
-	_, err := infMgr.objMgr.DeleteARecord(res[0].Ref)
+	recordsPTR, err := infMgr.getPTRRecords(req)
 	if err != nil {
-		log.Errorf("[IPMG] 'A' Record not available, %+v", req)
+		return err
+	}
+	for _, recPTR := range recordsPTR {
+		if _, err = infMgr.grid(label).objMgr().DeletePTRRecord(recPTR.Ref); err != nil {
+			return fmt.Errorf("unable to delete 'PTR' record %v: %v", recPTR.Ref, err)
+		}
 	}
+	return nil
+}
+
+// IsDNSEnabled Checks whether DNS records are to be created for the IPAM label
+// The host records of the labels in host mode hold the DNS records themselves
+func (infMgr *InfobloxManager) IsDNSEnabled(ipamLabel string) bool {
+	label, ok := infMgr.IBLabels[ipamLabel]
+	return ok && label.DNS && label.Mode != HostRecordMode
 }
 
 // GetIPAddress Gets IP Address associated with hostname
@@ -199,48 +529,137 @@ func (infMgr *InfobloxManager) GetIPAddress(req ipamspec.IPAMRequest) string {
 	//	return ""
 	//}
 
-	ip := infMgr.getIPAddressFromName(req)
-
+	ip, err := infMgr.getIPAddressFromName(req)
+	if err != nil {
+		log.Errorf("[IPMG] Unable to get IP Address of %+v, Error: %v", req, err)
+	}
 	return ip
 }
 
+// LookupIPAddress Gets the IP Address of the hostname/key, the failures of the grid are returned
+func (infMgr *InfobloxManager) LookupIPAddress(req ipamspec.IPAMRequest) (string, error) {
+	if req.HostName == "" && req.Key == "" {
+		return "", nil
+	}
+	return infMgr.getIPAddressFromName(req)
+}
+
 // GetNextIPAddress Gets and reserves the next available IP address
 func (infMgr *InfobloxManager) AllocateNextIPAddress(req ipamspec.IPAMRequest) string {
 	label, ok := infMgr.IBLabels[req.IPAMLabel]
 	if !ok {
 		return ""
 	}
-	name := req.HostName
-	if req.Key != "" {
-		name = req.Key
-	}
-	fixedAddr, err := infMgr.objMgr.AllocateIP(infMgr.NetView, label.CIDR, "", "", name, infMgr.ea)
+	name, err := objectName(label, req)
 	if err != nil {
-		log.Errorf("[IPMG] Unable to Get a New IP Address: %+v", req)
+		log.Errorf("[IPMG] Invalid Request to Get a New IP Address: %+v, Error: %v", req, err)
 		return ""
 	}
-	return fixedAddr.IPAddress
+	// The next available IP address comes from the first network, or range, with space
+	for _, child := range infMgr.getLabelChildren(label) {
+		ipAddr, err := infMgr.allocate(label, child, "", name, infMgr.allocationEA(label, req))
+		if err == nil {
+			infMgr.cache.add(req.IPAMLabel, name, ipAddr)
+			return ipAddr
+		}
+		log.Debugf("[IPMG] Unable to Get a New IP Address from %v, Error: %v", child, err)
+	}
+	log.Errorf("[IPMG] Unable to Get a New IP Address: %+v", req)
+	return ""
+}
+
+// ReserveIPAddress Reserves the IP address given in the request
+func (infMgr *InfobloxManager) ReserveIPAddress(req ipamspec.IPAMRequest) bool {
+	label, ok := infMgr.IBLabels[req.IPAMLabel]
+	if !ok || !utils.IsIPAddr(req.IPAddr) {
+		log.Errorf("[IPMG] Invalid Request to Reserve IP Address: %+v", req)
+		return false
+	}
+	name, err := objectName(label, req)
+	if err != nil {
+		log.Errorf("[IPMG] Invalid Request to Reserve IP Address: %+v, Error: %v", req, err)
+		return false
+	}
+	if !utils.IsIPInRange(req.IPAddr, labelRange(label)) {
+		log.Errorf("[IPMG] IP Address not in the range of label: %+v", req)
+		return false
+	}
+	_, err = infMgr.allocate(label, infMgr.networkOf(label, req.IPAddr), req.IPAddr, name, infMgr.allocationEA(label, req))
+	if err != nil {
+		log.Errorf("[IPMG] Unable to Reserve IP Address: %+v, Error: %v", req, err)
+		return false
+	}
+	infMgr.cache.add(req.IPAMLabel, name, req.IPAddr)
+	return true
+}
+
+// ValidateRequest Checks the IPAM label, the IP address and the name of the request
+func (infMgr *InfobloxManager) ValidateRequest(req ipamspec.IPAMRequest) error {
+	label, ok := infMgr.IBLabels[req.IPAMLabel]
+	if !ok {
+		return fmt.Errorf("unknown IPAM label %v", req.IPAMLabel)
+	}
+	if err := validateIPAddress(req, labelRange(label)); err != nil {
+		return err
+	}
+	_, err := objectName(label, req)
+	return err
 }
 
 // ReleaseIPAddress Releases an IP address
 func (infMgr *InfobloxManager) ReleaseIPAddress(req ipamspec.IPAMRequest) {
+	if err := infMgr.RemoveIPAddress(req); err != nil {
+		log.Errorf("[IPMG] Unable to Release IP Address: %+v, Error: %v", req, err)
+	}
+}
+
+// RemoveIPAddress Releases an IP address, the failures of the grid are returned
+func (infMgr *InfobloxManager) RemoveIPAddress(req ipamspec.IPAMRequest) error {
 	label, ok := infMgr.IBLabels[req.IPAMLabel]
 	if !ok {
-		return
+		return nil
 	}
-	_, err := infMgr.objMgr.ReleaseIP(infMgr.NetView, label.CIDR, req.IPAddr, "")
+	infMgr.cache.remove(req.IPAMLabel, req.IPAddr)
+	if label.Mode == HostRecordMode {
+		hostRecords, err := infMgr.getHostRecords(label, "", req.IPAddr)
+		if err != nil {
+			return err
+		}
+		for _, hostRecord := range hostRecords {
+			if _, err = infMgr.grid(label).objMgr().DeleteHostRecord(hostRecord.Ref); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	fixedAddr := &managedFixedAddress{
+		NetviewName: infMgr.netView(label),
+		Cidr:        infMgr.networkOf(label, req.IPAddr),
+		IPAddress:   req.IPAddr,
+	}
+	returnFixedAddresses, err := infMgr.searchFixedAddressObjects(label, fixedAddr)
 	if err != nil {
-		log.Errorf("[IPMG] Unable to Release IP Address: %+v", req)
+		return err
 	}
-	return
+	for _, fixedAddress := range returnFixedAddresses {
+		// The fixed addresses of other clusters are never released
+		if !infMgr.isOwned(fixedAddress.Ea) {
+			log.Warningf("[IPMG] IP Address %v is not owned by this cluster, skipped releasing it", req.IPAddr)
+			continue
+		}
+		if _, err = infMgr.grid(label).objMgr().DeleteFixedAddress(fixedAddress.Ref); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (infMgr *InfobloxManager) getARecords(req ipamspec.IPAMRequest) []ibxclient.RecordA {
+func (infMgr *InfobloxManager) getARecords(req ipamspec.IPAMRequest) ([]ibxclient.RecordA, error) {
 	var res []ibxclient.RecordA
 
 	label, ok := infMgr.IBLabels[req.IPAMLabel]
 	if !ok {
-		return nil
+		return nil, nil
 	}
 
 	recA := ibxclient.NewRecordA(ibxclient.RecordA{
@@ -248,57 +667,633 @@ func (infMgr *InfobloxManager) getARecords(req ipamspec.IPAMRequest) []ibxclient
 		View: label.DNSView,
 	})
 
-	err := infMgr.connector.GetObject(recA, "", &res)
-	if err != nil || len(res) == 0 {
-		log.Errorf("[IPMG] 'A' Record not available, %+v", req)
-		return nil
+	err := infMgr.grid(label).connector().GetObject(recA, "", &res)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get 'A' records of %v: %v", req.HostName, err)
+	}
+	var records []ibxclient.RecordA
+	for _, record := range res {
+		if infMgr.isOwned(record.Ea) {
+			records = append(records, record)
+		}
 	}
-	return res
+	return records, nil
 }
 
-func (infMgr *InfobloxManager) getIPAddressFromName(req ipamspec.IPAMRequest) (ip string) {
-	var returnFixedAddresses []ibxclient.FixedAddress
+func (infMgr *InfobloxManager) getPTRRecords(req ipamspec.IPAMRequest) ([]ibxclient.RecordPTR, error) {
+	var res []ibxclient.RecordPTR
 
 	label, ok := infMgr.IBLabels[req.IPAMLabel]
 	if !ok {
-		return ""
+		return nil, nil
 	}
 
-	name := req.HostName
-	if req.Key != "" {
-		name = req.Key
+	recPTR := ibxclient.NewRecordPTR(ibxclient.RecordPTR{
+		PtrdName: req.HostName,
+		Ipv4Addr: req.IPAddr,
+		View:     label.DNSView,
+	})
+
+	err := infMgr.grid(label).connector().GetObject(recPTR, "", &res)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get 'PTR' records of %v: %v", req.HostName, err)
+	}
+	var records []ibxclient.RecordPTR
+	for _, record := range res {
+		if infMgr.isOwned(record.Ea) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (infMgr *InfobloxManager) getIPAddressFromName(req ipamspec.IPAMRequest) (string, error) {
+	label, ok := infMgr.IBLabels[req.IPAMLabel]
+	if !ok {
+		return "", nil
 	}
 
-	fixedAddr := ibxclient.NewFixedAddress(ibxclient.FixedAddress{
-		NetviewName: infMgr.NetView,
-		Cidr:        label.CIDR,
+	name, err := objectName(label, req)
+	if err != nil {
+		return "", nil
+	}
+
+	if ipAddr, ok := infMgr.cache.get(req.IPAMLabel, name); ok {
+		return ipAddr, nil
+	}
+
+	if label.Mode == HostRecordMode {
+		hostRecords, err := infMgr.getHostRecords(label, name, "")
+		if err != nil {
+			return "", err
+		}
+		for _, hostRecord := range hostRecords {
+			infMgr.cache.add(req.IPAMLabel, name, hostRecord.Ipv4Addr)
+			return hostRecord.Ipv4Addr, nil
+		}
+		return "", nil
+	}
+
+	returnFixedAddresses, err := infMgr.searchFixedAddresses(label, name)
+	if err != nil {
+		return "", err
+	}
+
+	for _, fixedAddress := range returnFixedAddresses {
+		if fixedAddress.Name == name && infMgr.isOwned(fixedAddress.Ea) {
+			infMgr.cache.add(req.IPAMLabel, name, fixedAddress.IPAddress)
+			return fixedAddress.IPAddress, nil
+		}
+	}
+	return "", nil
+}
+
+// GetLabelUsage Gets the IPAM labels along with their utilisation
+func (infMgr *InfobloxManager) GetLabelUsage() []LabelUsage {
+	var usage []LabelUsage
+	for _, ipamLabel := range infMgr.getLabelNames() {
+		label := infMgr.IBLabels[ipamLabel]
+		usage = append(usage, LabelUsage{
+			IPAMLabel: ipamLabel,
+			Range:     labelRange(label),
+			Total:     rangeSize(labelRange(label)),
+			Allocated: len(infMgr.getLabelAllocations(ipamLabel)),
+		})
+	}
+	return usage
+}
+
+// GetAllocations Gets the allocations of the IPAM label
+func (infMgr *InfobloxManager) GetAllocations(ipamLabel string) []Allocation {
+	labels := []string{ipamLabel}
+	if ipamLabel == "" {
+		labels = infMgr.getLabelNames()
+	}
+	var allocations []Allocation
+	for _, label := range labels {
+		allocations = append(allocations, infMgr.getLabelAllocations(label)...)
+	}
+	return allocations
+}
+
+// getLabelAllocations returns the allocations of the label from its fixed addresses or host records
+func (infMgr *InfobloxManager) getLabelAllocations(ipamLabel string) []Allocation {
+	label, ok := infMgr.IBLabels[ipamLabel]
+	if !ok {
+		return nil
+	}
+	var allocations []Allocation
+	if label.Mode == HostRecordMode {
+		hostRecords, err := infMgr.getHostRecords(label, "", "")
+		if err != nil {
+			log.Errorf("[IPMG] Unable to get Host Records of %v, Error: %v", labelRange(label), err)
+		}
+		for _, hostRecord := range hostRecords {
+			// The host records created before ReferenceEAKey are named after their hostname
+			ref, ok := hostRecord.Ea[ReferenceEAKey].(string)
+			if !ok || ref == "" {
+				ref = hostRecord.Name
+			}
+			allocations = append(allocations, NewAllocation(ipamLabel, hostRecord.Ipv4Addr, ref))
+		}
+	} else {
+		for _, fixedAddress := range infMgr.getFixedAddresses(ipamLabel) {
+			allocations = append(allocations, NewAllocation(ipamLabel, fixedAddress.IPAddress, fixedAddress.Name))
+		}
+	}
+	sortAllocations(allocations)
+	return allocations
+}
+
+// allocate reserves the IP address, or the next available IP address of the network or range when it
+// is empty, as a fixed address or a host record depending on the mode of the label
+func (infMgr *InfobloxManager) allocate(label IBConfig, child, ipAddr, name string, ea ibxclient.EA) (string, error) {
+	if label.Mode == HostRecordMode {
+		hostRecord, err := infMgr.grid(label).objMgr().CreateHostRecord(
+			label.DNS,
+			name,
+			infMgr.netView(label),
+			label.DNSView,
+			child,
+			ipAddr,
+			"",
+			ea,
+		)
+		if err != nil {
+			return "", err
+		}
+		if hostRecord == nil || len(hostRecord.Ipv4Addrs) == 0 {
+			return "", fmt.Errorf("host record %v has no IP address", name)
+		}
+		return hostRecord.Ipv4Addrs[0].Ipv4Addr, nil
+	}
+	if isIPv6Label(label) {
+		return infMgr.allocateIPv6(label, child, ipAddr, name, ea)
+	}
+	if ipAddr == "" && isIPRange(child) {
+		// The network of a fixed address is not known before it is allocated from a range
+		fixedAddr := ibxclient.NewFixedAddress(ibxclient.FixedAddress{
+			NetviewName: infMgr.netView(label),
+			IPAddress:   fmt.Sprintf("func:nextavailableip:%s,%s", child, infMgr.netView(label)),
+			Mac:         ibxclient.MACADDR_ZERO,
+			Name:        name,
+			Ea:          ea,
+		})
+		ref, err := infMgr.grid(label).connector().CreateObject(fixedAddr)
+		if err != nil {
+			return "", err
+		}
+		return ibxclient.GetIPAddressFromRef(ref), nil
+	}
+	fixedAddr, err := infMgr.grid(label).objMgr().AllocateIP(infMgr.netView(label), child, ipAddr, "", name, ea)
+	if err != nil {
+		return "", err
+	}
+	return fixedAddr.IPAddress, nil
+}
+
+// objectReference returns the hostname/key that the fixed address, or the host record, of the request
+// is allocated for. Host records hold the DNS records of the hostname, so they prefer it to the key
+func objectReference(label IBConfig, req ipamspec.IPAMRequest) string {
+	if (label.Mode == HostRecordMode && req.HostName != "") || req.Key == "" {
+		return req.HostName
+	}
+	return req.Key
+}
+
+// objectName returns the name of the fixed address, or the host record, of the request.
+// Host records with DNS enabled are named after the hostname, as they hold its DNS records,
+// the others after their reference turned into a DNS name
+func objectName(label IBConfig, req ipamspec.IPAMRequest) (string, error) {
+	if label.Mode != HostRecordMode {
+		return objectReference(label, req), nil
+	}
+	if !label.DNS {
+		return hostRecordName(objectReference(label, req)), nil
+	}
+	if req.HostName == "" {
+		return "", fmt.Errorf("host records with DNS enabled require a hostname")
+	}
+	name := strings.ToLower(strings.TrimSuffix(req.HostName, "."))
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+		return "", fmt.Errorf("invalid host record name %v: %v", name, strings.Join(errs, ", "))
+	}
+	return name, nil
+}
+
+// hostRecordName returns the DNS name of the host record of a hostname/key, the key namespace/name
+// becomes name.namespace. The characters that DNS names do not allow are replaced with "-", and a
+// hash of the reference is then added to the first label so that the references do not share a name
+func hostRecordName(ref string) string {
+	name := strings.ToLower(strings.TrimSuffix(ref, "."))
+	if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+		name = parts[1] + "." + parts[0]
+	}
+	if len(validation.IsDNS1123Subdomain(name)) == 0 {
+		return name
+	}
+	hash := sha256.Sum256([]byte(ref))
+	suffix := hex.EncodeToString(hash[:4])
+	var labels []string
+	for _, label := range strings.Split(name, ".") {
+		label = strings.Trim(invalidDNSChars.ReplaceAllString(label, "-"), "-")
+		if label != "" {
+			labels = append(labels, label)
+		}
+	}
+	if len(labels) == 0 {
+		labels = []string{"fic"}
+	}
+	if len(labels[0]) > validation.DNS1123LabelMaxLength-len(suffix)-1 {
+		labels[0] = strings.TrimSuffix(labels[0][:validation.DNS1123LabelMaxLength-len(suffix)-1], "-")
+	}
+	labels[0] += "-" + suffix
+	name = strings.Join(labels, ".")
+	if len(validation.IsDNS1123Subdomain(name)) != 0 {
+		return "fic-" + hex.EncodeToString(hash[:8])
+	}
+	return name
+}
+
+// allocateIPv6 reserves the IP address, or the next available IP address of the network when it is empty,
+// as an ipv6fixedaddress
+func (infMgr *InfobloxManager) allocateIPv6(label IBConfig, network, ipAddr, name string, ea ibxclient.EA) (string, error) {
+	if ipAddr == "" {
+		ipAddr = fmt.Sprintf("func:nextavailableip:%s,%s", network, infMgr.netView(label))
+	}
+	fixedAddr := &newIPv6FixedAddress{
+		ipv6FixedAddress: ipv6FixedAddress{
+			NetviewName: infMgr.netView(label),
+			Cidr:        network,
+			IPAddress:   ipAddr,
+			Name:        name,
+			Ea:          ea,
+		},
+		Duid: duidZero,
+	}
+	ref, err := infMgr.grid(label).connector().CreateObject(fixedAddr)
+	if err != nil {
+		return "", err
+	}
+	return ipv6AddressFromRef(ref), nil
+}
+
+// getLabelChildren returns the networks, or the range, of the label in the order of allocation
+func (infMgr *InfobloxManager) getLabelChildren(label IBConfig) []string {
+	switch {
+	case label.Range != "":
+		return []string{label.Range}
+	case len(label.CIDRs) != 0:
+		return label.CIDRs
+	case label.NetworkContainer != "":
+		return infMgr.getContainerNetworks(label)
+	}
+	return []string{label.CIDR}
+}
+
+// getContainerNetworks returns the networks of the network container of the label, and of the network containers
+// nested in it, in the order of their addresses
+func (infMgr *InfobloxManager) getContainerNetworks(label IBConfig) []string {
+	networks, err := infMgr.containerNetworks(label, label.NetworkContainer)
+	if err != nil {
+		log.Errorf("[IPMG] Unable to get Networks of Network Container %v, Error: %v", label.NetworkContainer, err)
+		return nil
+	}
+	sort.Slice(networks, func(i, j int) bool {
+		ipI, _, _ := net.ParseCIDR(networks[i])
+		ipJ, _, _ := net.ParseCIDR(networks[j])
+		return bytes.Compare(ipI.To16(), ipJ.To16()) < 0
 	})
+	return networks
+}
 
-	err := infMgr.connector.GetObject(fixedAddr, "", &returnFixedAddresses)
+// containerNetworks walks the network container, the search of networks returns only its direct children
+func (infMgr *InfobloxManager) containerNetworks(label IBConfig, container string) ([]string, error) {
+	var res []containerNetwork
+	search := &containerNetwork{
+		NetworkView:      infMgr.netView(label),
+		NetworkContainer: container,
+	}
+	if err := infMgr.grid(label).connector().GetObject(search, "", &res); err != nil {
+		return nil, err
+	}
+	var networks []string
+	for _, network := range res {
+		networks = append(networks, network.Network)
+	}
 
-	if err != nil || returnFixedAddresses == nil || len(returnFixedAddresses) == 0 {
-		log.Errorf("[Infoblox] IP not available, %+v", req)
-		return ""
+	var nested []nestedContainer
+	nestedSearch := &nestedContainer{
+		NetworkView:      infMgr.netView(label),
+		NetworkContainer: container,
+	}
+	if err := infMgr.grid(label).connector().GetObject(nestedSearch, "", &nested); err != nil {
+		return nil, err
+	}
+	for _, child := range nested {
+		childNetworks, err := infMgr.containerNetworks(label, child.Network)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, childNetworks...)
 	}
+	return networks, nil
+}
+
+// searchFixedAddresses returns the fixed addresses of this cluster in the networks, or the range, of the label,
+// filtered by the name when it is given
+func (infMgr *InfobloxManager) searchFixedAddresses(label IBConfig, name string) ([]managedFixedAddress, error) {
+	var fixedAddresses []managedFixedAddress
 
+	children := infMgr.getLabelChildren(label)
+	if label.Range != "" || name != "" {
+		// Fixed addresses cannot be searched by range, they are searched in the network view.
+		// The name and the extensible attributes are selective enough to search the network view as well
+		children = []string{""}
+	}
+	for _, child := range children {
+		fixedAddr := &managedFixedAddress{
+			eaSearch:    ibxclient.EASearch(infMgr.scopeEA()),
+			NetviewName: infMgr.netView(label),
+			Cidr:        child,
+			Name:        name,
+		}
+		returnFixedAddresses, err := infMgr.searchFixedAddressObjects(label, fixedAddr)
+		if err != nil {
+			return nil, err
+		}
+		for _, fixedAddress := range returnFixedAddresses {
+			if utils.IsIPInRange(fixedAddress.IPAddress, labelRange(label)) {
+				fixedAddresses = append(fixedAddresses, fixedAddress)
+			}
+		}
+	}
+	return fixedAddresses, nil
+}
+
+// searchFixedAddressObjects gets the fixed addresses matching the search, the ipv6fixedaddress objects
+// for the IPv6 labels
+func (infMgr *InfobloxManager) searchFixedAddressObjects(label IBConfig, search *managedFixedAddress) ([]managedFixedAddress, error) {
+	var fixedAddresses []managedFixedAddress
+	if !isIPv6Label(label) {
+		err := infMgr.grid(label).searchObjects(search, &fixedAddresses)
+		return fixedAddresses, err
+	}
+	var ipv6FixedAddresses []ipv6FixedAddress
+	err := infMgr.grid(label).searchObjects((*ipv6FixedAddress)(search), &ipv6FixedAddresses)
+	for _, fixedAddress := range ipv6FixedAddresses {
+		fixedAddresses = append(fixedAddresses, managedFixedAddress(fixedAddress))
+	}
+	return fixedAddresses, err
+}
+
+// getHostRecords returns the host records of the label that are managed by the controller,
+// filtered by the name and the IP address when they are given. Each record carries the IP address
+// of the label in Ipv4Addr
+func (infMgr *InfobloxManager) getHostRecords(label IBConfig, name, ipAddr string) ([]managedHostRecord, error) {
+	var returnHostRecords []managedHostRecord
+
+	search := &managedHostRecord{
+		eaSearch:    ibxclient.EASearch(infMgr.scopeEA()),
+		Name:        name,
+		Ipv4Addr:    ipAddr,
+		NetworkView: infMgr.netView(label),
+	}
+	err := infMgr.grid(label).searchObjects(search, &returnHostRecords)
+	if err != nil {
+		return nil, err
+	}
+
+	var hostRecords []managedHostRecord
+	for _, hostRecord := range returnHostRecords {
+		if !infMgr.isOwned(hostRecord.Ea) {
+			continue
+		}
+		for _, addr := range hostRecord.Ipv4Addrs {
+			if (ipAddr == "" || addr.Ipv4Addr == ipAddr) && utils.IsIPInRange(addr.Ipv4Addr, labelRange(label)) {
+				hostRecord.Ipv4Addr = addr.Ipv4Addr
+				hostRecords = append(hostRecords, hostRecord)
+				break
+			}
+		}
+	}
+	return hostRecords, nil
+}
+
+func (infMgr *InfobloxManager) getLabelNames() []string {
+	var labels []string
+	for ipamLabel := range infMgr.IBLabels {
+		labels = append(labels, ipamLabel)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// getFixedAddresses returns the fixed addresses of the label that are managed by the controller
+func (infMgr *InfobloxManager) getFixedAddresses(ipamLabel string) []managedFixedAddress {
+	label, ok := infMgr.IBLabels[ipamLabel]
+	if !ok {
+		return nil
+	}
+
+	returnFixedAddresses, err := infMgr.searchFixedAddresses(label, "")
+	if err != nil {
+		log.Errorf("[IPMG] Unable to get Fixed Addresses of label %v, Error: %v", ipamLabel, err)
+		return nil
+	}
+
+	var fixedAddresses []managedFixedAddress
 	for _, fixedAddress := range returnFixedAddresses {
-		if fixedAddress.Name == name {
-			return fixedAddress.IPAddress
+		if infMgr.isOwned(fixedAddress.Ea) {
+			fixedAddresses = append(fixedAddresses, fixedAddress)
+		}
+	}
+	return fixedAddresses
+}
+
+// labelRange returns the networks, network container or range of the label, comma separated
+func labelRange(label IBConfig) string {
+	switch {
+	case label.Range != "":
+		return label.Range
+	case len(label.CIDRs) != 0:
+		return strings.Join(label.CIDRs, ",")
+	case label.NetworkContainer != "":
+		return label.NetworkContainer
+	}
+	return label.CIDR
+}
+
+// networkOf returns the network of the label that the IP address is in, empty when it is not known
+func (infMgr *InfobloxManager) networkOf(label IBConfig, ipAddr string) string {
+	switch {
+	case label.NetworkContainer != "":
+		for _, network := range infMgr.getContainerNetworks(label) {
+			if utils.IsIPInRange(ipAddr, network) {
+				return network
+			}
+		}
+		return ""
+	case label.Range != "":
+		// The network of a range is the one that contains its IP addresses
+		var res []containerNetwork
+		search := &containerNetwork{
+			NetworkView:     infMgr.netView(label),
+			ContainsAddress: ipAddr,
+		}
+		err := infMgr.grid(label).connector().GetObject(search, "", &res)
+		if err != nil {
+			log.Errorf("[IPMG] Unable to get the Network of IP Address %v, Error: %v", ipAddr, err)
+			return ""
+		}
+		for _, network := range res {
+			return network.Network
+		}
+		return ""
+	}
+	for _, cidr := range append([]string{label.CIDR}, label.CIDRs...) {
+		if cidr != "" && utils.IsIPInRange(ipAddr, cidr) {
+			return cidr
 		}
 	}
 	return ""
 }
 
-func (infMgr *InfobloxManager) validateIPAMLabels(dnsView, cidr string) (bool, error) {
+// isIPv6Label checks whether the label allocates IPv6 addresses
+func isIPv6Label(label IBConfig) bool {
+	first := strings.Split(labelRange(label), ",")[0]
+	first = strings.Split(strings.Split(first, "/")[0], "-")[0]
+	return utils.IsIPV6Addr(first)
+}
 
-	// DNSView is being disabled
-	// The below code can be uncommented when DNSView support is enabled
-	//if len(dnsView) == 0 {
-	//	return false, fmt.Errorf("dnsView should not be empty")
-	//}
-	_, err := infMgr.objMgr.GetNetwork(infMgr.NetView, cidr, infMgr.ea)
+// isIPRange checks whether it is an IP address range, e.g. 172.16.4.10-172.16.4.50
+func isIPRange(ipRange string) bool {
+	bounds := strings.Split(ipRange, "-")
+	return len(bounds) == 2 && utils.IsIPAddr(bounds[0]) && utils.IsIPAddr(bounds[1])
+}
+
+// validateLabelRange checks that exactly one of cidr, cidrs, networkContainer and range is set
+func validateLabelRange(label IBConfig) error {
+	count := 0
+	for _, set := range []bool{label.CIDR != "", len(label.CIDRs) != 0, label.NetworkContainer != "", label.Range != ""} {
+		if set {
+			count++
+		}
+	}
+	if count != 1 {
+		return fmt.Errorf("exactly one of cidr, cidrs, networkContainer and range is required")
+	}
+	for _, cidr := range append(label.CIDRs, label.CIDR, label.NetworkContainer) {
+		if _, _, err := net.ParseCIDR(cidr); cidr != "" && err != nil {
+			return fmt.Errorf("invalid CIDR %v", cidr)
+		}
+	}
+	if label.Range != "" && !isIPRange(label.Range) {
+		return fmt.Errorf("invalid range %v", label.Range)
+	}
+	for _, cidr := range label.CIDRs {
+		if utils.IsIPV6Addr(strings.Split(cidr, "/")[0]) != isIPv6Label(label) {
+			return fmt.Errorf("cidrs mix IPv4 and IPv6 networks")
+		}
+	}
+	return nil
+}
+
+// rangeSize returns the number of usable IPv4 addresses of the comma separated cidrs and ranges
+func rangeSize(ranges string) int {
+	size := 0
+	for _, rng := range strings.Split(ranges, ",") {
+		if isIPRange(rng) {
+			bounds := strings.Split(rng, "-")
+			startIP, endIP := net.ParseIP(bounds[0]).To4(), net.ParseIP(bounds[1]).To4()
+			if startIP == nil || endIP == nil {
+				continue
+			}
+			if count := int64(binary.BigEndian.Uint32(endIP)) - int64(binary.BigEndian.Uint32(startIP)) + 1; count > 0 {
+				size += int(count)
+			}
+		} else {
+			size += cidrSize(rng)
+		}
+		if size >= 1<<31-1 {
+			return 1<<31 - 1
+		}
+	}
+	return size
+}
+
+// cidrSize returns the number of usable IP addresses of the cidr
+func cidrSize(cidr string) int {
+	_, ipNet, err := net.ParseCIDR(cidr)
 	if err != nil {
-		return false, err
+		return 0
+	}
+	ones, bits := ipNet.Mask.Size()
+	if bits-ones >= 31 {
+		return 1<<31 - 1
+	}
+	size := 1 << uint(bits-ones)
+	// Network and broadcast addresses are not usable, IPv6 networks have no broadcast address
+	if size > 2 && bits == 32 {
+		size -= 2
+	}
+	return size
+}
+
+func (infMgr *InfobloxManager) validateIPAMLabels(label IBConfig) (bool, error) {
+	// dnsView is empty when DNS records are not enabled for the label
+	if label.DNSView != "" {
+		var views []wapiView
+		err := infMgr.grid(label).connector().GetObject(&wapiView{Name: label.DNSView}, "", &views)
+		if err != nil {
+			return false, err
+		}
+		if len(views) == 0 {
+			return false, fmt.Errorf("dnsView %v not found", label.DNSView)
+		}
+	}
+	switch {
+	case label.Range != "":
+		var ranges []wapiRange
+		bounds := strings.Split(label.Range, "-")
+		search := &wapiRange{StartAddr: bounds[0], EndAddr: bounds[1], NetworkView: infMgr.netView(label)}
+		err := infMgr.grid(label).connector().GetObject(search, "", &ranges)
+		if err != nil {
+			return false, err
+		}
+		if len(ranges) == 0 {
+			return false, fmt.Errorf("range %v not found", label.Range)
+		}
+	case label.NetworkContainer != "":
+		container, err := infMgr.grid(label).objMgr().GetNetworkContainer(infMgr.netView(label), label.NetworkContainer)
+		if err != nil {
+			return false, err
+		}
+		if container == nil {
+			return false, fmt.Errorf("network container %v not found", label.NetworkContainer)
+		}
+	case isIPv6Label(label):
+		for _, cidr := range infMgr.getLabelChildren(label) {
+			var networks []ipv6Network
+			search := &ipv6Network{Network: cidr, NetworkView: infMgr.netView(label)}
+			err := infMgr.grid(label).connector().GetObject(search, "", &networks)
+			if err != nil {
+				return false, err
+			}
+			if len(networks) == 0 {
+				return false, fmt.Errorf("network %v not found", cidr)
+			}
+		}
+	default:
+		for _, cidr := range infMgr.getLabelChildren(label) {
+			network, err := infMgr.grid(label).objMgr().GetNetwork(infMgr.netView(label), cidr, nil)
+			if err != nil {
+				return false, err
+			}
+			if network == nil {
+				return false, fmt.Errorf("network %v not found", cidr)
+			}
+		}
 	}
 	return true, nil
 }
@@ -1,51 +1,297 @@
 package manager
 
 import (
+	"crypto/x509"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
 	ibxclient "github.com/infobloxopen/infoblox-go-client"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 var DNSData = make(map[string]ibxclient.RecordA)
+var PTRData = make(map[string]ibxclient.RecordPTR)
+var HostRecordData = make(map[string]string)
+var HostEA = make(map[string]ibxclient.EA)
 var HostData = make(map[string]string)
-var IpList = []string{"10.0.0.1", "10.0.0.2"}
+var NetViewData = make(map[string]string)
+var IpList = []string{"192.168.9.1", "192.168.9.2"}
 var index = 0
+var PageRequests = 0
+
+type resourceMeta struct{}
+
+func (rm resourceMeta) GetName() string { return "app" }
+
+func (rm resourceMeta) GetNamespace() string { return "ns" }
+
+// The WAPI requests to the unreachable grid are retried without waiting
+var _ = BeforeSuite(func() {
+	wapiRetryBackoff = time.Millisecond
+})
 
 var _ = Describe("New infoblox manager ", func() {
 	//request := ipamspec.IPAMRequest{Metadata: "", Operation: ipamspec.CREATE, HostName: "", IPAddr: "", Key: "", IPAMLabel: ""}
 	It("Parsing JSON string provided in infoblox-label parameter ", func() {
 		// Try with valid json in params
 		labels, _ := ParseLabels(`{"Dev" :{"cidr": "172.16.4.0/24"},"Test" :{"cidr": "172.16.5.0/24"}}`)
-		Expect(labels["Dev"]).To(BeEquivalentTo(IBConfig{"", "172.16.4.0/24"}))
-		Expect(labels["Test"]).To(BeEquivalentTo(IBConfig{"", "172.16.5.0/24"}))
+		Expect(labels["Dev"]).To(BeEquivalentTo(IBConfig{CIDR: "172.16.4.0/24", Mode: FixedAddressMode}))
+		Expect(labels["Test"]).To(BeEquivalentTo(IBConfig{CIDR: "172.16.5.0/24", Mode: FixedAddressMode}))
+		// dnsView is used only when dns is enabled, and defaults to the default view
+		labels, _ = ParseLabels(`{"Dev" :{"cidr": "172.16.4.0/24", "dnsView": "internal"},"Test" :{"cidr": "172.16.5.0/24", "dns": true}}`)
+		Expect(labels["Dev"]).To(BeEquivalentTo(IBConfig{CIDR: "172.16.4.0/24", Mode: FixedAddressMode}))
+		Expect(labels["Test"]).To(BeEquivalentTo(IBConfig{DNSView: "default", CIDR: "172.16.5.0/24", DNS: true, Mode: FixedAddressMode}))
+		// ptr requires dns
+		_, err := ParseLabels(`{"Dev" :{"cidr": "172.16.4.0/24", "ptr": true}}`)
+		Expect(err).To(HaveOccurred())
+		// host record mode
+		labels, _ = ParseLabels(`{"Dev" :{"cidr": "172.16.4.0/24", "mode": "host"}}`)
+		Expect(labels["Dev"]).To(BeEquivalentTo(IBConfig{CIDR: "172.16.4.0/24", Mode: HostRecordMode}))
+		_, err = ParseLabels(`{"Dev" :{"cidr": "172.16.4.0/24", "mode": "network"}}`)
+		Expect(err).To(HaveOccurred())
+		// network container, list of CIDRs and range
+		labels, err = ParseLabels(`{"Dev" :{"networkContainer": "172.16.0.0/16"},"Test" :{"cidrs": ["172.16.4.0/24", "172.16.5.0/24"]},"Prod" :{"range": "172.16.6.10-172.16.6.50"}}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labelRange(labels["Dev"])).To(Equal("172.16.0.0/16"))
+		Expect(labelRange(labels["Test"])).To(Equal("172.16.4.0/24,172.16.5.0/24"))
+		Expect(labelRange(labels["Prod"])).To(Equal("172.16.6.10-172.16.6.50"))
+		_, err = ParseLabels(`{"Dev" :{"cidr": "172.16.4.0/24", "range": "172.16.4.10-172.16.4.50"}}`)
+		Expect(err).To(HaveOccurred())
+		_, err = ParseLabels(`{"Dev" :{}}`)
+		Expect(err).To(HaveOccurred())
+		_, err = ParseLabels(`{"Dev" :{"range": "172.16.4.10"}}`)
+		Expect(err).To(HaveOccurred())
+		_, err = ParseLabels(`{"Dev" :{"cidrs": ["172.16.4.0/24", "invalid"]}}`)
+		Expect(err).To(HaveOccurred())
+		// IPv6 labels allocate fixed addresses from cidr or cidrs
+		labels, err = ParseLabels(`{"V6" :{"cidrs": ["2001:db8::/120", "2001:db8:1::/120"]}}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(isIPv6Label(labels["V6"])).To(BeTrue())
+		Expect(labels["V6"].Mode).To(Equal(FixedAddressMode))
+		_, err = ParseLabels(`{"V6" :{"cidrs": ["2001:db8::/120", "172.16.4.0/24"]}}`)
+		Expect(err).To(HaveOccurred())
+		_, err = ParseLabels(`{"V6" :{"range": "2001:db8::10-2001:db8::50"}}`)
+		Expect(err).To(MatchError("IPv6 requires cidr or cidrs for label V6"))
+		_, err = ParseLabels(`{"V6" :{"cidr": "2001:db8::/120", "mode": "host"}}`)
+		Expect(err).To(HaveOccurred())
+		_, err = ParseLabels(`{"V6" :{"cidr": "2001:db8::/120", "dns": true}}`)
+		Expect(err).To(MatchError("dns is not supported for IPv6 label V6"))
 	})
 	It("Infoblox manager client", func() {
 		// Trying with invalid Json params
-		infoParams := InfobloxParams{"localhost",
-			"2.2.6",
-			"6443",
-			"admin",
-			"infoblox",
-			"{Dev :{\"cidr\": \"172.16.4.0/24\"},\"Test\" :{\"cidr\": \"172.16.5.0/24\"}}",
-			"default",
-			"false"}
+		infoParams := InfobloxParams{
+			Host:       "localhost",
+			Version:    "2.2.6",
+			Port:       "6443",
+			Username:   "admin",
+			Password:   "infoblox",
+			IbLabelMap: "{Dev :{\"cidr\": \"172.16.4.0/24\"},\"Test\" :{\"cidr\": \"172.16.5.0/24\"}}",
+			NetView:    "default",
+			SslVerify:  "false",
+		}
 		_, err := NewInfobloxManager(infoParams)
 		Expect(err).NotTo(BeEquivalentTo(nil))
 		// Try with valid json in params
 		infoParams.IbLabelMap = "{\"Dev\" :{\"cidr\": \"172.16.4.0/24\"},\"Test\" :{\"cidr\": \"172.16.5.0/24\"}}"
 		_, err = NewInfobloxManager(infoParams)
 		Expect(err).NotTo(BeEquivalentTo(nil))
+		// The manager starts while the grid is unreachable, but it is not ready
+		infoParams.RetryConnect = true
+		ibMgr, err := NewInfobloxManager(infoParams)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ibMgr.IsReady()).To(BeFalse())
+		// The connection is kept when the grid does not accept the changed credentials
+		connector := ibMgr.grids[DefaultGrid].connector()
+		Expect(ibMgr.UpdateCredentials("", GridParams{Host: "127.0.0.1", Port: "1", Username: "admin",
+			Password: "rotated", SslVerify: "false"})).NotTo(Succeed())
+		Expect(ibMgr.grids[DefaultGrid].connector()).To(BeIdenticalTo(connector))
+		Expect(ibMgr.UpdateCredentials("prod", GridParams{})).To(MatchError("grid prod not found"))
+		// Try with a label on a grid that is not defined
+		infoParams.IbLabelMap = `{"Dev": {"cidr": "172.16.4.0/24", "grid": "prod"}}`
+		_, err = NewInfobloxManager(infoParams)
+		Expect(err).To(MatchError("grid prod not found for label Dev"))
+		credsDir, err := ioutil.TempDir("", "grid")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(credsDir)
+		Expect(ioutil.WriteFile(filepath.Join(credsDir, "password"), []byte("infoblox"), 0600)).To(Succeed())
+		infoParams.Grids = fmt.Sprintf(`{"prod": {"host": "127.0.0.1", "port": "1", "username": "admin", "credentialsDirectory": %q}}`,
+			credsDir)
+		ibMgr, err = NewInfobloxManager(infoParams)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ibMgr.getGridNames()).To(Equal([]string{DefaultGrid, "prod"}))
+		Expect(ibMgr.IsReady()).To(BeFalse())
+		infoParams.Grids = ""
+		// Try with invalid extra EAs
+		infoParams.ExtraEAs = `{"F5IPAM": "{cluster}"}`
+		_, err = NewInfobloxManager(infoParams)
+		Expect(err).NotTo(BeEquivalentTo(nil))
+	})
+	It("Retrying WAPI requests and the circuit breaker", func() {
+		breakerCooldown = 50 * time.Millisecond
+		defer func() { breakerCooldown = 30 * time.Second }()
+		unreachable := &url.Error{Op: "Get", URL: "https://grid", Err: &net.OpError{Op: "read", Err: errors.New("reset")}}
+		refused := &url.Error{Op: "Post", URL: "https://grid", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}
+		inner := &scriptedRequestor{}
+		requestor := &resilientRequestor{HttpRequestor: inner, breaker: &circuitBreaker{}}
+		get, _ := http.NewRequest(http.MethodGet, "https://grid/wapi/v2.2.6/network", nil)
+		post, _ := http.NewRequest(http.MethodPost, "https://grid/wapi/v2.2.6/fixedaddress", nil)
+
+		// A request that fails to reach the grid is retried
+		inner.errs = []error{unreachable, unreachable}
+		_, err := requestor.SendRequest(get)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inner.calls).To(Equal(3))
+		// An error of the request is not retried
+		inner.calls = 0
+		inner.errs = []error{errors.New("WAPI request error: 400('400 Bad Request')")}
+		_, err = requestor.SendRequest(get)
+		Expect(err).To(HaveOccurred())
+		Expect(inner.calls).To(Equal(1))
+		// Nor is a certificate error, the grid is reachable
+		inner.calls = 0
+		inner.errs = []error{&url.Error{Op: "Get", URL: "https://grid", Err: x509.UnknownAuthorityError{}}}
+		_, err = requestor.SendRequest(get)
+		Expect(err).To(HaveOccurred())
+		Expect(inner.calls).To(Equal(1))
+		Expect(isTransient(err)).To(BeFalse())
+		Expect(isTransient(unreachable)).To(BeTrue())
+		// A create request is retried only when the connection was not established
+		inner.calls = 0
+		inner.errs = []error{unreachable}
+		_, err = requestor.SendRequest(post)
+		Expect(err).To(HaveOccurred())
+		Expect(inner.calls).To(Equal(1))
+		inner.calls = 0
+		inner.errs = []error{refused}
+		_, err = requestor.SendRequest(post)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inner.calls).To(Equal(2))
+
+		// The breaker opens after the consecutive failures and stops sending requests
+		for i := 0; i < breakerThreshold; i++ {
+			inner.errs = []error{unreachable, unreachable, unreachable, unreachable}
+			_, err = requestor.SendRequest(get)
+			Expect(err).To(HaveOccurred())
+		}
+		Expect(requestor.breaker.isOpen()).To(BeTrue())
+		inner.calls = 0
+		_, err = requestor.SendRequest(get)
+		Expect(err).To(Equal(errCircuitOpen))
+		Expect(inner.calls).To(Equal(0))
+		// After the cooldown a request is sent again, and its success closes the breaker
+		Eventually(requestor.breaker.isOpen).Should(BeFalse())
+		inner.errs = nil
+		_, err = requestor.SendRequest(get)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requestor.breaker.failures).To(Equal(0))
+	})
+	It("Connecting to the grids apart from each other", func() {
+		wapiRetries = 0
+		defer func() { wapiRetries = 3 }()
+		unreachable := &url.Error{Op: "Get", URL: "https://lab", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}
+		ibMgr := &InfobloxManager{
+			grids: map[string]*infobloxGrid{
+				DefaultGrid: newInfobloxGrid(DefaultGrid, GridParams{Host: "prod", Version: "2.5", SslVerify: "false"}),
+				"lab":       newInfobloxGrid("lab", GridParams{Host: "lab", Version: "2.5", SslVerify: "false"}),
+			},
+			ea:      ibxclient.EA{EAKey: EAVal},
+			NetView: "default",
+			IBLabels: map[string]IBConfig{
+				"Dev": {CIDR: "192.168.9.0/24", Mode: FixedAddressMode},
+				"Lab": {CIDR: "10.2.4.0/24", Mode: FixedAddressMode, Grid: "lab"},
+			},
+		}
+		prod := &scriptedRequestor{}
+		// The client sends a failed search again, to the grid master
+		lab := &scriptedRequestor{errs: []error{unreachable, unreachable, unreachable, unreachable}}
+		ibMgr.grids[DefaultGrid].connector().Requestor.(*resilientRequestor).HttpRequestor = prod
+		ibMgr.grids["lab"].connector().Requestor.(*resilientRequestor).HttpRequestor = lab
+		// The grid that is unreachable does not keep the other grid from connecting
+		err := ibMgr.connect()
+		Expect(err).To(HaveOccurred())
+		Expect(isTransient(err)).To(BeTrue())
+		Expect(ibMgr.IsReady()).To(BeTrue())
+		Expect(ibMgr.IsLabelReady("Dev")).To(BeTrue())
+		Expect(ibMgr.IsLabelReady("Lab")).To(BeFalse())
+		// Only the grid that is not connected is connected again
+		prod.calls = 0
+		Expect(ibMgr.connect()).To(Succeed())
+		Expect(prod.calls).To(BeZero())
+		Expect(ibMgr.IsLabelReady("Lab")).To(BeTrue())
+	})
+	It("Parsing JSON string provided in infoblox-grids parameter ", func() {
+		defaults := GridParams{Port: "443", Version: "2.11", SslVerify: "false"}
+		grids, err := ParseGrids("", defaults)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(grids).To(BeEmpty())
+		// The credentials directory of the grid holds the password and the certificate
+		dir, err := ioutil.TempDir("", "grid")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(ioutil.WriteFile(filepath.Join(dir, "password"), []byte("secret"), 0600)).To(Succeed())
+		grids, err = ParseGrids(fmt.Sprintf(`{"prod": {"host": "10.1.1.1", "username": "admin", "credentialsDirectory": %q}}`,
+			dir), defaults)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(grids).To(Equal(map[string]GridParams{"prod": {Host: "10.1.1.1", Port: "443", Version: "2.11",
+			Username: "admin", Password: "secret", SslVerify: "false", CredentialsDirectory: dir}}))
+		Expect(ioutil.WriteFile(filepath.Join(dir, "username"), []byte("operator"), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "certificate"), []byte("cert"), 0600)).To(Succeed())
+		grids, err = ParseGrids(fmt.Sprintf(`{"dev": {"host": "10.1.1.2", "credentialsDirectory": %q}}`, dir), defaults)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(grids["dev"].Username).To(Equal("operator"))
+		Expect(grids["dev"].Password).To(Equal("secret"))
+		Expect(grids["dev"].SslVerify).To(Equal(filepath.Join(dir, "certificate")))
+		// The password is not taken from the command line
+		_, err = ParseGrids(`{"dev": {"host": "10.1.1.2", "username": "admin", "password": "secret"}}`, defaults)
+		Expect(err).To(MatchError("password of grid dev must be in the password file of its credentialsDirectory"))
+		_, err = ParseGrids(`{"dev": {"host": "10.1.1.2"}}`, defaults)
+		Expect(err).To(MatchError("credentialsDirectory is required for grid dev"))
+		Expect(os.Remove(filepath.Join(dir, "password"))).To(Succeed())
+		_, err = ParseGrids(fmt.Sprintf(`{"dev": {"host": "10.1.1.2", "credentialsDirectory": %q}}`, dir), defaults)
+		Expect(err).To(MatchError("Infoblox password not specified for grid dev"))
+		_, err = ParseGrids(fmt.Sprintf(`{"default": {"host": "10.1.1.2", "credentialsDirectory": %q}}`, dir), defaults)
+		Expect(err).To(HaveOccurred())
+		_, err = ParseGrids(`invalid`, defaults)
+		Expect(err).To(HaveOccurred())
+	})
+	It("Parsing JSON string provided in infoblox-extra-eas parameter ", func() {
+		extraEAs, err := ParseExtraEAs("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extraEAs).To(BeEmpty())
+		extraEAs, err = ParseExtraEAs(`{"Namespace": "{namespace}", "Owner": "team-a"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extraEAs).To(Equal(map[string]string{"Namespace": "{namespace}", "Owner": "team-a"}))
+		_, err = ParseExtraEAs(`{"F5IPAMCluster": "{cluster}"}`)
+		Expect(err).To(HaveOccurred())
+		_, err = ParseExtraEAs(`invalid`)
+		Expect(err).To(HaveOccurred())
 	})
 })
 var _ = Describe("Infoblox Manager functions", func() {
 	infMgr := InfobloxManager{
-		&ConnectorHandler{},
-		&ObjMgrHandler{},
-		ibxclient.EA{},
-		"default",
-		map[string]IBConfig{},
+		grids: map[string]*infobloxGrid{DefaultGrid: {
+			name:        DefaultGrid,
+			breaker:     &circuitBreaker{},
+			ibConnector: &ConnectorHandler{},
+			ibObjMgr:    &ObjMgrHandler{},
+		}},
+		ea:       ibxclient.EA{EAKey: EAVal},
+		NetView:  "default",
+		IBLabels: map[string]IBConfig{},
 	}
 	It("Testing CreateARecord function", func() {
 		// Note: we are using the infMgr as defined in global section
@@ -63,13 +309,39 @@ var _ = Describe("Infoblox Manager functions", func() {
 		request.IPAddr = "192.168.9.9"
 		Expect(infMgr.CreateARecord(request)).To(BeFalse())
 		// Now let's set the iblabel map
-		infMgr.IBLabels["Dev"] = IBConfig{"", "192.168.9.0/24"}
+		infMgr.IBLabels["Dev"] = IBConfig{CIDR: "192.168.9.0/24"}
 		Expect(infMgr.CreateARecord(request)).To(BeTrue())
 		Expect(len(DNSData)).To(BeEquivalentTo(1))
 		// Now let's get the error from backend
 		request.HostName = "send-error"
 		Expect(infMgr.CreateARecord(request)).To(BeFalse())
 	})
+	It("Testing PTR records", func() {
+		infMgr.IBLabels["Prod"] = IBConfig{DNSView: "default", CIDR: "192.168.10.0/24", DNS: true, PTR: true}
+		Expect(infMgr.IsDNSEnabled("Prod")).To(BeTrue())
+		Expect(infMgr.IsDNSEnabled("Dev")).To(BeFalse())
+		Expect(infMgr.IsDNSEnabled("invalid")).To(BeFalse())
+		request := ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "prod.com", IPAddr: "192.168.10.9", IPAMLabel: "Prod"}
+		Expect(infMgr.CreateARecord(request)).To(BeTrue())
+		Expect(DNSData).To(HaveKey("prod.com"))
+		Expect(PTRData).To(HaveKey("prod.com"))
+		infMgr.DeleteARecord(request)
+		Expect(DNSData).NotTo(HaveKey("prod.com"))
+		Expect(PTRData).NotTo(HaveKey("prod.com"))
+		// The A record is deleted when the PTR record is not created
+		request.HostName = "ptr-error"
+		Expect(infMgr.CreateARecord(request)).To(BeFalse())
+		Expect(DNSData).NotTo(HaveKey("ptr-error"))
+		Expect(PTRData).NotTo(HaveKey("ptr-error"))
+		// The records are deleted once DNS is disabled for the label
+		request.HostName = "prod.com"
+		Expect(infMgr.CreateARecord(request)).To(BeTrue())
+		infMgr.IBLabels["Prod"] = IBConfig{CIDR: "192.168.10.0/24"}
+		infMgr.DeleteARecord(request)
+		Expect(DNSData).NotTo(HaveKey("prod.com"))
+		Expect(PTRData).NotTo(HaveKey("prod.com"))
+		delete(infMgr.IBLabels, "Prod")
+	})
 	It("Testing getARecords function", func() {
 		// Note: we are using the infMgr as defined in global section
 		// trying with invalid IPAM label
@@ -80,9 +352,12 @@ var _ = Describe("Infoblox Manager functions", func() {
 		Expect(infMgr.getARecords(request)).To(BeEmpty())
 		// Let's try to get the error if hostname does not exist
 		request.HostName = "send-error"
-		Expect(infMgr.getARecords(request)).To(BeEmpty())
+		_, err := infMgr.getARecords(request)
+		Expect(err).To(HaveOccurred())
+		Expect(infMgr.RemoveARecord(request)).NotTo(Succeed())
 		request.HostName = "example.com"
-		result := infMgr.getARecords(request)
+		result, err := infMgr.getARecords(request)
+		Expect(err).NotTo(HaveOccurred())
 		Expect(result[0].Name).To(BeEquivalentTo("example.com"))
 		Expect(result[0].Ipv4Addr).To(BeEquivalentTo("192.168.9.9"))
 	})
@@ -91,13 +366,32 @@ var _ = Describe("Infoblox Manager functions", func() {
 		request := ipamspec.IPAMRequest{Metadata: "", Operation: ipamspec.DELETE, HostName: "example.com", IPAddr: "192.168.9.9", Key: "", IPAMLabel: "Dev"}
 		infMgr.DeleteARecord(request)
 		Expect(len(DNSData)).To(BeEquivalentTo(0))
+		// Deleting again should not fail when the A record is not available
+		infMgr.DeleteARecord(request)
+		Expect(len(DNSData)).To(BeEquivalentTo(0))
 	})
 	It("Testing validateIPAMLabels function", func() {
 		// Note: we are using the infMgr as defined in global section
 		// trying with valid CIDR
-		result, _ := infMgr.validateIPAMLabels("", "192.168.9.9/24")
+		result, _ := infMgr.validateIPAMLabels(IBConfig{CIDR: "192.168.9.9/24"})
+		Expect(result).To(BeTrue())
+		result, _ = infMgr.validateIPAMLabels(IBConfig{CIDR: "send-error"})
+		Expect(result).To(BeFalse())
+		result, _ = infMgr.validateIPAMLabels(IBConfig{CIDRs: []string{"192.168.9.9/24", "send-error"}})
+		Expect(result).To(BeFalse())
+		// trying with dnsView
+		result, _ = infMgr.validateIPAMLabels(IBConfig{DNSView: "default", CIDR: "192.168.9.9/24"})
+		Expect(result).To(BeTrue())
+		result, _ = infMgr.validateIPAMLabels(IBConfig{DNSView: "unknown", CIDR: "192.168.9.9/24"})
+		Expect(result).To(BeFalse())
+		// trying with network container and range
+		result, _ = infMgr.validateIPAMLabels(IBConfig{NetworkContainer: "192.168.16.0/20"})
+		Expect(result).To(BeTrue())
+		result, _ = infMgr.validateIPAMLabels(IBConfig{NetworkContainer: "192.168.32.0/20"})
+		Expect(result).To(BeFalse())
+		result, _ = infMgr.validateIPAMLabels(IBConfig{Range: "192.168.12.10-192.168.12.20"})
 		Expect(result).To(BeTrue())
-		result, _ = infMgr.validateIPAMLabels("", "send-error")
+		result, _ = infMgr.validateIPAMLabels(IBConfig{Range: "192.168.13.10-192.168.13.20"})
 		Expect(result).To(BeFalse())
 	})
 	It("Testing AllocateNextIPAddress function", func() {
@@ -108,7 +402,7 @@ var _ = Describe("Infoblox Manager functions", func() {
 		Expect(len(HostData)).To(BeEquivalentTo(0))
 		// Requesting error
 		// Now let's set the iblabel map for sending the error
-		infMgr.IBLabels["invalid"] = IBConfig{"", "send-error"}
+		infMgr.IBLabels["invalid"] = IBConfig{CIDR: "send-error"}
 		Expect(infMgr.AllocateNextIPAddress(request)).To(BeEquivalentTo(""))
 		delete(infMgr.IBLabels, "invalid")
 		// Now let's fix the label
@@ -137,6 +431,20 @@ var _ = Describe("Infoblox Manager functions", func() {
 		Expect(infMgr.GetIPAddress(request)).To(BeEquivalentTo(HostData[request.Key]))
 	})
 
+	It("Testing GetLabelUsage and GetAllocations functions", func() {
+		Expect(cidrSize("172.16.4.0/24")).To(Equal(254))
+		Expect(cidrSize("172.16.4.1/32")).To(Equal(1))
+		Expect(cidrSize("invalid")).To(Equal(0))
+		Expect(infMgr.GetAllocations("invalid")).To(BeEmpty())
+		Expect(infMgr.GetAllocations("")).To(ConsistOf(
+			Allocation{IPAMLabel: "Dev", IPAddr: HostData["foo.com"], Reference: "foo.com", HostName: true},
+			Allocation{IPAMLabel: "Dev", IPAddr: HostData["example-key"], Reference: "example-key", HostName: true},
+		))
+		Expect(infMgr.GetLabelUsage()).To(Equal([]LabelUsage{
+			{IPAMLabel: "Dev", Range: "192.168.9.0/24", Total: 254, Allocated: 2},
+		}))
+	})
+
 	It("Testing ReleaseIPAddress function", func() {
 		// Note: we are using the infMgr as defined in global section
 		// trying with invalid IPAM label
@@ -161,6 +469,268 @@ var _ = Describe("Infoblox Manager functions", func() {
 
 	})
 
+	It("Testing network containers, lists of CIDRs and ranges", func() {
+		Expect(rangeSize("192.168.12.10-192.168.12.20,192.168.9.0/24")).To(Equal(265))
+		Expect(rangeSize("192.168.12.20-192.168.12.10")).To(Equal(0))
+		// Networks of the container are in the order of their addresses
+		Expect(infMgr.getLabelChildren(IBConfig{NetworkContainer: "192.168.16.0/20"})).To(Equal(
+			[]string{"192.168.16.0/24", "192.168.17.0/24", "192.168.20.0/24"}))
+		// The network of an IP address is looked up in the network container, and for the range
+		Expect(infMgr.networkOf(IBConfig{NetworkContainer: "192.168.16.0/20"}, "192.168.20.5")).To(Equal("192.168.20.0/24"))
+		Expect(infMgr.networkOf(IBConfig{NetworkContainer: "192.168.16.0/20"}, "192.168.22.5")).To(BeEmpty())
+		Expect(infMgr.networkOf(IBConfig{Range: "192.168.12.10-192.168.12.20"}, "192.168.12.15")).To(Equal("192.168.12.0/24"))
+		Expect(infMgr.networkOf(IBConfig{CIDRs: []string{"192.168.9.0/24"}}, "192.168.9.5")).To(Equal("192.168.9.0/24"))
+		// The next available IP address comes from the first network with space
+		infMgr.IBLabels["List"] = IBConfig{CIDRs: []string{"send-error", "192.168.9.0/24"}}
+		defer delete(infMgr.IBLabels, "List")
+		request := ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "list.com", IPAMLabel: "List"}
+		Expect(infMgr.AllocateNextIPAddress(request)).To(Equal("192.168.9.1"))
+		Expect(infMgr.GetIPAddress(request)).To(Equal("192.168.9.1"))
+		Expect(infMgr.GetLabelUsage()).To(ContainElement(
+			LabelUsage{IPAMLabel: "List", Range: "send-error,192.168.9.0/24", Total: 254, Allocated: 1}))
+		// Reserve is limited to the networks of the label
+		reserve := ipamspec.IPAMRequest{Operation: ipamspec.CREATE, Key: "list-key", IPAddr: "192.168.10.1", IPAMLabel: "List"}
+		Expect(infMgr.ReserveIPAddress(reserve)).To(BeFalse())
+		request.IPAddr = "192.168.9.1"
+		infMgr.ReleaseIPAddress(request)
+		Expect(HostData).To(BeEmpty())
+		// Fixed addresses are allocated from the range
+		infMgr.IBLabels["Range"] = IBConfig{Range: "192.168.12.10-192.168.12.20"}
+		defer delete(infMgr.IBLabels, "Range")
+		request = ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "range.com", IPAMLabel: "Range"}
+		Expect(infMgr.AllocateNextIPAddress(request)).To(Equal("192.168.12.10"))
+		Expect(infMgr.GetIPAddress(request)).To(Equal("192.168.12.10"))
+		Expect(infMgr.GetAllocations("Range")).To(Equal([]Allocation{
+			{IPAMLabel: "Range", IPAddr: "192.168.12.10", Reference: "range.com", HostName: true},
+		}))
+		request.IPAddr = "192.168.12.10"
+		infMgr.ReleaseIPAddress(request)
+		Expect(HostData).To(BeEmpty())
+	})
+
+	It("Testing ownership extensible attributes", func() {
+		infMgr.ClusterName = "cluster-a"
+		infMgr.extraEAs = map[string]string{"Namespace": "{namespace}", "Resource": "{namespace}/{name}",
+			"Reference": "{reference}", "Cluster": "{cluster}", "Owner": "team-a"}
+		defer func() {
+			infMgr.ClusterName = ""
+			infMgr.extraEAs = nil
+		}()
+		request := ipamspec.IPAMRequest{Metadata: resourceMeta{}, Operation: ipamspec.CREATE, HostName: "owned.com", IPAMLabel: "Dev"}
+		Expect(infMgr.objectEA(request, "owned.com")).To(Equal(ibxclient.EA{EAKey: EAVal, ClusterEAKey: "cluster-a",
+			"Namespace": "ns", "Resource": "ns/app", "Reference": "owned.com", "Cluster": "cluster-a", "Owner": "team-a"}))
+		// Empty values are not written
+		request.Metadata = nil
+		Expect(infMgr.objectEA(request, "owned.com")).NotTo(HaveKey("Namespace"))
+		Expect(infMgr.AllocateNextIPAddress(request)).To(Equal("192.168.9.1"))
+		Expect(HostEA["owned.com"]).To(HaveKeyWithValue(ClusterEAKey, "cluster-a"))
+		// The fixed addresses of other clusters are neither found nor released
+		HostData["other.com"] = "192.168.9.2"
+		HostEA["other.com"] = ibxclient.EA{EAKey: EAVal, ClusterEAKey: "cluster-b"}
+		index += 1
+		other := ipamspec.IPAMRequest{Operation: ipamspec.DELETE, HostName: "other.com", IPAddr: "192.168.9.2", IPAMLabel: "Dev"}
+		Expect(infMgr.GetIPAddress(other)).To(BeEmpty())
+		Expect(infMgr.GetAllocations("Dev")).To(Equal([]Allocation{
+			{IPAMLabel: "Dev", IPAddr: "192.168.9.1", Reference: "owned.com", HostName: true},
+		}))
+		infMgr.ReleaseIPAddress(other)
+		Expect(HostData).To(HaveKey("other.com"))
+		// Without the cluster name all the F5IPAM objects are managed
+		infMgr.ClusterName = ""
+		infMgr.ReleaseIPAddress(other)
+		Expect(HostData).NotTo(HaveKey("other.com"))
+		infMgr.ClusterName = "cluster-a"
+		request.IPAddr = "192.168.9.1"
+		infMgr.ReleaseIPAddress(request)
+		Expect(HostData).To(BeEmpty())
+	})
+
+	It("Testing host record mode", func() {
+		infMgr.IBLabels["Host"] = IBConfig{CIDR: "192.168.11.0/24", Mode: HostRecordMode, DNS: true, DNSView: "default"}
+		defer delete(infMgr.IBLabels, "Host")
+		// The host record holds the A record
+		Expect(infMgr.IsDNSEnabled("Host")).To(BeFalse())
+		request := ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "host.com", IPAMLabel: "Host"}
+		Expect(infMgr.GetIPAddress(request)).To(BeEmpty())
+		Expect(infMgr.AllocateNextIPAddress(request)).To(Equal("192.168.11.1"))
+		Expect(infMgr.GetIPAddress(request)).To(Equal("192.168.11.1"))
+		Expect(len(HostData)).To(BeEquivalentTo(0))
+		// Reserve a given IP address, the host records with DNS are named after the hostname
+		reserve := ipamspec.IPAMRequest{Operation: ipamspec.CREATE, Key: "default/svc", IPAddr: "192.168.11.7", IPAMLabel: "Host"}
+		Expect(infMgr.ReserveIPAddress(reserve)).To(BeFalse())
+		reserve.HostName = "Reserved.Host.com."
+		Expect(infMgr.ReserveIPAddress(reserve)).To(BeTrue())
+		Expect(infMgr.GetAllocations("Host")).To(Equal([]Allocation{
+			{IPAMLabel: "Host", IPAddr: "192.168.11.1", Reference: "host.com", HostName: true},
+			{IPAMLabel: "Host", IPAddr: "192.168.11.7", Reference: "Reserved.Host.com.", HostName: true},
+		}))
+		Expect(HostRecordData).To(HaveKey("reserved.host.com"))
+		// The hostname must be a DNS name
+		Expect(infMgr.AllocateNextIPAddress(ipamspec.IPAMRequest{HostName: "host_1.com", IPAMLabel: "Host"})).To(BeEmpty())
+		// Now let's get the error from backend
+		request.HostName = "send-error"
+		Expect(infMgr.AllocateNextIPAddress(request)).To(BeEmpty())
+		// Release deletes the host record
+		request.HostName = "host.com"
+		request.IPAddr = "192.168.11.1"
+		infMgr.ReleaseIPAddress(request)
+		Expect(infMgr.GetIPAddress(request)).To(BeEmpty())
+		infMgr.ReleaseIPAddress(reserve)
+		Expect(HostRecordData).To(BeEmpty())
+
+		// Without DNS the host records of the requests without a hostname are named after the key
+		infMgr.IBLabels["Host"] = IBConfig{CIDR: "192.168.11.0/24", Mode: HostRecordMode}
+		request = ipamspec.IPAMRequest{Operation: ipamspec.CREATE, Key: "default/svc", IPAMLabel: "Host"}
+		Expect(infMgr.AllocateNextIPAddress(request)).NotTo(BeEmpty())
+		Expect(HostRecordData).To(HaveKey("svc.default"))
+		Expect(infMgr.GetIPAddress(request)).To(Equal(HostRecordData["svc.default"]))
+		request.IPAddr = HostRecordData["svc.default"]
+		infMgr.ReleaseIPAddress(request)
+		Expect(HostRecordData).To(BeEmpty())
+		// The characters that DNS names do not allow are replaced, the allocation keeps the key
+		request = ipamspec.IPAMRequest{Operation: ipamspec.CREATE, Key: "default/web_svc", IPAMLabel: "Host"}
+		Expect(infMgr.ValidateRequest(request)).To(Succeed())
+		ipAddr := infMgr.AllocateNextIPAddress(request)
+		Expect(ipAddr).NotTo(BeEmpty())
+		name := hostRecordName("default/web_svc")
+		Expect(name).To(MatchRegexp(`^web-svc-[0-9a-f]{8}\.default$`))
+		Expect(HostRecordData).To(HaveKeyWithValue(name, ipAddr))
+		Expect(infMgr.GetIPAddress(request)).To(Equal(ipAddr))
+		Expect(infMgr.GetAllocations("Host")).To(Equal([]Allocation{
+			{IPAMLabel: "Host", IPAddr: ipAddr, Reference: "default/web_svc"},
+		}))
+		// Another key does not get the same name
+		Expect(hostRecordName("default/web-svc")).To(Equal("web-svc.default"))
+		request.IPAddr = ipAddr
+		infMgr.ReleaseIPAddress(request)
+		Expect(HostRecordData).To(BeEmpty())
+	})
+
+	It("Testing paged searches and the IP address cache", func() {
+		infMgr.IBLabels["Cache"] = IBConfig{CIDR: "192.168.9.0/24", Mode: FixedAddressMode}
+		infMgr.cache = newIPCache(time.Minute)
+		wapiPageSize = 1
+		defer func() {
+			delete(infMgr.IBLabels, "Cache")
+			infMgr.cache = nil
+			wapiPageSize = 1000
+		}()
+		first := ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "first.com", IPAMLabel: "Cache"}
+		second := ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "second.com", IPAMLabel: "Cache"}
+		Expect(infMgr.AllocateNextIPAddress(first)).To(Equal("192.168.9.1"))
+		Expect(infMgr.AllocateNextIPAddress(second)).To(Equal("192.168.9.2"))
+		// The allocations are read a page at a time
+		PageRequests = 0
+		Expect(infMgr.GetAllocations("Cache")).To(HaveLen(2))
+		Expect(PageRequests).To(Equal(2))
+		// The allocated IP addresses are cached
+		PageRequests = 0
+		Expect(infMgr.GetIPAddress(first)).To(Equal("192.168.9.1"))
+		Expect(PageRequests).To(Equal(0))
+		// The cache is warmed from the fixed addresses of the cluster
+		infMgr.cache = newIPCache(time.Minute)
+		infMgr.warmCache(DefaultGrid)
+		Expect(infMgr.cache.len()).NotTo(BeZero())
+		ipAddr, ok := infMgr.cache.get("Cache", "second.com")
+		Expect(ok).To(BeTrue())
+		Expect(ipAddr).To(Equal("192.168.9.2"))
+		// Release removes the IP address from the cache
+		first.IPAddr = "192.168.9.1"
+		infMgr.ReleaseIPAddress(first)
+		_, ok = infMgr.cache.get("Cache", "first.com")
+		Expect(ok).To(BeFalse())
+		Expect(infMgr.GetIPAddress(first)).To(BeEmpty())
+		second.IPAddr = "192.168.9.2"
+		infMgr.ReleaseIPAddress(second)
+		Expect(HostData).To(BeEmpty())
+	})
+
+	It("Testing the network view and the grid of the labels", func() {
+		infMgr.grids["prod"] = &infobloxGrid{
+			name:        "prod",
+			breaker:     &circuitBreaker{},
+			ibConnector: &ConnectorHandler{},
+			ibObjMgr:    &ObjMgrHandler{},
+		}
+		infMgr.IBLabels["Prod"] = IBConfig{CIDR: "192.168.9.0/24", Mode: FixedAddressMode, NetView: "prod", Grid: "prod"}
+		defer func() {
+			delete(infMgr.grids, "prod")
+			delete(infMgr.IBLabels, "Prod")
+		}()
+		Expect(infMgr.grid(infMgr.IBLabels["Prod"])).To(BeIdenticalTo(infMgr.grids["prod"]))
+		Expect(infMgr.grid(IBConfig{})).To(BeIdenticalTo(infMgr.grids[DefaultGrid]))
+		Expect(infMgr.netView(IBConfig{})).To(Equal("default"))
+		Expect(infMgr.validateIPAMLabels(infMgr.IBLabels["Prod"])).To(BeTrue())
+		// The IP address is allocated in the network view of the label
+		request := ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "prod.com", IPAMLabel: "Prod"}
+		Expect(infMgr.AllocateNextIPAddress(request)).To(Equal("192.168.9.1"))
+		Expect(NetViewData["prod.com"]).To(Equal("prod"))
+		request.IPAddr = "192.168.9.1"
+		infMgr.ReleaseIPAddress(request)
+		Expect(HostData).To(BeEmpty())
+		// The network views of the labels must exist on their grid
+		Expect(infMgr.validateNetViews(infMgr.grids["prod"])).To(Succeed())
+		infMgr.IBLabels["Prod"] = IBConfig{CIDR: "192.168.9.0/24", Mode: FixedAddressMode, NetView: "missing", Grid: "prod"}
+		Expect(infMgr.validateNetViews(infMgr.grids["prod"])).To(MatchError("network view missing not found"))
+		Expect(infMgr.validateNetViews(infMgr.grids[DefaultGrid])).To(Succeed())
+		// A grid that is not connected, or whose circuit breaker is open, holds only the labels on it
+		atomic.StoreInt32(&infMgr.grids[DefaultGrid].connected, 1)
+		defer atomic.StoreInt32(&infMgr.grids[DefaultGrid].connected, 0)
+		Expect(infMgr.IsReady()).To(BeTrue())
+		Expect(infMgr.IsLabelReady("Dev")).To(BeTrue())
+		Expect(infMgr.IsLabelReady("Prod")).To(BeFalse())
+		atomic.StoreInt32(&infMgr.grids["prod"].connected, 1)
+		Expect(infMgr.IsLabelReady("Prod")).To(BeTrue())
+		infMgr.grids["prod"].breaker.openUntil = time.Now().Add(time.Minute)
+		Expect(infMgr.IsLabelReady("Prod")).To(BeFalse())
+		Expect(infMgr.IsLabelReady("Dev")).To(BeTrue())
+		Expect(infMgr.IsReady()).To(BeTrue())
+		Expect(infMgr.IsLabelReady("Unknown")).To(BeFalse())
+	})
+
+	It("Testing IPv6 labels", func() {
+		infMgr.IBLabels["V6"] = IBConfig{CIDR: "2001:db8::/120", Mode: FixedAddressMode}
+		defer delete(infMgr.IBLabels, "V6")
+		Expect(rangeSize("2001:db8::/120")).To(Equal(256))
+		Expect(infMgr.validateIPAMLabels(infMgr.IBLabels["V6"])).To(BeTrue())
+		_, err := infMgr.validateIPAMLabels(IBConfig{CIDR: "2001:db8:1::/120"})
+		Expect(err).To(MatchError("network 2001:db8:1::/120 not found"))
+		Expect(ipv6AddressFromRef("ipv6fixedaddress/ZG5zLmZpeGVkX2FkZHJlc3Mk:2001%3Adb8%3A%3A10/default")).To(Equal("2001:db8::10"))
+		Expect(ipv6AddressFromRef("fixedaddress/ZG5zLmZpeGVkX2FkZHJlc3Mk:192.168.12.10/default")).To(BeEmpty())
+		// The IP addresses are allocated, looked up by name and released as ipv6fixedaddress objects
+		request := ipamspec.IPAMRequest{Operation: ipamspec.CREATE, HostName: "v6.com", IPAMLabel: "V6"}
+		Expect(infMgr.AllocateNextIPAddress(request)).To(Equal("2001:db8::10"))
+		Expect(infMgr.GetIPAddress(request)).To(Equal("2001:db8::10"))
+		reserve := ipamspec.IPAMRequest{Operation: ipamspec.CREATE, Key: "v6-key", IPAddr: "2001:db8::20", IPAMLabel: "V6"}
+		Expect(infMgr.ReserveIPAddress(reserve)).To(BeTrue())
+		Expect(infMgr.GetAllocations("V6")).To(Equal([]Allocation{
+			{IPAMLabel: "V6", IPAddr: "2001:db8::10", Reference: "v6.com", HostName: true},
+			{IPAMLabel: "V6", IPAddr: "2001:db8::20", Reference: "v6-key", HostName: true},
+		}))
+		request.IPAddr = "2001:db8::10"
+		infMgr.ReleaseIPAddress(request)
+		infMgr.ReleaseIPAddress(reserve)
+		Expect(HostData).To(BeEmpty())
+		Expect(infMgr.GetIPAddress(request)).To(BeEmpty())
+	})
+
+	It("Testing the IP address cache expiry", func() {
+		Expect(newIPCache(0)).To(BeNil())
+		var disabled *ipCache
+		disabled.add("Dev", "example.com", "192.168.9.1")
+		_, ok := disabled.get("Dev", "example.com")
+		Expect(ok).To(BeFalse())
+		cache := newIPCache(10 * time.Millisecond)
+		cache.add("Dev", "example.com", "192.168.9.1")
+		ipAddr, ok := cache.get("Dev", "example.com")
+		Expect(ok).To(BeTrue())
+		Expect(ipAddr).To(Equal("192.168.9.1"))
+		Eventually(func() bool {
+			_, ok := cache.get("Dev", "example.com")
+			return ok
+		}).Should(BeFalse())
+	})
+
 })
 
 func (manager ObjMgrHandler) GetNetwork(netview string, cidr string, ea ibxclient.EA) (*ibxclient.Network, error) {
@@ -175,22 +745,18 @@ func (manager ObjMgrHandler) AllocateIP(netview string, cidr string, ipAddr stri
 		return nil, errors.New("error as requested")
 	}
 	HostData[name] = IpList[index]
+	HostEA[name] = ea
+	NetViewData[name] = netview
 	index += 1
 	return &ibxclient.FixedAddress{NetviewName: netview, Cidr: cidr,
 		IPAddress: HostData[name], Name: name, Ea: ea}, nil
 }
 
-func (manager ObjMgrHandler) ReleaseIP(netview string, cidr string, ipAddr string, macAddr string) (string, error) {
-	if ipAddr == "send-error" {
-		return "", errors.New("error as requested")
-	}
-	for k, v := range HostData {
-		if v == ipAddr {
-			delete(HostData, k)
-		}
-	}
+func (manager ObjMgrHandler) DeleteFixedAddress(ref string) (string, error) {
+	delete(HostData, ref)
+	delete(HostEA, ref)
 	index -= 1
-	return "", nil
+	return ref, nil
 }
 
 func (manager ObjMgrHandler) DeleteARecord(ref string) (string, error) {
@@ -213,6 +779,82 @@ func (manager ObjMgrHandler) CreateARecord(netview string, dnsview string, recor
 	return &record, nil
 }
 
+func (manager ObjMgrHandler) CreatePTRRecord(netview string, dnsview string, recordname string, cidr string, ipAddr string, ea ibxclient.EA) (*ibxclient.RecordPTR, error) {
+	if recordname == "ptr-error" {
+		return nil, errors.New("error as requested")
+	}
+	record := ibxclient.RecordPTR{Ref: recordname,
+		Ipv4Addr: ipAddr,
+		PtrdName: recordname,
+		View:     dnsview,
+		Ea:       ea,
+	}
+	PTRData[recordname] = record
+	return &record, nil
+}
+
+func (manager ObjMgrHandler) DeletePTRRecord(ref string) (string, error) {
+	delete(PTRData, ref)
+	return ref, nil
+}
+
+func (manager ObjMgrHandler) CreateHostRecord(enabledns bool, recordName string, netview string, dnsview string, cidr string, ipAddr string, macAddress string, ea ibxclient.EA) (*ibxclient.HostRecord, error) {
+	if recordName == "send-error" {
+		return nil, errors.New("error as requested")
+	}
+	if ipAddr == "" {
+		ipAddr = fmt.Sprintf("192.168.11.%d", len(HostRecordData)+1)
+	}
+	HostRecordData[recordName] = ipAddr
+	HostEA[recordName] = ea
+	return &ibxclient.HostRecord{Ref: recordName, Name: recordName, NetworkView: netview, View: dnsview,
+		Ipv4Addrs: []ibxclient.HostRecordIpv4Addr{{Ipv4Addr: ipAddr}}, Ea: ea}, nil
+}
+
+func (manager ObjMgrHandler) DeleteHostRecord(ref string) (string, error) {
+	delete(HostRecordData, ref)
+	delete(HostEA, ref)
+	return ref, nil
+}
+
+func (manager ObjMgrHandler) GetNetworkView(name string) (*ibxclient.NetworkView, error) {
+	if name == "missing" {
+		return nil, nil
+	}
+	return &ibxclient.NetworkView{Name: name}, nil
+}
+
+func (manager ObjMgrHandler) GetNetworkContainer(netview string, cidr string) (*ibxclient.NetworkContainer, error) {
+	if cidr != "192.168.16.0/20" {
+		return nil, nil
+	}
+	return &ibxclient.NetworkContainer{NetviewName: netview, Cidr: cidr}, nil
+}
+
+func (connector ConnectorHandler) CreateObject(obj ibxclient.IBObject) (ref string, err error) {
+	if ipv6Addr, ok := obj.(*newIPv6FixedAddress); ok {
+		if ipv6Addr.Duid != duidZero {
+			return "", errors.New("unexpected duid")
+		}
+		ipAddr := ipv6Addr.IPAddress
+		if ipAddr == "func:nextavailableip:2001:db8::/120,default" {
+			ipAddr = "2001:db8::10"
+		}
+		HostData[ipv6Addr.Name] = ipAddr
+		HostEA[ipv6Addr.Name] = ipv6Addr.Ea
+		index += 1
+		return "ipv6fixedaddress/ZG5zLmZpeGVkX2FkZHJlc3Mk:" + strings.ReplaceAll(ipAddr, ":", "%3A") + "/default", nil
+	}
+	fixedAddr := obj.(*ibxclient.FixedAddress)
+	if fixedAddr.IPAddress != "func:nextavailableip:192.168.12.10-192.168.12.20,default" {
+		return "", errors.New("unexpected ipv4addr")
+	}
+	HostData[fixedAddr.Name] = "192.168.12.10"
+	HostEA[fixedAddr.Name] = fixedAddr.Ea
+	index += 1
+	return "fixedaddress/ZG5zLmZpeGVkX2FkZHJlc3Mk:192.168.12.10/default", nil
+}
+
 func (connector ConnectorHandler) GetObject(obj ibxclient.IBObject, ref string, res interface{}) (err error) {
 	switch obj.(type) {
 	case *ibxclient.RecordA:
@@ -221,21 +863,159 @@ func (connector ConnectorHandler) GetObject(obj ibxclient.IBObject, ref string,
 		if rec.Name == "send-error" {
 			return errors.New("error as requested")
 		}
-		if rec.Name != "" {
-			rec.Ref = rec.Name
-			*result = append(*result, DNSData[rec.Name])
+		if record, ok := DNSData[rec.Name]; ok {
+			*result = append(*result, record)
+		}
+	case *ibxclient.RecordPTR:
+		rec := obj.(*ibxclient.RecordPTR)
+		result := res.(*[]ibxclient.RecordPTR)
+		if record, ok := PTRData[rec.PtrdName]; ok {
+			*result = append(*result, record)
+		}
+	case *managedHostRecord:
+		rec := obj.(*managedHostRecord)
+		result := res.(*[]managedHostRecord)
+		for name, ipAddr := range HostRecordData {
+			if (rec.Name == "" || rec.Name == name) && (rec.Ipv4Addr == "" || rec.Ipv4Addr == ipAddr) {
+				*result = append(*result, managedHostRecord{Ref: name, Name: name,
+					Ipv4Addrs: []ibxclient.HostRecordIpv4Addr{{Ipv4Addr: ipAddr}}, Ea: HostEA[name]})
+			}
+		}
+	case *wapiRange:
+		rec := obj.(*wapiRange)
+		result := res.(*[]wapiRange)
+		if rec.StartAddr == "192.168.12.10" {
+			*result = append(*result, *rec)
+		}
+	case *containerNetwork:
+		rec := obj.(*containerNetwork)
+		result := res.(*[]containerNetwork)
+		switch {
+		case rec.ContainsAddress != "":
+			if utils.IsIPInRange(rec.ContainsAddress, "192.168.12.0/24") {
+				*result = append(*result, containerNetwork{Network: "192.168.12.0/24"})
+			}
+		case rec.NetworkContainer == "192.168.16.0/20":
+			*result = append(*result, containerNetwork{Network: "192.168.17.0/24"}, containerNetwork{Network: "192.168.16.0/24"})
+		case rec.NetworkContainer == "192.168.20.0/22":
+			*result = append(*result, containerNetwork{Network: "192.168.20.0/24"})
+		}
+	case *nestedContainer:
+		rec := obj.(*nestedContainer)
+		result := res.(*[]nestedContainer)
+		if rec.NetworkContainer == "192.168.16.0/20" {
+			*result = append(*result, nestedContainer{Network: "192.168.20.0/22"})
+		}
+	case *wapiView:
+		rec := obj.(*wapiView)
+		result := res.(*[]wapiView)
+		if rec.Name == "default" {
+			*result = append(*result, *rec)
+		}
+	case *ipv6Network:
+		rec := obj.(*ipv6Network)
+		result := res.(*[]ipv6Network)
+		if rec.Network == "2001:db8::/120" {
+			*result = append(*result, *rec)
 		}
-	case *ibxclient.FixedAddress:
-		rec := obj.(*ibxclient.FixedAddress)
-		result := res.(*[]ibxclient.FixedAddress)
+	case *managedFixedAddress:
+		rec := obj.(*managedFixedAddress)
+		result := res.(*[]managedFixedAddress)
 		for k, v := range HostData {
-			tmpRec := rec
-			(*tmpRec).IPAddress = v
-			(*tmpRec).Name = k
-			*result = append(*result, *tmpRec)
+			if rec.Cidr != "" && !utils.IsIPInRange(v, rec.Cidr) {
+				continue
+			}
+			if rec.IPAddress != "" && rec.IPAddress != v {
+				continue
+			}
+			if rec.Name != "" && rec.Name != k {
+				continue
+			}
+			if !matchesEASearch(HostEA[k], rec.eaSearch) {
+				continue
+			}
+			tmpRec := *rec
+			tmpRec.Ref = k
+			tmpRec.IPAddress = v
+			tmpRec.Name = k
+			tmpRec.Ea = HostEA[k]
+			*result = append(*result, tmpRec)
+		}
+	case *pagedSearch:
+		search := obj.(*pagedSearch)
+		page := res.(*wapiPage)
+		PageRequests += 1
+		var items []interface{}
+		switch search.IBObject.(type) {
+		case *managedFixedAddress:
+			var result []managedFixedAddress
+			_ = connector.GetObject(search.IBObject, ref, &result)
+			sort.Slice(result, func(i, j int) bool { return result[i].Ref < result[j].Ref })
+			for _, item := range result {
+				items = append(items, item)
+			}
+		case *managedHostRecord:
+			var result []managedHostRecord
+			_ = connector.GetObject(search.IBObject, ref, &result)
+			sort.Slice(result, func(i, j int) bool { return result[i].Ref < result[j].Ref })
+			for _, item := range result {
+				items = append(items, item)
+			}
+		case *ipv6FixedAddress:
+			var result []managedFixedAddress
+			_ = connector.GetObject((*managedFixedAddress)(search.IBObject.(*ipv6FixedAddress)), ref, &result)
+			sort.Slice(result, func(i, j int) bool { return result[i].Ref < result[j].Ref })
+			for _, item := range result {
+				items = append(items, ipv6FixedAddress(item))
+			}
+		default:
+			panic("Unexpected type")
+		}
+		// The page ID is the offset of the page in the results
+		offset, _ := strconv.Atoi(search.PageID)
+		end := offset + search.MaxResults
+		if end < len(items) {
+			page.NextPageID = strconv.Itoa(end)
+		} else {
+			end = len(items)
+		}
+		for _, item := range items[offset:end] {
+			data, _ := json.Marshal(item)
+			page.Result = append(page.Result, data)
 		}
 	default:
 		panic("Unexpected type")
 	}
 	return nil
 }
+
+// scriptedRequestor fails the WAPI requests with its errors in order, and succeeds once they are used up
+type scriptedRequestor struct {
+	errs  []error
+	calls int
+}
+
+func (sr *scriptedRequestor) Init(cfg ibxclient.TransportConfig) {}
+
+func (sr *scriptedRequestor) SendRequest(req *http.Request) ([]byte, error) {
+	sr.calls += 1
+	if len(sr.errs) == 0 {
+		// The create requests return the reference of the object
+		if req.Method == http.MethodPost {
+			return []byte(`"ref"`), nil
+		}
+		return []byte("[]"), nil
+	}
+	err := sr.errs[0]
+	sr.errs = sr.errs[1:]
+	return nil, err
+}
+
+func matchesEASearch(ea ibxclient.EA, eaSearch ibxclient.EASearch) bool {
+	for key, val := range eaSearch {
+		if ea[key] != val {
+			return false
+		}
+	}
+	return true
+}
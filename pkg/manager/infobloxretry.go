@@ -0,0 +1,138 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"errors"
+	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	ibxclient "github.com/infobloxopen/infoblox-go-client"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// wapiRetries is the number of times a WAPI request that failed to reach the grid is retried
+	wapiRetries = 3
+	// wapiRetryBackoff is the delay before the first retry, it doubles on every retry
+	wapiRetryBackoff    = 500 * time.Millisecond
+	wapiRetryMaxBackoff = 5 * time.Second
+
+	// breakerThreshold is the number of consecutive WAPI requests that failed to reach the grid
+	// after which the circuit breaker opens
+	breakerThreshold = 5
+	// breakerCooldown is how long the circuit breaker stays open before requests are sent again
+	breakerCooldown = 30 * time.Second
+)
+
+var errCircuitOpen = errors.New("circuit breaker is open, Infoblox grid is unreachable")
+
+// circuitBreaker stops sending WAPI requests for a while once the grid is unreachable
+type circuitBreaker struct {
+	sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// allow reports whether a request can be sent, i.e. the breaker is closed or its cooldown has passed
+func (cb *circuitBreaker) allow() bool {
+	cb.Lock()
+	defer cb.Unlock()
+	return !time.Now().Before(cb.openUntil)
+}
+
+// isOpen reports whether requests are being stopped
+func (cb *circuitBreaker) isOpen() bool {
+	return !cb.allow()
+}
+
+// record counts the requests that failed to reach the grid, any other result closes the breaker
+func (cb *circuitBreaker) record(err error) {
+	cb.Lock()
+	defer cb.Unlock()
+	if err == nil || !isUnreachable(err) {
+		if cb.failures >= breakerThreshold {
+			log.Infof("[IPMG] Infoblox grid is reachable again, circuit breaker closed")
+		}
+		cb.failures = 0
+		cb.openUntil = time.Time{}
+		return
+	}
+	cb.failures++
+	if cb.failures >= breakerThreshold {
+		if cb.failures == breakerThreshold {
+			log.Warningf("[IPMG] Infoblox grid is unreachable, circuit breaker opened for %v", breakerCooldown)
+		}
+		cb.openUntil = time.Now().Add(breakerCooldown)
+	}
+}
+
+// resilientRequestor retries the WAPI requests that failed to reach the grid with exponential backoff,
+// and stops sending requests while the circuit breaker is open
+type resilientRequestor struct {
+	ibxclient.HttpRequestor
+	breaker *circuitBreaker
+}
+
+func (rr *resilientRequestor) SendRequest(req *http.Request) ([]byte, error) {
+	if !rr.breaker.allow() {
+		return nil, errCircuitOpen
+	}
+	var res []byte
+	var err error
+	for attempt := 0; ; attempt++ {
+		res, err = rr.HttpRequestor.SendRequest(req)
+		if err == nil || attempt >= wapiRetries || !isRetriable(req.Method, err) {
+			break
+		}
+		log.Debugf("[IPMG] Retrying WAPI request %v %v, Error: %v", req.Method, req.URL.Path, err)
+		time.Sleep(utils.Backoff(attempt, wapiRetryBackoff, wapiRetryMaxBackoff))
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				break
+			}
+		}
+	}
+	rr.breaker.record(err)
+	return res, err
+}
+
+// isUnreachable checks whether the error is a connection failure or a server error of the grid
+func isUnreachable(err error) bool {
+	return isConnectionError(err) || strings.HasPrefix(err.Error(), "WAPI request error: 5")
+}
+
+// isTransient checks whether connecting to the grid can succeed later without a change of the configuration
+func isTransient(err error) bool {
+	return errors.Is(err, errCircuitOpen) || isUnreachable(err)
+}
+
+// isRetriable checks whether the request can be sent again. A create request is retried only when
+// it did not reach the grid, so that no object is created twice
+func isRetriable(method string, err error) bool {
+	if !isUnreachable(err) {
+		return false
+	}
+	if method != http.MethodPost {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,263 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"encoding/json"
+	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
+	ibxclient "github.com/infobloxopen/infoblox-go-client"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// wapiPageSize is the maximum number of objects that WAPI returns in a page
+var wapiPageSize = 1000
+
+// duidZero is the DUID of the ipv6fixedaddress objects, like the zero MAC address of the fixedaddress objects
+const duidZero = "00:00:00:00:00:00:00:00"
+
+// wapiView is the WAPI view object, used to validate the DNSView of the labels
+type wapiView struct {
+	Ref  string `json:"_ref,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+func (v *wapiView) ObjectType() string { return "view" }
+
+func (v *wapiView) ReturnFields() []string { return []string{"name"} }
+
+func (v *wapiView) EaSearch() ibxclient.EASearch { return nil }
+
+// wapiRange is the WAPI range object, used to validate the Range of the labels
+type wapiRange struct {
+	Ref         string `json:"_ref,omitempty"`
+	StartAddr   string `json:"start_addr,omitempty"`
+	EndAddr     string `json:"end_addr,omitempty"`
+	NetworkView string `json:"network_view,omitempty"`
+}
+
+func (r *wapiRange) ObjectType() string { return "range" }
+
+func (r *wapiRange) ReturnFields() []string {
+	return []string{"start_addr", "end_addr", "network_view"}
+}
+
+func (r *wapiRange) EaSearch() ibxclient.EASearch { return nil }
+
+// containerNetwork is the WAPI network object, used to list the networks of a network container
+// and to find the network of an IP address
+type containerNetwork struct {
+	Ref              string `json:"_ref,omitempty"`
+	Network          string `json:"network,omitempty"`
+	NetworkView      string `json:"network_view,omitempty"`
+	NetworkContainer string `json:"network_container,omitempty"`
+	ContainsAddress  string `json:"contains_address,omitempty"`
+}
+
+func (n *containerNetwork) ObjectType() string { return "network" }
+
+func (n *containerNetwork) ReturnFields() []string { return []string{"network", "network_view"} }
+
+func (n *containerNetwork) EaSearch() ibxclient.EASearch { return nil }
+
+// nestedContainer is the WAPI networkcontainer object, used to list the network containers of a network container
+type nestedContainer struct {
+	Ref              string `json:"_ref,omitempty"`
+	Network          string `json:"network,omitempty"`
+	NetworkView      string `json:"network_view,omitempty"`
+	NetworkContainer string `json:"network_container,omitempty"`
+}
+
+func (n *nestedContainer) ObjectType() string { return "networkcontainer" }
+
+func (n *nestedContainer) ReturnFields() []string { return []string{"network", "network_view"} }
+
+func (n *nestedContainer) EaSearch() ibxclient.EASearch { return nil }
+
+// managedHostRecord is the WAPI record:host object, searched by the extensible attributes of the manager
+type managedHostRecord struct {
+	eaSearch    ibxclient.EASearch
+	Ref         string                         `json:"_ref,omitempty"`
+	Name        string                         `json:"name,omitempty"`
+	Ipv4Addr    string                         `json:"ipv4addr,omitempty"`
+	Ipv4Addrs   []ibxclient.HostRecordIpv4Addr `json:"ipv4addrs,omitempty"`
+	NetworkView string                         `json:"network_view,omitempty"`
+	Ea          ibxclient.EA                   `json:"extattrs,omitempty"`
+}
+
+func (h *managedHostRecord) ObjectType() string { return "record:host" }
+
+func (h *managedHostRecord) ReturnFields() []string {
+	return []string{"extattrs", "ipv4addrs", "name", "network_view"}
+}
+
+func (h *managedHostRecord) EaSearch() ibxclient.EASearch { return h.eaSearch }
+
+// managedFixedAddress is the WAPI fixedaddress object, searched by the extensible attributes of the manager
+type managedFixedAddress struct {
+	eaSearch    ibxclient.EASearch
+	Ref         string       `json:"_ref,omitempty"`
+	NetviewName string       `json:"network_view,omitempty"`
+	Cidr        string       `json:"network,omitempty"`
+	IPAddress   string       `json:"ipv4addr,omitempty"`
+	Name        string       `json:"name,omitempty"`
+	Ea          ibxclient.EA `json:"extattrs,omitempty"`
+}
+
+func (f *managedFixedAddress) ObjectType() string { return "fixedaddress" }
+
+func (f *managedFixedAddress) ReturnFields() []string {
+	return []string{"extattrs", "ipv4addr", "name", "network", "network_view"}
+}
+
+func (f *managedFixedAddress) EaSearch() ibxclient.EASearch { return f.eaSearch }
+
+// ipv6FixedAddress is the WAPI ipv6fixedaddress object, the fixed address of the IPv6 labels.
+// It has the fields of managedFixedAddress, which it converts to
+type ipv6FixedAddress struct {
+	eaSearch    ibxclient.EASearch
+	Ref         string       `json:"_ref,omitempty"`
+	NetviewName string       `json:"network_view,omitempty"`
+	Cidr        string       `json:"network,omitempty"`
+	IPAddress   string       `json:"ipv6addr,omitempty"`
+	Name        string       `json:"name,omitempty"`
+	Ea          ibxclient.EA `json:"extattrs,omitempty"`
+}
+
+func (f *ipv6FixedAddress) ObjectType() string { return "ipv6fixedaddress" }
+
+func (f *ipv6FixedAddress) ReturnFields() []string {
+	return []string{"extattrs", "ipv6addr", "name", "network", "network_view"}
+}
+
+func (f *ipv6FixedAddress) EaSearch() ibxclient.EASearch { return f.eaSearch }
+
+// newIPv6FixedAddress creates an ipv6fixedaddress, which requires a DUID
+type newIPv6FixedAddress struct {
+	ipv6FixedAddress
+	Duid string `json:"duid"`
+}
+
+// ipv6Network is the WAPI ipv6network object, used to validate the CIDRs of the IPv6 labels
+type ipv6Network struct {
+	Ref         string `json:"_ref,omitempty"`
+	Network     string `json:"network,omitempty"`
+	NetworkView string `json:"network_view,omitempty"`
+}
+
+func (n *ipv6Network) ObjectType() string { return "ipv6network" }
+
+func (n *ipv6Network) ReturnFields() []string { return []string{"network", "network_view"} }
+
+func (n *ipv6Network) EaSearch() ibxclient.EASearch { return nil }
+
+// ipv6AddressFromRef returns the IP address of the reference of an ipv6fixedaddress,
+// e.g. ipv6fixedaddress/ZG5zLmZpeGVkX2FkZHJlc3Mk:2001%3Adb8%3A%3A10/default
+func ipv6AddressFromRef(ref string) string {
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	ipAddr, err := url.PathUnescape(strings.SplitN(parts[1], "/", 2)[0])
+	if err != nil || !utils.IsIPV6Addr(ipAddr) {
+		return ""
+	}
+	return ipAddr
+}
+
+// pagedSearch gets a page of the objects matching the search of the IBObject
+type pagedSearch struct {
+	ibxclient.IBObject
+	PageID     string
+	MaxResults int
+}
+
+// MarshalJSON sends the search fields on the first page only, the next pages are identified by the PageID
+func (p *pagedSearch) MarshalJSON() ([]byte, error) {
+	if p.PageID != "" {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(p.IBObject)
+}
+
+func (p *pagedSearch) EaSearch() ibxclient.EASearch {
+	if p.PageID != "" {
+		return nil
+	}
+	return p.IBObject.EaSearch()
+}
+
+// wapiPage is a page of the results of a pagedSearch
+type wapiPage struct {
+	Result     []json.RawMessage `json:"result"`
+	NextPageID string            `json:"next_page_id,omitempty"`
+}
+
+// pagingRequestBuilder is the WAPI request builder that adds the paging arguments to the paged searches
+type pagingRequestBuilder struct {
+	ibxclient.WapiRequestBuilder
+}
+
+func (rb *pagingRequestBuilder) BuildRequest(
+	t ibxclient.RequestType,
+	obj ibxclient.IBObject,
+	ref string,
+	queryParams ibxclient.QueryParams,
+) (*http.Request, error) {
+	req, err := rb.WapiRequestBuilder.BuildRequest(t, obj, ref, queryParams)
+	if err != nil {
+		return req, err
+	}
+	if page, ok := obj.(*pagedSearch); ok && t == ibxclient.GET {
+		query := req.URL.Query()
+		query.Set("_paging", "1")
+		query.Set("_return_as_object", "1")
+		query.Set("_max_results", strconv.Itoa(page.MaxResults))
+		if page.PageID != "" {
+			query.Set("_page_id", page.PageID)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+	return req, nil
+}
+
+// searchObjects gets all the objects matching the search a page at a time, res is a pointer to a slice
+func (grid *infobloxGrid) searchObjects(obj ibxclient.IBObject, res interface{}) error {
+	var results []json.RawMessage
+	search := &pagedSearch{IBObject: obj, MaxResults: wapiPageSize}
+	for {
+		var page wapiPage
+		if err := grid.connector().GetObject(search, "", &page); err != nil {
+			return err
+		}
+		results = append(results, page.Result...)
+		if page.NextPageID == "" {
+			break
+		}
+		search.PageID = page.NextPageID
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, res)
+}
@@ -0,0 +1,87 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+)
+
+// Inspector defines the interface of the IPAM systems that can list their allocations
+type Inspector interface {
+	// Gets the IPAM labels along with their utilisation
+	GetLabelUsage() []LabelUsage
+	// Gets the allocations of the IPAM label, allocations of all labels when it is empty
+	GetAllocations(ipamLabel string) []Allocation
+}
+
+// Allocation is an IP address allocated to a hostname/key
+type Allocation struct {
+	IPAMLabel string `json:"ipamLabel"`
+	IPAddr    string `json:"ip"`
+	Reference string `json:"reference"`
+	// HostName tells that the reference is a hostname rather than a key
+	HostName bool `json:"hostName,omitempty"`
+}
+
+// NewAllocation returns the allocation of the IP address to the reference of a provider. The providers
+// keep the hostname, or the key, of the requests as their reference, only the keys namespace/name hold a "/"
+func NewAllocation(ipamLabel, ipAddr, ref string) Allocation {
+	return Allocation{
+		IPAMLabel: ipamLabel,
+		IPAddr:    ipAddr,
+		Reference: ref,
+		HostName:  ref != "" && !strings.Contains(ref, "/"),
+	}
+}
+
+// Request returns the request of the operation for the IP address of the allocation, with its
+// reference as the hostname or the key
+func (alloc Allocation) Request(operation string) ipamspec.IPAMRequest {
+	req := ipamspec.IPAMRequest{
+		Operation: operation,
+		IPAddr:    alloc.IPAddr,
+		IPAMLabel: alloc.IPAMLabel,
+	}
+	if alloc.HostName {
+		req.HostName = alloc.Reference
+	} else {
+		req.Key = alloc.Reference
+	}
+	return req
+}
+
+// LabelUsage is the utilisation of an IPAM label
+type LabelUsage struct {
+	IPAMLabel string `json:"ipamLabel"`
+	Range     string `json:"range"`
+	Total     int    `json:"total"`
+	Allocated int    `json:"allocated"`
+}
+
+// sortAllocations sorts the allocations in the order of their IP addresses
+func sortAllocations(allocations []Allocation) {
+	sort.Slice(allocations, func(i, j int) bool {
+		ipI := net.ParseIP(allocations[i].IPAddr).To16()
+		ipJ := net.ParseIP(allocations[j].IPAddr).To16()
+		return bytes.Compare(ipI, ipJ) < 0
+	})
+}
@@ -32,38 +32,65 @@ type Manager interface {
 	GetIPAddress(req ipamspec.IPAMRequest) string
 	// Gets and reserves the next available IP address
 	AllocateNextIPAddress(req ipamspec.IPAMRequest) string
+	// Reserves the IP address given in the request for hostname/key
+	ReserveIPAddress(req ipamspec.IPAMRequest) bool
 	// Releases an IP address
 	ReleaseIPAddress(req ipamspec.IPAMRequest)
 }
 
 const F5IPAMProvider = "f5-ip-provider"
 const InfobloxProvider = "infoblox"
+const NetBoxProvider = "netbox"
+const PhpIPAMProvider = "phpipam"
+const PluginProvider = "plugin"
+const RoutingProvider = "routing"
 
 type Params struct {
 	Provider string
 	IPAMManagerParams
 	InfobloxParams
+	NetBoxParams
+	PhpIPAMParams
+	PluginParams
+	RoutingParams
 }
 
 func NewManager(params Params) (Manager, error) {
 	switch params.Provider {
 	case F5IPAMProvider:
 		log.Debugf("[MGR] Creating Manager with Provider: %v", F5IPAMProvider)
-		f5IPAMParams := IPAMManagerParams{Range: params.Range}
+		f5IPAMParams := IPAMManagerParams{Range: params.Range, DBFile: params.DBFile, KeepLabels: params.KeepLabels}
 		return NewIPAMManager(f5IPAMParams)
 	case InfobloxProvider:
 		log.Debugf("[MGR] Creating Manager with Provider: %v", InfobloxProvider)
 		ibxParams := InfobloxParams{
-			Host:       params.Host,
-			Version:    params.Version,
-			Port:       params.Port,
-			Username:   params.Username,
-			Password:   params.Password,
-			IbLabelMap: params.IbLabelMap,
-			NetView:    params.NetView,
-			SslVerify:  params.SslVerify,
+			Host:         params.Host,
+			Version:      params.Version,
+			Port:         params.Port,
+			Username:     params.InfobloxParams.Username,
+			Password:     params.InfobloxParams.Password,
+			IbLabelMap:   params.IbLabelMap,
+			NetView:      params.NetView,
+			SslVerify:    params.SslVerify,
+			ClusterName:  params.ClusterName,
+			ExtraEAs:     params.ExtraEAs,
+			CacheTTL:     params.CacheTTL,
+			RetryConnect: params.InfobloxParams.RetryConnect,
+			Grids:        params.Grids,
 		}
 		return NewInfobloxManager(ibxParams)
+	case NetBoxProvider:
+		log.Debugf("[MGR] Creating Manager with Provider: %v", NetBoxProvider)
+		return NewNetBoxManager(params.NetBoxParams)
+	case PhpIPAMProvider:
+		log.Debugf("[MGR] Creating Manager with Provider: %v", PhpIPAMProvider)
+		return NewPhpIPAMManager(params.PhpIPAMParams)
+	case PluginProvider:
+		log.Debugf("[MGR] Creating Manager with Provider: %v", PluginProvider)
+		return NewPluginManager(params.PluginParams)
+	case RoutingProvider:
+		log.Debugf("[MGR] Creating Manager with Provider: %v", RoutingProvider)
+		return NewRoutingManager(params)
 	default:
 		log.Errorf("[MGR] Unknown Provider: %v", params.Provider)
 	}
@@ -8,20 +8,53 @@ import (
 var _ = Describe("Static IP Provider", func() {
 	It("New Manger test", func() {
 		params := Params{InfobloxProvider,
-			IPAMManagerParams{`"test":"172.16.1.1-172.16.1.5", "prod":"172.16.1.50-172.16.1.55"`},
-			InfobloxParams{"localhost",
-				"2.2.6",
-				"6443",
-				"admin",
-				"infoblox",
-				"{\"Dev\" :{\"cidr\": \"172.16.4.0/24\"},\"Test\" :{\"cidr\": \"172.16.5.0/24\"}}",
-				"default",
-				"false"}}
+			IPAMManagerParams{Range: `"test":"172.16.1.1-172.16.1.5", "prod":"172.16.1.50-172.16.1.55"`},
+			InfobloxParams{
+				Host:       "localhost",
+				Version:    "2.2.6",
+				Port:       "6443",
+				Username:   "admin",
+				Password:   "infoblox",
+				IbLabelMap: "{\"Dev\" :{\"cidr\": \"172.16.4.0/24\"},\"Test\" :{\"cidr\": \"172.16.5.0/24\"}}",
+				NetView:    "default",
+				SslVerify:  "false",
+			},
+			NetBoxParams{
+				URL:      "https://localhost:6443",
+				Token:    "token",
+				LabelMap: `{"Dev": {"prefix": "172.16.4.0/24"}}`,
+			},
+			PhpIPAMParams{
+				URL:      "https://localhost:6443",
+				AppID:    "fic",
+				Username: "admin",
+				Password: "ipamadmin",
+				LabelMap: `{"Dev": {"subnetId": 7}}`,
+			},
+			PluginParams{
+				URL:   "https://localhost:6443",
+				Token: "token",
+			},
+			RoutingParams{
+				LabelMap: `{"Dev": "netbox"}`,
+			}}
 		_, err := NewManager(params)
 		Expect(err).NotTo(BeEquivalentTo(nil))
 		params.Provider = F5IPAMProvider
 		_, err = NewManager(params)
 		Expect(err).NotTo(BeEquivalentTo(nil))
+		params.Provider = NetBoxProvider
+		_, err = NewManager(params)
+		Expect(err).NotTo(BeEquivalentTo(nil))
+		params.Provider = PhpIPAMProvider
+		_, err = NewManager(params)
+		Expect(err).NotTo(BeEquivalentTo(nil))
+		params.Provider = PluginProvider
+		_, err = NewManager(params)
+		Expect(err).NotTo(BeEquivalentTo(nil))
+		params.Provider = RoutingProvider
+		_, err = NewManager(params)
+		Expect(err).NotTo(BeEquivalentTo(nil))
 		params.Provider = "default"
 		_, err = NewManager(params)
 		Expect(err).NotTo(BeEquivalentTo(nil))
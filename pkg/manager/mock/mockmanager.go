@@ -1,16 +1,29 @@
 package mock
 
 import (
+	"fmt"
+
 	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
 )
 
 type MockManager struct {
-	data MockData
+	data     MockData
+	aRecords []string
 }
 type MockData struct {
 	IPList      []string
 	index       int
 	SkipARecord bool
+	DNSEnabled  bool
+	NotReady    bool
+	// NotReadyLabels are the IPAM labels that the manager can not serve
+	NotReadyLabels []string
+	// Labels are the valid IPAM labels, all labels are valid when it is empty
+	Labels []string
+	// FailRelease fails the releases of the IP addresses
+	FailRelease bool
+	// FailLookup fails the lookups of the IP addresses
+	FailLookup bool
 }
 
 func NewMockIPAMManager(mockData MockData) (*MockManager, error) {
@@ -38,6 +51,42 @@ func (fm *MockManager) CreateARecord(req ipamspec.IPAMRequest) bool {
 
 // Deletes an A record and releases the IP address
 func (fm *MockManager) DeleteARecord(req ipamspec.IPAMRequest) {
+	fm.aRecords = append(fm.aRecords, req.HostName)
+}
+
+// Gets the hostnames of the deleted A records
+func (fm *MockManager) DeletedARecords() []string {
+	return fm.aRecords
+}
+
+// Checks whether DNS records are to be created for the IPAM label
+func (fm *MockManager) IsDNSEnabled(ipamLabel string) bool {
+	return fm.data.DNSEnabled
+}
+
+// Fails the creation of A records when set
+func (fm *MockManager) SkipRecord(skip bool) {
+	fm.data.SkipARecord = skip
+}
+
+// Checks whether the manager can serve requests
+func (fm *MockManager) IsReady() bool {
+	return !fm.data.NotReady
+}
+
+// Checks whether the manager can serve the requests of the IPAM label
+func (fm *MockManager) IsLabelReady(ipamLabel string) bool {
+	for _, label := range fm.data.NotReadyLabels {
+		if label == ipamLabel {
+			return false
+		}
+	}
+	return fm.IsReady()
+}
+
+// Makes the manager ready or not ready
+func (fm *MockManager) SetReady(ready bool) {
+	fm.data.NotReady = !ready
 }
 
 // Gets and reserves the next available IP address
@@ -50,7 +99,58 @@ func (fm *MockManager) AllocateNextIPAddress(req ipamspec.IPAMRequest) string {
 	return ip
 }
 
+// Reserves the IP address given in the request
+func (fm *MockManager) ReserveIPAddress(req ipamspec.IPAMRequest) bool {
+	return req.IPAddr != ""
+}
+
 // Releases an IP address
 func (fm *MockManager) ReleaseIPAddress(req ipamspec.IPAMRequest) {
 	fm.data.index--
 }
+
+// Checks the IPAM label of the request
+func (fm *MockManager) ValidateRequest(req ipamspec.IPAMRequest) error {
+	if len(fm.data.Labels) == 0 {
+		return nil
+	}
+	for _, label := range fm.data.Labels {
+		if label == req.IPAMLabel {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown IPAM label %v", req.IPAMLabel)
+}
+
+// Gets the IP address of the hostname/key, fails when FailLookup is set
+func (fm *MockManager) LookupIPAddress(req ipamspec.IPAMRequest) (string, error) {
+	if fm.data.FailLookup {
+		return "", fmt.Errorf("unable to look up %v", req.HostName+req.Key)
+	}
+	return fm.GetIPAddress(req), nil
+}
+
+// Deletes an A record
+func (fm *MockManager) RemoveARecord(req ipamspec.IPAMRequest) error {
+	fm.DeleteARecord(req)
+	return nil
+}
+
+// Releases an IP address, fails when FailRelease is set
+func (fm *MockManager) RemoveIPAddress(req ipamspec.IPAMRequest) error {
+	if fm.data.FailRelease {
+		return fmt.Errorf("unable to release %v", req.IPAddr)
+	}
+	fm.ReleaseIPAddress(req)
+	return nil
+}
+
+// Fails the releases of the IP addresses when set
+func (fm *MockManager) SetFailRelease(fail bool) {
+	fm.data.FailRelease = fail
+}
+
+// Fails the lookups of the IP addresses when set
+func (fm *MockManager) SetFailLookup(fail bool) {
+	fm.data.FailLookup = fail
+}
@@ -0,0 +1,199 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// netboxPageSize is the number of objects that a NetBox list request returns at most
+var netboxPageSize = 1000
+
+// netboxTimeout is the timeout of the NetBox requests
+const netboxTimeout = 20 * time.Second
+
+// netboxTagRef refers to a tag by its slug in the objects sent to NetBox
+type netboxTagRef struct {
+	Slug string `json:"slug"`
+}
+
+// netboxTag is a tag of NetBox
+type netboxTag struct {
+	ID   int    `json:"id,omitempty"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// netboxPrefix is a prefix of NetBox
+type netboxPrefix struct {
+	ID     int    `json:"id"`
+	Prefix string `json:"prefix"`
+}
+
+// netboxRange is an IP range of NetBox, the addresses carry the prefix length, e.g. 10.1.0.10/24
+type netboxRange struct {
+	ID           int    `json:"id"`
+	StartAddress string `json:"start_address"`
+	EndAddress   string `json:"end_address"`
+}
+
+// netboxIPAddress is an IP address of NetBox as it is read
+type netboxIPAddress struct {
+	ID          int         `json:"id"`
+	Address     string      `json:"address"`
+	DNSName     string      `json:"dns_name"`
+	Description string      `json:"description"`
+	Tags        []netboxTag `json:"tags"`
+}
+
+// newNetboxIPAddress is an IP address of NetBox as it is created
+type newNetboxIPAddress struct {
+	Address     string         `json:"address,omitempty"`
+	Status      string         `json:"status"`
+	DNSName     string         `json:"dns_name,omitempty"`
+	Description string         `json:"description"`
+	Comments    string         `json:"comments,omitempty"`
+	Tags        []netboxTagRef `json:"tags"`
+}
+
+// netboxList is a page of the objects of a NetBox list request
+type netboxList struct {
+	Count   int               `json:"count"`
+	Results []json.RawMessage `json:"results"`
+}
+
+// host returns the IP address of the address with its prefix length, e.g. 10.1.0.5 of 10.1.0.5/24
+func (addr netboxIPAddress) host() string {
+	return strings.Split(addr.Address, "/")[0]
+}
+
+// netboxClient sends the requests of the NetBox REST API
+type netboxClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+func newNetboxClient(params NetBoxParams) (*netboxClient, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: params.Insecure}
+	if params.CACertFile != "" && !params.Insecure {
+		cert, err := ioutil.ReadFile(params.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(cert) {
+			return nil, fmt.Errorf("no certificate found in %v", params.CACertFile)
+		}
+	}
+	return &netboxClient{
+		baseURL: strings.TrimSuffix(params.URL, "/"),
+		token:   params.Token,
+		httpClient: &http.Client{
+			Timeout:   netboxTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+	}, nil
+}
+
+// netboxStatusError is the error response of NetBox to a request
+type netboxStatusError struct {
+	method string
+	path   string
+	status int
+	body   []byte
+}
+
+func (err *netboxStatusError) Error() string {
+	return fmt.Sprintf("NetBox request error: %v %v: %d %s", err.method, err.path, err.status, err.body)
+}
+
+// do sends the request to the path, e.g. /api/ipam/prefixes/, with the body as JSON and decodes the response in res
+func (client *netboxClient) do(method, path string, query url.Values, body, res interface{}) error {
+	reqURL := client.baseURL + path
+	if len(query) != 0 {
+		reqURL += "?" + query.Encode()
+	}
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, reqURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+client.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return &netboxStatusError{method: method, path: path, status: resp.StatusCode, body: bytes.TrimSpace(data)}
+	}
+	if res == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, res)
+}
+
+// list gets all the objects of the path matching the query a page at a time, res is a pointer to a slice
+func (client *netboxClient) list(path string, query url.Values, res interface{}) error {
+	var results []json.RawMessage
+	pageQuery := url.Values{}
+	for k, v := range query {
+		pageQuery[k] = v
+	}
+	pageQuery.Set("limit", strconv.Itoa(netboxPageSize))
+	for {
+		pageQuery.Set("offset", strconv.Itoa(len(results)))
+		var page netboxList
+		if err := client.do(http.MethodGet, path, pageQuery, nil, &page); err != nil {
+			return err
+		}
+		results = append(results, page.Results...)
+		if len(page.Results) == 0 || len(results) >= page.Count {
+			break
+		}
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, res)
+}
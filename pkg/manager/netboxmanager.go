@@ -0,0 +1,426 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+// NetBoxTag is the slug of the tag of the IP addresses created by the controller, the lookups and
+// releases are scoped to it
+const NetBoxTag = "f5-ipam-controller"
+
+type NetBoxParams struct {
+	// URL of NetBox, e.g. https://netbox.example.com
+	URL string
+	// Token is the API token of NetBox
+	Token string
+	// LabelMap is the JSON of the prefix or IP range of each IPAM label
+	LabelMap string
+	// CACertFile is the certificate to verify NetBox with, the system certificates are used when it is empty
+	CACertFile string
+	// Insecure skips the verification of the certificate of NetBox
+	Insecure bool
+	// RetryConnect keeps connecting to NetBox in the background instead of failing when it is unreachable
+	RetryConnect bool
+}
+
+// NBConfig maps an IPAM label to a prefix, e.g. 10.1.0.0/24, or an IP range, e.g. 10.1.0.10-10.1.0.50, of NetBox
+type NBConfig struct {
+	Prefix string `json:"prefix,omitempty"`
+	Range  string `json:"range,omitempty"`
+}
+
+// netboxLabel is the prefix or IP range of a label as it is found in NetBox
+type netboxLabel struct {
+	NBConfig
+	// path is the API path of the prefix or IP range, its available-ips are allocated from
+	path string
+	// prefixLength of the IP addresses of the label
+	prefixLength string
+}
+
+type NetBoxManager struct {
+	client *netboxClient
+	labels map[string]*netboxLabel
+	// connected is set once the tag is created and the prefixes and IP ranges of the labels are found
+	connected int32
+}
+
+func NewNetBoxManager(params NetBoxParams) (*NetBoxManager, error) {
+	labels, err := ParseNetBoxLabels(params.LabelMap)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newNetboxClient(params)
+	if err != nil {
+		return nil, err
+	}
+	nbMgr := &NetBoxManager{
+		client: client,
+		labels: make(map[string]*netboxLabel),
+	}
+	for name, label := range labels {
+		nbMgr.labels[name] = &netboxLabel{NBConfig: label}
+	}
+	if err = nbMgr.connect(); err != nil {
+		// Only an unreachable NetBox is retried, the errors of the configuration fail at once
+		if !params.RetryConnect || !isNetBoxTransient(err) {
+			return nil, err
+		}
+		log.Errorf("[IPMG] Unable to connect to NetBox, retrying in the background, Error: %v", err)
+		go retryConnect("NetBox", nbMgr.connect, isNetBoxTransient)
+	}
+	return nbMgr, nil
+}
+
+// isNetBoxTransient checks whether connecting to NetBox can succeed later without a change of the configuration
+func isNetBoxTransient(err error) bool {
+	var statusErr *netboxStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status >= http.StatusInternalServerError
+	}
+	return isConnectionError(err)
+}
+
+// IsReady checks whether the manager is connected to NetBox
+func (nbMgr *NetBoxManager) IsReady() bool {
+	return atomic.LoadInt32(&nbMgr.connected) == 1
+}
+
+// ParseNetBoxLabels parses the prefix or IP range of each IPAM label
+func ParseNetBoxLabels(params string) (map[string]NBConfig, error) {
+	nbLabelMap := make(map[string]NBConfig)
+	err := json.Unmarshal([]byte(params), &nbLabelMap)
+	if err != nil {
+		return nil, err
+	}
+	for label, nbParam := range nbLabelMap {
+		switch {
+		case (nbParam.Prefix == "") == (nbParam.Range == ""):
+			return nil, fmt.Errorf("exactly one of prefix and range is required for label %v", label)
+		case nbParam.Prefix != "":
+			if _, _, err = net.ParseCIDR(nbParam.Prefix); err != nil {
+				return nil, fmt.Errorf("invalid prefix %v for label %v", nbParam.Prefix, label)
+			}
+		case !isIPRange(nbParam.Range):
+			return nil, fmt.Errorf("invalid range %v for label %v", nbParam.Range, label)
+		}
+	}
+	return nbLabelMap, nil
+}
+
+// connect creates the tag of the controller and finds the prefixes and IP ranges of the labels
+func (nbMgr *NetBoxManager) connect() error {
+	var tags []netboxTag
+	err := nbMgr.client.list("/api/extras/tags/", url.Values{"slug": {NetBoxTag}}, &tags)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		tag := netboxTag{Name: NetBoxTag, Slug: NetBoxTag}
+		if err = nbMgr.client.do(http.MethodPost, "/api/extras/tags/", nil, tag, nil); err != nil {
+			return err
+		}
+	}
+	for name, label := range nbMgr.labels {
+		if err = nbMgr.findLabel(label); err != nil {
+			return fmt.Errorf("%w for label %v", err, name)
+		}
+	}
+	atomic.StoreInt32(&nbMgr.connected, 1)
+	return nil
+}
+
+// findLabel finds the prefix or the IP range of the label, it has to be unique
+func (nbMgr *NetBoxManager) findLabel(label *netboxLabel) error {
+	if label.Prefix != "" {
+		var prefixes []netboxPrefix
+		err := nbMgr.client.list("/api/ipam/prefixes/", url.Values{"prefix": {label.Prefix}}, &prefixes)
+		if err != nil {
+			return err
+		}
+		if len(prefixes) != 1 {
+			return fmt.Errorf("found %d prefixes %v, expected one", len(prefixes), label.Prefix)
+		}
+		label.path = fmt.Sprintf("/api/ipam/prefixes/%d/", prefixes[0].ID)
+		label.prefixLength = strings.Split(label.Prefix, "/")[1]
+		return nil
+	}
+	bounds := strings.Split(label.Range, "-")
+	var ranges []netboxRange
+	query := url.Values{"start_address": {bounds[0]}, "end_address": {bounds[1]}}
+	if err := nbMgr.client.list("/api/ipam/ip-ranges/", query, &ranges); err != nil {
+		return err
+	}
+	if len(ranges) != 1 {
+		return fmt.Errorf("found %d IP ranges %v, expected one", len(ranges), label.Range)
+	}
+	label.path = fmt.Sprintf("/api/ipam/ip-ranges/%d/", ranges[0].ID)
+	if parts := strings.Split(ranges[0].StartAddress, "/"); len(parts) == 2 {
+		label.prefixLength = parts[1]
+	}
+	return nil
+}
+
+// CreateARecord is a no-op, NetBox holds the hostname in the dns_name of the IP address
+func (nbMgr *NetBoxManager) CreateARecord(req ipamspec.IPAMRequest) bool {
+	return true
+}
+
+// DeleteARecord is a no-op, the dns_name is deleted along with the IP address
+func (nbMgr *NetBoxManager) DeleteARecord(req ipamspec.IPAMRequest) {
+}
+
+// RemoveARecord NetBox does not manage DNS records
+func (nbMgr *NetBoxManager) RemoveARecord(req ipamspec.IPAMRequest) error {
+	return nil
+}
+
+// GetIPAddress Gets the IP Address of the hostname/key from the description of the IP addresses of the label
+func (nbMgr *NetBoxManager) GetIPAddress(req ipamspec.IPAMRequest) string {
+	if req.HostName == "" && req.Key == "" {
+		log.Errorf("[IPMG] Invalid Request to get IPAddress: %+v", req)
+		return ""
+	}
+	ipAddr, err := nbMgr.LookupIPAddress(req)
+	if err != nil {
+		log.Errorf("[IPMG] Unable to get IP Address of %v, Error: %v", reference(req), err)
+	}
+	return ipAddr
+}
+
+// LookupIPAddress Gets the IP Address of the hostname/key, the failures of NetBox are returned
+func (nbMgr *NetBoxManager) LookupIPAddress(req ipamspec.IPAMRequest) (string, error) {
+	if req.HostName == "" && req.Key == "" {
+		return "", nil
+	}
+	addrs, err := nbMgr.searchIPAddresses(req.IPAMLabel, url.Values{"description": {reference(req)}})
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		return addr.host(), nil
+	}
+	return "", nil
+}
+
+// AllocateNextIPAddress Gets and reserves the next available IP address of the prefix or IP range of the label
+func (nbMgr *NetBoxManager) AllocateNextIPAddress(req ipamspec.IPAMRequest) string {
+	label, ok := nbMgr.labels[req.IPAMLabel]
+	if !ok {
+		return ""
+	}
+	// The prefix or IP range of the label is found once NetBox is connected
+	if !nbMgr.IsReady() {
+		log.Errorf("[IPMG] Unable to Get a New IP Address: %+v, NetBox is not connected", req)
+		return ""
+	}
+	var addr netboxIPAddress
+	err := nbMgr.client.do(http.MethodPost, label.path+"available-ips/", nil, nbMgr.newIPAddress(req, ""), &addr)
+	if err != nil {
+		log.Errorf("[IPMG] Unable to Get a New IP Address: %+v, Error: %v", req, err)
+		return ""
+	}
+	return addr.host()
+}
+
+// ReserveIPAddress Reserves the IP address given in the request, unless NetBox holds it already
+func (nbMgr *NetBoxManager) ReserveIPAddress(req ipamspec.IPAMRequest) bool {
+	label, ok := nbMgr.labels[req.IPAMLabel]
+	if !ok || !utils.IsIPAddr(req.IPAddr) {
+		log.Errorf("[IPMG] Invalid Request to Reserve IP Address: %+v", req)
+		return false
+	}
+	if !utils.IsIPInRange(req.IPAddr, nbMgr.labelRange(label)) {
+		log.Errorf("[IPMG] IP Address not in the range of label: %+v", req)
+		return false
+	}
+	if !nbMgr.IsReady() {
+		log.Errorf("[IPMG] Unable to Reserve IP Address: %+v, NetBox is not connected", req)
+		return false
+	}
+	var addrs []netboxIPAddress
+	err := nbMgr.client.list("/api/ipam/ip-addresses/", url.Values{"address": {req.IPAddr}}, &addrs)
+	if err != nil {
+		log.Errorf("[IPMG] Unable to Reserve IP Address: %+v, Error: %v", req, err)
+		return false
+	}
+	if len(addrs) != 0 {
+		log.Errorf("[IPMG] IP Address %v is already in NetBox, Request: %+v", req.IPAddr, req)
+		return false
+	}
+	address := req.IPAddr + "/" + label.prefixLength
+	err = nbMgr.client.do(http.MethodPost, "/api/ipam/ip-addresses/", nil, nbMgr.newIPAddress(req, address), nil)
+	if err != nil {
+		log.Errorf("[IPMG] Unable to Reserve IP Address: %+v, Error: %v", req, err)
+		return false
+	}
+	return true
+}
+
+// ValidateRequest Checks the IPAM label and the IP address of the request
+func (nbMgr *NetBoxManager) ValidateRequest(req ipamspec.IPAMRequest) error {
+	label, ok := nbMgr.labels[req.IPAMLabel]
+	if !ok {
+		return fmt.Errorf("unknown IPAM label %v", req.IPAMLabel)
+	}
+	return validateIPAddress(req, nbMgr.labelRange(label))
+}
+
+// ReleaseIPAddress Releases an IP address by deleting the IP address object
+func (nbMgr *NetBoxManager) ReleaseIPAddress(req ipamspec.IPAMRequest) {
+	if !utils.IsIPAddr(req.IPAddr) {
+		log.Errorf("[IPMG] Unable to Release IP Address, as Invalid IP Address Provided")
+		return
+	}
+	if err := nbMgr.RemoveIPAddress(req); err != nil {
+		log.Errorf("[IPMG] Unable to Release IP Address: %+v, Error: %v", req, err)
+	}
+}
+
+// RemoveIPAddress Releases an IP address, the failures of NetBox are returned
+func (nbMgr *NetBoxManager) RemoveIPAddress(req ipamspec.IPAMRequest) error {
+	if !utils.IsIPAddr(req.IPAddr) {
+		return nil
+	}
+	addrs, err := nbMgr.searchIPAddresses(req.IPAMLabel, url.Values{"address": {req.IPAddr}})
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		err = nbMgr.client.do(http.MethodDelete, fmt.Sprintf("/api/ipam/ip-addresses/%d/", addr.ID), nil, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLabelUsage Gets the IPAM labels along with their utilisation
+func (nbMgr *NetBoxManager) GetLabelUsage() []LabelUsage {
+	var usage []LabelUsage
+	for _, ipamLabel := range nbMgr.getLabelNames() {
+		label := nbMgr.labels[ipamLabel]
+		usage = append(usage, LabelUsage{
+			IPAMLabel: ipamLabel,
+			Range:     nbMgr.labelRange(label),
+			Total:     rangeSize(nbMgr.labelRange(label)),
+			Allocated: len(nbMgr.GetAllocations(ipamLabel)),
+		})
+	}
+	return usage
+}
+
+// GetAllocations Gets the allocations of the IPAM label
+func (nbMgr *NetBoxManager) GetAllocations(ipamLabel string) []Allocation {
+	labels := []string{ipamLabel}
+	if ipamLabel == "" {
+		labels = nbMgr.getLabelNames()
+	}
+	var allocations []Allocation
+	for _, name := range labels {
+		addrs, err := nbMgr.searchIPAddresses(name, url.Values{})
+		if err != nil {
+			log.Errorf("[IPMG] Unable to get IP Addresses of label %v, Error: %v", name, err)
+			continue
+		}
+		for _, addr := range addrs {
+			allocations = append(allocations, NewAllocation(name, addr.host(), addr.Description))
+		}
+	}
+	sortAllocations(allocations)
+	return allocations
+}
+
+// searchIPAddresses returns the IP addresses of the controller in the prefix or IP range of the label
+// that match the query
+func (nbMgr *NetBoxManager) searchIPAddresses(ipamLabel string, query url.Values) ([]netboxIPAddress, error) {
+	label, ok := nbMgr.labels[ipamLabel]
+	if !ok {
+		return nil, fmt.Errorf("label %v not found", ipamLabel)
+	}
+	query.Set("tag", NetBoxTag)
+	if label.Prefix != "" {
+		query.Set("parent", label.Prefix)
+	}
+	var addrs, res []netboxIPAddress
+	if err := nbMgr.client.list("/api/ipam/ip-addresses/", query, &addrs); err != nil {
+		return nil, err
+	}
+	// IP addresses cannot be searched by IP range
+	for _, addr := range addrs {
+		if utils.IsIPInRange(addr.host(), nbMgr.labelRange(label)) {
+			res = append(res, addr)
+		}
+	}
+	return res, nil
+}
+
+// newIPAddress returns the IP address to create for the request, tagged and described with its hostname/key
+// and the resource that owns it. The address is empty when it is allocated from the available IPs
+func (nbMgr *NetBoxManager) newIPAddress(req ipamspec.IPAMRequest, address string) newNetboxIPAddress {
+	addr := newNetboxIPAddress{
+		Address:     address,
+		Status:      "active",
+		DNSName:     req.HostName,
+		Description: reference(req),
+		Tags:        []netboxTagRef{{Slug: NetBoxTag}},
+	}
+	if meta, ok := req.Metadata.(ipamspec.ResourceMetadata); ok {
+		addr.Comments = fmt.Sprintf("Allocated by the F5 IPAM Controller to %v/%v", meta.GetNamespace(), meta.GetName())
+	}
+	return addr
+}
+
+// labelRange returns the prefix or IP range of the label
+func (nbMgr *NetBoxManager) labelRange(label *netboxLabel) string {
+	if label.Prefix != "" {
+		return label.Prefix
+	}
+	return label.Range
+}
+
+// getLabelNames returns the names of the labels in order
+func (nbMgr *NetBoxManager) getLabelNames() []string {
+	var names []string
+	for name := range nbMgr.labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reference returns the key of the request, or its hostname when it has no key
+func reference(req ipamspec.IPAMRequest) string {
+	if req.Key != "" {
+		return req.Key
+	}
+	return req.HostName
+}
@@ -0,0 +1,217 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// phpipamTimeout is the timeout of the phpIPAM requests
+const phpipamTimeout = 20 * time.Second
+
+// phpipamID is an ID of phpIPAM, which are sent as numbers or strings depending on the object
+type phpipamID string
+
+func (id *phpipamID) UnmarshalJSON(data []byte) error {
+	*id = phpipamID(strings.Trim(string(data), `"`))
+	return nil
+}
+
+// phpipamResponse is the envelope of the phpIPAM responses
+type phpipamResponse struct {
+	Code    int             `json:"code"`
+	Success interface{}     `json:"success"`
+	Message string          `json:"message"`
+	ID      phpipamID       `json:"id"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// phpipamToken is the data of the response to the authentication
+type phpipamToken struct {
+	Token string `json:"token"`
+}
+
+// phpipamSubnet is a subnet of phpIPAM, e.g. 10.1.0.0 with the mask 24
+type phpipamSubnet struct {
+	ID     phpipamID `json:"id"`
+	Subnet string    `json:"subnet"`
+	Mask   phpipamID `json:"mask"`
+}
+
+// phpipamAddress is an address of phpIPAM
+type phpipamAddress struct {
+	ID          phpipamID `json:"id,omitempty"`
+	SubnetID    phpipamID `json:"subnetId,omitempty"`
+	IP          string    `json:"ip,omitempty"`
+	Hostname    string    `json:"hostname,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+}
+
+// phpipamClient sends the requests of the phpIPAM REST API, it authenticates again when the token expires
+type phpipamClient struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+
+	mutex sync.Mutex
+	token string
+}
+
+func newPhpipamClient(params PhpIPAMParams) (*phpipamClient, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: params.Insecure}
+	if params.CACertFile != "" && !params.Insecure {
+		cert, err := ioutil.ReadFile(params.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(cert) {
+			return nil, fmt.Errorf("no certificate found in %v", params.CACertFile)
+		}
+	}
+	return &phpipamClient{
+		baseURL:  strings.TrimSuffix(params.URL, "/") + "/api/" + url.PathEscape(params.AppID),
+		username: params.Username,
+		password: params.Password,
+		httpClient: &http.Client{
+			Timeout:   phpipamTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+	}, nil
+}
+
+// login gets a new token with the username and password
+func (client *phpipamClient) login() error {
+	req, err := http.NewRequest(http.MethodPost, client.baseURL+"/user/", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(client.username, client.password)
+	var token phpipamToken
+	if _, err = client.send(req, &token); err != nil {
+		return err
+	}
+	if token.Token == "" {
+		return fmt.Errorf("phpIPAM returned no token")
+	}
+	client.mutex.Lock()
+	client.token = token.Token
+	client.mutex.Unlock()
+	return nil
+}
+
+// do sends the request to the path, e.g. /addresses/, with the body as JSON and decodes the data of the
+// response in res. It returns the ID of the created object
+func (client *phpipamClient) do(method, path string, body, res interface{}) (phpipamID, error) {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return "", err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, client.baseURL+path, bytes.NewReader(reqBody))
+		if err != nil {
+			return "", err
+		}
+		client.mutex.Lock()
+		req.Header.Set("token", client.token)
+		client.mutex.Unlock()
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		id, err := client.send(req, res)
+		// The token expires after a while without requests
+		if isPhpipamStatus(err, http.StatusUnauthorized, http.StatusForbidden) && attempt == 0 {
+			if err = client.login(); err != nil {
+				return "", err
+			}
+			continue
+		}
+		return id, err
+	}
+}
+
+// phpipamError is an error response of phpIPAM
+type phpipamError struct {
+	method  string
+	path    string
+	code    int
+	message string
+}
+
+func (e *phpipamError) Error() string {
+	return fmt.Sprintf("phpIPAM request error: %v %v: %d %v", e.method, e.path, e.code, e.message)
+}
+
+// isPhpipamStatus checks whether the error is a phpIPAM error response of one of the status codes
+func isPhpipamStatus(err error, codes ...int) bool {
+	apiErr, ok := err.(*phpipamError)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends the request and decodes the data of the response in res
+func (client *phpipamClient) send(req *http.Request, res interface{}) (phpipamID, error) {
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var envelope phpipamResponse
+	if err = json.Unmarshal(data, &envelope); err != nil {
+		return "", &phpipamError{req.Method, req.URL.Path, resp.StatusCode, string(bytes.TrimSpace(data))}
+	}
+	code := resp.StatusCode
+	if envelope.Code != 0 {
+		code = envelope.Code
+	}
+	if code < http.StatusOK || code >= http.StatusMultipleChoices {
+		return "", &phpipamError{req.Method, req.URL.Path, code, envelope.Message}
+	}
+	if res != nil && len(envelope.Data) != 0 && string(envelope.Data) != "null" {
+		if err = json.Unmarshal(envelope.Data, res); err != nil {
+			return "", err
+		}
+	}
+	return envelope.ID, nil
+}
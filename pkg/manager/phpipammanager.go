@@ -0,0 +1,415 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+// PhpIPAMOwner is the owner of the addresses created by the controller, the lookups and releases are scoped to it
+const PhpIPAMOwner = "f5-ipam-controller"
+
+type PhpIPAMParams struct {
+	// URL of phpIPAM, e.g. https://phpipam.example.com
+	URL string
+	// AppID is the ID of the API application of phpIPAM
+	AppID    string
+	Username string
+	Password string
+	// LabelMap is the JSON of the subnet ID of each IPAM label
+	LabelMap string
+	// CACertFile is the certificate to verify phpIPAM with, the system certificates are used when it is empty
+	CACertFile string
+	// Insecure skips the verification of the certificate of phpIPAM
+	Insecure bool
+	// RetryConnect keeps connecting to phpIPAM in the background instead of failing when it is unreachable
+	RetryConnect bool
+}
+
+// PIConfig maps an IPAM label to a subnet of phpIPAM
+type PIConfig struct {
+	SubnetID int `json:"subnetId"`
+}
+
+type PhpIPAMManager struct {
+	params PhpIPAMParams
+	labels map[string]PIConfig
+	// connected is set once the manager is authenticated and the subnets of the labels are found
+	connected int32
+
+	mutex  sync.RWMutex
+	client *phpipamClient
+	// cidrs are the subnets of the labels, e.g. 10.1.0.0/24
+	cidrs map[string]string
+}
+
+func NewPhpIPAMManager(params PhpIPAMParams) (*PhpIPAMManager, error) {
+	labels, err := ParsePhpIPAMLabels(params.LabelMap)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newPhpipamClient(params)
+	if err != nil {
+		return nil, err
+	}
+	piMgr := &PhpIPAMManager{
+		params: params,
+		client: client,
+		labels: labels,
+		cidrs:  make(map[string]string),
+	}
+	if err = piMgr.connect(); err != nil {
+		// Only an unreachable phpIPAM is retried, the errors of the configuration fail at once
+		if !params.RetryConnect || !isPhpIPAMTransient(err) {
+			return nil, err
+		}
+		log.Errorf("[IPMG] Unable to connect to phpIPAM, retrying in the background, Error: %v", err)
+		go retryConnect("phpIPAM", piMgr.connect, isPhpIPAMTransient)
+	}
+	return piMgr, nil
+}
+
+// isPhpIPAMTransient checks whether connecting to phpIPAM can succeed later without a change of the configuration
+func isPhpIPAMTransient(err error) bool {
+	var apiErr *phpipamError
+	if errors.As(err, &apiErr) {
+		// phpIPAM rejects the username and password of the login with 500
+		if apiErr.code == http.StatusInternalServerError && strings.HasSuffix(apiErr.path, "/user/") {
+			return false
+		}
+		return apiErr.code >= http.StatusInternalServerError
+	}
+	return isConnectionError(err)
+}
+
+// IsReady checks whether the manager is connected to phpIPAM
+func (piMgr *PhpIPAMManager) IsReady() bool {
+	return atomic.LoadInt32(&piMgr.connected) == 1
+}
+
+// UpdateCredentials authenticates with the host, port, username and password of the params, the certificate
+// file is read again. The current client is kept when phpIPAM does not accept them. phpIPAM has no grids,
+// the credentials of the other grids belong to the Infoblox provider that the labels are routed to along with it
+func (piMgr *PhpIPAMManager) UpdateCredentials(grid string, params GridParams) error {
+	if grid != "" && grid != DefaultGrid {
+		return nil
+	}
+	piParams := piMgr.params
+	piParams.Username = params.Username
+	piParams.Password = params.Password
+	if params.Host != "" && params.Port != "" {
+		addr, err := url.Parse(piParams.URL)
+		if err != nil {
+			return err
+		}
+		addr.Host = net.JoinHostPort(params.Host, params.Port)
+		piParams.URL = addr.String()
+	}
+	client, err := newPhpipamClient(piParams)
+	if err != nil {
+		return err
+	}
+	if err = client.login(); err != nil {
+		return err
+	}
+	piMgr.mutex.Lock()
+	piMgr.params = piParams
+	piMgr.client = client
+	piMgr.mutex.Unlock()
+	return nil
+}
+
+// getClient returns the client of the current credentials
+func (piMgr *PhpIPAMManager) getClient() *phpipamClient {
+	piMgr.mutex.RLock()
+	defer piMgr.mutex.RUnlock()
+	return piMgr.client
+}
+
+// cidr returns the subnet of the label, it is empty until phpIPAM is connected
+func (piMgr *PhpIPAMManager) cidr(ipamLabel string) string {
+	piMgr.mutex.RLock()
+	defer piMgr.mutex.RUnlock()
+	return piMgr.cidrs[ipamLabel]
+}
+
+// ParsePhpIPAMLabels parses the subnet ID of each IPAM label
+func ParsePhpIPAMLabels(params string) (map[string]PIConfig, error) {
+	piLabelMap := make(map[string]PIConfig)
+	err := json.Unmarshal([]byte(params), &piLabelMap)
+	if err != nil {
+		return nil, err
+	}
+	for label, piParam := range piLabelMap {
+		if piParam.SubnetID <= 0 {
+			return nil, fmt.Errorf("subnetId is required for label %v", label)
+		}
+	}
+	return piLabelMap, nil
+}
+
+// connect authenticates with phpIPAM and finds the subnets of the labels
+func (piMgr *PhpIPAMManager) connect() error {
+	client := piMgr.getClient()
+	if err := client.login(); err != nil {
+		return err
+	}
+	cidrs := make(map[string]string)
+	for name, label := range piMgr.labels {
+		var subnet phpipamSubnet
+		_, err := client.do(http.MethodGet, fmt.Sprintf("/subnets/%d/", label.SubnetID), nil, &subnet)
+		if err != nil {
+			return fmt.Errorf("%w for label %v", err, name)
+		}
+		cidrs[name] = fmt.Sprintf("%v/%v", subnet.Subnet, subnet.Mask)
+	}
+	piMgr.mutex.Lock()
+	piMgr.cidrs = cidrs
+	piMgr.mutex.Unlock()
+	atomic.StoreInt32(&piMgr.connected, 1)
+	return nil
+}
+
+// CreateARecord is a no-op, phpIPAM holds the hostname in the address
+func (piMgr *PhpIPAMManager) CreateARecord(req ipamspec.IPAMRequest) bool {
+	return true
+}
+
+// DeleteARecord is a no-op, the hostname is deleted along with the address
+func (piMgr *PhpIPAMManager) DeleteARecord(req ipamspec.IPAMRequest) {
+}
+
+// RemoveARecord phpIPAM does not manage DNS records
+func (piMgr *PhpIPAMManager) RemoveARecord(req ipamspec.IPAMRequest) error {
+	return nil
+}
+
+// GetIPAddress Gets the IP Address of the hostname/key by searching the addresses by hostname
+func (piMgr *PhpIPAMManager) GetIPAddress(req ipamspec.IPAMRequest) string {
+	if req.HostName == "" && req.Key == "" {
+		log.Errorf("[IPMG] Invalid Request to get IPAddress: %+v", req)
+		return ""
+	}
+	ipAddr, err := piMgr.LookupIPAddress(req)
+	if err != nil {
+		log.Errorf("[IPMG] Unable to get IP Address of %v, Error: %v", reference(req), err)
+	}
+	return ipAddr
+}
+
+// LookupIPAddress Gets the IP Address of the hostname/key, the failures of phpIPAM are returned
+func (piMgr *PhpIPAMManager) LookupIPAddress(req ipamspec.IPAMRequest) (string, error) {
+	if req.HostName == "" && req.Key == "" {
+		return "", nil
+	}
+	path := "/addresses/search_hostname/" + url.PathEscape(reference(req)) + "/"
+	addrs, err := piMgr.searchAddresses(req.IPAMLabel, path)
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		return addr.IP, nil
+	}
+	return "", nil
+}
+
+// AllocateNextIPAddress Gets and reserves the first free IP address of the subnet of the label
+func (piMgr *PhpIPAMManager) AllocateNextIPAddress(req ipamspec.IPAMRequest) string {
+	label, ok := piMgr.labels[req.IPAMLabel]
+	if !ok {
+		return ""
+	}
+	if !piMgr.IsReady() {
+		log.Errorf("[IPMG] Unable to Get a New IP Address: %+v, phpIPAM is not connected", req)
+		return ""
+	}
+	var ipAddr string
+	path := fmt.Sprintf("/addresses/first_free/%d/", label.SubnetID)
+	if _, err := piMgr.getClient().do(http.MethodPost, path, piMgr.newAddress(req, label), &ipAddr); err != nil {
+		log.Errorf("[IPMG] Unable to Get a New IP Address: %+v, Error: %v", req, err)
+		return ""
+	}
+	return ipAddr
+}
+
+// ReserveIPAddress Reserves the IP address given in the request, phpIPAM rejects the addresses that exist
+func (piMgr *PhpIPAMManager) ReserveIPAddress(req ipamspec.IPAMRequest) bool {
+	label, ok := piMgr.labels[req.IPAMLabel]
+	if !ok || !utils.IsIPAddr(req.IPAddr) {
+		log.Errorf("[IPMG] Invalid Request to Reserve IP Address: %+v", req)
+		return false
+	}
+	// The subnet of the label is found once phpIPAM is connected
+	if !piMgr.IsReady() {
+		log.Errorf("[IPMG] Unable to Reserve IP Address: %+v, phpIPAM is not connected", req)
+		return false
+	}
+	if !utils.IsIPInRange(req.IPAddr, piMgr.cidr(req.IPAMLabel)) {
+		log.Errorf("[IPMG] IP Address not in the range of label: %+v", req)
+		return false
+	}
+	addr := piMgr.newAddress(req, label)
+	addr.IP = req.IPAddr
+	if _, err := piMgr.getClient().do(http.MethodPost, "/addresses/", addr, nil); err != nil {
+		log.Errorf("[IPMG] Unable to Reserve IP Address: %+v, Error: %v", req, err)
+		return false
+	}
+	return true
+}
+
+// ValidateRequest Checks the IPAM label and the IP address of the request
+func (piMgr *PhpIPAMManager) ValidateRequest(req ipamspec.IPAMRequest) error {
+	if _, ok := piMgr.labels[req.IPAMLabel]; !ok {
+		return fmt.Errorf("unknown IPAM label %v", req.IPAMLabel)
+	}
+	// The range is checked once phpIPAM is connected and the subnet of the label is found
+	if !piMgr.IsReady() {
+		if req.IPAddr != "" && !utils.IsIPAddr(req.IPAddr) {
+			return fmt.Errorf("invalid IP address %v", req.IPAddr)
+		}
+		return nil
+	}
+	return validateIPAddress(req, piMgr.cidr(req.IPAMLabel))
+}
+
+// ReleaseIPAddress Releases an IP address by deleting the address
+func (piMgr *PhpIPAMManager) ReleaseIPAddress(req ipamspec.IPAMRequest) {
+	if !utils.IsIPAddr(req.IPAddr) {
+		log.Errorf("[IPMG] Unable to Release IP Address, as Invalid IP Address Provided")
+		return
+	}
+	if err := piMgr.RemoveIPAddress(req); err != nil {
+		log.Errorf("[IPMG] Unable to Release IP Address: %+v, Error: %v", req, err)
+	}
+}
+
+// RemoveIPAddress Releases an IP address, the failures of phpIPAM are returned
+func (piMgr *PhpIPAMManager) RemoveIPAddress(req ipamspec.IPAMRequest) error {
+	if !utils.IsIPAddr(req.IPAddr) {
+		return nil
+	}
+	addrs, err := piMgr.searchAddresses(req.IPAMLabel, "/addresses/search/"+req.IPAddr+"/")
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if _, err = piMgr.getClient().do(http.MethodDelete, fmt.Sprintf("/addresses/%v/", addr.ID), nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLabelUsage Gets the IPAM labels along with their utilisation
+func (piMgr *PhpIPAMManager) GetLabelUsage() []LabelUsage {
+	var usage []LabelUsage
+	for _, ipamLabel := range piMgr.getLabelNames() {
+		usage = append(usage, LabelUsage{
+			IPAMLabel: ipamLabel,
+			Range:     piMgr.cidr(ipamLabel),
+			Total:     rangeSize(piMgr.cidr(ipamLabel)),
+			Allocated: len(piMgr.GetAllocations(ipamLabel)),
+		})
+	}
+	return usage
+}
+
+// GetAllocations Gets the allocations of the IPAM label
+func (piMgr *PhpIPAMManager) GetAllocations(ipamLabel string) []Allocation {
+	labels := []string{ipamLabel}
+	if ipamLabel == "" {
+		labels = piMgr.getLabelNames()
+	}
+	var allocations []Allocation
+	for _, name := range labels {
+		label, ok := piMgr.labels[name]
+		if !ok {
+			continue
+		}
+		addrs, err := piMgr.searchAddresses(name, fmt.Sprintf("/subnets/%d/addresses/", label.SubnetID))
+		if err != nil {
+			log.Errorf("[IPMG] Unable to get IP Addresses of label %v, Error: %v", name, err)
+			continue
+		}
+		for _, addr := range addrs {
+			allocations = append(allocations, NewAllocation(name, addr.IP, addr.Hostname))
+		}
+	}
+	sortAllocations(allocations)
+	return allocations
+}
+
+// searchAddresses returns the addresses of the path that the controller owns in the subnet of the label,
+// phpIPAM answers not found when there are none
+func (piMgr *PhpIPAMManager) searchAddresses(ipamLabel, path string) ([]phpipamAddress, error) {
+	label, ok := piMgr.labels[ipamLabel]
+	if !ok {
+		return nil, fmt.Errorf("label %v not found", ipamLabel)
+	}
+	var addrs, res []phpipamAddress
+	_, err := piMgr.getClient().do(http.MethodGet, path, nil, &addrs)
+	if isPhpipamStatus(err, http.StatusNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if addr.Owner == PhpIPAMOwner && addr.SubnetID == phpipamID(fmt.Sprint(label.SubnetID)) {
+			res = append(res, addr)
+		}
+	}
+	return res, nil
+}
+
+// newAddress returns the address to create for the request, with the hostname/key as hostname and
+// described with the resource that owns it
+func (piMgr *PhpIPAMManager) newAddress(req ipamspec.IPAMRequest, label PIConfig) phpipamAddress {
+	addr := phpipamAddress{
+		SubnetID:    phpipamID(fmt.Sprint(label.SubnetID)),
+		Hostname:    reference(req),
+		Owner:       PhpIPAMOwner,
+		Description: "Allocated by the F5 IPAM Controller",
+	}
+	if meta, ok := req.Metadata.(ipamspec.ResourceMetadata); ok {
+		addr.Description = fmt.Sprintf("Allocated by the F5 IPAM Controller to %v/%v", meta.GetNamespace(), meta.GetName())
+	}
+	return addr
+}
+
+// getLabelNames returns the names of the labels in order
+func (piMgr *PhpIPAMManager) getLabelNames() []string {
+	var names []string
+	for name := range piMgr.labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,101 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package pluginapi is the versioned HTTP/JSON contract between FIC and the out-of-process IPAM provider
+// plugins. The operations of the Manager are POSTs of a Request to their path, refer docs/plugin-api.md
+package pluginapi
+
+// Version is the version of the contract, the prefix of the paths
+const Version = "v1"
+
+// Paths of the operations
+const (
+	// InfoPath answers an Info to a GET, FIC checks it at startup and for readiness
+	InfoPath = "/" + Version + "/info"
+
+	GetIPAddressPath          = "/" + Version + "/get-ip-address"
+	AllocateNextIPAddressPath = "/" + Version + "/allocate-next-ip-address"
+	ReserveIPAddressPath      = "/" + Version + "/reserve-ip-address"
+	ReleaseIPAddressPath      = "/" + Version + "/release-ip-address"
+	CreateARecordPath         = "/" + Version + "/create-a-record"
+	DeleteARecordPath         = "/" + Version + "/delete-a-record"
+
+	// LabelUsagePath answers a list of LabelUsage to a GET, with the CapabilityInspect capability
+	LabelUsagePath = "/" + Version + "/label-usage"
+	// AllocationsPath answers a list of Allocation to a GET, of the label of the ipamLabel query parameter,
+	// with the CapabilityInspect capability
+	AllocationsPath = "/" + Version + "/allocations"
+)
+
+// CapabilityInspect is the capability of the plugins that list their labels and allocations
+const CapabilityInspect = "inspect"
+
+// Info describes the plugin
+type Info struct {
+	// APIVersion is the version of the contract that the plugin implements, Version
+	APIVersion string `json:"apiVersion"`
+	// Name of the plugin, for the logs
+	Name string `json:"name"`
+	// Labels are the IPAM labels that the plugin allocates from
+	Labels []string `json:"labels"`
+	// DNSLabels are the IPAM labels that FIC creates the A records of
+	DNSLabels []string `json:"dnsLabels,omitempty"`
+	// Capabilities are the optional operations that the plugin implements, e.g. CapabilityInspect
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// Request is the body of the operations, the IPAMRequest of FIC
+type Request struct {
+	Operation string `json:"operation,omitempty"`
+	HostName  string `json:"hostName,omitempty"`
+	Key       string `json:"key,omitempty"`
+	IPAddr    string `json:"ipAddr,omitempty"`
+	IPAMLabel string `json:"ipamLabel"`
+	// Namespace and Name of the IPAM resource of the request, when it comes from one
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// AddressResponse is the response of GetIPAddressPath and AllocateNextIPAddressPath, IPAddr is empty
+// when there is no IP address
+type AddressResponse struct {
+	IPAddr string `json:"ipAddr"`
+}
+
+// ResultResponse is the response of ReserveIPAddressPath and CreateARecordPath
+type ResultResponse struct {
+	Success bool `json:"success"`
+}
+
+// ErrorResponse is the body of the responses with an error status
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+// LabelUsage is the utilisation of an IPAM label
+type LabelUsage struct {
+	IPAMLabel string `json:"ipamLabel"`
+	Range     string `json:"range"`
+	Total     int    `json:"total"`
+	Allocated int    `json:"allocated"`
+}
+
+// Allocation is an IP address allocated to a hostname/key
+type Allocation struct {
+	IPAMLabel string `json:"ipamLabel"`
+	IPAddr    string `json:"ip"`
+	Reference string `json:"reference"`
+}
@@ -0,0 +1,343 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/pluginapi"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+const (
+	// pluginTimeout is the timeout of the plugin requests
+	pluginTimeout = 20 * time.Second
+	// pluginReadinessInterval is the default interval between the checks whether the plugin answers
+	pluginReadinessInterval = 10 * time.Second
+)
+
+type PluginParams struct {
+	// URL of the plugin, e.g. https://ipam-plugin.kube-system:8443
+	URL string
+	// Token is sent as bearer token when it is not empty
+	Token string
+	// CACertFile is the certificate to verify the plugin with, the system certificates are used when it is empty
+	CACertFile string
+	// Insecure skips the verification of the certificate of the plugin
+	Insecure bool
+	// ReadinessInterval is the interval between the checks whether the plugin answers, 10s when it is zero
+	ReadinessInterval time.Duration
+}
+
+// PluginManager forwards the operations of the Manager to an out-of-process plugin over the HTTP/JSON
+// contract of pluginapi
+type PluginManager struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	info       pluginapi.Info
+	// ready is whether the plugin answered the last check, it is refreshed in the background so that the
+	// readiness probe does not wait for the plugin
+	ready int32
+}
+
+func NewPluginManager(params PluginParams) (*PluginManager, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: params.Insecure}
+	if params.CACertFile != "" && !params.Insecure {
+		cert, err := ioutil.ReadFile(params.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(cert) {
+			return nil, fmt.Errorf("no certificate found in %v", params.CACertFile)
+		}
+	}
+	plMgr := &PluginManager{
+		baseURL: strings.TrimSuffix(params.URL, "/"),
+		token:   params.Token,
+		httpClient: &http.Client{
+			Timeout:   pluginTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+	}
+	if err := plMgr.do(http.MethodGet, pluginapi.InfoPath, nil, nil, &plMgr.info); err != nil {
+		return nil, err
+	}
+	if plMgr.info.APIVersion != pluginapi.Version {
+		return nil, fmt.Errorf("plugin %v implements the API version %v, expected %v",
+			plMgr.info.Name, plMgr.info.APIVersion, pluginapi.Version)
+	}
+	log.Infof("[IPMG] Connected to plugin %v with the labels %v", plMgr.info.Name, plMgr.info.Labels)
+	plMgr.ready = 1
+	interval := params.ReadinessInterval
+	if interval <= 0 {
+		interval = pluginReadinessInterval
+	}
+	go plMgr.refreshReadiness(interval)
+	return plMgr, nil
+}
+
+// refreshReadiness checks whether the plugin answers on every interval
+func (plMgr *PluginManager) refreshReadiness(interval time.Duration) {
+	for range time.Tick(interval) {
+		var info pluginapi.Info
+		err := plMgr.do(http.MethodGet, pluginapi.InfoPath, nil, nil, &info)
+		var ready int32
+		if err == nil {
+			ready = 1
+		}
+		if old := atomic.SwapInt32(&plMgr.ready, ready); old != ready {
+			if err != nil {
+				log.Errorf("[IPMG] Plugin %v is not ready, Error: %v", plMgr.info.Name, err)
+			} else {
+				log.Infof("[IPMG] Plugin %v is ready again", plMgr.info.Name)
+			}
+		}
+	}
+}
+
+// Info returns the description of the plugin that it answered at startup
+func (plMgr *PluginManager) Info() pluginapi.Info {
+	return plMgr.info
+}
+
+// CreateARecord Creates an A record
+func (plMgr *PluginManager) CreateARecord(req ipamspec.IPAMRequest) bool {
+	var res pluginapi.ResultResponse
+	if err := plMgr.do(http.MethodPost, pluginapi.CreateARecordPath, nil, newPluginRequest(req), &res); err != nil {
+		log.Errorf("[IPMG] Unable to Create A Record: %+v, Error: %v", req, err)
+		return false
+	}
+	return res.Success
+}
+
+// DeleteARecord Deletes an A record
+func (plMgr *PluginManager) DeleteARecord(req ipamspec.IPAMRequest) {
+	if err := plMgr.RemoveARecord(req); err != nil {
+		log.Errorf("[IPMG] Unable to Delete A Record: %+v, Error: %v", req, err)
+	}
+}
+
+// RemoveARecord Deletes an A record, the failures of the plugin are returned
+func (plMgr *PluginManager) RemoveARecord(req ipamspec.IPAMRequest) error {
+	return plMgr.do(http.MethodPost, pluginapi.DeleteARecordPath, nil, newPluginRequest(req), nil)
+}
+
+// GetIPAddress Gets the IP Address associated with the hostname/key
+func (plMgr *PluginManager) GetIPAddress(req ipamspec.IPAMRequest) string {
+	ipAddr, err := plMgr.LookupIPAddress(req)
+	if err != nil {
+		log.Errorf("[IPMG] Unable to get IP Address of %+v, Error: %v", req, err)
+	}
+	return ipAddr
+}
+
+// LookupIPAddress Gets the IP Address of the hostname/key, the failures of the plugin are returned
+func (plMgr *PluginManager) LookupIPAddress(req ipamspec.IPAMRequest) (string, error) {
+	var res pluginapi.AddressResponse
+	if err := plMgr.do(http.MethodPost, pluginapi.GetIPAddressPath, nil, newPluginRequest(req), &res); err != nil {
+		return "", err
+	}
+	return res.IPAddr, nil
+}
+
+// AllocateNextIPAddress Gets and reserves the next available IP address
+func (plMgr *PluginManager) AllocateNextIPAddress(req ipamspec.IPAMRequest) string {
+	var res pluginapi.AddressResponse
+	if err := plMgr.do(http.MethodPost, pluginapi.AllocateNextIPAddressPath, nil, newPluginRequest(req), &res); err != nil {
+		log.Errorf("[IPMG] Unable to Get a New IP Address: %+v, Error: %v", req, err)
+		return ""
+	}
+	return res.IPAddr
+}
+
+// ReserveIPAddress Reserves the IP address given in the request for the hostname/key
+func (plMgr *PluginManager) ReserveIPAddress(req ipamspec.IPAMRequest) bool {
+	var res pluginapi.ResultResponse
+	if err := plMgr.do(http.MethodPost, pluginapi.ReserveIPAddressPath, nil, newPluginRequest(req), &res); err != nil {
+		log.Errorf("[IPMG] Unable to Reserve IP Address: %+v, Error: %v", req, err)
+		return false
+	}
+	return res.Success
+}
+
+// ValidateRequest Checks that the plugin allocates from the IPAM label of the request,
+// the plugins that do not list their labels are sent all requests
+func (plMgr *PluginManager) ValidateRequest(req ipamspec.IPAMRequest) error {
+	if len(plMgr.info.Labels) == 0 {
+		return nil
+	}
+	for _, label := range plMgr.info.Labels {
+		if label == req.IPAMLabel {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown IPAM label %v", req.IPAMLabel)
+}
+
+// ReleaseIPAddress Releases an IP address
+func (plMgr *PluginManager) ReleaseIPAddress(req ipamspec.IPAMRequest) {
+	if err := plMgr.RemoveIPAddress(req); err != nil {
+		log.Errorf("[IPMG] Unable to Release IP Address: %+v, Error: %v", req, err)
+	}
+}
+
+// RemoveIPAddress Releases an IP address, the failures of the plugin are returned
+func (plMgr *PluginManager) RemoveIPAddress(req ipamspec.IPAMRequest) error {
+	return plMgr.do(http.MethodPost, pluginapi.ReleaseIPAddressPath, nil, newPluginRequest(req), nil)
+}
+
+// IsDNSEnabled checks whether the plugin creates the A records of the IPAM label
+func (plMgr *PluginManager) IsDNSEnabled(ipamLabel string) bool {
+	for _, label := range plMgr.info.DNSLabels {
+		if label == ipamLabel {
+			return true
+		}
+	}
+	return false
+}
+
+// IsReady reports whether the plugin answered the last check
+func (plMgr *PluginManager) IsReady() bool {
+	return atomic.LoadInt32(&plMgr.ready) == 1
+}
+
+// GetLabelUsage Gets the IPAM labels along with their utilisation, only the labels of the plugins
+// without the inspect capability
+func (plMgr *PluginManager) GetLabelUsage() []LabelUsage {
+	var usage []LabelUsage
+	if !plMgr.hasCapability(pluginapi.CapabilityInspect) {
+		for _, label := range plMgr.info.Labels {
+			usage = append(usage, LabelUsage{IPAMLabel: label})
+		}
+		return usage
+	}
+	var res []pluginapi.LabelUsage
+	if err := plMgr.do(http.MethodGet, pluginapi.LabelUsagePath, nil, nil, &res); err != nil {
+		log.Errorf("[IPMG] Unable to get the label usage of plugin %v, Error: %v", plMgr.info.Name, err)
+		return nil
+	}
+	for _, labelUsage := range res {
+		usage = append(usage, LabelUsage(labelUsage))
+	}
+	return usage
+}
+
+// GetAllocations Gets the allocations of the IPAM label, none of the plugins without the inspect capability
+func (plMgr *PluginManager) GetAllocations(ipamLabel string) []Allocation {
+	if !plMgr.hasCapability(pluginapi.CapabilityInspect) {
+		log.Warningf("[IPMG] Plugin %v does not list its allocations", plMgr.info.Name)
+		return nil
+	}
+	var res []pluginapi.Allocation
+	query := url.Values{}
+	if ipamLabel != "" {
+		query.Set("ipamLabel", ipamLabel)
+	}
+	if err := plMgr.do(http.MethodGet, pluginapi.AllocationsPath, query, nil, &res); err != nil {
+		log.Errorf("[IPMG] Unable to get the allocations of plugin %v, Error: %v", plMgr.info.Name, err)
+		return nil
+	}
+	var allocations []Allocation
+	for _, alloc := range res {
+		allocations = append(allocations, NewAllocation(alloc.IPAMLabel, alloc.IPAddr, alloc.Reference))
+	}
+	return allocations
+}
+
+func (plMgr *PluginManager) hasCapability(capability string) bool {
+	for _, c := range plMgr.info.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// do sends the request with the body as JSON and decodes the response in res
+func (plMgr *PluginManager) do(method, path string, query url.Values, body, res interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	reqURL := plMgr.baseURL + path
+	if len(query) != 0 {
+		reqURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, reqURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if plMgr.token != "" {
+		req.Header.Set("Authorization", "Bearer "+plMgr.token)
+	}
+	resp, err := plMgr.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		var apiErr pluginapi.ErrorResponse
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = string(bytes.TrimSpace(data))
+		}
+		return fmt.Errorf("plugin request error: %v %v: %d %v", method, path, resp.StatusCode, apiErr.Message)
+	}
+	if res != nil && len(bytes.TrimSpace(data)) != 0 {
+		return json.Unmarshal(data, res)
+	}
+	return nil
+}
+
+// newPluginRequest returns the request of the contract, with the namespace and name of the IPAM resource
+func newPluginRequest(req ipamspec.IPAMRequest) pluginapi.Request {
+	plReq := pluginapi.Request{
+		Operation: req.Operation,
+		HostName:  req.HostName,
+		Key:       req.Key,
+		IPAddr:    req.IPAddr,
+		IPAMLabel: req.IPAMLabel,
+	}
+	if meta, ok := req.Metadata.(ipamspec.ResourceMetadata); ok {
+		plReq.Namespace = meta.GetNamespace()
+		plReq.Name = meta.GetName()
+	}
+	return plReq
+}
@@ -0,0 +1,45 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+// ReadinessChecker is implemented by the managers whose provider can be unreachable
+type ReadinessChecker interface {
+	// IsReady reports whether the provider is reachable and the manager can serve requests
+	IsReady() bool
+}
+
+// IsReady reports whether the manager can serve requests, managers without a ReadinessChecker always can
+func IsReady(mgr Manager) bool {
+	checker, ok := mgr.(ReadinessChecker)
+	return !ok || checker.IsReady()
+}
+
+// LabelReadinessChecker is implemented by the managers whose labels can be unreachable apart from each other,
+// e.g. the labels on different Infoblox grids
+type LabelReadinessChecker interface {
+	// IsLabelReady reports whether the provider of the label is reachable and the manager can serve its requests
+	IsLabelReady(ipamLabel string) bool
+}
+
+// IsLabelReady reports whether the manager can serve the requests of the label, managers without
+// a LabelReadinessChecker can when they are ready
+func IsLabelReady(mgr Manager, ipamLabel string) bool {
+	if checker, ok := mgr.(LabelReadinessChecker); ok {
+		return checker.IsLabelReady(ipamLabel)
+	}
+	return IsReady(mgr)
+}
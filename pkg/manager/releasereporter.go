@@ -0,0 +1,56 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import "github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+
+// ReleaseReporter is implemented by the managers whose provider can be unreachable. It reports the failures
+// of the lookups and the releases, which the controller retries instead of losing the IP addresses
+type ReleaseReporter interface {
+	// LookupIPAddress gets the IP address of the hostname/key, empty without an error when it has none
+	LookupIPAddress(req ipamspec.IPAMRequest) (string, error)
+	// RemoveARecord deletes the DNS records of the hostname
+	RemoveARecord(req ipamspec.IPAMRequest) error
+	// RemoveIPAddress releases the IP address
+	RemoveIPAddress(req ipamspec.IPAMRequest) error
+}
+
+// LookupIPAddress gets the IP address of the hostname/key with the manager
+func LookupIPAddress(mgr Manager, req ipamspec.IPAMRequest) (string, error) {
+	if reporter, ok := mgr.(ReleaseReporter); ok {
+		return reporter.LookupIPAddress(req)
+	}
+	return mgr.GetIPAddress(req), nil
+}
+
+// RemoveARecord deletes the DNS records of the hostname with the manager
+func RemoveARecord(mgr Manager, req ipamspec.IPAMRequest) error {
+	if reporter, ok := mgr.(ReleaseReporter); ok {
+		return reporter.RemoveARecord(req)
+	}
+	mgr.DeleteARecord(req)
+	return nil
+}
+
+// RemoveIPAddress releases the IP address with the manager
+func RemoveIPAddress(mgr Manager, req ipamspec.IPAMRequest) error {
+	if reporter, ok := mgr.(ReleaseReporter); ok {
+		return reporter.RemoveIPAddress(req)
+	}
+	mgr.ReleaseIPAddress(req)
+	return nil
+}
@@ -0,0 +1,54 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"fmt"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
+)
+
+// RequestValidator is implemented by the managers that can tell the requests that never succeed,
+// e.g. of an unknown IPAM label or with an IP address out of the label, from the failures worth retrying
+type RequestValidator interface {
+	// ValidateRequest returns an error when the request fails however often it is retried
+	ValidateRequest(req ipamspec.IPAMRequest) error
+}
+
+// ValidateRequest validates the request with the manager, managers without a RequestValidator accept all requests
+func ValidateRequest(mgr Manager, req ipamspec.IPAMRequest) error {
+	validator, ok := mgr.(RequestValidator)
+	if !ok {
+		return nil
+	}
+	return validator.ValidateRequest(req)
+}
+
+// validateIPAddress checks that the IP address of the request, when it has one, is in the range of its IPAM label
+func validateIPAddress(req ipamspec.IPAMRequest, ipRange string) error {
+	if req.IPAddr == "" {
+		return nil
+	}
+	if !utils.IsIPAddr(req.IPAddr) {
+		return fmt.Errorf("invalid IP address %v", req.IPAddr)
+	}
+	if !utils.IsIPInRange(req.IPAddr, ipRange) {
+		return fmt.Errorf("IP address %v is not in the range %v of label %v", req.IPAddr, ipRange, req.IPAMLabel)
+	}
+	return nil
+}
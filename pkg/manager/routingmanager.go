@@ -0,0 +1,413 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+type RoutingParams struct {
+	// LabelMap is the JSON of the provider of each IPAM label, e.g. {"Prod":"infoblox","Test":"f5-ip-provider"},
+	// or of its provider chain, e.g. {"Test":{"provider":"infoblox","fallback":"f5-ip-provider"}}.
+	// The labels are configured in the parameters of their providers
+	LabelMap string
+}
+
+// Route is the provider chain of an IPAM label
+type Route struct {
+	// Provider is the primary provider of the label
+	Provider string `json:"provider"`
+	// Fallback is the provider that allocates when the primary provider can not, optional
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// UnmarshalJSON reads a route from the name of its provider or from a provider chain
+func (rt *Route) UnmarshalJSON(data []byte) error {
+	var prov string
+	if err := json.Unmarshal(data, &prov); err == nil {
+		*rt = Route{Provider: prov}
+		return nil
+	}
+	type route Route
+	return json.Unmarshal(data, (*route)(rt))
+}
+
+// RoutingManager sends each request to the provider of its IPAM label. The labels with a fallback
+// provider get their IP addresses from it while their primary provider is unable to allocate
+type RoutingManager struct {
+	// managers are the managers by provider
+	managers map[string]Manager
+	// labels are the routes by IPAM label
+	labels map[string]Route
+}
+
+// NewRoutingManager creates the manager of every provider that the labels are routed to, with the
+// parameters of the provider in params
+func NewRoutingManager(params Params) (*RoutingManager, error) {
+	labels, err := ParseRoutingLabels(params.RoutingParams.LabelMap)
+	if err != nil {
+		return nil, err
+	}
+	rtMgr := &RoutingManager{
+		managers: make(map[string]Manager),
+		labels:   labels,
+	}
+	for _, prov := range RoutedProviders(labels) {
+		provParams := params
+		provParams.Provider = prov
+		mgr, err := NewManager(provParams)
+		if err != nil {
+			return nil, fmt.Errorf("provider %v: %v", prov, err)
+		}
+		rtMgr.managers[prov] = mgr
+	}
+	return rtMgr, nil
+}
+
+// ParseRoutingLabels parses the route of each IPAM label
+func ParseRoutingLabels(labelMap string) (map[string]Route, error) {
+	labels := make(map[string]Route)
+	if err := json.Unmarshal([]byte(labelMap), &labels); err != nil {
+		return nil, err
+	}
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("no labels to route")
+	}
+	for label, rt := range labels {
+		if !isRoutable(rt.Provider) {
+			return nil, fmt.Errorf("unknown provider %v for label %v", rt.Provider, label)
+		}
+		if rt.Fallback == "" {
+			continue
+		}
+		if !isRoutable(rt.Fallback) {
+			return nil, fmt.Errorf("unknown fallback provider %v for label %v", rt.Fallback, label)
+		}
+		if rt.Fallback == rt.Provider {
+			return nil, fmt.Errorf("fallback provider of label %v is its provider", label)
+		}
+	}
+	return labels, nil
+}
+
+func isRoutable(prov string) bool {
+	switch prov {
+	case F5IPAMProvider, InfobloxProvider, NetBoxProvider, PhpIPAMProvider, PluginProvider:
+		return true
+	}
+	return false
+}
+
+// RoutedProviders returns the providers and fallback providers that the labels are routed to, in order
+func RoutedProviders(labels map[string]Route) []string {
+	var providers []string
+	found := make(map[string]bool)
+	for _, rt := range labels {
+		for _, prov := range []string{rt.Provider, rt.Fallback} {
+			if prov != "" && !found[prov] {
+				found[prov] = true
+				providers = append(providers, prov)
+			}
+		}
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// Manager returns the manager of the provider, nil when no label is routed to it
+func (rtMgr *RoutingManager) Manager(prov string) Manager {
+	return rtMgr.managers[prov]
+}
+
+// Route returns the route of the IPAM label
+func (rtMgr *RoutingManager) Route(ipamLabel string) (Route, bool) {
+	rt, ok := rtMgr.labels[ipamLabel]
+	return rt, ok
+}
+
+// getManager returns the manager of the primary provider of the IPAM label
+func (rtMgr *RoutingManager) getManager(req ipamspec.IPAMRequest) (Manager, bool) {
+	rt, ok := rtMgr.labels[req.IPAMLabel]
+	if !ok {
+		log.Errorf("[IPMG] No provider for IPAM label %v: %+v", req.IPAMLabel, req)
+		return nil, false
+	}
+	return rtMgr.managers[rt.Provider], true
+}
+
+// getFallback returns the manager of the fallback provider of the IPAM label
+func (rtMgr *RoutingManager) getFallback(req ipamspec.IPAMRequest) (Manager, bool) {
+	rt, ok := rtMgr.labels[req.IPAMLabel]
+	if !ok || rt.Fallback == "" {
+		return nil, false
+	}
+	return rtMgr.managers[rt.Fallback], true
+}
+
+// CreateARecord Creates an A record with the provider of the label
+func (rtMgr *RoutingManager) CreateARecord(req ipamspec.IPAMRequest) bool {
+	mgr, ok := rtMgr.getManager(req)
+	return ok && mgr.CreateARecord(req)
+}
+
+// DeleteARecord Deletes an A record with the provider of the label
+func (rtMgr *RoutingManager) DeleteARecord(req ipamspec.IPAMRequest) {
+	if mgr, ok := rtMgr.getManager(req); ok {
+		mgr.DeleteARecord(req)
+	}
+}
+
+// RemoveARecord Deletes an A record with the provider of the label, its failures are returned
+func (rtMgr *RoutingManager) RemoveARecord(req ipamspec.IPAMRequest) error {
+	mgr, ok := rtMgr.getManager(req)
+	if !ok {
+		return nil
+	}
+	return RemoveARecord(mgr, req)
+}
+
+// GetIPAddress Gets the IP Address of the hostname/key from the provider of the label,
+// or from its fallback provider
+func (rtMgr *RoutingManager) GetIPAddress(req ipamspec.IPAMRequest) string {
+	mgr, ok := rtMgr.getManager(req)
+	if !ok {
+		return ""
+	}
+	if ip := mgr.GetIPAddress(req); ip != "" {
+		return ip
+	}
+	if fallback, ok := rtMgr.getFallback(req); ok {
+		return fallback.GetIPAddress(req)
+	}
+	return ""
+}
+
+// LookupIPAddress Gets the IP Address of the hostname/key from the provider of the label,
+// or from its fallback provider, the failures of the providers are returned. The IP address
+// of the fallback provider is returned even when the provider of the label fails
+func (rtMgr *RoutingManager) LookupIPAddress(req ipamspec.IPAMRequest) (string, error) {
+	mgr, ok := rtMgr.getManager(req)
+	if !ok {
+		return "", nil
+	}
+	ip, err := LookupIPAddress(mgr, req)
+	if ip != "" {
+		return ip, nil
+	}
+	if fallback, ok := rtMgr.getFallback(req); ok {
+		if fallbackIP, fallbackErr := LookupIPAddress(fallback, req); fallbackIP != "" || fallbackErr != nil {
+			return fallbackIP, fallbackErr
+		}
+	}
+	return "", err
+}
+
+// AllocateNextIPAddress Gets and reserves the next available IP address from the provider of the label,
+// from its fallback provider when the provider is not ready or unable to allocate
+func (rtMgr *RoutingManager) AllocateNextIPAddress(req ipamspec.IPAMRequest) string {
+	mgr, ok := rtMgr.getManager(req)
+	if !ok {
+		return ""
+	}
+	fallback, hasFallback := rtMgr.getFallback(req)
+	if !hasFallback || IsLabelReady(mgr, req.IPAMLabel) {
+		if ip := mgr.AllocateNextIPAddress(req); ip != "" || !hasFallback {
+			return ip
+		}
+	}
+	ip := fallback.AllocateNextIPAddress(req)
+	if ip != "" {
+		rt := rtMgr.labels[req.IPAMLabel]
+		log.Warningf("[IPMG] Allocated IP address %v of label %v to %v from fallback provider %v, "+
+			"provider %v is unable to allocate", ip, req.IPAMLabel, reference(req), rt.Fallback, rt.Provider)
+	}
+	return ip
+}
+
+// ReserveIPAddress Reserves the IP address with the provider of the label,
+// with its fallback provider when the provider does not take it, e.g. for an IP address of the fallback pool
+func (rtMgr *RoutingManager) ReserveIPAddress(req ipamspec.IPAMRequest) bool {
+	mgr, ok := rtMgr.getManager(req)
+	if !ok {
+		return false
+	}
+	if mgr.ReserveIPAddress(req) {
+		return true
+	}
+	fallback, ok := rtMgr.getFallback(req)
+	return ok && fallback.ReserveIPAddress(req)
+}
+
+// ValidateRequest Checks the request with the provider of the label, the requests that only its
+// fallback provider accepts, e.g. of an IP address of the fallback pool, are valid too
+func (rtMgr *RoutingManager) ValidateRequest(req ipamspec.IPAMRequest) error {
+	rt, ok := rtMgr.labels[req.IPAMLabel]
+	if !ok {
+		return fmt.Errorf("unknown IPAM label %v", req.IPAMLabel)
+	}
+	err := ValidateRequest(rtMgr.managers[rt.Provider], req)
+	if err != nil && rt.Fallback != "" && ValidateRequest(rtMgr.managers[rt.Fallback], req) == nil {
+		return nil
+	}
+	return err
+}
+
+// ReleaseIPAddress Releases the IP address with the provider of the label. The IP address of the
+// hostname/key in the fallback provider is released as well, so that it is not left behind when
+// the hostname/key got IP addresses from both providers
+func (rtMgr *RoutingManager) ReleaseIPAddress(req ipamspec.IPAMRequest) {
+	if err := rtMgr.RemoveIPAddress(req); err != nil {
+		log.Errorf("[IPMG] Unable to Release IP Address: %+v, Error: %v", req, err)
+	}
+}
+
+// RemoveIPAddress Releases the IP address as ReleaseIPAddress does, the failures of the providers are returned
+func (rtMgr *RoutingManager) RemoveIPAddress(req ipamspec.IPAMRequest) error {
+	mgr, ok := rtMgr.getManager(req)
+	if !ok {
+		return nil
+	}
+	if fallback, ok := rtMgr.getFallback(req); ok {
+		ip, err := LookupIPAddress(fallback, req)
+		if err != nil {
+			return err
+		}
+		if ip != "" {
+			fallbackReq := req
+			fallbackReq.IPAddr = ip
+			if err = RemoveIPAddress(fallback, fallbackReq); err != nil {
+				return err
+			}
+			if ip == req.IPAddr {
+				return nil
+			}
+		}
+	}
+	return RemoveIPAddress(mgr, req)
+}
+
+// IsDNSEnabled checks whether the provider of the label creates the DNS records of the label
+func (rtMgr *RoutingManager) IsDNSEnabled(ipamLabel string) bool {
+	rt, ok := rtMgr.labels[ipamLabel]
+	if !ok {
+		return false
+	}
+	registrar, ok := rtMgr.managers[rt.Provider].(DNSRegistrar)
+	return ok && registrar.IsDNSEnabled(ipamLabel)
+}
+
+// IsReady reports whether the provider or the fallback provider of a label can serve requests, the labels
+// whose providers can not are checked by IsLabelReady
+func (rtMgr *RoutingManager) IsReady() bool {
+	for ipamLabel := range rtMgr.labels {
+		if rtMgr.IsLabelReady(ipamLabel) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLabelReady reports whether the provider or the fallback provider of the label can serve its requests
+func (rtMgr *RoutingManager) IsLabelReady(ipamLabel string) bool {
+	rt, ok := rtMgr.labels[ipamLabel]
+	if !ok {
+		return false
+	}
+	if IsLabelReady(rtMgr.managers[rt.Provider], ipamLabel) {
+		return true
+	}
+	return rt.Fallback != "" && IsLabelReady(rtMgr.managers[rt.Fallback], ipamLabel)
+}
+
+// UpdateCredentials updates the credentials of the providers that take credentials
+func (rtMgr *RoutingManager) UpdateCredentials(grid string, params GridParams) error {
+	found := false
+	for _, prov := range RoutedProviders(rtMgr.labels) {
+		if updater, ok := rtMgr.managers[prov].(CredentialsUpdater); ok {
+			found = true
+			if err := updater.UpdateCredentials(grid, params); err != nil {
+				return err
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("no provider takes credentials")
+	}
+	return nil
+}
+
+// GetLabelUsage Gets the routed IPAM labels along with their utilisation in their primary provider
+func (rtMgr *RoutingManager) GetLabelUsage() []LabelUsage {
+	var usage []LabelUsage
+	for _, prov := range RoutedProviders(rtMgr.labels) {
+		insp, ok := rtMgr.managers[prov].(Inspector)
+		if !ok {
+			continue
+		}
+		for _, labelUsage := range insp.GetLabelUsage() {
+			if rtMgr.labels[labelUsage.IPAMLabel].Provider == prov {
+				usage = append(usage, labelUsage)
+			}
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].IPAMLabel < usage[j].IPAMLabel
+	})
+	return usage
+}
+
+// GetAllocations Gets the allocations of the IPAM label from its provider and fallback provider,
+// of all routed labels when it is empty
+func (rtMgr *RoutingManager) GetAllocations(ipamLabel string) []Allocation {
+	return rtMgr.getAllocations(ipamLabel, func(rt Route, prov string) bool {
+		return rt.Provider == prov || rt.Fallback == prov
+	})
+}
+
+// GetFallbackAllocations Gets the allocations of the IPAM label from its fallback provider,
+// of all labels with a fallback provider when it is empty
+func (rtMgr *RoutingManager) GetFallbackAllocations(ipamLabel string) []Allocation {
+	return rtMgr.getAllocations(ipamLabel, func(rt Route, prov string) bool {
+		return rt.Fallback == prov
+	})
+}
+
+// getAllocations Gets the allocations of the IPAM label from the providers that match its route
+func (rtMgr *RoutingManager) getAllocations(ipamLabel string, match func(rt Route, prov string) bool) []Allocation {
+	var allocations []Allocation
+	for _, prov := range RoutedProviders(rtMgr.labels) {
+		if rt, ok := rtMgr.labels[ipamLabel]; ipamLabel != "" && (!ok || !match(rt, prov)) {
+			continue
+		}
+		insp, ok := rtMgr.managers[prov].(Inspector)
+		if !ok {
+			log.Warningf("[IPMG] Provider %v does not list its allocations", prov)
+			continue
+		}
+		for _, alloc := range insp.GetAllocations(ipamLabel) {
+			if rt, ok := rtMgr.labels[alloc.IPAMLabel]; ok && match(rt, prov) {
+				allocations = append(allocations, alloc)
+			}
+		}
+	}
+	return allocations
+}
@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/fakenetbox"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/fakephpipam"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Routing Manager", func() {
+	var nbSrv *fakenetbox.Server
+	var piSrv *fakephpipam.Server
+	var params Params
+
+	BeforeEach(func() {
+		nbSrv = fakenetbox.NewServer(fakenetbox.Params{})
+		nbSrv.AddPrefix("172.16.4.0/29")
+		piSrv = fakephpipam.NewServer(fakephpipam.Params{})
+		subnetID := piSrv.AddSubnet("172.16.5.0/29")
+		params = Params{
+			Provider: RoutingProvider,
+			NetBoxParams: NetBoxParams{
+				URL:      nbSrv.URL,
+				Token:    fakenetbox.DefaultToken,
+				LabelMap: `{"Prod": {"prefix": "172.16.4.0/29"}}`,
+				Insecure: true,
+			},
+			PhpIPAMParams: PhpIPAMParams{
+				URL:      piSrv.URL,
+				AppID:    fakephpipam.DefaultAppID,
+				Username: fakephpipam.DefaultUsername,
+				Password: fakephpipam.DefaultPassword,
+				LabelMap: fmt.Sprintf(`{"Test": {"subnetId": %d}, "Prod": {"subnetId": %d}}`, subnetID, subnetID),
+				Insecure: true,
+			},
+			RoutingParams: RoutingParams{LabelMap: `{"Prod": "netbox", "Test": "phpipam"}`},
+		}
+	})
+
+	AfterEach(func() {
+		nbSrv.Close()
+		piSrv.Close()
+	})
+
+	It("Parses the labels", func() {
+		labels, err := ParseRoutingLabels(`{"Prod": "infoblox", "Test": "f5-ip-provider", "Dev": "infoblox"}`)
+		Expect(err).To(BeNil())
+		Expect(RoutedProviders(labels)).To(Equal([]string{F5IPAMProvider, InfobloxProvider}))
+		labels, err = ParseRoutingLabels(`{"Prod": "infoblox", "Test": {"provider": "netbox", "fallback": "f5-ip-provider"}}`)
+		Expect(err).To(BeNil())
+		Expect(labels["Test"]).To(Equal(Route{Provider: NetBoxProvider, Fallback: F5IPAMProvider}))
+		Expect(RoutedProviders(labels)).To(Equal([]string{F5IPAMProvider, InfobloxProvider, NetBoxProvider}))
+		_, err = ParseRoutingLabels(`{"Prod": "routing"}`)
+		Expect(err).To(MatchError("unknown provider routing for label Prod"))
+		_, err = ParseRoutingLabels(`{"Prod": {"provider": "infoblox", "fallback": "routing"}}`)
+		Expect(err).To(MatchError("unknown fallback provider routing for label Prod"))
+		_, err = ParseRoutingLabels(`{"Prod": {"provider": "infoblox", "fallback": "infoblox"}}`)
+		Expect(err).To(MatchError("fallback provider of label Prod is its provider"))
+		_, err = ParseRoutingLabels(`{}`)
+		Expect(err).To(MatchError("no labels to route"))
+	})
+
+	It("Sends the requests to the provider of the label", func() {
+		mgr, err := NewManager(params)
+		Expect(err).To(BeNil())
+		rtMgr := mgr.(*RoutingManager)
+		Expect(rtMgr.Manager(NetBoxProvider)).To(BeAssignableToTypeOf(&NetBoxManager{}))
+		Expect(rtMgr.Manager(InfobloxProvider)).To(BeNil())
+
+		prodReq := ipamspec.IPAMRequest{HostName: "prod.com", IPAMLabel: "Prod"}
+		testReq := ipamspec.IPAMRequest{HostName: "test.com", IPAMLabel: "Test"}
+		Expect(mgr.AllocateNextIPAddress(prodReq)).To(Equal("172.16.4.1"))
+		Expect(mgr.AllocateNextIPAddress(testReq)).To(Equal("172.16.5.1"))
+		Expect(nbSrv.Objects("ipam/ip-addresses")).To(HaveLen(1))
+		Expect(piSrv.Objects("addresses")).To(HaveLen(1))
+		Expect(mgr.GetIPAddress(prodReq)).To(Equal("172.16.4.1"))
+		Expect(mgr.GetIPAddress(testReq)).To(Equal("172.16.5.1"))
+
+		// The labels without a provider are rejected
+		Expect(mgr.AllocateNextIPAddress(ipamspec.IPAMRequest{HostName: "dev.com", IPAMLabel: "Dev"})).To(BeEmpty())
+		Expect(mgr.ReserveIPAddress(ipamspec.IPAMRequest{HostName: "dev.com", IPAddr: "172.16.4.2", IPAMLabel: "Dev"})).To(BeFalse())
+
+		// phpIPAM has the Prod label too, only the allocations of NetBox are listed for it
+		Expect(rtMgr.GetLabelUsage()).To(Equal([]LabelUsage{
+			{IPAMLabel: "Prod", Range: "172.16.4.0/29", Total: 6, Allocated: 1},
+			{IPAMLabel: "Test", Range: "172.16.5.0/29", Total: 6, Allocated: 1},
+		}))
+		Expect(rtMgr.GetAllocations("")).To(ConsistOf(
+			Allocation{IPAMLabel: "Prod", IPAddr: "172.16.4.1", Reference: "prod.com", HostName: true},
+			Allocation{IPAMLabel: "Test", IPAddr: "172.16.5.1", Reference: "test.com", HostName: true},
+		))
+		Expect(rtMgr.GetAllocations("Test")).To(Equal([]Allocation{
+			{IPAMLabel: "Test", IPAddr: "172.16.5.1", Reference: "test.com", HostName: true},
+		}))
+		Expect(rtMgr.IsDNSEnabled("Prod")).To(BeFalse())
+		Expect(rtMgr.IsReady()).To(BeTrue())
+		Expect(rtMgr.IsLabelReady("Prod")).To(BeTrue())
+		Expect(rtMgr.IsLabelReady("Dev")).To(BeFalse())
+		// phpIPAM takes the credentials of the default grid only
+		Expect(rtMgr.UpdateCredentials("lab", GridParams{})).To(Succeed())
+		Expect(rtMgr.UpdateCredentials(DefaultGrid, GridParams{})).To(HaveOccurred())
+
+		testReq.IPAddr = "172.16.5.1"
+		mgr.ReleaseIPAddress(testReq)
+		Expect(piSrv.Objects("addresses")).To(BeEmpty())
+		Expect(nbSrv.Objects("ipam/ip-addresses")).To(HaveLen(1))
+	})
+
+	It("Allocates from the fallback provider when the provider is unable to", func() {
+		nbSrv.AddPrefix("172.16.6.0/30")
+		params.NetBoxParams.LabelMap = `{"Prod": {"prefix": "172.16.4.0/29"}, "Test": {"prefix": "172.16.6.0/30"}}`
+		params.RoutingParams.LabelMap = `{"Prod": "netbox", "Test": {"provider": "netbox", "fallback": "phpipam"}}`
+		mgr, err := NewManager(params)
+		Expect(err).To(BeNil())
+		rtMgr := mgr.(*RoutingManager)
+
+		// The prefix of the provider has two IP addresses
+		for i, ip := range []string{"172.16.6.1", "172.16.6.2", "172.16.5.1"} {
+			Expect(mgr.AllocateNextIPAddress(ipamspec.IPAMRequest{
+				HostName:  fmt.Sprintf("test%d.com", i),
+				IPAMLabel: "Test",
+			})).To(Equal(ip))
+		}
+		fallbackReq := ipamspec.IPAMRequest{HostName: "test2.com", IPAMLabel: "Test"}
+		Expect(mgr.GetIPAddress(fallbackReq)).To(Equal("172.16.5.1"))
+		Expect(rtMgr.GetFallbackAllocations("")).To(Equal([]Allocation{
+			{IPAMLabel: "Test", IPAddr: "172.16.5.1", Reference: "test2.com", HostName: true},
+		}))
+		Expect(rtMgr.GetFallbackAllocations("Prod")).To(BeEmpty())
+		Expect(rtMgr.GetAllocations("Test")).To(HaveLen(3))
+		// The labels without a fallback provider do not fall back
+		Expect(mgr.AllocateNextIPAddress(ipamspec.IPAMRequest{HostName: "prod.com", IPAMLabel: "Prod"})).To(Equal("172.16.4.1"))
+		Expect(rtMgr.GetLabelUsage()).To(Equal([]LabelUsage{
+			{IPAMLabel: "Prod", Range: "172.16.4.0/29", Total: 6, Allocated: 1},
+			{IPAMLabel: "Test", Range: "172.16.6.0/30", Total: 2, Allocated: 2},
+		}))
+
+		// The hostname/key with IP addresses of both providers releases both of them
+		Expect(rtMgr.Manager(PhpIPAMProvider).ReserveIPAddress(ipamspec.IPAMRequest{
+			HostName: "test0.com", IPAMLabel: "Test", IPAddr: "172.16.5.2"})).To(BeTrue())
+		mgr.ReleaseIPAddress(ipamspec.IPAMRequest{HostName: "test0.com", IPAMLabel: "Test", IPAddr: "172.16.6.1"})
+		Expect(nbSrv.Objects("ipam/ip-addresses")).To(HaveLen(2))
+		Expect(piSrv.Objects("addresses")).To(HaveLen(1))
+		fallbackReq.IPAddr = "172.16.5.1"
+		mgr.ReleaseIPAddress(fallbackReq)
+		Expect(rtMgr.GetFallbackAllocations("")).To(BeEmpty())
+		Expect(nbSrv.Objects("ipam/ip-addresses")).To(HaveLen(2))
+	})
+
+	It("Fails when a provider fails", func() {
+		params.PhpIPAMParams.Password = "wrong"
+		_, err := NewManager(params)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix("provider phpipam: "))
+	})
+})
@@ -0,0 +1,167 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"fmt"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+// StatusUpdater updates the resources that advertise the IP addresses of the allocations in their status,
+// e.g. the IPAM resources, Services and Gateways
+type StatusUpdater interface {
+	// Owners returns the requests of the resources that advertise the IP address of the allocation,
+	// with the hostname or the key of the allocation as the resources hold it
+	Owners(alloc manager.Allocation) ([]ipamspec.IPAMRequest, error)
+	// UpdateStatus replaces the IP address of the request with ip in the status of its resource
+	UpdateStatus(req ipamspec.IPAMRequest, ip string) error
+}
+
+type FailbackParams struct {
+	// Router is the routing manager of the labels with a fallback provider
+	Router *manager.RoutingManager
+	// StatusUpdater points the resources to the new IP addresses before the fallback IP addresses are
+	// released, it is required unless DryRun is set
+	StatusUpdater StatusUpdater
+	// IPAMLabel is the label to migrate, all labels with a fallback provider when it is empty
+	IPAMLabel string
+	// Compute and report the changes without allocating anything
+	DryRun bool
+}
+
+// FailbackMigrator moves the allocations of the fallback providers back to the primary provider of their
+// label. The hostnames/keys get a new IP address from the primary provider, the resources that advertise
+// the IP address of the fallback provider are updated, and then it is released
+type FailbackMigrator struct {
+	router        *manager.RoutingManager
+	statusUpdater StatusUpdater
+	ipamLabel     string
+	dryRun        bool
+}
+
+func NewFailbackMigrator(params FailbackParams) *FailbackMigrator {
+	return &FailbackMigrator{
+		router:        params.Router,
+		statusUpdater: params.StatusUpdater,
+		ipamLabel:     params.IPAMLabel,
+		dryRun:        params.DryRun,
+	}
+}
+
+// Run moves the fallback allocations, those of the labels whose primary provider is not ready are left untouched
+func (fm *FailbackMigrator) Run() (*ProviderReport, error) {
+	if fm.ipamLabel != "" {
+		if rt, ok := fm.router.Route(fm.ipamLabel); !ok || rt.Fallback == "" {
+			return nil, fmt.Errorf("label %v has no fallback provider", fm.ipamLabel)
+		}
+	}
+	if fm.statusUpdater == nil && !fm.dryRun {
+		return nil, fmt.Errorf("the resources that advertise the fallback IP addresses can not be updated")
+	}
+
+	report := &ProviderReport{DryRun: fm.dryRun}
+	for _, alloc := range fm.router.GetFallbackAllocations(fm.ipamLabel) {
+		report.add(fm.move(alloc))
+	}
+	return report, nil
+}
+
+// move allocates an IP address to the hostname/key of the allocation in the primary provider, unless it holds
+// one already, along with its A record. The resources that advertise the IP address of the fallback provider
+// are updated to the new one before it is released, so that no resource advertises a released IP address
+func (fm *FailbackMigrator) move(alloc manager.Allocation) ProviderResult {
+	rt, _ := fm.router.Route(alloc.IPAMLabel)
+	// The IP address of the primary provider is allocated anew
+	req := alloc.Request(ipamspec.CREATE)
+	req.IPAddr = ""
+	result := ProviderResult{
+		IPAMLabel: alloc.IPAMLabel,
+		IP:        alloc.IPAddr,
+		Reference: alloc.Reference,
+	}
+	primary := fm.router.Manager(rt.Provider)
+	fallback := fm.router.Manager(rt.Fallback)
+	if !manager.IsLabelReady(primary, alloc.IPAMLabel) {
+		result.Status = StatusFailed
+		result.Message = fmt.Sprintf("provider %v is not ready", rt.Provider)
+		return result
+	}
+	var owners []ipamspec.IPAMRequest
+	if fm.statusUpdater != nil {
+		var err error
+		if owners, err = fm.statusUpdater.Owners(alloc); err != nil {
+			log.Errorf("[MIGR] Unable to find the resources of %v, Error: %v", alloc.Reference, err)
+			result.Status = StatusFailed
+			result.Message = fmt.Sprintf("unable to find the resources of %v: %v", alloc.IPAddr, err)
+			return result
+		}
+	}
+	// The hostname/key may have got an IP address from the primary provider meanwhile
+	ip := primary.GetIPAddress(req)
+	if ip != "" {
+		result.Message = fmt.Sprintf("holds %v in %v", ip, rt.Provider)
+	}
+	if fm.dryRun {
+		result.Status = StatusPlanned
+		return result
+	}
+	if ip == "" {
+		if ip = primary.AllocateNextIPAddress(req); ip == "" {
+			log.Errorf("[MIGR] Unable to allocate an IP address for %v in %v", alloc.Reference, rt.Provider)
+			result.Status = StatusFailed
+			result.Message = fmt.Sprintf("unable to allocate IP address in %v", rt.Provider)
+			return result
+		}
+		if req.HostName != "" && fm.router.IsDNSEnabled(alloc.IPAMLabel) {
+			dnsReq := req
+			dnsReq.IPAddr = ip
+			if !primary.CreateARecord(dnsReq) {
+				log.Errorf("[MIGR] Unable to create the A record of %v in %v", req.HostName, rt.Provider)
+				primary.ReleaseIPAddress(dnsReq)
+				result.Status = StatusFailed
+				result.Message = fmt.Sprintf("unable to create A record in %v", rt.Provider)
+				return result
+			}
+		}
+	}
+	for _, owner := range owners {
+		if err := fm.statusUpdater.UpdateStatus(owner, ip); err != nil {
+			meta := owner.Metadata.(ipamspec.ResourceMetadata)
+			log.Errorf("[MIGR] Unable to update the status of %v/%v, Error: %v", meta.GetNamespace(), meta.GetName(), err)
+			result.Status = StatusFailed
+			result.Message = fmt.Sprintf("allocated %v in %v, unable to update the status of %v/%v: %v",
+				ip, rt.Provider, meta.GetNamespace(), meta.GetName(), err)
+			return result
+		}
+	}
+	req.Operation = ipamspec.DELETE
+	req.IPAddr = alloc.IPAddr
+	fallback.ReleaseIPAddress(req)
+	if fallback.GetIPAddress(req) == alloc.IPAddr {
+		log.Errorf("[MIGR] Unable to release IP address %v of %v in %v", alloc.IPAddr, alloc.Reference, rt.Fallback)
+		result.Status = StatusFailed
+		result.Message = fmt.Sprintf("allocated %v in %v, unable to release IP address in %v",
+			ip, rt.Provider, rt.Fallback)
+		return result
+	}
+	result.Status = StatusMigrated
+	result.Message = fmt.Sprintf("moved to %v in %v", ip, rt.Provider)
+	return result
+}
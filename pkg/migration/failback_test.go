@@ -0,0 +1,175 @@
+package migration_test
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/fakenetbox"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/fakephpipam"
+	"github.com/F5Networks/f5-ipam-controller/pkg/migration"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type owner struct {
+	name, namespace string
+}
+
+func (o owner) GetName() string      { return o.name }
+func (o owner) GetNamespace() string { return o.namespace }
+
+// fakeStatusUpdater advertises the IP addresses of the hostnames in the status of an IPAM resource each
+type fakeStatusUpdater struct {
+	statuses map[string]string
+	fail     bool
+}
+
+func (su *fakeStatusUpdater) Owners(alloc manager.Allocation) ([]ipamspec.IPAMRequest, error) {
+	if su.statuses[alloc.Reference] != alloc.IPAddr {
+		return nil, nil
+	}
+	return []ipamspec.IPAMRequest{{
+		Metadata:  owner{name: alloc.Reference, namespace: "default"},
+		HostName:  alloc.Reference,
+		IPAMLabel: alloc.IPAMLabel,
+		IPAddr:    alloc.IPAddr,
+	}}, nil
+}
+
+func (su *fakeStatusUpdater) UpdateStatus(req ipamspec.IPAMRequest, ip string) error {
+	if su.fail {
+		return fmt.Errorf("conflict")
+	}
+	su.statuses[req.HostName] = ip
+	return nil
+}
+
+var _ = Describe("Failback Migration", func() {
+	var nbSrv *fakenetbox.Server
+	var piSrv *fakephpipam.Server
+	var router *manager.RoutingManager
+	var updater *fakeStatusUpdater
+
+	BeforeEach(func() {
+		nbSrv = fakenetbox.NewServer(fakenetbox.Params{})
+		nbSrv.AddPrefix("172.16.6.0/30")
+		piSrv = fakephpipam.NewServer(fakephpipam.Params{})
+		subnetID := piSrv.AddSubnet("172.16.5.0/29")
+		mgr, err := manager.NewManager(manager.Params{
+			Provider: manager.RoutingProvider,
+			NetBoxParams: manager.NetBoxParams{
+				URL:      nbSrv.URL,
+				Token:    fakenetbox.DefaultToken,
+				LabelMap: `{"Test": {"prefix": "172.16.6.0/30"}}`,
+				Insecure: true,
+			},
+			PhpIPAMParams: manager.PhpIPAMParams{
+				URL:      piSrv.URL,
+				AppID:    fakephpipam.DefaultAppID,
+				Username: fakephpipam.DefaultUsername,
+				Password: fakephpipam.DefaultPassword,
+				LabelMap: fmt.Sprintf(`{"Test": {"subnetId": %d}, "Dev": {"subnetId": %d}}`, subnetID, subnetID),
+				Insecure: true,
+			},
+			RoutingParams: manager.RoutingParams{
+				LabelMap: `{"Test": {"provider": "netbox", "fallback": "phpipam"}, "Dev": "phpipam"}`,
+			},
+		})
+		Expect(err).To(BeNil())
+		router = mgr.(*manager.RoutingManager)
+
+		// The prefix of the provider has two IP addresses, the next ones come from the fallback provider
+		for i := 0; i < 4; i++ {
+			Expect(router.AllocateNextIPAddress(ipamspec.IPAMRequest{
+				HostName:  fmt.Sprintf("test%d.com", i),
+				IPAMLabel: "Test",
+			})).NotTo(BeEmpty())
+		}
+		Expect(router.GetFallbackAllocations("")).To(HaveLen(2))
+		// Free one IP address of the provider, and give one of the hostnames with a fallback IP address
+		// an IP address of the provider too
+		router.ReleaseIPAddress(ipamspec.IPAMRequest{HostName: "test0.com", IPAMLabel: "Test", IPAddr: "172.16.6.1"})
+		Expect(router.Manager(manager.NetBoxProvider).ReserveIPAddress(ipamspec.IPAMRequest{
+			HostName: "test3.com", IPAMLabel: "Test", IPAddr: "172.16.6.1"})).To(BeTrue())
+		updater = &fakeStatusUpdater{statuses: map[string]string{"test2.com": "172.16.5.1", "test3.com": "172.16.5.2"}}
+	})
+
+	AfterEach(func() {
+		nbSrv.Close()
+		piSrv.Close()
+	})
+
+	run := func(ipamLabel string, dryRun bool) *migration.ProviderReport {
+		report, err := migration.NewFailbackMigrator(migration.FailbackParams{
+			Router:        router,
+			StatusUpdater: updater,
+			IPAMLabel:     ipamLabel,
+			DryRun:        dryRun,
+		}).Run()
+		Expect(err).NotTo(HaveOccurred())
+		return report
+	}
+
+	It("reports the allocations to move in a dry run", func() {
+		report := run("Test", true)
+		Expect(report.Planned).To(Equal(2))
+		Expect(router.GetFallbackAllocations("Test")).To(HaveLen(2))
+
+		var out bytes.Buffer
+		report.Print(&out)
+		Expect(out.String()).To(ContainSubstring("holds 172.16.6.1 in netbox"))
+		Expect(out.String()).To(ContainSubstring("Dry run, Planned: 2, Skipped: 0, Conflicts: 0"))
+	})
+
+	It("moves the allocations back to the provider", func() {
+		report := run("", false)
+		Expect(report.Migrated).To(Equal(1))
+		Expect(report.Failed).To(Equal(1))
+		Expect(report.Results).To(ContainElement(migration.ProviderResult{
+			IPAMLabel: "Test",
+			IP:        "172.16.5.2",
+			Reference: "test3.com",
+			Status:    migration.StatusMigrated,
+			Message:   "moved to 172.16.6.1 in netbox",
+		}))
+		Expect(report.Results).To(ContainElement(migration.ProviderResult{
+			IPAMLabel: "Test",
+			IP:        "172.16.5.1",
+			Reference: "test2.com",
+			Status:    migration.StatusFailed,
+			Message:   "unable to allocate IP address in netbox",
+		}))
+		Expect(router.GetFallbackAllocations("")).To(HaveLen(1))
+		Expect(router.GetIPAddress(ipamspec.IPAMRequest{HostName: "test3.com", IPAMLabel: "Test"})).To(Equal("172.16.6.1"))
+		// The status advertises the new IP address, the one of the failed allocation is kept
+		Expect(updater.statuses).To(Equal(map[string]string{"test2.com": "172.16.5.1", "test3.com": "172.16.6.1"}))
+
+		_, err := migration.NewFailbackMigrator(migration.FailbackParams{Router: router, IPAMLabel: "Dev"}).Run()
+		Expect(err).To(MatchError("label Dev has no fallback provider"))
+		_, err = migration.NewFailbackMigrator(migration.FailbackParams{Router: router}).Run()
+		Expect(err).To(MatchError("the resources that advertise the fallback IP addresses can not be updated"))
+	})
+
+	It("keeps the fallback IP address while the status advertises it", func() {
+		updater.fail = true
+		report := run("Test", false)
+		Expect(report.Failed).To(Equal(2))
+		Expect(report.Results).To(ContainElement(migration.ProviderResult{
+			IPAMLabel: "Test",
+			IP:        "172.16.5.2",
+			Reference: "test3.com",
+			Status:    migration.StatusFailed,
+			Message:   "allocated 172.16.6.1 in netbox, unable to update the status of default/test3.com: conflict",
+		}))
+		Expect(router.GetFallbackAllocations("Test")).To(HaveLen(2))
+
+		// The next run finds the IP address of the provider and moves the allocation
+		updater.fail = false
+		report = run("Test", false)
+		Expect(report.Migrated).To(Equal(1))
+		Expect(updater.statuses).To(HaveKeyWithValue("test3.com", "172.16.6.1"))
+		Expect(router.GetFallbackAllocations("Test")).To(HaveLen(1))
+	})
+})
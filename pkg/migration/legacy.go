@@ -0,0 +1,186 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"context"
+	"fmt"
+
+	ficV1 "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/apis/fic/v1"
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/client/clientset/versioned"
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// LegacyCRDResource is the f5ipams resource used by FIC 0.1.4 and earlier
+var LegacyCRDResource = schema.GroupVersionResource{
+	Group:    "fic.f5.com",
+	Version:  "v1",
+	Resource: "f5ipams",
+}
+
+// legacyIPAM is the F5IPAM resource, it carries the same host and IP specs
+// as the IPAM resource
+type legacyIPAM struct {
+	metaV1.TypeMeta   `json:",inline"`
+	metaV1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec struct {
+		HostSpecs []*ficV1.HostSpec `json:"hostSpecs,omitempty"`
+	} `json:"spec,omitempty"`
+	Status struct {
+		IPStatus []*ficV1.IPSpec `json:"IPStatus,omitempty"`
+	} `json:"status,omitempty"`
+}
+
+// LegacyParams defines the parameters of the legacy CRD migration
+type LegacyParams struct {
+	DynamicClient dynamic.Interface
+	KubeCRClient  versioned.Interface
+	Manager       manager.Manager
+	// Namespaces to migrate, an empty namespace migrates all namespaces
+	Namespaces []string
+}
+
+// LegacyMigrator migrates F5IPAM resources to IPAM resources along with
+// the allocated IP addresses
+type LegacyMigrator struct {
+	LegacyParams
+}
+
+func NewLegacyMigrator(params LegacyParams) *LegacyMigrator {
+	return &LegacyMigrator{LegacyParams: params}
+}
+
+// Run migrates every F5IPAM resource once. IPAM resources that already exist
+// are skipped, so that the migration can be run again safely. It stops at the
+// first IPAM resource whose status can not be persisted.
+func (lm *LegacyMigrator) Run() (*Report, error) {
+	report := &Report{}
+	for _, namespace := range lm.Namespaces {
+		list, err := lm.DynamicClient.Resource(LegacyCRDResource).Namespace(namespace).List(
+			context.TODO(), metaV1.ListOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				log.Infof("[MIGR] No legacy %v resources found", LegacyCRDResource.Resource)
+				continue
+			}
+			return report, err
+		}
+		for _, item := range list.Items {
+			legacy := &legacyIPAM{}
+			err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, legacy)
+			if err != nil {
+				report.add(Result{
+					Namespace: item.GetNamespace(),
+					Name:      item.GetName(),
+					Status:    StatusFailed,
+					Message:   fmt.Sprintf("unable to decode: %v", err),
+				})
+				continue
+			}
+			if err = lm.migrate(legacy, report); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// migrate creates the IPAM resource of the F5IPAM resource and reserves its IP addresses,
+// the reserved IP addresses are reported as failed when the status can not be updated
+func (lm *LegacyMigrator) migrate(legacy *legacyIPAM, report *Report) error {
+	ipamCli := lm.KubeCRClient.K8sV1().IPAMs(legacy.Namespace)
+
+	ipam := &ficV1.IPAM{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        legacy.Name,
+			Namespace:   legacy.Namespace,
+			Labels:      legacy.Labels,
+			Annotations: legacy.Annotations,
+		},
+		Spec: ficV1.IPAMSpec{HostSpecs: legacy.Spec.HostSpecs},
+	}
+	ipam, err := ipamCli.Create(context.TODO(), ipam, metaV1.CreateOptions{})
+	if err != nil {
+		result := Result{Namespace: legacy.Namespace, Name: legacy.Name, Status: StatusFailed}
+		if apierrors.IsAlreadyExists(err) {
+			result.Status = StatusSkipped
+			result.Message = "IPAM already exists"
+		} else {
+			result.Message = err.Error()
+		}
+		report.add(result)
+		return nil
+	}
+
+	var migrated []Result
+	for _, ipSpec := range legacy.Status.IPStatus {
+		if ipSpec == nil {
+			continue
+		}
+		result := Result{
+			Namespace: legacy.Namespace,
+			Name:      legacy.Name,
+			Host:      ipSpec.Host,
+			Key:       ipSpec.Key,
+			IPAMLabel: ipSpec.IPAMLabel,
+			IP:        ipSpec.IP,
+			Status:    StatusMigrated,
+		}
+		req := ipamspec.IPAMRequest{
+			Operation: ipamspec.CREATE,
+			HostName:  ipSpec.Host,
+			Key:       ipSpec.Key,
+			IPAMLabel: ipSpec.IPAMLabel,
+			IPAddr:    ipSpec.IP,
+		}
+		// The controller allocates a new IP address for the entries that fail here
+		if !lm.Manager.ReserveIPAddress(req) {
+			result.Status = StatusFailed
+			result.Message = "unable to reserve IP address"
+			report.add(result)
+			continue
+		}
+		ipam.Status.IPStatus = append(ipam.Status.IPStatus, ipSpec)
+		migrated = append(migrated, result)
+	}
+
+	if len(ipam.Status.IPStatus) != 0 {
+		_, err = ipamCli.UpdateStatus(context.TODO(), ipam, metaV1.UpdateOptions{})
+		if err != nil {
+			log.Errorf("[MIGR] Unable to Update IPAM: %v/%v\t Error: %v", ipam.Namespace, ipam.Name, err)
+			for i := range migrated {
+				migrated[i].Status = StatusFailed
+				migrated[i].Message = fmt.Sprintf("unable to update status: %v", err)
+			}
+		}
+	}
+	for _, result := range migrated {
+		report.add(result)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to update status of IPAM %v/%v: %v", ipam.Namespace, ipam.Name, err)
+	}
+	return nil
+}
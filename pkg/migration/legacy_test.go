@@ -0,0 +1,107 @@
+package migration_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	ficV1 "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/apis/fic/v1"
+	ipamFake "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/client/clientset/versioned/fake"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/mock"
+	"github.com/F5Networks/f5-ipam-controller/pkg/migration"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func TestMigration(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Migration Suite")
+}
+
+func newLegacyIPAM(name string, ipStatus ...interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "fic.f5.com/v1",
+		"kind":       "F5IPAM",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "kube-system"},
+		"spec": map[string]interface{}{
+			"hostSpecs": []interface{}{
+				map[string]interface{}{"host": "foo.com", "ipamLabel": "Dev"},
+				map[string]interface{}{"host": "bar.com", "ipamLabel": "Dev"},
+			},
+		},
+		"status": map[string]interface{}{"IPStatus": ipStatus},
+	}}
+}
+
+var _ = Describe("Legacy CRD Migration", func() {
+	It("migrates F5IPAM resources with their IP addresses", func() {
+		dynCli := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{migration.LegacyCRDResource: "F5IPAMList"},
+			newLegacyIPAM("legacy",
+				map[string]interface{}{"host": "foo.com", "ipamLabel": "Dev", "ip": "10.1.1.1"},
+				// no IP address, cannot be reserved
+				map[string]interface{}{"host": "bar.com", "ipamLabel": "Dev"},
+			),
+			newLegacyIPAM("exists",
+				map[string]interface{}{"host": "foo.com", "ipamLabel": "Dev", "ip": "10.1.1.2"},
+			),
+		)
+		existing := &ficV1.IPAM{ObjectMeta: metaV1.ObjectMeta{Name: "exists", Namespace: "kube-system"}}
+		crCli := ipamFake.NewSimpleClientset()
+		_, _ = crCli.K8sV1().IPAMs("kube-system").Create(context.TODO(), existing, metaV1.CreateOptions{})
+		mgr, _ := mock.NewMockIPAMManager(mock.MockData{})
+
+		report, err := migration.NewLegacyMigrator(migration.LegacyParams{
+			DynamicClient: dynCli,
+			KubeCRClient:  crCli,
+			Manager:       mgr,
+			Namespaces:    []string{"kube-system"},
+		}).Run()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Migrated).To(Equal(1))
+		Expect(report.Failed).To(Equal(1))
+		Expect(report.Skipped).To(Equal(1))
+
+		ipam, err := crCli.K8sV1().IPAMs("kube-system").Get(context.TODO(), "legacy", metaV1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ipam.Spec.HostSpecs).To(HaveLen(2))
+		Expect(ipam.Status.IPStatus).To(HaveLen(1))
+		Expect(ipam.Status.IPStatus[0].IP).To(Equal("10.1.1.1"))
+
+		out := &bytes.Buffer{}
+		report.Print(out)
+		Expect(out.String()).To(ContainSubstring("Migrated: 1, Skipped: 1, Failed: 1"))
+	})
+
+	It("reports the IP addresses as failed when the status can not be updated", func() {
+		dynCli := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{migration.LegacyCRDResource: "F5IPAMList"},
+			newLegacyIPAM("legacy",
+				map[string]interface{}{"host": "foo.com", "ipamLabel": "Dev", "ip": "10.1.1.1"},
+			),
+		)
+		crCli := ipamFake.NewSimpleClientset()
+		crCli.PrependReactor("update", "ipams", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+			return action.GetSubresource() == "status", nil, errors.New("forbidden")
+		})
+		mgr, _ := mock.NewMockIPAMManager(mock.MockData{})
+
+		report, err := migration.NewLegacyMigrator(migration.LegacyParams{
+			DynamicClient: dynCli,
+			KubeCRClient:  crCli,
+			Manager:       mgr,
+			Namespaces:    []string{"kube-system"},
+		}).Run()
+		Expect(err).To(MatchError(ContainSubstring("unable to update status of IPAM kube-system/legacy")))
+		Expect(report.Migrated).To(Equal(0))
+		Expect(report.Failed).To(Equal(1))
+		Expect(report.Results[0].Message).To(ContainSubstring("forbidden"))
+	})
+})
@@ -0,0 +1,117 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"fmt"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+type ProviderParams struct {
+	// Source provider to read the allocations from
+	Source manager.Inspector
+	// Target provider to reserve the allocations in
+	Target manager.Manager
+	// Compute and report the changes without reserving anything
+	DryRun bool
+}
+
+// ProviderMigrator copies the allocations of one IPAM provider to another,
+// keeping the IP address of every hostname/key
+type ProviderMigrator struct {
+	source manager.Inspector
+	target manager.Manager
+	dryRun bool
+}
+
+func NewProviderMigrator(params ProviderParams) *ProviderMigrator {
+	return &ProviderMigrator{
+		source: params.Source,
+		target: params.Target,
+		dryRun: params.DryRun,
+	}
+}
+
+// Run reserves the allocations of the source provider in the target provider,
+// allocations that conflict with the target are reported and left untouched
+func (pm *ProviderMigrator) Run() (*ProviderReport, error) {
+	targetInsp, ok := pm.target.(manager.Inspector)
+	if !ok {
+		return nil, fmt.Errorf("target provider does not support listing allocations")
+	}
+
+	ranges := make(map[string]string)
+	for _, lu := range targetInsp.GetLabelUsage() {
+		ranges[lu.IPAMLabel] = lu.Range
+	}
+	byIP := make(map[string]manager.Allocation)
+	byRef := make(map[string]manager.Allocation)
+	for _, alloc := range targetInsp.GetAllocations("") {
+		byIP[alloc.IPAddr] = alloc
+		byRef[alloc.Reference] = alloc
+	}
+
+	report := &ProviderReport{DryRun: pm.dryRun}
+	for _, alloc := range pm.source.GetAllocations("") {
+		result := ProviderResult{
+			IPAMLabel: alloc.IPAMLabel,
+			IP:        alloc.IPAddr,
+			Reference: alloc.Reference,
+		}
+		existing, ipTaken := byIP[alloc.IPAddr]
+		held, refTaken := byRef[alloc.Reference]
+		rng, labelFound := ranges[alloc.IPAMLabel]
+		switch {
+		case ipTaken && existing.Reference == alloc.Reference && existing.IPAMLabel == alloc.IPAMLabel:
+			result.Status = StatusSkipped
+			result.Message = "already allocated in target"
+		case !labelFound:
+			result.Status = StatusConflict
+			result.Message = fmt.Sprintf("label %v is not configured in target", alloc.IPAMLabel)
+		case !utils.IsIPInRange(alloc.IPAddr, rng):
+			result.Status = StatusConflict
+			result.Message = fmt.Sprintf("not in range %v of target label", rng)
+		case ipTaken:
+			result.Status = StatusConflict
+			result.Message = fmt.Sprintf("allocated to %v in target", existing.Reference)
+		case refTaken:
+			result.Status = StatusConflict
+			result.Message = fmt.Sprintf("reference holds %v in target", held.IPAddr)
+		case pm.dryRun:
+			result.Status = StatusPlanned
+		default:
+			ok := pm.target.ReserveIPAddress(alloc.Request(ipamspec.CREATE))
+			if ok {
+				result.Status = StatusMigrated
+			} else {
+				log.Errorf("[MIGR] Unable to reserve IP address %v for %v in target", alloc.IPAddr, alloc.Reference)
+				result.Status = StatusFailed
+				result.Message = "unable to reserve IP address in target"
+			}
+		}
+		if result.Status == StatusMigrated || result.Status == StatusPlanned {
+			byIP[alloc.IPAddr] = alloc
+			byRef[alloc.Reference] = alloc
+		}
+		report.add(result)
+	}
+	return report, nil
+}
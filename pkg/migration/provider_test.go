@@ -0,0 +1,115 @@
+package migration_test
+
+import (
+	"bytes"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/migration"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeProvider is an in-memory provider that can list its allocations
+type fakeProvider struct {
+	labels      []manager.LabelUsage
+	allocations []manager.Allocation
+	failIP      string
+}
+
+func (fp *fakeProvider) CreateARecord(req ipamspec.IPAMRequest) bool { return true }
+
+func (fp *fakeProvider) DeleteARecord(req ipamspec.IPAMRequest) {}
+
+func (fp *fakeProvider) GetIPAddress(req ipamspec.IPAMRequest) string { return "" }
+
+func (fp *fakeProvider) AllocateNextIPAddress(req ipamspec.IPAMRequest) string { return "" }
+
+func (fp *fakeProvider) ReserveIPAddress(req ipamspec.IPAMRequest) bool {
+	if req.IPAddr == fp.failIP {
+		return false
+	}
+	fp.allocations = append(fp.allocations, manager.Allocation{
+		IPAMLabel: req.IPAMLabel,
+		IPAddr:    req.IPAddr,
+		Reference: req.Key,
+	})
+	return true
+}
+
+func (fp *fakeProvider) ReleaseIPAddress(req ipamspec.IPAMRequest) {}
+
+func (fp *fakeProvider) GetLabelUsage() []manager.LabelUsage { return fp.labels }
+
+func (fp *fakeProvider) GetAllocations(ipamLabel string) []manager.Allocation { return fp.allocations }
+
+var _ = Describe("Provider Migration", func() {
+	var source, target *fakeProvider
+
+	BeforeEach(func() {
+		source = &fakeProvider{allocations: []manager.Allocation{
+			{IPAMLabel: "Dev", IPAddr: "10.1.1.1", Reference: "present.com"},
+			{IPAMLabel: "Dev", IPAddr: "10.1.1.2", Reference: "new.com"},
+			{IPAMLabel: "Dev", IPAddr: "10.1.1.3", Reference: "taken.com"},
+			{IPAMLabel: "Dev", IPAddr: "10.1.1.4", Reference: "holder.com"},
+			{IPAMLabel: "Dev", IPAddr: "10.1.9.1", Reference: "outside.com"},
+			{IPAMLabel: "Prod", IPAddr: "10.2.1.1", Reference: "prod.com"},
+			{IPAMLabel: "Dev", IPAddr: "10.1.1.6", Reference: "broken.com"},
+		}}
+		target = &fakeProvider{
+			labels: []manager.LabelUsage{{IPAMLabel: "Dev", Range: "10.1.1.0/24"}},
+			allocations: []manager.Allocation{
+				{IPAMLabel: "Dev", IPAddr: "10.1.1.1", Reference: "present.com"},
+				{IPAMLabel: "Dev", IPAddr: "10.1.1.3", Reference: "other.com"},
+				{IPAMLabel: "Dev", IPAddr: "10.1.1.5", Reference: "holder.com"},
+			},
+			failIP: "10.1.1.6",
+		}
+	})
+
+	statuses := func(report *migration.ProviderReport) map[string]string {
+		result := make(map[string]string)
+		for _, res := range report.Results {
+			result[res.Reference] = res.Status
+		}
+		return result
+	}
+
+	It("reports the changes without reserving in a dry run", func() {
+		report, err := migration.NewProviderMigrator(migration.ProviderParams{
+			Source: source,
+			Target: target,
+			DryRun: true,
+		}).Run()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statuses(report)).To(Equal(map[string]string{
+			"present.com": migration.StatusSkipped,
+			"new.com":     migration.StatusPlanned,
+			"taken.com":   migration.StatusConflict,
+			"holder.com":  migration.StatusConflict,
+			"outside.com": migration.StatusConflict,
+			"prod.com":    migration.StatusConflict,
+			"broken.com":  migration.StatusPlanned,
+		}))
+		Expect(report.Planned).To(Equal(2))
+		Expect(report.Conflicts).To(Equal(4))
+		Expect(target.allocations).To(HaveLen(3))
+
+		var out bytes.Buffer
+		report.Print(&out)
+		Expect(out.String()).To(ContainSubstring("allocated to other.com in target"))
+		Expect(out.String()).To(ContainSubstring("Dry run, Planned: 2, Skipped: 1, Conflicts: 4"))
+	})
+
+	It("reserves the allocations in the target", func() {
+		report, err := migration.NewProviderMigrator(migration.ProviderParams{
+			Source: source,
+			Target: target,
+		}).Run()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Migrated).To(Equal(1))
+		Expect(report.Failed).To(Equal(1))
+		Expect(target.allocations).To(ContainElement(
+			manager.Allocation{IPAMLabel: "Dev", IPAddr: "10.1.1.2", Reference: "new.com"}))
+	})
+})
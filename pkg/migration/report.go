@@ -0,0 +1,137 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+const (
+	StatusMigrated = "Migrated"
+	StatusSkipped  = "Skipped"
+	StatusFailed   = "Failed"
+	StatusPlanned  = "Planned"
+	StatusConflict = "Conflict"
+)
+
+// Result is the outcome of migrating a resource or one of its IP addresses
+type Result struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Host      string `json:"host,omitempty"`
+	Key       string `json:"key,omitempty"`
+	IPAMLabel string `json:"ipamLabel,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+}
+
+// Report holds the results of a migration
+type Report struct {
+	Results  []Result `json:"results"`
+	Migrated int      `json:"migrated"`
+	Skipped  int      `json:"skipped"`
+	Failed   int      `json:"failed"`
+}
+
+func (r *Report) add(result Result) {
+	switch result.Status {
+	case StatusMigrated:
+		r.Migrated++
+	case StatusSkipped:
+		r.Skipped++
+	case StatusFailed:
+		r.Failed++
+	}
+	r.Results = append(r.Results, result)
+}
+
+// Print writes the report as a table
+func (r *Report) Print(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAMESPACE\tNAME\tHOST\tKEY\tIPAMLABEL\tIP\tSTATUS\tMESSAGE")
+	for _, res := range r.Results {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			res.Namespace, res.Name, res.Host, res.Key, res.IPAMLabel, res.IP, res.Status, res.Message)
+	}
+	_ = w.Flush()
+	_, _ = fmt.Fprintf(out, "Migrated: %d, Skipped: %d, Failed: %d\n", r.Migrated, r.Skipped, r.Failed)
+}
+
+// ProviderResult is the outcome of migrating an allocation to the target provider
+type ProviderResult struct {
+	IPAMLabel string `json:"ipamLabel"`
+	IP        string `json:"ip"`
+	Reference string `json:"reference"`
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+}
+
+// ProviderReport holds the results of a migration between providers,
+// a dry run reports the allocations to be reserved as planned
+type ProviderReport struct {
+	DryRun    bool             `json:"dryRun"`
+	Results   []ProviderResult `json:"results"`
+	Migrated  int              `json:"migrated"`
+	Planned   int              `json:"planned"`
+	Skipped   int              `json:"skipped"`
+	Conflicts int              `json:"conflicts"`
+	Failed    int              `json:"failed"`
+}
+
+func (r *ProviderReport) add(result ProviderResult) {
+	switch result.Status {
+	case StatusMigrated:
+		r.Migrated++
+	case StatusPlanned:
+		r.Planned++
+	case StatusSkipped:
+		r.Skipped++
+	case StatusConflict:
+		r.Conflicts++
+	case StatusFailed:
+		r.Failed++
+	}
+	r.Results = append(r.Results, result)
+}
+
+// Print writes the report as a table, marking each allocation as in a diff:
+// + to be reserved or reserved, = already present and ! conflicting or failed
+func (r *ProviderReport) Print(out io.Writer) {
+	marks := map[string]string{
+		StatusMigrated: "+",
+		StatusPlanned:  "+",
+		StatusSkipped:  "=",
+		StatusConflict: "!",
+		StatusFailed:   "!",
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, " \tIPAMLABEL\tIP\tREFERENCE\tSTATUS\tMESSAGE")
+	for _, res := range r.Results {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			marks[res.Status], res.IPAMLabel, res.IP, res.Reference, res.Status, res.Message)
+	}
+	_ = w.Flush()
+	if r.DryRun {
+		_, _ = fmt.Fprintf(out, "Dry run, Planned: %d, Skipped: %d, Conflicts: %d\n", r.Planned, r.Skipped, r.Conflicts)
+		return
+	}
+	_, _ = fmt.Fprintf(out, "Migrated: %d, Skipped: %d, Conflicts: %d, Failed: %d\n",
+		r.Migrated, r.Skipped, r.Conflicts, r.Failed)
+}
@@ -0,0 +1,109 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package orchestration
+
+import (
+	"context"
+	"os"
+	"time"
+
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	typedCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// PodNameEnv and PodNamespaceEnv identify the pod of the controller, set them with the downward API
+	PodNameEnv      = "POD_NAME"
+	PodNamespaceEnv = "POD_NAMESPACE"
+
+	// EventTypeNormal and EventTypeWarning are the types of the reported events
+	EventTypeNormal  = coreV1.EventTypeNormal
+	EventTypeWarning = coreV1.EventTypeWarning
+
+	eventSource = "f5-ipam-controller"
+)
+
+// EventReporter reports the events of the controller on its pod
+type EventReporter struct {
+	events    typedCoreV1.EventsGetter
+	podName   string
+	namespace string
+}
+
+// NewEventReporter returns nil when the pod of the controller is not known
+func NewEventReporter() *EventReporter {
+	podName := os.Getenv(PodNameEnv)
+	namespace := os.Getenv(PodNamespaceEnv)
+	if podName == "" || namespace == "" {
+		log.Debugf("[IPAM] %v or %v not set, events are not reported", PodNameEnv, PodNamespaceEnv)
+		return nil
+	}
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		log.Errorf("[IPAM] Unable to report events: %v", err)
+		return nil
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Errorf("[IPAM] Unable to report events: %v", err)
+		return nil
+	}
+	return &EventReporter{
+		events:    kubeClient.CoreV1(),
+		podName:   podName,
+		namespace: namespace,
+	}
+}
+
+// Report creates an event of the eventType, Normal or Warning, on the pod of the controller
+func (er *EventReporter) Report(eventType, reason, message string) {
+	if er == nil {
+		return
+	}
+	reportEvent(er.events, coreV1.ObjectReference{
+		Kind:      "Pod",
+		Name:      er.podName,
+		Namespace: er.namespace,
+	}, eventType, reason, message)
+}
+
+// reportEvent creates an event of the eventType on the object
+func reportEvent(events typedCoreV1.EventsGetter, object coreV1.ObjectReference, eventType, reason, message string) {
+	now := metaV1.NewTime(time.Now())
+	event := &coreV1.Event{
+		ObjectMeta: metaV1.ObjectMeta{
+			GenerateName: object.Name + ".",
+			Namespace:    object.Namespace,
+		},
+		InvolvedObject: object,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         coreV1.EventSource{Component: eventSource},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err := events.Events(object.Namespace).Create(context.TODO(), event, metaV1.CreateOptions{})
+	if err != nil {
+		log.Errorf("[IPAM] Unable to report event %v: %v", reason, err)
+	}
+}
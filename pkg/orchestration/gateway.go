@@ -0,0 +1,504 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package orchestration
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	coreInfV1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// GatewayClassIPAMLabelKey is the key of the IPAM label in the ConfigMap of the
+	// parametersRef of the GatewayClass
+	GatewayClassIPAMLabelKey = "ipamLabel"
+	// AllocatedIPAMLabelAnnotation is the annotation of the Gateways with the IPAM label that
+	// their IP address was allocated from, to release it from there when the IPAM label changes
+	AllocatedIPAMLabelAnnotation = "fic.f5.com/allocated-ipam-label"
+	// gatewayAddressType is the type of the addresses written to the status of the Gateways
+	gatewayAddressType = "IPAddress"
+)
+
+var (
+	gatewayGVR = schema.GroupVersionResource{
+		Group:    "gateway.networking.k8s.io",
+		Version:  "v1",
+		Resource: "gateways",
+	}
+	gatewayClassGVR = schema.GroupVersionResource{
+		Group:    "gateway.networking.k8s.io",
+		Version:  "v1",
+		Resource: "gatewayclasses",
+	}
+)
+
+// K8sGatewayClient allocates the IP addresses of the Gateways of a GatewayClass
+type K8sGatewayClient struct {
+	resourceClient
+	dynamicClient dynamic.Interface
+
+	// gatewayClass of the Gateways that this client allocates for
+	gatewayClass         string
+	gatewayClassInformer cache.SharedIndexInformer
+	// configMaps watches the ConfigMap of the parametersRef of the GatewayClass
+	configMaps *namespacedInformers
+
+	// configMapLock guards configMapNamespace and configMapName, as the
+	// parametersRef of the GatewayClass changes while the informers run
+	configMapLock      sync.Mutex
+	configMapNamespace string
+	configMapName      string
+}
+
+// GatewayMeta identifies the Gateway of a request
+type GatewayMeta struct {
+	name      string
+	namespace string
+}
+
+// GetName returns the name of the Gateway
+func (gm GatewayMeta) GetName() string {
+	return gm.name
+}
+
+// GetNamespace returns the namespace of the Gateway
+func (gm GatewayMeta) GetNamespace() string {
+	return gm.namespace
+}
+
+func NewGatewayK8SClient(params Params) *K8sGatewayClient {
+	log.Debugf("Creating Gateway Kubernetes Client")
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		log.Errorf("[IPAM] Error creating configuration: %v", err)
+		return nil
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Errorf("[IPAM] Unable to create Kubernetes client: %v", err)
+		return nil
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Errorf("[IPAM] Unable to create Kubernetes dynamic client: %v", err)
+		return nil
+	}
+	return newGatewayClient(kubeClient, dynamicClient, params)
+}
+
+func newGatewayClient(kubeClient kubernetes.Interface, dynamicClient dynamic.Interface, params Params) *K8sGatewayClient {
+	gwc := &K8sGatewayClient{
+		resourceClient: newResourceClient(kubeClient, "Gateway", "ipam-controller-gateways"),
+		dynamicClient:  dynamicClient,
+		gatewayClass:   params.GatewayClass,
+	}
+	eventHandlers := &cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { gwc.enqueueGateway(obj) },
+		UpdateFunc: func(_, newObj interface{}) { gwc.enqueueUpdatedGateway(newObj) },
+		DeleteFunc: func(obj interface{}) { gwc.enqueueDeletedGateway(obj) },
+	}
+	// Gateways are watched in all namespaces unless namespaces or a namespace label are given
+	gwc.informers = newNamespacedInformers("Gateway", func(namespace string) cache.SharedIndexInformer {
+		informer := dynamicinformer.NewFilteredDynamicInformer(dynamicClient, gatewayGVR, namespace,
+			0*time.Second, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, nil).Informer()
+		informer.AddEventHandler(eventHandlers)
+		return informer
+	})
+	gwc.informers.watchNamespaces(kubeClient, params)
+
+	// The IPAM label of the GatewayClass changes along with the GatewayClass and its ConfigMap
+	parametersHandlers := &cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { gwc.enqueueGatewayClass() },
+		UpdateFunc: func(_, _ interface{}) { gwc.enqueueGatewayClass() },
+		DeleteFunc: func(obj interface{}) { gwc.enqueueGatewayClass() },
+	}
+	gwc.gatewayClassInformer = dynamicinformer.NewFilteredDynamicInformer(dynamicClient, gatewayClassGVR, "",
+		0*time.Second, cache.Indexers{}, func(options *metaV1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", gwc.gatewayClass).String()
+		}).Informer()
+	gwc.gatewayClassInformer.AddEventHandler(parametersHandlers)
+	gwc.configMaps = newNamespacedInformers("ConfigMap", func(namespace string) cache.SharedIndexInformer {
+		gwc.configMapLock.Lock()
+		name := gwc.configMapName
+		gwc.configMapLock.Unlock()
+		informer := coreInfV1.NewFilteredConfigMapInformer(kubeClient, namespace, 0*time.Second, cache.Indexers{},
+			func(options *metaV1.ListOptions) {
+				options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+			})
+		informer.AddEventHandler(parametersHandlers)
+		return informer
+	})
+	return gwc
+}
+
+// Start method runs the Orchestrator, watching for Gateways
+func (gwc *K8sGatewayClient) Start(stopCh <-chan struct{}) {
+	gwc.startGatewayClass(stopCh)
+	gwc.run(stopCh, gwc.processResponse)
+}
+
+// startGatewayClass watches the GatewayClass and the ConfigMap of its parametersRef, and waits for them
+func (gwc *K8sGatewayClient) startGatewayClass(stopCh <-chan struct{}) {
+	go gwc.gatewayClassInformer.Run(stopCh)
+	cache.WaitForNamedCacheSync("F5 IPAMClient GatewayClass Controller", stopCh,
+		gwc.gatewayClassInformer.HasSynced)
+	gwc.watchConfigMap()
+	gwc.configMaps.start(stopCh)
+}
+
+// ownsRequest checks whether the request is of a Gateway
+func (gwc *K8sGatewayClient) ownsRequest(req ipamspec.IPAMRequest) bool {
+	_, ok := req.Metadata.(GatewayMeta)
+	return ok
+}
+
+// isManagedGateway checks whether the Gateway is of the GatewayClass of this client
+// and leaves its addresses to the controller
+func (gwc *K8sGatewayClient) isManagedGateway(gw *unstructured.Unstructured) bool {
+	className, _, _ := unstructured.NestedString(gw.Object, "spec", "gatewayClassName")
+	if className != gwc.gatewayClass {
+		return false
+	}
+	addresses, _, _ := unstructured.NestedSlice(gw.Object, "spec", "addresses")
+	return len(addresses) == 0
+}
+
+// parametersRef returns the namespace and the name of the ConfigMap of the parametersRef of the
+// GatewayClass, an empty name when it has none
+func (gwc *K8sGatewayClient) parametersRef() (string, string) {
+	obj, found, err := gwc.gatewayClassInformer.GetStore().GetByKey(gwc.gatewayClass)
+	if err != nil || !found {
+		log.Debugf("Unable to find GatewayClass: %v", gwc.gatewayClass)
+		return "", ""
+	}
+	ref, found, _ := unstructured.NestedStringMap(obj.(*unstructured.Unstructured).Object, "spec", "parametersRef")
+	if !found || ref["group"] != "" || ref["kind"] != "ConfigMap" {
+		return "", ""
+	}
+	return ref["namespace"], ref["name"]
+}
+
+// watchConfigMap watches the ConfigMap of the parametersRef of the GatewayClass, in place of the
+// ConfigMap of its previous parametersRef
+func (gwc *K8sGatewayClient) watchConfigMap() {
+	namespace, name := gwc.parametersRef()
+	gwc.configMapLock.Lock()
+	if namespace == gwc.configMapNamespace && name == gwc.configMapName {
+		gwc.configMapLock.Unlock()
+		return
+	}
+	oldNamespace, oldName := gwc.configMapNamespace, gwc.configMapName
+	gwc.configMapNamespace, gwc.configMapName = namespace, name
+	gwc.configMapLock.Unlock()
+
+	if oldName != "" {
+		gwc.configMaps.remove(oldNamespace)
+	}
+	if name != "" {
+		gwc.configMaps.add(namespace)
+	}
+}
+
+// gatewayIPAMLabel returns the IPAM label of the annotation of the Gateway, or of the ConfigMap
+// of the parametersRef of its GatewayClass
+func (gwc *K8sGatewayClient) gatewayIPAMLabel(gw *unstructured.Unstructured) string {
+	if ipamLabel := gw.GetAnnotations()[IPAMLabelAnnotation]; ipamLabel != "" {
+		return ipamLabel
+	}
+	gwc.configMapLock.Lock()
+	namespace, name := gwc.configMapNamespace, gwc.configMapName
+	gwc.configMapLock.Unlock()
+	if name == "" {
+		return ""
+	}
+	store := gwc.configMaps.get(namespace)
+	if store == nil {
+		return ""
+	}
+	obj, found, err := store.GetByKey(namespace + "/" + name)
+	if err != nil || !found {
+		log.Warningf("[IPAM] Unable to find ConfigMap %v/%v of GatewayClass %v", namespace, name, gwc.gatewayClass)
+		return ""
+	}
+	return obj.(*coreV1.ConfigMap).Data[GatewayClassIPAMLabelKey]
+}
+
+// gatewayRequest returns the request of the operation for the Gateway, false when the Gateway is not managed.
+// The IP address is released from the IPAM label it was allocated from
+func (gwc *K8sGatewayClient) gatewayRequest(gw *unstructured.Unstructured, operation string) (ipamspec.IPAMRequest, bool) {
+	ipamLabel := gw.GetAnnotations()[AllocatedIPAMLabelAnnotation]
+	if operation == CREATE || ipamLabel == "" {
+		if !gwc.isManagedGateway(gw) {
+			return ipamspec.IPAMRequest{}, false
+		}
+		ipamLabel = gwc.gatewayIPAMLabel(gw)
+	}
+	if ipamLabel == "" {
+		log.Warningf("[IPAM] Gateway %v/%v has no %v annotation and GatewayClass %v has no IPAM label",
+			gw.GetNamespace(), gw.GetName(), IPAMLabelAnnotation, gwc.gatewayClass)
+		return ipamspec.IPAMRequest{}, false
+	}
+	req := ipamspec.IPAMRequest{
+		Metadata: GatewayMeta{
+			name:      gw.GetName(),
+			namespace: gw.GetNamespace(),
+		},
+		Key:       gatewayKey(gw),
+		IPAMLabel: ipamLabel,
+		Operation: ipamspec.DELETE,
+	}
+	if operation == CREATE {
+		req.Operation = ipamspec.CREATE
+	}
+	return req, true
+}
+
+// allocatedIPAMLabel returns the IPAM label that the IP address of the Gateway was allocated from,
+// empty when it has none. The addresses of a managed Gateway without the annotation are allocated
+// from its IPAM label, as the addresses are written before the annotation
+func (gwc *K8sGatewayClient) allocatedIPAMLabel(gw *unstructured.Unstructured) string {
+	if ipamLabel := gw.GetAnnotations()[AllocatedIPAMLabelAnnotation]; ipamLabel != "" {
+		return ipamLabel
+	}
+	if len(gatewayAddresses(gw)) == 0 || !gwc.isManagedGateway(gw) {
+		return ""
+	}
+	return gwc.gatewayIPAMLabel(gw)
+}
+
+// gatewayKey is the key of the Gateway in the IPAM provider
+func gatewayKey(gw *unstructured.Unstructured) string {
+	return gw.GetNamespace() + "/" + gw.GetName() + "_gateway"
+}
+
+// gatewayAddresses returns the addresses of the status of the Gateway
+func gatewayAddresses(gw *unstructured.Unstructured) []interface{} {
+	addresses, _, _ := unstructured.NestedSlice(gw.Object, "status", "addresses")
+	return addresses
+}
+
+// gatewayConditions returns the conditions of the status of the Gateway
+func gatewayConditions(gw *unstructured.Unstructured) []metaV1.Condition {
+	items, _, _ := unstructured.NestedSlice(gw.Object, "status", "conditions")
+	var conditions []metaV1.Condition
+	for _, item := range items {
+		var condition metaV1.Condition
+		if obj, ok := item.(map[string]interface{}); ok &&
+			runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &condition) == nil {
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions
+}
+
+func (gwc *K8sGatewayClient) enqueueGateway(obj interface{}) {
+	gw := obj.(*unstructured.Unstructured)
+	gwc.enqueueRelease(gw)
+	if req, ok := gwc.gatewayRequest(gw, CREATE); ok {
+		log.Debugf("Enqueueing Gateway on Create: %v/%v", gw.GetNamespace(), gw.GetName())
+		gwc.rscQueue.Add(req)
+	}
+}
+
+// enqueueUpdatedGateway releases the IP address of the Gateway when it is no longer managed or its
+// IPAM label changed, and allocates it again
+func (gwc *K8sGatewayClient) enqueueUpdatedGateway(obj interface{}) {
+	gw := obj.(*unstructured.Unstructured)
+	gwc.enqueueRelease(gw)
+	// A Gateway without addresses gets its IP address again
+	req, ok := gwc.gatewayRequest(gw, CREATE)
+	if ok && (req.IPAMLabel != gwc.allocatedIPAMLabel(gw) || len(gatewayAddresses(gw)) == 0) {
+		log.Debugf("Enqueueing Gateway on Update: %v/%v", gw.GetNamespace(), gw.GetName())
+		gwc.rscQueue.Add(req)
+	}
+}
+
+// enqueueRelease releases the IP address of the Gateway from the IPAM label it was allocated from, when
+// the Gateway is no longer managed or has another IPAM label. A managed Gateway whose IPAM label is
+// not known keeps its IP address
+func (gwc *K8sGatewayClient) enqueueRelease(gw *unstructured.Unstructured) {
+	allocated := gwc.allocatedIPAMLabel(gw)
+	if allocated == "" {
+		return
+	}
+	if gwc.isManagedGateway(gw) {
+		if ipamLabel := gwc.gatewayIPAMLabel(gw); ipamLabel == "" || ipamLabel == allocated {
+			return
+		}
+	}
+	if req, ok := gwc.gatewayRequest(gw, DELETE); ok {
+		log.Debugf("Enqueueing Gateway on Update: %v/%v, releasing its IP address", gw.GetNamespace(), gw.GetName())
+		gwc.rscQueue.Add(req)
+	}
+}
+
+// enqueueGatewayClass follows the GatewayClass to its ConfigMap, and processes the Gateways again
+// as their IPAM label may have changed
+func (gwc *K8sGatewayClient) enqueueGatewayClass() {
+	gwc.watchConfigMap()
+	for _, obj := range gwc.informers.list() {
+		gwc.enqueueUpdatedGateway(obj)
+	}
+}
+
+func (gwc *K8sGatewayClient) enqueueDeletedGateway(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	gw, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	if req, ok := gwc.gatewayRequest(gw, DELETE); ok {
+		log.Debugf("Enqueueing Gateway on Delete: %v/%v", gw.GetNamespace(), gw.GetName())
+		gwc.rscQueue.Add(req)
+	}
+}
+
+// processResponse writes the allocated IP address to the addresses of the status of the Gateway,
+// and removes the released IP address from them. The condition of the status tells whether the
+// allocation failed, and the annotation of the Gateway records the IPAM label of the IP address
+func (gwc *K8sGatewayClient) processResponse(resp ipamspec.IPAMResponse) {
+	metadata := resp.Request.Metadata.(GatewayMeta)
+	gw, err := gwc.dynamicClient.Resource(gatewayGVR).Namespace(metadata.namespace).Get(
+		context.TODO(), metadata.name, metaV1.GetOptions{})
+	if err != nil {
+		log.Debugf("Unable to find Gateway: %v/%v to update: %v", metadata.namespace, metadata.name, err)
+		return
+	}
+	switch resp.Request.Operation {
+	case ipamspec.CREATE:
+		// The Gateway may have changed since the request
+		req, ok := gwc.gatewayRequest(gw, CREATE)
+		if !ok || req.IPAMLabel != resp.Request.IPAMLabel {
+			return
+		}
+		condition := allocationCondition(resp, gw.GetGeneration())
+		if !resp.Status {
+			// The failure is reported once, until the Gateway changes or gets allocated
+			changed := gwc.updateStatus(gw, gatewayAddresses(gw), &condition)
+			gwc.reportAllocationFailure(gw, gatewayGVR.GroupVersion().String(), condition, changed)
+			return
+		}
+		gwc.updateStatus(gw, []interface{}{map[string]interface{}{
+			"type":  gatewayAddressType,
+			"value": resp.IPAddr,
+		}}, &condition)
+		gwc.annotateAllocatedIPAMLabel(gw, req.IPAMLabel)
+	case ipamspec.DELETE:
+		// The annotation goes first, a managed Gateway without it keeps the addresses of its IPAM label
+		if gw.GetAnnotations()[AllocatedIPAMLabelAnnotation] == resp.Request.IPAMLabel {
+			gw = gwc.annotateAllocatedIPAMLabel(gw, "")
+		}
+		var addresses []interface{}
+		for _, addr := range gatewayAddresses(gw) {
+			if value, _, _ := unstructured.NestedString(addr.(map[string]interface{}), "value"); value != resp.Request.IPAddr {
+				addresses = append(addresses, addr)
+			}
+		}
+		gwc.updateStatus(gw, addresses, nil)
+	}
+}
+
+// updateStatus writes the addresses and the condition to the status of the Gateway, the condition is
+// removed when nil. It returns whether the status changed
+func (gwc *K8sGatewayClient) updateStatus(
+	gw *unstructured.Unstructured,
+	addresses []interface{},
+	condition *metaV1.Condition,
+) bool {
+	current := gatewayConditions(gw)
+	conditions := append([]metaV1.Condition(nil), current...)
+	setAllocationCondition(&conditions, condition)
+	if equality.Semantic.DeepEqual(addresses, gatewayAddresses(gw)) && equality.Semantic.DeepEqual(conditions, current) {
+		return false
+	}
+	gw = gw.DeepCopy()
+	err := setGatewayStatus(gw, addresses, conditions)
+	if err == nil {
+		_, err = gwc.dynamicClient.Resource(gatewayGVR).Namespace(gw.GetNamespace()).UpdateStatus(
+			context.TODO(), gw, metaV1.UpdateOptions{})
+	}
+	if err != nil {
+		log.Errorf("Unable to Update Gateway: %v/%v\t Error: %v", gw.GetNamespace(), gw.GetName(), err)
+		return false
+	}
+	log.Debugf("Updated: %v/%v with Status. With Addresses: %v", gw.GetNamespace(), gw.GetName(), addresses)
+	return true
+}
+
+// setGatewayStatus sets the addresses and the conditions of the status of the Gateway
+func setGatewayStatus(gw *unstructured.Unstructured, addresses []interface{}, conditions []metaV1.Condition) error {
+	items := make([]interface{}, 0, len(conditions))
+	for i := range conditions {
+		item, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&conditions[i])
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+	for field, values := range map[string][]interface{}{"addresses": addresses, "conditions": items} {
+		if len(values) == 0 {
+			unstructured.RemoveNestedField(gw.Object, "status", field)
+		} else if err := unstructured.SetNestedSlice(gw.Object, values, "status", field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// annotateAllocatedIPAMLabel records the IPAM label of the IP address of the Gateway, and removes
+// the annotation when ipamLabel is empty. It returns the annotated Gateway
+func (gwc *K8sGatewayClient) annotateAllocatedIPAMLabel(gw *unstructured.Unstructured, ipamLabel string) *unstructured.Unstructured {
+	if gw.GetAnnotations()[AllocatedIPAMLabelAnnotation] == ipamLabel {
+		return gw
+	}
+	var value interface{}
+	if ipamLabel != "" {
+		value = ipamLabel
+	}
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{AllocatedIPAMLabelAnnotation: value},
+		},
+	})
+	patched, err := gwc.dynamicClient.Resource(gatewayGVR).Namespace(gw.GetNamespace()).Patch(
+		context.TODO(), gw.GetName(), types.MergePatchType, patch, metaV1.PatchOptions{})
+	if err != nil {
+		log.Errorf("Unable to Annotate Gateway: %v/%v\t Error: %v", gw.GetNamespace(), gw.GetName(), err)
+		return gw
+	}
+	return patched
+}
@@ -0,0 +1,213 @@
+package orchestration
+
+import (
+	"context"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Gateways", func() {
+	var kubeClient *k8sfake.Clientset
+	var dynamicClient *dynamicfake.FakeDynamicClient
+	var gwc *K8sGatewayClient
+	var stopCh chan struct{}
+	class := "f5"
+	devLabel := map[string]string{IPAMLabelAnnotation: "Dev"}
+	parametersRef := map[string]interface{}{
+		"group":     "",
+		"kind":      "ConfigMap",
+		"name":      "f5-gateway",
+		"namespace": "kube-system",
+	}
+	newConfigMap := func(ipamLabel string) *coreV1.ConfigMap {
+		return &coreV1.ConfigMap{
+			ObjectMeta: metaV1.ObjectMeta{Name: "f5-gateway", Namespace: "kube-system"},
+			Data:       map[string]string{GatewayClassIPAMLabelKey: ipamLabel},
+		}
+	}
+	withAddress := func(gw *unstructured.Unstructured, ip string) *unstructured.Unstructured {
+		Expect(unstructured.SetNestedSlice(gw.Object, []interface{}{
+			map[string]interface{}{"type": gatewayAddressType, "value": ip},
+		}, "status", "addresses")).To(Succeed())
+		return gw
+	}
+
+	// newClients creates the client of the GatewayClass with the objects, the GatewayClass and
+	// its ConfigMap are watched
+	newClients := func(params Params, gwClass *unstructured.Unstructured, objects ...runtime.Object) {
+		kubeClient = k8sfake.NewSimpleClientset(objects...)
+		dynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{
+				gatewayGVR:      "GatewayList",
+				gatewayClassGVR: "GatewayClassList",
+			})
+		_, err := dynamicClient.Resource(gatewayClassGVR).Create(context.TODO(), gwClass, metaV1.CreateOptions{})
+		Expect(err).To(BeNil())
+		params.GatewayClass = class
+		gwc = newGatewayClient(kubeClient, dynamicClient, params)
+		gwc.startGatewayClass(stopCh)
+	}
+
+	BeforeEach(func() {
+		stopCh = make(chan struct{})
+		newClients(Params{}, newGatewayClass(class, nil))
+	})
+
+	AfterEach(func() {
+		close(stopCh)
+	})
+
+	It("processes the Gateways of its GatewayClass without addresses", func() {
+		gwc.enqueueGateway(newGateway("other", "other", devLabel))
+		withAddresses := newGateway("static", class, devLabel)
+		Expect(unstructured.SetNestedSlice(withAddresses.Object, []interface{}{
+			map[string]interface{}{"type": "IPAddress", "value": "10.1.1.10"},
+		}, "spec", "addresses")).To(Succeed())
+		gwc.enqueueGateway(withAddresses)
+		// The GatewayClass has no parameters with the IPAM label
+		gwc.enqueueGateway(newGateway("nolabel", class, nil))
+		Expect(gwc.rscQueue.Len()).To(Equal(0))
+
+		gwc.enqueueGateway(newGateway("web", class, devLabel))
+		Expect(queued(&gwc.resourceClient)).To(Equal([]ipamspec.IPAMRequest{{
+			Metadata:  GatewayMeta{name: "web", namespace: "default"},
+			Operation: ipamspec.CREATE,
+			Key:       "default/web_gateway",
+			IPAMLabel: "Dev",
+		}}))
+	})
+
+	It("takes the IPAM label from the parameters of the GatewayClass", func() {
+		newClients(Params{}, newGatewayClass(class, parametersRef), newConfigMap("Test"))
+
+		gwc.enqueueGateway(newGateway("web", class, nil))
+		gwc.enqueueGateway(newGateway("dev", class, devLabel))
+		requests := queued(&gwc.resourceClient)
+		Expect(requests).To(HaveLen(2))
+		Expect(requests[0].IPAMLabel).To(Equal("Test"))
+		// The annotation of the Gateway overrides the GatewayClass
+		Expect(requests[1].IPAMLabel).To(Equal("Dev"))
+	})
+
+	It("releases and allocates again when the Gateway changes", func() {
+		old := withAddress(newGateway("web", class, map[string]string{
+			IPAMLabelAnnotation:          "Dev",
+			AllocatedIPAMLabelAnnotation: "Dev",
+		}), "10.1.1.1")
+		gwc.enqueueUpdatedGateway(old)
+		Expect(gwc.rscQueue.Len()).To(Equal(0))
+
+		cur := old.DeepCopy()
+		cur.SetAnnotations(map[string]string{IPAMLabelAnnotation: "Test", AllocatedIPAMLabelAnnotation: "Dev"})
+		gwc.enqueueUpdatedGateway(cur)
+		requests := queued(&gwc.resourceClient)
+		Expect(requests).To(HaveLen(2))
+		Expect(requests[0].Operation).To(Equal(ipamspec.DELETE))
+		Expect(requests[0].IPAMLabel).To(Equal("Dev"))
+		Expect(requests[1].Operation).To(Equal(ipamspec.CREATE))
+		Expect(requests[1].IPAMLabel).To(Equal("Test"))
+
+		cur = old.DeepCopy()
+		Expect(unstructured.SetNestedField(cur.Object, "other", "spec", "gatewayClassName")).To(Succeed())
+		gwc.enqueueUpdatedGateway(cur)
+		Expect(queued(&gwc.resourceClient)).To(ConsistOf(HaveField("Operation", ipamspec.DELETE)))
+
+		gwc.enqueueDeletedGateway(old)
+		Expect(queued(&gwc.resourceClient)).To(ConsistOf(HaveField("Operation", ipamspec.DELETE)))
+	})
+
+	It("releases from the IPAM label of the allocation when the GatewayClass changes", func() {
+		newClients(Params{}, newGatewayClass(class, parametersRef), newConfigMap("Test"))
+		gw := withAddress(newGateway("web", class, map[string]string{AllocatedIPAMLabelAnnotation: "Test"}), "10.1.1.1")
+		_, err := dynamicClient.Resource(gatewayGVR).Namespace("default").Create(context.TODO(), gw, metaV1.CreateOptions{})
+		Expect(err).To(BeNil())
+		gwc.informers.start(stopCh)
+		Eventually(queued).WithArguments(&gwc.resourceClient).Should(ConsistOf(HaveField("Operation", ipamspec.CREATE)))
+
+		_, err = kubeClient.CoreV1().ConfigMaps("kube-system").Update(context.TODO(), newConfigMap("Prod"), metaV1.UpdateOptions{})
+		Expect(err).To(BeNil())
+		Eventually(queued).WithArguments(&gwc.resourceClient).Should(Equal([]ipamspec.IPAMRequest{
+			{
+				Metadata:  GatewayMeta{name: "web", namespace: "default"},
+				Operation: ipamspec.DELETE,
+				Key:       "default/web_gateway",
+				IPAMLabel: "Test",
+			},
+			{
+				Metadata:  GatewayMeta{name: "web", namespace: "default"},
+				Operation: ipamspec.CREATE,
+				Key:       "default/web_gateway",
+				IPAMLabel: "Prod",
+			},
+		}))
+	})
+
+	It("watches the Gateways of the namespaces of the namespace label", func() {
+		ipamLabel := map[string]string{"ipam": "true"}
+		newClients(Params{NamespaceLabel: "ipam=true"}, newGatewayClass(class, nil),
+			newNamespace("prod", ipamLabel), newNamespace("dev", nil))
+		for _, namespace := range []string{"prod", "dev"} {
+			gw := newGateway("web", class, devLabel)
+			gw.SetNamespace(namespace)
+			_, err := dynamicClient.Resource(gatewayGVR).Namespace(namespace).Create(context.TODO(), gw, metaV1.CreateOptions{})
+			Expect(err).To(BeNil())
+		}
+		gwc.informers.start(stopCh)
+		Eventually(queued).WithArguments(&gwc.resourceClient).Should(ConsistOf(HaveField("Key", "prod/web_gateway")))
+
+		// The namespaces are watched as they get labelled
+		_, err := kubeClient.CoreV1().Namespaces().Update(context.TODO(), newNamespace("dev", ipamLabel), metaV1.UpdateOptions{})
+		Expect(err).To(BeNil())
+		Eventually(queued).WithArguments(&gwc.resourceClient).Should(ConsistOf(HaveField("Key", "dev/web_gateway")))
+	})
+
+	It("writes the IP address to the addresses of the Gateway", func() {
+		gw := newGateway("web", class, devLabel)
+		gateways := dynamicClient.Resource(gatewayGVR).Namespace("default")
+		_, err := gateways.Create(context.TODO(), gw, metaV1.CreateOptions{})
+		Expect(err).To(BeNil())
+		req, _ := gwc.gatewayRequest(gw, CREATE)
+		// The failure is reported once
+		gwc.processResponse(ipamspec.IPAMResponse{Request: req, Status: false})
+		gwc.processResponse(ipamspec.IPAMResponse{Request: req, Status: false})
+		gw, err = gateways.Get(context.TODO(), "web", metaV1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(gatewayConditions(gw)).To(ConsistOf(And(
+			HaveField("Type", IPAllocatedCondition),
+			HaveField("Status", metaV1.ConditionFalse),
+			HaveField("Message", "Unable to allocate an IP address from IPAM label Dev"),
+		)))
+		events, err := kubeClient.CoreV1().Events("default").List(context.TODO(), metaV1.ListOptions{})
+		Expect(err).To(BeNil())
+		Expect(events.Items).To(ConsistOf(And(
+			HaveField("InvolvedObject.Kind", "Gateway"),
+			HaveField("Reason", "AllocationFailed"),
+		)))
+
+		gwc.processResponse(ipamspec.IPAMResponse{Request: req, IPAddr: "10.1.1.1", Status: true})
+		gw, err = gateways.Get(context.TODO(), "web", metaV1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(gatewayAddresses(gw)).To(Equal([]interface{}{
+			map[string]interface{}{"type": "IPAddress", "value": "10.1.1.1"},
+		}))
+		Expect(gatewayConditions(gw)).To(ConsistOf(HaveField("Status", metaV1.ConditionTrue)))
+		Expect(gw.GetAnnotations()).To(HaveKeyWithValue(AllocatedIPAMLabelAnnotation, "Dev"))
+
+		req.Operation = ipamspec.DELETE
+		req.IPAddr = "10.1.1.1"
+		gwc.processResponse(ipamspec.IPAMResponse{Request: req, Status: true})
+		gw, _ = gateways.Get(context.TODO(), "web", metaV1.GetOptions{})
+		Expect(gatewayAddresses(gw)).To(BeEmpty())
+		Expect(gatewayConditions(gw)).To(BeEmpty())
+		Expect(gw.GetAnnotations()).NotTo(HaveKey(AllocatedIPAMLabelAnnotation))
+	})
+})
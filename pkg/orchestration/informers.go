@@ -0,0 +1,186 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package orchestration
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreInfV1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// namespacedInformers keeps an informer of a kind of resources in each watched namespace. With a
+// namespace label, the informers follow the namespaces of the label as they are created, labelled
+// or deleted, as the IPAM resources do
+type namespacedInformers struct {
+	// kind of the resources, for the logs
+	kind        string
+	newInformer func(namespace string) cache.SharedIndexInformer
+	nsInformer  cache.SharedIndexInformer
+
+	// informersLock guards informers and started, as namespaces come and
+	// go while the informers run
+	informersLock sync.Mutex
+	informers     map[string]*namespacedInformer
+	started       bool
+}
+
+type namespacedInformer struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+}
+
+// newNamespacedInformers returns the informers of the namespaces that get added, newInformer creates them
+func newNamespacedInformers(kind string, newInformer func(namespace string) cache.SharedIndexInformer) *namespacedInformers {
+	return &namespacedInformers{
+		kind:        kind,
+		newInformer: newInformer,
+		informers:   make(map[string]*namespacedInformer),
+	}
+}
+
+// watchNamespaces adds the informers of the namespaces of the params, the informer of all namespaces
+// unless namespaces or a namespace label are given
+func (nsi *namespacedInformers) watchNamespaces(kubeClient kubernetes.Interface, params Params) {
+	if params.NamespaceLabel != "" {
+		nsi.nsInformer = coreInfV1.NewFilteredNamespaceInformer(kubeClient, 0*time.Second, cache.Indexers{},
+			func(options *metaV1.ListOptions) { options.LabelSelector = params.NamespaceLabel })
+		nsi.nsInformer.AddEventHandler(&cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { nsi.addNamespace(obj) },
+			DeleteFunc: func(obj interface{}) { nsi.removeNamespace(obj) },
+		})
+		return
+	}
+	namespaces := params.Namespaces
+	if params.WatchAllNamespaces || len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	for _, namespace := range namespaces {
+		nsi.add(namespace)
+	}
+}
+
+// start runs the informers until stopCh is closed, and waits for their caches
+func (nsi *namespacedInformers) start(stopCh <-chan struct{}) {
+	if nsi.nsInformer != nil {
+		go nsi.nsInformer.Run(stopCh)
+		cache.WaitForNamedCacheSync("F5 IPAMClient "+nsi.kind+" Namespace Controller", stopCh,
+			nsi.nsInformer.HasSynced)
+	}
+	nsi.informersLock.Lock()
+	var cacheSyncs []cache.InformerSynced
+	for _, nsInf := range nsi.informers {
+		go nsInf.informer.Run(nsInf.stopCh)
+		cacheSyncs = append(cacheSyncs, nsInf.informer.HasSynced)
+	}
+	nsi.started = true
+	nsi.informersLock.Unlock()
+
+	go func() {
+		<-stopCh
+		nsi.informersLock.Lock()
+		defer nsi.informersLock.Unlock()
+		for _, nsInf := range nsi.informers {
+			close(nsInf.stopCh)
+		}
+		nsi.started = false
+	}()
+	cache.WaitForNamedCacheSync("F5 IPAMClient "+nsi.kind+" Controller", stopCh, cacheSyncs...)
+}
+
+func (nsi *namespacedInformers) add(namespace string) {
+	nsi.informersLock.Lock()
+	defer nsi.informersLock.Unlock()
+
+	if _, found := nsi.informers[namespace]; found {
+		return
+	}
+	log.Debugf("[ipam] Creating %v Informer for Namespace %v", nsi.kind, namespace)
+	nsInf := &namespacedInformer{
+		informer: nsi.newInformer(namespace),
+		stopCh:   make(chan struct{}),
+	}
+	nsi.informers[namespace] = nsInf
+	// Informers added after the informers have started are started right away,
+	// the rest are started along with them
+	if nsi.started {
+		go nsInf.informer.Run(nsInf.stopCh)
+	}
+}
+
+func (nsi *namespacedInformers) remove(namespace string) {
+	nsi.informersLock.Lock()
+	defer nsi.informersLock.Unlock()
+
+	nsInf, found := nsi.informers[namespace]
+	if !found {
+		return
+	}
+	log.Debugf("[ipam] Removing %v Informer for Namespace %v", nsi.kind, namespace)
+	if nsi.started {
+		close(nsInf.stopCh)
+	}
+	delete(nsi.informers, namespace)
+}
+
+// get returns the store of the resources of the namespace, nil when the namespace is not watched
+func (nsi *namespacedInformers) get(namespace string) cache.Store {
+	nsi.informersLock.Lock()
+	defer nsi.informersLock.Unlock()
+
+	nsInf, found := nsi.informers[namespace]
+	if !found {
+		return nil
+	}
+	return nsInf.informer.GetStore()
+}
+
+// list returns the resources of all the watched namespaces
+func (nsi *namespacedInformers) list() []interface{} {
+	nsi.informersLock.Lock()
+	defer nsi.informersLock.Unlock()
+
+	var objs []interface{}
+	for _, nsInf := range nsi.informers {
+		objs = append(objs, nsInf.informer.GetStore().List()...)
+	}
+	return objs
+}
+
+// addNamespace starts watching the resources of a namespace that got created or labelled to
+// match the namespace label
+func (nsi *namespacedInformers) addNamespace(obj interface{}) {
+	if ns, ok := obj.(*coreV1.Namespace); ok {
+		nsi.add(ns.Name)
+	}
+}
+
+// removeNamespace stops watching the resources of a namespace that got deleted or no longer
+// matches the namespace label. The IP addresses of its resources are left allocated
+func (nsi *namespacedInformers) removeNamespace(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if ns, ok := obj.(*coreV1.Namespace); ok {
+		nsi.remove(ns.Name)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	ficV1 "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/apis/fic/v1"
 	"github.com/F5Networks/f5-ipam-controller/pkg/ipammachinery"
 	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	extClient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 
@@ -43,6 +44,9 @@ type K8sIPAMClient struct {
 	reqChan chan<- ipamspec.IPAMRequest
 	// Channel for receiving responce from controller
 	respChan <-chan ipamspec.IPAMResponse
+
+	// controllerClass of the IPAM resources that this client reconciles
+	controllerClass string
 }
 
 const (
@@ -57,6 +61,8 @@ type rqKey struct {
 	rsc       *ficV1.IPAM
 	oldRsc    *ficV1.IPAM
 	Operation string
+	// disowned is set on the deletion of a resource that moved to another controller class
+	disowned bool
 }
 
 type specMap map[ficV1.HostSpec]bool
@@ -65,9 +71,22 @@ type statusMap map[ficV1.IPSpec]bool
 type ResourceMeta struct {
 	name      string
 	namespace string
+	// disowned requests release the IP addresses of a resource that moved to another
+	// controller class, its status belongs to the other controller and is left alone
+	disowned bool
+}
+
+// GetName returns the name of the IPAM resource
+func (rm ResourceMeta) GetName() string {
+	return rm.name
 }
 
-func NewIPAMK8SClient(namespaces []string) *K8sIPAMClient {
+// GetNamespace returns the namespace of the IPAM resource
+func (rm ResourceMeta) GetNamespace() string {
+	return rm.namespace
+}
+
+func NewIPAMK8SClient(params Params) *K8sIPAMClient {
 	log.Debugf("Creating IPAM Kubernetes Client")
 	config, err := rest.InClusterConfig()
 	if err != nil {
@@ -75,9 +94,17 @@ func NewIPAMK8SClient(namespaces []string) *K8sIPAMClient {
 		return nil
 	}
 
+	if params.ManageCRD {
+		if err = registerIPAMCRD(config); err != nil {
+			log.Errorf("[IPAM] Unable to register CRD: %v", err)
+			return nil
+		}
+	}
+
 	k8sIPAMClient := &K8sIPAMClient{
 		rscQueue: workqueue.NewNamedRateLimitingQueue(
 			workqueue.DefaultControllerRateLimiter(), "ipam-controller"),
+		controllerClass: params.ControllerClass,
 	}
 
 	eventHandlers := &cache.ResourceEventHandlerFuncs{
@@ -85,13 +112,19 @@ func NewIPAMK8SClient(namespaces []string) *K8sIPAMClient {
 		UpdateFunc: func(oldObj, newObj interface{}) { k8sIPAMClient.enqueueUpdatedIPAM(oldObj, newObj) },
 		DeleteFunc: func(obj interface{}) { k8sIPAMClient.enqueueDeletedIPAM(obj) },
 	}
-	if len(namespaces) == 0 {
+	namespaces := params.Namespaces
+	if params.WatchAllNamespaces {
+		// An empty namespace makes the informer watch all namespaces
+		namespaces = []string{""}
+	} else if len(namespaces) == 0 && params.NamespaceLabel == "" {
 		namespaces = append(namespaces, DefaultNamespace)
 	}
 	ipamParams := ipammachinery.Params{
-		Config:        config,
-		EventHandlers: eventHandlers,
-		Namespaces:    namespaces,
+		Config:         config,
+		EventHandlers:  eventHandlers,
+		Namespaces:     namespaces,
+		NamespaceLabel: params.NamespaceLabel,
+		LabelSelector:  params.LabelSelector,
 	}
 
 	ipamCli := ipammachinery.NewIPAMClient(ipamParams)
@@ -100,8 +133,6 @@ func NewIPAMK8SClient(namespaces []string) *K8sIPAMClient {
 		return nil
 	}
 	k8sIPAMClient.ipamCli = ipamCli
-	//k8sIPAMClient.registerIPAMCRD(config)
-	//k8sIPAMClient.createIPAMResource()
 	return k8sIPAMClient
 }
 
@@ -114,41 +145,14 @@ func (k8sc *K8sIPAMClient) SetupCommunicationChannels(
 	k8sc.respChan = respChan
 }
 
-//
-//func (k8sc *K8sIPAMClient) registerIPAMCRD(confg *rest.Config) {
-//
-//	regClint, err := clientset.NewForConfig(confg)
-//	if err != nil {
-//		log.Debugf("[IPAM] error while Creating reg Client %v", err)
-//		return
-//	}
-//
-//	err = ipammachinery.RegisterCRD(regClint)
-//	if err != nil {
-//		log.Debugf("[IPAM] error while registering CRD %v", err)
-//	}
-//}
-//
-////Create IPAM CRD
-//func (k8sc *K8sIPAMClient) createIPAMResource() error {
-//
-//	crName := "sample.ipam"
-//	f5ipam := &ficV1.F5IPAM{
-//		ObjectMeta: metaV1.ObjectMeta{
-//			Name: crName,
-//		},
-//		Spec:   ficV1.F5IPAMSpec{},
-//		Status: ficV1.F5IPAMStatus{},
-//	}
-//	// f5ipam.SetResourceVersion(obj.ResourceVersion)
-//	ipamCR, err := k8sc.ipamCli.Create("kube-system", f5ipam)
-//	if err != nil {
-//		log.Errorf("[ipam] error while creating the CRD object %v\n", err)
-//		return err
-//	}
-//	log.Debugf("[ipam] Created IPAM Custom Resource: \n%v\n", ipamCR)
-//	return nil
-//}
+// registerIPAMCRD creates the IPAM CRD or updates its schema in place
+func registerIPAMCRD(config *rest.Config) error {
+	regClient, err := extClient.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	return ipammachinery.RegisterCRD(regClient)
+}
 
 // Start method runs the Orchestrator, watching for resources
 func (k8sc *K8sIPAMClient) Start(stopCh <-chan struct{}) {
@@ -163,7 +167,25 @@ func (k8sc *K8sIPAMClient) Stop() {
 	k8sc.ipamCli.Stop()
 }
 
+// ownsRequest checks whether the request is of an IPAM resource
+func (k8sc *K8sIPAMClient) ownsRequest(req ipamspec.IPAMRequest) bool {
+	_, ok := req.Metadata.(ResourceMeta)
+	return ok
+}
+
+// isManagedIPAM checks whether the IPAM resource belongs to the controller class
+// of this client, resources of other classes are left alone
+func (k8sc *K8sIPAMClient) isManagedIPAM(ipam *ficV1.IPAM) bool {
+	return ipam.Spec.ControllerClass == k8sc.controllerClass
+}
+
 func (k8sc *K8sIPAMClient) enqueueIPAM(obj interface{}) {
+	ipam := obj.(*ficV1.IPAM)
+	if !k8sc.isManagedIPAM(ipam) {
+		log.Debugf("Skipping IPAM: %v/%v of controller class: %v",
+			ipam.Namespace, ipam.Name, ipam.Spec.ControllerClass)
+		return
+	}
 
 	key := &rqKey{
 		rsc:       obj.(*ficV1.IPAM),
@@ -176,9 +198,33 @@ func (k8sc *K8sIPAMClient) enqueueIPAM(obj interface{}) {
 }
 
 func (k8sc *K8sIPAMClient) enqueueUpdatedIPAM(old, cur interface{}) {
+	curIPAM := cur.(*ficV1.IPAM)
+	oldIPAM := old.(*ficV1.IPAM)
+	if !k8sc.isManagedIPAM(curIPAM) {
+		if k8sc.isManagedIPAM(oldIPAM) {
+			// Resource moved to another controller class, release its IP addresses
+			key := &rqKey{
+				rsc:       oldIPAM,
+				Operation: DELETE,
+				disowned:  true,
+			}
+			log.Debugf("Enqueueing on Controller Class change: %v/%v", oldIPAM.Namespace, oldIPAM.Name)
+			k8sc.rscQueue.Add(key)
+			return
+		}
+		log.Debugf("Skipping IPAM: %v/%v of controller class: %v",
+			curIPAM.Namespace, curIPAM.Name, curIPAM.Spec.ControllerClass)
+		return
+	}
+	if !k8sc.isManagedIPAM(oldIPAM) {
+		// Resource moved into this controller class
+		k8sc.enqueueIPAM(cur)
+		return
+	}
+
 	key := &rqKey{
-		rsc:       cur.(*ficV1.IPAM),
-		oldRsc:    old.(*ficV1.IPAM),
+		rsc:       curIPAM,
+		oldRsc:    oldIPAM,
 		Operation: UPDATE,
 	}
 	log.Debugf("Enqueueing on Update: %v/%v", key.rsc.Namespace, key.rsc.Name)
@@ -187,8 +233,15 @@ func (k8sc *K8sIPAMClient) enqueueUpdatedIPAM(old, cur interface{}) {
 }
 
 func (k8sc *K8sIPAMClient) enqueueDeletedIPAM(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	ipam, ok := obj.(*ficV1.IPAM)
+	if !ok || !k8sc.isManagedIPAM(ipam) {
+		return
+	}
 	key := &rqKey{
-		rsc:       obj.(*ficV1.IPAM),
+		rsc:       ipam,
 		oldRsc:    nil,
 		Operation: DELETE,
 	}
@@ -269,7 +322,11 @@ func (k8sc *K8sIPAMClient) processResource() bool {
 		// wait for max retry time(12 seconds) to check if delete operation is followed by create
 		// if IPAM resource is found in max retry time, then delete operation will be skipped
 		// if IPAM resource is not found in max retry time, then delete operation will be processed
+		// A resource that moved to another controller class still exists, so skip the wait
 		maxRetries := 3
+		if rKey.disowned {
+			maxRetries = 0
+		}
 		retry := 0
 		for retry < maxRetries {
 			time.Sleep(4 * time.Second)
@@ -288,7 +345,7 @@ func (k8sc *K8sIPAMClient) processResource() bool {
 				rKey.rsc.Namespace, rKey.rsc.Name)
 		} else {
 			for _, ipam := range ipams {
-				if ipam.Name == rKey.rsc.Name {
+				if ipam.Name == rKey.rsc.Name || !k8sc.isManagedIPAM(&ipam) {
 					continue
 				}
 				for _, ipStatus := range ipam.Status.IPStatus {
@@ -304,6 +361,7 @@ func (k8sc *K8sIPAMClient) processResource() bool {
 				Metadata: ResourceMeta{
 					name:      rKey.rsc.Name,
 					namespace: rKey.rsc.Namespace,
+					disowned:  rKey.disowned,
 				},
 				HostName:  ipStatus.Host,
 				IPAMLabel: ipStatus.IPAMLabel,
@@ -417,6 +475,11 @@ func (k8sc *K8sIPAMClient) processResponse() bool {
 		case ipamspec.DELETE:
 			if resp.Status || removeStatusEntry {
 				metadata := resp.Request.Metadata.(ResourceMeta)
+				if metadata.disowned {
+					log.Debugf("Released %v of: %v/%v, that moved to another controller class",
+						resp.Request.String(), metadata.namespace, metadata.name)
+					break
+				}
 				ipamRsc, err := k8sc.ipamCli.Get(metadata.namespace, metadata.name)
 				if err != nil {
 					log.Errorf("Unable to find IPAM: %v/%v to update", metadata.namespace, metadata.name)
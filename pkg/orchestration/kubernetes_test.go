@@ -0,0 +1,132 @@
+package orchestration
+
+import (
+	"testing"
+
+	ficV1 "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/apis/fic/v1"
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestOrchestration(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Orchestration Suite")
+}
+
+func newIPAM(name, class string) *ficV1.IPAM {
+	return &ficV1.IPAM{
+		ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: ficV1.IPAMSpec{
+			HostSpecs:       []*ficV1.HostSpec{{Host: "foo.com", IPAMLabel: "Dev"}},
+			ControllerClass: class,
+		},
+	}
+}
+
+// newService returns a Service of type LoadBalancer of the default namespace
+func newService(name string, class *string, annotations map[string]string) *coreV1.Service {
+	return &coreV1.Service{
+		ObjectMeta: newObjectMeta(name, annotations),
+		Spec: coreV1.ServiceSpec{
+			Type:              coreV1.ServiceTypeLoadBalancer,
+			LoadBalancerClass: class,
+		},
+	}
+}
+
+// newGateway returns a Gateway of the GatewayClass className of the default namespace
+func newGateway(name, className string, annotations map[string]string) *unstructured.Unstructured {
+	return newGatewayAPIObject("Gateway", newObjectMeta(name, annotations), map[string]interface{}{
+		"gatewayClassName": className,
+	})
+}
+
+// newGatewayClass returns a GatewayClass, with the parametersRef when it is not nil
+func newGatewayClass(name string, parametersRef map[string]interface{}) *unstructured.Unstructured {
+	spec := map[string]interface{}{"controllerName": "f5.com/gateway"}
+	if parametersRef != nil {
+		spec["parametersRef"] = parametersRef
+	}
+	return newGatewayAPIObject("GatewayClass", metaV1.ObjectMeta{Name: name}, spec)
+}
+
+func newGatewayAPIObject(kind string, objectMeta metaV1.ObjectMeta, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       kind,
+		"spec":       spec,
+	}}
+	obj.SetName(objectMeta.Name)
+	obj.SetNamespace(objectMeta.Namespace)
+	obj.SetAnnotations(objectMeta.Annotations)
+	return obj
+}
+
+func newObjectMeta(name string, annotations map[string]string) metaV1.ObjectMeta {
+	return metaV1.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations}
+}
+
+// newNamespace returns a namespace with the labels
+func newNamespace(name string, labels map[string]string) *coreV1.Namespace {
+	return &coreV1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+// queued takes the requests out of the queue of the client
+func queued(rc *resourceClient) []ipamspec.IPAMRequest {
+	var requests []ipamspec.IPAMRequest
+	for rc.rscQueue.Len() > 0 {
+		item, _ := rc.rscQueue.Get()
+		rc.rscQueue.Done(item)
+		requests = append(requests, item.(ipamspec.IPAMRequest))
+	}
+	return requests
+}
+
+var _ = Describe("Controller Class", func() {
+	var k8sc *K8sIPAMClient
+
+	BeforeEach(func() {
+		k8sc = &K8sIPAMClient{
+			rscQueue: workqueue.NewNamedRateLimitingQueue(
+				workqueue.DefaultControllerRateLimiter(), "ipam-controller-test"),
+			controllerClass: "lab",
+		}
+	})
+
+	It("processes only the resources of its class", func() {
+		k8sc.enqueueIPAM(newIPAM("prod", ""))
+		k8sc.enqueueIPAM(newIPAM("other", "prod"))
+		Expect(k8sc.rscQueue.Len()).To(Equal(0))
+		k8sc.enqueueIPAM(newIPAM("lab", "lab"))
+		Expect(k8sc.rscQueue.Len()).To(Equal(1))
+	})
+
+	It("leaves foreign resources alone on update and delete", func() {
+		k8sc.enqueueUpdatedIPAM(newIPAM("ipam", "other"), newIPAM("ipam", "prod"))
+		k8sc.enqueueDeletedIPAM(newIPAM("ipam", "prod"))
+		Expect(k8sc.rscQueue.Len()).To(Equal(0))
+	})
+
+	It("releases resources that move out of its class", func() {
+		oldIPAM := newIPAM("ipam", "lab")
+		oldIPAM.Status.IPStatus = []*ficV1.IPSpec{{Host: "foo.com", IPAMLabel: "Dev", IP: "10.1.1.1"}}
+		k8sc.enqueueUpdatedIPAM(oldIPAM, newIPAM("ipam", "prod"))
+		Expect(k8sc.rscQueue.Len()).To(Equal(1))
+		key, _ := k8sc.rscQueue.Get()
+		Expect(key.(*rqKey).Operation).To(Equal(DELETE))
+		Expect(key.(*rqKey).disowned).To(BeTrue())
+		Expect(key.(*rqKey).rsc).To(BeIdenticalTo(oldIPAM))
+	})
+
+	It("creates resources that move into its class", func() {
+		k8sc.enqueueUpdatedIPAM(newIPAM("ipam", "prod"), newIPAM("ipam", "lab"))
+		Expect(k8sc.rscQueue.Len()).To(Equal(1))
+		key, _ := k8sc.rscQueue.Get()
+		Expect(key.(*rqKey).Operation).To(Equal(CREATE))
+	})
+})
@@ -18,6 +18,16 @@ package orchestration
 
 import (
 	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+const (
+	// ModeIPAM allocates the IP addresses of the IPAM resources
+	ModeIPAM = "ipam"
+	// ModeService allocates the IP addresses of the Services of type LoadBalancer
+	ModeService = "service"
+	// ModeGateway allocates the IP addresses of the Gateways of the Gateway API
+	ModeGateway = "gateway"
 )
 
 type Orchestrator interface {
@@ -30,6 +40,117 @@ type Orchestrator interface {
 	Stop()
 }
 
-func NewOrchestrator(namespaces []string) Orchestrator {
-	return NewIPAMK8SClient(namespaces)
+// Params defines the parameters of the Orchestrator
+type Params struct {
+	// Namespaces to watch, defaults to kube-system
+	Namespaces []string
+	// WatchAllNamespaces watches IPAM resources in every namespace
+	WatchAllNamespaces bool
+	// NamespaceLabel watches the namespaces that match the label selector,
+	// namespaces are added and removed as they are created, labelled or deleted
+	NamespaceLabel string
+	// ControllerClass processes only the IPAM resources of this class
+	ControllerClass string
+	// LabelSelector processes only the IPAM resources matching the selector
+	LabelSelector string
+	// ManageCRD creates the IPAM CRD and upgrades its schema in place
+	ManageCRD bool
+	// Modes are the orchestrators to run, defaults to ipam
+	Modes []string
+	// LoadBalancerClass processes the Services of this class, when empty the Services
+	// without class that have the IPAM label annotation
+	LoadBalancerClass string
+	// GatewayClass processes the Gateways of this GatewayClass
+	GatewayClass string
+}
+
+// requestOwner is implemented by the orchestrators that run along with others,
+// to receive the responses of their requests
+type requestOwner interface {
+	ownsRequest(req ipamspec.IPAMRequest) bool
+}
+
+// NewOrchestrator returns the orchestrator of the modes, nil when one of them can not be created
+func NewOrchestrator(params Params) Orchestrator {
+	modes := params.Modes
+	if len(modes) == 0 {
+		modes = []string{ModeIPAM}
+	}
+	var orchestrators []Orchestrator
+	for _, mode := range modes {
+		switch mode {
+		case ModeIPAM:
+			ipamCli := NewIPAMK8SClient(params)
+			if ipamCli == nil {
+				return nil
+			}
+			orchestrators = append(orchestrators, ipamCli)
+		case ModeService:
+			svcCli := NewServiceK8SClient(params)
+			if svcCli == nil {
+				return nil
+			}
+			orchestrators = append(orchestrators, svcCli)
+		case ModeGateway:
+			gwCli := NewGatewayK8SClient(params)
+			if gwCli == nil {
+				return nil
+			}
+			orchestrators = append(orchestrators, gwCli)
+		default:
+			log.Errorf("[IPAM] Unknown orchestration mode: %v", mode)
+			return nil
+		}
+	}
+	if len(orchestrators) == 1 {
+		return orchestrators[0]
+	}
+	return &multiOrchestrator{orchestrators: orchestrators}
+}
+
+// multiOrchestrator runs several orchestrators with one controller, the requests of all of
+// them go to the controller and each response goes back to the orchestrator of its request
+type multiOrchestrator struct {
+	orchestrators []Orchestrator
+	respChan      <-chan ipamspec.IPAMResponse
+	respChans     []chan ipamspec.IPAMResponse
+}
+
+// SetupCommunicationChannels sets Request and Response channels
+func (mo *multiOrchestrator) SetupCommunicationChannels(
+	reqChan chan<- ipamspec.IPAMRequest,
+	respChan <-chan ipamspec.IPAMResponse,
+) {
+	mo.respChan = respChan
+	mo.respChans = nil
+	for _, orc := range mo.orchestrators {
+		orcRespChan := make(chan ipamspec.IPAMResponse)
+		orc.SetupCommunicationChannels(reqChan, orcRespChan)
+		mo.respChans = append(mo.respChans, orcRespChan)
+	}
+}
+
+// Start starts the orchestrators and dispatches the responses
+func (mo *multiOrchestrator) Start(stopCh <-chan struct{}) {
+	for _, orc := range mo.orchestrators {
+		orc.Start(stopCh)
+	}
+	go mo.dispatchResponses()
+}
+
+func (mo *multiOrchestrator) dispatchResponses() {
+	for resp := range mo.respChan {
+		for i, orc := range mo.orchestrators {
+			if owner, ok := orc.(requestOwner); ok && owner.ownsRequest(resp.Request) {
+				mo.respChans[i] <- resp
+				break
+			}
+		}
+	}
+}
+
+func (mo *multiOrchestrator) Stop() {
+	for _, orc := range mo.orchestrators {
+		orc.Stop()
+	}
 }
@@ -0,0 +1,163 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package orchestration
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// IPAMLabelAnnotation is the annotation of the Services and Gateways with the IPAM label to allocate from
+	IPAMLabelAnnotation = "fic.f5.com/ipam-label"
+	// IPAllocatedCondition is the condition of the status of the Services and Gateways that tells
+	// whether their IP address is allocated
+	IPAllocatedCondition = "fic.f5.com/IPAllocated"
+)
+
+// resourceClient sends the requests of the Kubernetes resources of a kind to the controller, and
+// hands the responses to the orchestrator of the kind
+type resourceClient struct {
+	kubeClient kubernetes.Interface
+	// kind of the resources, for the logs and the events
+	kind      string
+	informers *namespacedInformers
+	// Queue of the requests of the resources
+	rscQueue workqueue.RateLimitingInterface
+
+	// Channel for sending request to controller
+	reqChan chan<- ipamspec.IPAMRequest
+	// Channel for receiving responce from controller
+	respChan <-chan ipamspec.IPAMResponse
+}
+
+func newResourceClient(kubeClient kubernetes.Interface, kind, queueName string) resourceClient {
+	return resourceClient{
+		kubeClient: kubeClient,
+		kind:       kind,
+		rscQueue: workqueue.NewNamedRateLimitingQueue(
+			workqueue.DefaultControllerRateLimiter(), queueName),
+	}
+}
+
+// SetupCommunicationChannels sets Request and Response channels
+func (rc *resourceClient) SetupCommunicationChannels(
+	reqChan chan<- ipamspec.IPAMRequest,
+	respChan <-chan ipamspec.IPAMResponse,
+) {
+	rc.reqChan = reqChan
+	rc.respChan = respChan
+}
+
+func (rc *resourceClient) Stop() {
+	rc.rscQueue.ShutDown()
+}
+
+// run watches the resources and sends their requests to the controller, processResponse
+// handles the responses
+func (rc *resourceClient) run(stopCh <-chan struct{}, processResponse func(ipamspec.IPAMResponse)) {
+	rc.informers.start(stopCh)
+	go wait.Until(rc.requestWorker, time.Second, stopCh)
+	go wait.Until(func() { rc.responseWorker(processResponse) }, time.Second, stopCh)
+
+	log.Debugf("K8S %v Orchestrator Started", rc.kind)
+}
+
+// requestWorker sends the requests of the resources to the controller
+func (rc *resourceClient) requestWorker() {
+	log.Debugf("Starting %v Worker", rc.kind)
+	for rc.processRequest() {
+	}
+}
+
+func (rc *resourceClient) responseWorker(processResponse func(ipamspec.IPAMResponse)) {
+	log.Debugf("Starting %v Response Worker", rc.kind)
+	for resp := range rc.respChan {
+		processResponse(resp)
+	}
+}
+
+func (rc *resourceClient) processRequest() bool {
+	item, quit := rc.rscQueue.Get()
+	if quit {
+		return false
+	}
+	defer rc.rscQueue.Done(item)
+	rc.reqChan <- item.(ipamspec.IPAMRequest)
+	return true
+}
+
+// allocationCondition returns the condition of the response of an allocation for the generation
+// of the resource
+func allocationCondition(resp ipamspec.IPAMResponse, generation int64) metaV1.Condition {
+	req := resp.Request
+	if !resp.Status {
+		message := fmt.Sprintf("Unable to allocate an IP address from IPAM label %v", req.IPAMLabel)
+		if req.IPAddr != "" {
+			message = fmt.Sprintf("Unable to allocate IP address %v from IPAM label %v", req.IPAddr, req.IPAMLabel)
+		}
+		return metaV1.Condition{
+			Type:               IPAllocatedCondition,
+			Status:             metaV1.ConditionFalse,
+			ObservedGeneration: generation,
+			Reason:             "AllocationFailed",
+			Message:            message,
+		}
+	}
+	return metaV1.Condition{
+		Type:               IPAllocatedCondition,
+		Status:             metaV1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             "Allocated",
+		Message:            fmt.Sprintf("Allocated IP address %v from IPAM label %v", resp.IPAddr, req.IPAMLabel),
+	}
+}
+
+// setAllocationCondition sets the condition in the conditions, and removes the condition of the
+// allocation when it is nil
+func setAllocationCondition(conditions *[]metaV1.Condition, condition *metaV1.Condition) {
+	if condition != nil {
+		meta.SetStatusCondition(conditions, *condition)
+	} else {
+		meta.RemoveStatusCondition(conditions, IPAllocatedCondition)
+	}
+}
+
+// reportAllocationFailure logs the failed allocation of the condition, and reports it with a
+// Warning event on the resource when its status changed
+func (rc *resourceClient) reportAllocationFailure(obj metaV1.Object, apiVersion string, condition metaV1.Condition, changed bool) {
+	log.Errorf("[IPAM] %v for %v: %v/%v", condition.Message, rc.kind, obj.GetNamespace(), obj.GetName())
+	if !changed {
+		return
+	}
+	reportEvent(rc.kubeClient.CoreV1(), coreV1.ObjectReference{
+		Kind:       rc.kind,
+		APIVersion: apiVersion,
+		Name:       obj.GetName(),
+		Namespace:  obj.GetNamespace(),
+		UID:        obj.GetUID(),
+	}, EventTypeWarning, condition.Reason, condition.Message)
+}
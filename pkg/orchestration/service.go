@@ -0,0 +1,248 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package orchestration
+
+import (
+	"context"
+	"time"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreInfV1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// K8sServiceClient allocates the IP addresses of the Services of type LoadBalancer
+type K8sServiceClient struct {
+	resourceClient
+
+	// loadBalancerClass of the Services that this client allocates for, when empty the
+	// Services without class that have the IPAM label annotation
+	loadBalancerClass string
+}
+
+// ServiceMeta identifies the Service of a request
+type ServiceMeta struct {
+	name      string
+	namespace string
+}
+
+// GetName returns the name of the Service
+func (sm ServiceMeta) GetName() string {
+	return sm.name
+}
+
+// GetNamespace returns the namespace of the Service
+func (sm ServiceMeta) GetNamespace() string {
+	return sm.namespace
+}
+
+func NewServiceK8SClient(params Params) *K8sServiceClient {
+	log.Debugf("Creating Service Kubernetes Client")
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		log.Errorf("[IPAM] Error creating configuration: %v", err)
+		return nil
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Errorf("[IPAM] Unable to create Kubernetes client: %v", err)
+		return nil
+	}
+	return newServiceClient(kubeClient, params)
+}
+
+func newServiceClient(kubeClient kubernetes.Interface, params Params) *K8sServiceClient {
+	svcc := &K8sServiceClient{
+		resourceClient:    newResourceClient(kubeClient, "Service", "ipam-controller-services"),
+		loadBalancerClass: params.LoadBalancerClass,
+	}
+	eventHandlers := &cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { svcc.enqueueService(obj) },
+		UpdateFunc: func(oldObj, newObj interface{}) { svcc.enqueueUpdatedService(oldObj, newObj) },
+		DeleteFunc: func(obj interface{}) { svcc.enqueueDeletedService(obj) },
+	}
+	// Services are watched in all namespaces unless namespaces or a namespace label are given
+	svcc.informers = newNamespacedInformers("Service", func(namespace string) cache.SharedIndexInformer {
+		informer := coreInfV1.NewServiceInformer(kubeClient, namespace, 0*time.Second,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		informer.AddEventHandler(eventHandlers)
+		return informer
+	})
+	svcc.informers.watchNamespaces(kubeClient, params)
+	return svcc
+}
+
+// Start method runs the Orchestrator, watching for Services
+func (svcc *K8sServiceClient) Start(stopCh <-chan struct{}) {
+	svcc.run(stopCh, svcc.processResponse)
+}
+
+// ownsRequest checks whether the request is of a Service
+func (svcc *K8sServiceClient) ownsRequest(req ipamspec.IPAMRequest) bool {
+	_, ok := req.Metadata.(ServiceMeta)
+	return ok
+}
+
+// isManagedService checks whether the Service of type LoadBalancer is of the load balancer class of
+// this client, or has the IPAM label annotation when the client has no class
+func (svcc *K8sServiceClient) isManagedService(svc *coreV1.Service) bool {
+	if svc.Spec.Type != coreV1.ServiceTypeLoadBalancer {
+		return false
+	}
+	if svcc.loadBalancerClass != "" {
+		return svc.Spec.LoadBalancerClass != nil && *svc.Spec.LoadBalancerClass == svcc.loadBalancerClass
+	}
+	_, found := svc.Annotations[IPAMLabelAnnotation]
+	return svc.Spec.LoadBalancerClass == nil && found
+}
+
+// serviceRequest returns the request of the operation for the Service, false when the Service is not managed
+func (svcc *K8sServiceClient) serviceRequest(svc *coreV1.Service, operation string) (ipamspec.IPAMRequest, bool) {
+	if !svcc.isManagedService(svc) {
+		return ipamspec.IPAMRequest{}, false
+	}
+	ipamLabel := svc.Annotations[IPAMLabelAnnotation]
+	if ipamLabel == "" {
+		log.Warningf("[IPAM] Service %v/%v has no %v annotation", svc.Namespace, svc.Name, IPAMLabelAnnotation)
+		return ipamspec.IPAMRequest{}, false
+	}
+	req := ipamspec.IPAMRequest{
+		Metadata: ServiceMeta{
+			name:      svc.Name,
+			namespace: svc.Namespace,
+		},
+		Key:       serviceKey(svc),
+		IPAMLabel: ipamLabel,
+		Operation: ipamspec.DELETE,
+	}
+	if operation == CREATE {
+		req.Operation = ipamspec.CREATE
+		req.IPAddr = svc.Spec.LoadBalancerIP
+	}
+	return req, true
+}
+
+// serviceKey is the key of the Service in the IPAM provider, the key that CIS uses for it
+func serviceKey(svc *coreV1.Service) string {
+	return svc.Namespace + "/" + svc.Name + "_svc"
+}
+
+func (svcc *K8sServiceClient) enqueueService(obj interface{}) {
+	svc := obj.(*coreV1.Service)
+	if req, ok := svcc.serviceRequest(svc, CREATE); ok {
+		log.Debugf("Enqueueing Service on Create: %v/%v", svc.Namespace, svc.Name)
+		svcc.rscQueue.Add(req)
+	}
+}
+
+func (svcc *K8sServiceClient) enqueueUpdatedService(old, cur interface{}) {
+	oldSvc := old.(*coreV1.Service)
+	curSvc := cur.(*coreV1.Service)
+	oldReq, oldOK := svcc.serviceRequest(oldSvc, DELETE)
+	curReq, curOK := svcc.serviceRequest(curSvc, CREATE)
+	changed := oldOK != curOK || oldReq.IPAMLabel != curReq.IPAMLabel ||
+		oldSvc.Spec.LoadBalancerIP != curSvc.Spec.LoadBalancerIP
+	if oldOK && changed {
+		log.Debugf("Enqueueing Service on Update: %v/%v, releasing its IP address", oldSvc.Namespace, oldSvc.Name)
+		svcc.rscQueue.Add(oldReq)
+	}
+	// A Service without ingress gets its IP address again
+	if curOK && (changed || len(curSvc.Status.LoadBalancer.Ingress) == 0) {
+		log.Debugf("Enqueueing Service on Update: %v/%v", curSvc.Namespace, curSvc.Name)
+		svcc.rscQueue.Add(curReq)
+	}
+}
+
+func (svcc *K8sServiceClient) enqueueDeletedService(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	svc, ok := obj.(*coreV1.Service)
+	if !ok {
+		return
+	}
+	if req, ok := svcc.serviceRequest(svc, DELETE); ok {
+		log.Debugf("Enqueueing Service on Delete: %v/%v", svc.Namespace, svc.Name)
+		svcc.rscQueue.Add(req)
+	}
+}
+
+// processResponse writes the allocated IP address to the ingress of the Service, and removes the
+// released IP address from it. The condition of the status tells whether the allocation failed
+func (svcc *K8sServiceClient) processResponse(resp ipamspec.IPAMResponse) {
+	metadata := resp.Request.Metadata.(ServiceMeta)
+	svc, err := svcc.kubeClient.CoreV1().Services(metadata.namespace).Get(
+		context.TODO(), metadata.name, metaV1.GetOptions{})
+	if err != nil {
+		log.Debugf("Unable to find Service: %v/%v to update: %v", metadata.namespace, metadata.name, err)
+		return
+	}
+	switch resp.Request.Operation {
+	case ipamspec.CREATE:
+		// The Service may have changed since the request
+		req, ok := svcc.serviceRequest(svc, CREATE)
+		if !ok || req.IPAMLabel != resp.Request.IPAMLabel || req.IPAddr != resp.Request.IPAddr {
+			return
+		}
+		condition := allocationCondition(resp, svc.Generation)
+		if !resp.Status {
+			// The failure is reported once, until the Service changes or gets allocated
+			changed := svcc.updateStatus(svc, svc.Status.LoadBalancer.Ingress, &condition)
+			svcc.reportAllocationFailure(svc, "v1", condition, changed)
+			return
+		}
+		svcc.updateStatus(svc, []coreV1.LoadBalancerIngress{{IP: resp.IPAddr}}, &condition)
+	case ipamspec.DELETE:
+		var ingress []coreV1.LoadBalancerIngress
+		for _, ing := range svc.Status.LoadBalancer.Ingress {
+			if ing.IP != resp.Request.IPAddr {
+				ingress = append(ingress, ing)
+			}
+		}
+		svcc.updateStatus(svc, ingress, nil)
+	}
+}
+
+// updateStatus writes the ingress and the condition to the status of the Service, the condition is
+// removed when nil. It returns whether the status changed
+func (svcc *K8sServiceClient) updateStatus(
+	svc *coreV1.Service,
+	ingress []coreV1.LoadBalancerIngress,
+	condition *metaV1.Condition,
+) bool {
+	status := svc.Status.DeepCopy()
+	status.LoadBalancer.Ingress = ingress
+	setAllocationCondition(&status.Conditions, condition)
+	if equality.Semantic.DeepEqual(*status, svc.Status) {
+		return false
+	}
+	svc = svc.DeepCopy()
+	svc.Status = *status
+	_, err := svcc.kubeClient.CoreV1().Services(svc.Namespace).UpdateStatus(context.TODO(), svc, metaV1.UpdateOptions{})
+	if err != nil {
+		log.Errorf("Unable to Update Service: %v/%v\t Error: %v", svc.Namespace, svc.Name, err)
+		return false
+	}
+	log.Debugf("Updated: %v/%v with Status. With Ingress: %v", svc.Namespace, svc.Name, ingress)
+	return true
+}
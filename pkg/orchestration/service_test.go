@@ -0,0 +1,178 @@
+package orchestration
+
+import (
+	"context"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Services", func() {
+	var kubeClient *k8sfake.Clientset
+	var svcc *K8sServiceClient
+	class := "f5.com/ipam"
+	otherClass := "other"
+	devLabel := map[string]string{IPAMLabelAnnotation: "Dev"}
+
+	BeforeEach(func() {
+		kubeClient = k8sfake.NewSimpleClientset()
+		svcc = newServiceClient(kubeClient, Params{})
+	})
+
+	It("processes the Services without class that have the IPAM label annotation", func() {
+		svcc.enqueueService(newService("plain", nil, nil))
+		svcc.enqueueService(newService("other", &otherClass, devLabel))
+		clusterIP := newService("cluster", nil, devLabel)
+		clusterIP.Spec.Type = coreV1.ServiceTypeClusterIP
+		svcc.enqueueService(clusterIP)
+		Expect(svcc.rscQueue.Len()).To(Equal(0))
+
+		svc := newService("web", nil, devLabel)
+		svc.Spec.LoadBalancerIP = "10.1.1.10"
+		svcc.enqueueService(svc)
+		Expect(queued(&svcc.resourceClient)).To(Equal([]ipamspec.IPAMRequest{{
+			Metadata:  ServiceMeta{name: "web", namespace: "default"},
+			Operation: ipamspec.CREATE,
+			Key:       "default/web_svc",
+			IPAddr:    "10.1.1.10",
+			IPAMLabel: "Dev",
+		}}))
+	})
+
+	It("processes the Services of its load balancer class", func() {
+		svcc = newServiceClient(kubeClient, Params{LoadBalancerClass: class})
+		svcc.enqueueService(newService("plain", nil, devLabel))
+		svcc.enqueueService(newService("other", &otherClass, devLabel))
+		// The Services of the class need the IPAM label annotation
+		svcc.enqueueService(newService("nolabel", &class, nil))
+		Expect(svcc.rscQueue.Len()).To(Equal(0))
+		svcc.enqueueService(newService("web", &class, devLabel))
+		Expect(svcc.rscQueue.Len()).To(Equal(1))
+	})
+
+	It("releases and allocates again when the Service changes", func() {
+		old := newService("web", nil, devLabel)
+		old.Status.LoadBalancer.Ingress = []coreV1.LoadBalancerIngress{{IP: "10.1.1.1"}}
+		cur := old.DeepCopy()
+		svcc.enqueueUpdatedService(old, cur)
+		Expect(svcc.rscQueue.Len()).To(Equal(0))
+
+		cur.Annotations = map[string]string{IPAMLabelAnnotation: "Test"}
+		svcc.enqueueUpdatedService(old, cur)
+		requests := queued(&svcc.resourceClient)
+		Expect(requests).To(HaveLen(2))
+		Expect(requests[0].Operation).To(Equal(ipamspec.DELETE))
+		Expect(requests[0].IPAMLabel).To(Equal("Dev"))
+		Expect(requests[1].Operation).To(Equal(ipamspec.CREATE))
+		Expect(requests[1].IPAMLabel).To(Equal("Test"))
+
+		cur = old.DeepCopy()
+		cur.Spec.Type = coreV1.ServiceTypeNodePort
+		svcc.enqueueUpdatedService(old, cur)
+		Expect(queued(&svcc.resourceClient)).To(ConsistOf(HaveField("Operation", ipamspec.DELETE)))
+
+		svcc.enqueueDeletedService(old)
+		Expect(queued(&svcc.resourceClient)).To(ConsistOf(HaveField("Operation", ipamspec.DELETE)))
+	})
+
+	It("writes the IP address to the ingress of the Service", func() {
+		svc := newService("web", nil, devLabel)
+		_, err := kubeClient.CoreV1().Services("default").Create(context.TODO(), svc, metaV1.CreateOptions{})
+		Expect(err).To(BeNil())
+		req, _ := svcc.serviceRequest(svc, CREATE)
+		svcc.processResponse(ipamspec.IPAMResponse{Request: req, IPAddr: "10.1.1.1", Status: true})
+		svc, err = kubeClient.CoreV1().Services("default").Get(context.TODO(), "web", metaV1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(svc.Status.LoadBalancer.Ingress).To(Equal([]coreV1.LoadBalancerIngress{{IP: "10.1.1.1"}}))
+
+		// The responses of an outdated request are ignored
+		staleReq := req
+		staleReq.IPAMLabel = "Test"
+		svcc.processResponse(ipamspec.IPAMResponse{Request: staleReq, IPAddr: "10.2.1.1", Status: true})
+		svc, _ = kubeClient.CoreV1().Services("default").Get(context.TODO(), "web", metaV1.GetOptions{})
+		Expect(svc.Status.LoadBalancer.Ingress).To(Equal([]coreV1.LoadBalancerIngress{{IP: "10.1.1.1"}}))
+
+		req.Operation = ipamspec.DELETE
+		req.IPAddr = "10.1.1.1"
+		svcc.processResponse(ipamspec.IPAMResponse{Request: req, Status: true})
+		svc, _ = kubeClient.CoreV1().Services("default").Get(context.TODO(), "web", metaV1.GetOptions{})
+		Expect(svc.Status.LoadBalancer.Ingress).To(BeEmpty())
+	})
+
+	It("reports the IP addresses that it is unable to allocate", func() {
+		svc := newService("web", nil, devLabel)
+		svc.Spec.LoadBalancerIP = "10.9.1.1"
+		_, err := kubeClient.CoreV1().Services("default").Create(context.TODO(), svc, metaV1.CreateOptions{})
+		Expect(err).To(BeNil())
+		req, _ := svcc.serviceRequest(svc, CREATE)
+		// The failure is reported once
+		svcc.processResponse(ipamspec.IPAMResponse{Request: req, Status: false})
+		svcc.processResponse(ipamspec.IPAMResponse{Request: req, Status: false})
+		svc, _ = kubeClient.CoreV1().Services("default").Get(context.TODO(), "web", metaV1.GetOptions{})
+		Expect(svc.Status.LoadBalancer.Ingress).To(BeEmpty())
+		Expect(svc.Status.Conditions).To(ConsistOf(And(
+			HaveField("Type", IPAllocatedCondition),
+			HaveField("Status", metaV1.ConditionFalse),
+			HaveField("Reason", "AllocationFailed"),
+			HaveField("Message", "Unable to allocate IP address 10.9.1.1 from IPAM label Dev"),
+		)))
+		events, err := kubeClient.CoreV1().Events("default").List(context.TODO(), metaV1.ListOptions{})
+		Expect(err).To(BeNil())
+		Expect(events.Items).To(ConsistOf(And(
+			HaveField("InvolvedObject.Kind", "Service"),
+			HaveField("InvolvedObject.Name", "web"),
+			HaveField("Type", EventTypeWarning),
+			HaveField("Reason", "AllocationFailed"),
+		)))
+
+		svcc.processResponse(ipamspec.IPAMResponse{Request: req, IPAddr: "10.9.1.1", Status: true})
+		svc, _ = kubeClient.CoreV1().Services("default").Get(context.TODO(), "web", metaV1.GetOptions{})
+		Expect(svc.Status.LoadBalancer.Ingress).To(Equal([]coreV1.LoadBalancerIngress{{IP: "10.9.1.1"}}))
+		Expect(svc.Status.Conditions).To(ConsistOf(And(
+			HaveField("Type", IPAllocatedCondition),
+			HaveField("Status", metaV1.ConditionTrue),
+		)))
+	})
+
+	It("watches the Services of the namespaces of the namespace label", func() {
+		ipamLabel := map[string]string{"ipam": "true"}
+		kubeClient = k8sfake.NewSimpleClientset(newNamespace("prod", ipamLabel), newNamespace("dev", nil))
+		for _, namespace := range []string{"prod", "dev"} {
+			svc := newService("web", nil, devLabel)
+			svc.Namespace = namespace
+			_, err := kubeClient.CoreV1().Services(namespace).Create(context.TODO(), svc, metaV1.CreateOptions{})
+			Expect(err).To(BeNil())
+		}
+		svcc = newServiceClient(kubeClient, Params{NamespaceLabel: "ipam=true"})
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		svcc.informers.start(stopCh)
+		Eventually(queued).WithArguments(&svcc.resourceClient).Should(ConsistOf(HaveField("Key", "prod/web_svc")))
+
+		// The namespaces are watched as they get labelled
+		_, err := kubeClient.CoreV1().Namespaces().Update(context.TODO(), newNamespace("dev", ipamLabel), metaV1.UpdateOptions{})
+		Expect(err).To(BeNil())
+		Eventually(queued).WithArguments(&svcc.resourceClient).Should(ConsistOf(HaveField("Key", "dev/web_svc")))
+	})
+
+	It("sends the responses to the orchestrator of the request", func() {
+		ipamCli := &K8sIPAMClient{}
+		mo := &multiOrchestrator{orchestrators: []Orchestrator{ipamCli, svcc}}
+		reqChan := make(chan ipamspec.IPAMRequest)
+		respChan := make(chan ipamspec.IPAMResponse)
+		mo.SetupCommunicationChannels(reqChan, respChan)
+		go mo.dispatchResponses()
+		defer close(respChan)
+
+		svcResp := ipamspec.IPAMResponse{Request: ipamspec.IPAMRequest{Metadata: ServiceMeta{name: "web"}}}
+		respChan <- svcResp
+		Expect(<-svcc.respChan).To(Equal(svcResp))
+		ipamResp := ipamspec.IPAMResponse{Request: ipamspec.IPAMRequest{Metadata: ResourceMeta{name: "ipam"}}}
+		respChan <- ipamResp
+		Expect(<-ipamCli.respChan).To(Equal(ipamResp))
+	})
+})
@@ -0,0 +1,202 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package orchestration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/client/clientset/versioned"
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// K8sStatusUpdater finds the IPAM resources, Services and Gateways whose status advertises the IP address
+// of an allocation, and replaces it with another IP address
+type K8sStatusUpdater struct {
+	kubeClient    kubernetes.Interface
+	kubeCRClient  versioned.Interface
+	dynamicClient dynamic.Interface
+}
+
+// NewStatusUpdater returns the status updater of the cluster that it runs in
+func NewStatusUpdater() (*K8sStatusUpdater, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	kubeCRClient, err := versioned.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return newStatusUpdater(kubeClient, kubeCRClient, dynamicClient), nil
+}
+
+func newStatusUpdater(
+	kubeClient kubernetes.Interface,
+	kubeCRClient versioned.Interface,
+	dynamicClient dynamic.Interface,
+) *K8sStatusUpdater {
+	return &K8sStatusUpdater{
+		kubeClient:    kubeClient,
+		kubeCRClient:  kubeCRClient,
+		dynamicClient: dynamicClient,
+	}
+}
+
+// Owners returns the requests of the resources whose status advertises the IP address of the allocation. The
+// requests hold the hostname or the key of the allocation as the resources do, and the IP address
+func (su *K8sStatusUpdater) Owners(alloc manager.Allocation) ([]ipamspec.IPAMRequest, error) {
+	req := ipamspec.IPAMRequest{
+		Key:       alloc.Reference,
+		IPAMLabel: alloc.IPAMLabel,
+		IPAddr:    alloc.IPAddr,
+	}
+	switch {
+	case strings.HasSuffix(alloc.Reference, "_svc"):
+		namespace, name := splitKey(strings.TrimSuffix(alloc.Reference, "_svc"))
+		svc, err := su.kubeClient.CoreV1().Services(namespace).Get(context.TODO(), name, metaV1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, ing := range svc.Status.LoadBalancer.Ingress {
+			if ing.IP == alloc.IPAddr {
+				req.Metadata = ServiceMeta{name: name, namespace: namespace}
+				return []ipamspec.IPAMRequest{req}, nil
+			}
+		}
+		return nil, nil
+	case strings.HasSuffix(alloc.Reference, "_gateway"):
+		namespace, name := splitKey(strings.TrimSuffix(alloc.Reference, "_gateway"))
+		gw, err := su.dynamicClient.Resource(gatewayGVR).Namespace(namespace).Get(context.TODO(), name, metaV1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range gatewayAddresses(gw) {
+			if value, _, _ := unstructured.NestedString(addr.(map[string]interface{}), "value"); value == alloc.IPAddr {
+				req.Metadata = GatewayMeta{name: name, namespace: namespace}
+				return []ipamspec.IPAMRequest{req}, nil
+			}
+		}
+		return nil, nil
+	}
+	// A hostname can be in the status of several IPAM resources
+	ipams, err := su.kubeCRClient.K8sV1().IPAMs("").List(context.TODO(), metaV1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var owners []ipamspec.IPAMRequest
+	for _, ipam := range ipams.Items {
+		for _, ipStatus := range ipam.Status.IPStatus {
+			if ipStatus.IP != alloc.IPAddr || ipStatus.IPAMLabel != alloc.IPAMLabel {
+				continue
+			}
+			owner := req
+			owner.Metadata = ResourceMeta{name: ipam.Name, namespace: ipam.Namespace}
+			switch alloc.Reference {
+			case ipStatus.Host:
+				owner.HostName, owner.Key = ipStatus.Host, ""
+			case ipStatus.Key:
+			default:
+				continue
+			}
+			owners = append(owners, owner)
+		}
+	}
+	return owners, nil
+}
+
+// UpdateStatus replaces the IP address of the request with ip in the status of its resource
+func (su *K8sStatusUpdater) UpdateStatus(req ipamspec.IPAMRequest, ip string) error {
+	switch metadata := req.Metadata.(type) {
+	case ServiceMeta:
+		services := su.kubeClient.CoreV1().Services(metadata.namespace)
+		svc, err := services.Get(context.TODO(), metadata.name, metaV1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for i := range svc.Status.LoadBalancer.Ingress {
+			if svc.Status.LoadBalancer.Ingress[i].IP == req.IPAddr {
+				svc.Status.LoadBalancer.Ingress[i].IP = ip
+			}
+		}
+		_, err = services.UpdateStatus(context.TODO(), svc, metaV1.UpdateOptions{})
+		return err
+	case GatewayMeta:
+		gateways := su.dynamicClient.Resource(gatewayGVR).Namespace(metadata.namespace)
+		gw, err := gateways.Get(context.TODO(), metadata.name, metaV1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		addresses := gatewayAddresses(gw)
+		for _, addr := range addresses {
+			if value, _, _ := unstructured.NestedString(addr.(map[string]interface{}), "value"); value == req.IPAddr {
+				addr.(map[string]interface{})["value"] = ip
+			}
+		}
+		if err = unstructured.SetNestedSlice(gw.Object, addresses, "status", "addresses"); err != nil {
+			return err
+		}
+		_, err = gateways.UpdateStatus(context.TODO(), gw, metaV1.UpdateOptions{})
+		return err
+	case ResourceMeta:
+		ipamCli := su.kubeCRClient.K8sV1().IPAMs(metadata.namespace)
+		ipam, err := ipamCli.Get(context.TODO(), metadata.name, metaV1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for _, ipStatus := range ipam.Status.IPStatus {
+			if ipStatus.IP == req.IPAddr && ipStatus.IPAMLabel == req.IPAMLabel &&
+				((req.HostName != "" && ipStatus.Host == req.HostName) || (req.Key != "" && ipStatus.Key == req.Key)) {
+				ipStatus.IP = ip
+			}
+		}
+		_, err = ipamCli.UpdateStatus(context.TODO(), ipam, metaV1.UpdateOptions{})
+		return err
+	}
+	return fmt.Errorf("unknown resource of request %v", req.String())
+}
+
+// splitKey returns the namespace and the name of a namespace/name key
+func splitKey(key string) (string, string) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 {
+		return "", key
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,109 @@
+package orchestration
+
+import (
+	"context"
+
+	ficV1 "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/apis/fic/v1"
+	crfake "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/client/clientset/versioned/fake"
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Status Updater", func() {
+	var kubeCRClient *crfake.Clientset
+	var kubeClient *k8sfake.Clientset
+	var dynamicClient *dynamicfake.FakeDynamicClient
+	var su *K8sStatusUpdater
+
+	BeforeEach(func() {
+		web := newIPAM("web", "")
+		web.Status.IPStatus = []*ficV1.IPSpec{
+			{Host: "foo.com", IPAMLabel: "Dev", IP: "10.1.1.1"},
+			{Key: "bar", IPAMLabel: "Dev", IP: "10.1.1.2"},
+		}
+		api := newIPAM("api", "")
+		api.Status.IPStatus = []*ficV1.IPSpec{{Host: "foo.com", IPAMLabel: "Dev", IP: "10.1.1.1"}}
+		// The fake clientset finds only the IPAM resources created with it, and lists none
+		kubeCRClient = crfake.NewSimpleClientset()
+		for _, ipam := range []*ficV1.IPAM{web, api} {
+			_, err := kubeCRClient.K8sV1().IPAMs("default").Create(context.TODO(), ipam, metaV1.CreateOptions{})
+			Expect(err).To(BeNil())
+		}
+		kubeCRClient.PrependReactor("list", "ipams", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, &ficV1.IPAMList{Items: []ficV1.IPAM{*web, *api}}, nil
+		})
+
+		svc := newService("web", nil, nil)
+		svc.Status.LoadBalancer.Ingress = []coreV1.LoadBalancerIngress{{IP: "10.1.1.3"}}
+		kubeClient = k8sfake.NewSimpleClientset(svc)
+
+		gw := newGateway("web", "f5", nil)
+		gw.Object["status"] = map[string]interface{}{"addresses": []interface{}{
+			map[string]interface{}{"type": gatewayAddressType, "value": "10.1.1.4"},
+		}}
+		dynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+		_, err := dynamicClient.Resource(gatewayGVR).Namespace("default").Create(context.TODO(), gw, metaV1.CreateOptions{})
+		Expect(err).To(BeNil())
+		su = newStatusUpdater(kubeClient, kubeCRClient, dynamicClient)
+	})
+
+	It("updates the IPAM resources that advertise the IP address", func() {
+		owners, err := su.Owners(manager.Allocation{IPAMLabel: "Dev", IPAddr: "10.1.1.1", Reference: "foo.com"})
+		Expect(err).To(BeNil())
+		Expect(owners).To(ConsistOf(
+			ipamspec.IPAMRequest{Metadata: ResourceMeta{name: "web", namespace: "default"},
+				HostName: "foo.com", IPAMLabel: "Dev", IPAddr: "10.1.1.1"},
+			ipamspec.IPAMRequest{Metadata: ResourceMeta{name: "api", namespace: "default"},
+				HostName: "foo.com", IPAMLabel: "Dev", IPAddr: "10.1.1.1"},
+		))
+		for _, owner := range owners {
+			Expect(su.UpdateStatus(owner, "10.2.2.1")).To(Succeed())
+		}
+		web, err := kubeCRClient.K8sV1().IPAMs("default").Get(context.TODO(), "web", metaV1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(web.Status.IPStatus[0].IP).To(Equal("10.2.2.1"))
+		Expect(web.Status.IPStatus[1].IP).To(Equal("10.1.1.2"))
+
+		owners, err = su.Owners(manager.Allocation{IPAMLabel: "Dev", IPAddr: "10.1.1.2", Reference: "bar"})
+		Expect(err).To(BeNil())
+		Expect(owners).To(Equal([]ipamspec.IPAMRequest{{Metadata: ResourceMeta{name: "web", namespace: "default"},
+			Key: "bar", IPAMLabel: "Dev", IPAddr: "10.1.1.2"}}))
+
+		// The allocations that no status advertises have no owners
+		owners, err = su.Owners(manager.Allocation{IPAMLabel: "Test", IPAddr: "10.1.1.2", Reference: "bar"})
+		Expect(err).To(BeNil())
+		Expect(owners).To(BeEmpty())
+	})
+
+	It("updates the Services and Gateways that advertise the IP address", func() {
+		owners, err := su.Owners(manager.Allocation{IPAMLabel: "Dev", IPAddr: "10.1.1.3", Reference: "default/web_svc"})
+		Expect(err).To(BeNil())
+		Expect(owners).To(HaveLen(1))
+		Expect(su.UpdateStatus(owners[0], "10.2.2.3")).To(Succeed())
+		svc, err := kubeClient.CoreV1().Services("default").Get(context.TODO(), "web", metaV1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(svc.Status.LoadBalancer.Ingress).To(Equal([]coreV1.LoadBalancerIngress{{IP: "10.2.2.3"}}))
+
+		owners, err = su.Owners(manager.Allocation{IPAMLabel: "Dev", IPAddr: "10.1.1.4", Reference: "default/web_gateway"})
+		Expect(err).To(BeNil())
+		Expect(owners).To(HaveLen(1))
+		Expect(su.UpdateStatus(owners[0], "10.2.2.4")).To(Succeed())
+		gw, err := dynamicClient.Resource(gatewayGVR).Namespace("default").Get(context.TODO(), "web", metaV1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(gatewayAddresses(gw)).To(Equal([]interface{}{
+			map[string]interface{}{"type": gatewayAddressType, "value": "10.2.2.4"},
+		}))
+
+		owners, err = su.Owners(manager.Allocation{IPAMLabel: "Dev", IPAddr: "10.1.1.3", Reference: "default/gone_svc"})
+		Expect(err).To(BeNil())
+		Expect(owners).To(BeEmpty())
+	})
+})
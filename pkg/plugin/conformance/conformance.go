@@ -0,0 +1,181 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package conformance checks that an IPAM provider plugin implements the plugin contract as FIC expects,
+// through the plugin provider of FIC. The test of the package runs it against the plugin of FIC_PLUGIN_URL
+package conformance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/pluginapi"
+)
+
+// Params defines the plugin to check
+type Params struct {
+	manager.PluginParams
+	// Label is the IPAM label to allocate from, it needs at least two free IP addresses
+	Label string
+}
+
+// Run checks the plugin and returns the first check that fails. The IP addresses that it allocates are
+// released at the end
+func Run(params Params) error {
+	plMgr, err := manager.NewPluginManager(params.PluginParams)
+	if err != nil {
+		return fmt.Errorf("info: %v", err)
+	}
+	c := &checker{mgr: plMgr, label: params.Label, suffix: fmt.Sprint(time.Now().UnixNano())}
+	defer c.cleanup()
+	return c.run()
+}
+
+type checker struct {
+	mgr   *manager.PluginManager
+	label string
+	// suffix makes the hostnames/keys of a run unique
+	suffix string
+	// allocated are the requests of the IP addresses to release at the end
+	allocated []ipamspec.IPAMRequest
+}
+
+type resource struct {
+	name, namespace string
+}
+
+func (rsc resource) GetName() string      { return rsc.name }
+func (rsc resource) GetNamespace() string { return rsc.namespace }
+
+func (c *checker) run() error {
+	info := c.mgr.Info()
+	if !contains(info.Labels, c.label) {
+		return fmt.Errorf("info: label %v is not in the labels %v", c.label, info.Labels)
+	}
+
+	hostReq := c.request("conformance-"+c.suffix+".example.com", "")
+	if ip := c.mgr.GetIPAddress(hostReq); ip != "" {
+		return fmt.Errorf("get-ip-address: got %v for a hostname without IP address, expected none", ip)
+	}
+	hostIP := c.allocate(hostReq)
+	if hostIP == "" {
+		return fmt.Errorf("allocate-next-ip-address: got no IP address for a hostname")
+	}
+	if ip := c.mgr.GetIPAddress(hostReq); ip != hostIP {
+		return fmt.Errorf("get-ip-address: got %q for the hostname, expected %v", ip, hostIP)
+	}
+
+	keyReq := c.request("", "conformance/svc-"+c.suffix)
+	keyIP := c.allocate(keyReq)
+	if keyIP == "" || keyIP == hostIP {
+		return fmt.Errorf("allocate-next-ip-address: got %q for a key, expected an IP address other than %v", keyIP, hostIP)
+	}
+	if ip := c.mgr.GetIPAddress(keyReq); ip != keyIP {
+		return fmt.Errorf("get-ip-address: got %q for the key, expected %v", ip, keyIP)
+	}
+
+	otherReq := c.request("other-"+c.suffix+".example.com", "")
+	otherReq.IPAddr = keyIP
+	if c.mgr.ReserveIPAddress(otherReq) {
+		return fmt.Errorf("reserve-ip-address: reserved %v that the key holds", keyIP)
+	}
+
+	releaseReq := hostReq
+	releaseReq.Operation = ipamspec.DELETE
+	releaseReq.IPAddr = hostIP
+	c.mgr.ReleaseIPAddress(releaseReq)
+	c.allocated = c.allocated[1:]
+	if ip := c.mgr.GetIPAddress(hostReq); ip != "" {
+		return fmt.Errorf("release-ip-address: got %v for the released hostname, expected none", ip)
+	}
+	reserveReq := hostReq
+	reserveReq.IPAddr = hostIP
+	if !c.mgr.ReserveIPAddress(reserveReq) {
+		return fmt.Errorf("reserve-ip-address: unable to reserve the released %v", hostIP)
+	}
+	c.allocated = append(c.allocated, reserveReq)
+	if ip := c.mgr.GetIPAddress(hostReq); ip != hostIP {
+		return fmt.Errorf("get-ip-address: got %q for the reserved hostname, expected %v", ip, hostIP)
+	}
+
+	unknownReq := c.request("unknown-"+c.suffix+".example.com", "")
+	unknownReq.IPAMLabel = "conformance-unknown-label-" + c.suffix
+	if ip := c.allocate(unknownReq); ip != "" {
+		return fmt.Errorf("allocate-next-ip-address: got %v for an unknown label, expected none", ip)
+	}
+
+	for _, capability := range info.Capabilities {
+		if capability != pluginapi.CapabilityInspect {
+			continue
+		}
+		allocations := make(map[string]string)
+		for _, alloc := range c.mgr.GetAllocations(c.label) {
+			allocations[alloc.IPAddr] = alloc.Reference
+		}
+		if allocations[hostIP] != hostReq.HostName || allocations[keyIP] != keyReq.Key {
+			return fmt.Errorf("allocations: got %v, expected %v for %v and %v for %v",
+				allocations, hostReq.HostName, hostIP, keyReq.Key, keyIP)
+		}
+		found := false
+		for _, usage := range c.mgr.GetLabelUsage() {
+			if usage.IPAMLabel == c.label {
+				found = usage.Allocated >= 2
+			}
+		}
+		if !found {
+			return fmt.Errorf("label-usage: label %v is missing or has less than the 2 allocated IP addresses", c.label)
+		}
+	}
+	return nil
+}
+
+func (c *checker) request(hostname, key string) ipamspec.IPAMRequest {
+	return ipamspec.IPAMRequest{
+		Metadata:  resource{name: "conformance", namespace: "conformance"},
+		Operation: ipamspec.CREATE,
+		HostName:  hostname,
+		Key:       key,
+		IPAMLabel: c.label,
+	}
+}
+
+func (c *checker) allocate(req ipamspec.IPAMRequest) string {
+	ip := c.mgr.AllocateNextIPAddress(req)
+	if ip != "" {
+		req.IPAddr = ip
+		c.allocated = append(c.allocated, req)
+	}
+	return ip
+}
+
+// cleanup releases the IP addresses of the run
+func (c *checker) cleanup() {
+	for _, req := range c.allocated {
+		req.Operation = ipamspec.DELETE
+		c.mgr.ReleaseIPAddress(req)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conformance_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/pluginapi"
+	"github.com/F5Networks/f5-ipam-controller/pkg/plugin"
+	"github.com/F5Networks/f5-ipam-controller/pkg/plugin/conformance"
+	"github.com/F5Networks/f5-ipam-controller/pkg/plugin/reference"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestConformance(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Plugin Conformance Suite")
+}
+
+// stickyManager is a broken plugin that allocates the same IP address to every hostname/key
+type stickyManager struct {
+	*reference.Manager
+}
+
+func (mgr stickyManager) AllocateNextIPAddress(req ipamspec.IPAMRequest) string {
+	return "10.1.0.10"
+}
+
+var _ = Describe("Plugin conformance", func() {
+	var srv *httptest.Server
+	var certDir string
+
+	newPlugin := func(mgr manager.Manager, token string) {
+		srv = httptest.NewTLSServer(plugin.NewHandler(plugin.Params{Name: "test", Manager: mgr, Token: token}))
+		var buf bytes.Buffer
+		Expect(pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(certDir, "ca.crt"), buf.Bytes(), 0600)).To(Succeed())
+	}
+
+	params := func(token string) conformance.Params {
+		return conformance.Params{
+			PluginParams: manager.PluginParams{
+				URL:        srv.URL,
+				Token:      token,
+				CACertFile: filepath.Join(certDir, "ca.crt"),
+			},
+			Label: "Dev",
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		certDir, err = ioutil.TempDir("", "conformance")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		if srv != nil {
+			srv.Close()
+			srv = nil
+		}
+		_ = os.RemoveAll(certDir)
+	})
+
+	It("Passes with the reference plugin", func() {
+		mgr, err := reference.NewManager(`{"Dev": "10.1.0.10-10.1.0.12", "Test": "10.2.0.10-10.2.0.10"}`)
+		Expect(err).To(BeNil())
+		newPlugin(mgr, "secret")
+		Expect(conformance.Run(params("secret"))).To(Succeed())
+		// The IP addresses of the run are released
+		Expect(mgr.GetAllocations("")).To(BeEmpty())
+
+		err = conformance.Run(params("wrong"))
+		Expect(err).To(MatchError("info: plugin request error: GET /v1/info: 401 invalid token"))
+		err = conformance.Run(conformance.Params{PluginParams: params("secret").PluginParams, Label: "Prod"})
+		Expect(err).To(MatchError("info: label Prod is not in the labels [Dev Test]"))
+	})
+
+	It("Fails with a broken plugin", func() {
+		mgr, err := reference.NewManager(`{"Dev": "10.1.0.10-10.1.0.12"}`)
+		Expect(err).To(BeNil())
+		newPlugin(stickyManager{mgr}, "")
+		Expect(conformance.Run(params(""))).To(MatchError(
+			`get-ip-address: got "" for the hostname, expected 10.1.0.10`))
+	})
+
+	It("Rejects the plugins of another API version", func() {
+		srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"apiVersion": "v2", "name": "future"}`))
+		}))
+		_, err := manager.NewPluginManager(manager.PluginParams{URL: srv.URL, Insecure: true})
+		Expect(err).To(MatchError("plugin future implements the API version v2, expected " + pluginapi.Version))
+	})
+
+	It("Forwards the operations, DNS labels and metadata to the plugin", func() {
+		mgr, err := reference.NewManager(`{"Dev": "10.1.0.10-10.1.0.12"}`)
+		Expect(err).To(BeNil())
+		var received []pluginapi.Request
+		handler := plugin.NewHandler(plugin.Params{Name: "test", Manager: mgr, Labels: []string{"Dev"}})
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == pluginapi.InfoPath {
+				_, _ = w.Write([]byte(`{"apiVersion": "v1", "name": "test", "labels": ["Dev"], "dnsLabels": ["Dev"]}`))
+				return
+			}
+			data, _ := ioutil.ReadAll(r.Body)
+			var req pluginapi.Request
+			Expect(json.Unmarshal(data, &req)).To(Succeed())
+			received = append(received, req)
+			r.Body = ioutil.NopCloser(bytes.NewReader(data))
+			handler.ServeHTTP(w, r)
+		}))
+		plMgr, err := manager.NewPluginManager(manager.PluginParams{URL: srv.URL, ReadinessInterval: 10 * time.Millisecond})
+		Expect(err).To(BeNil())
+		Expect(plMgr.IsDNSEnabled("Dev")).To(BeTrue())
+		Expect(plMgr.IsDNSEnabled("Test")).To(BeFalse())
+		Expect(plMgr.IsReady()).To(BeTrue())
+		// Without the inspect capability only the labels are listed
+		Expect(plMgr.GetLabelUsage()).To(Equal([]manager.LabelUsage{{IPAMLabel: "Dev"}}))
+		Expect(plMgr.GetAllocations("")).To(BeEmpty())
+
+		req := ipamspec.IPAMRequest{
+			Metadata:  resource{name: "foo", namespace: "default"},
+			Operation: ipamspec.CREATE,
+			HostName:  "foo.com",
+			IPAMLabel: "Dev",
+		}
+		Expect(plMgr.AllocateNextIPAddress(req)).To(Equal("10.1.0.10"))
+		Expect(plMgr.CreateARecord(req)).To(BeTrue())
+		Expect(received).To(Equal([]pluginapi.Request{
+			{Operation: "Create", HostName: "foo.com", IPAMLabel: "Dev", Namespace: "default", Name: "foo"},
+			{Operation: "Create", HostName: "foo.com", IPAMLabel: "Dev", Namespace: "default", Name: "foo"},
+		}))
+
+		srv.Close()
+		Eventually(plMgr.IsReady).Should(BeFalse())
+		Expect(plMgr.GetIPAddress(req)).To(BeEmpty())
+		srv = nil
+	})
+
+	It("Passes with the plugin of FIC_PLUGIN_URL", func() {
+		if os.Getenv("FIC_PLUGIN_URL") == "" {
+			Skip("FIC_PLUGIN_URL is not set")
+		}
+		Expect(conformance.Run(conformance.Params{
+			PluginParams: manager.PluginParams{
+				URL:        os.Getenv("FIC_PLUGIN_URL"),
+				Token:      os.Getenv("FIC_PLUGIN_TOKEN"),
+				CACertFile: os.Getenv("FIC_PLUGIN_CA_CERT"),
+				Insecure:   os.Getenv("FIC_PLUGIN_INSECURE") == "true",
+			},
+			Label: os.Getenv("FIC_PLUGIN_LABEL"),
+		})).To(Succeed())
+	})
+})
+
+type resource struct {
+	name, namespace string
+}
+
+func (rsc resource) GetName() string      { return rsc.name }
+func (rsc resource) GetNamespace() string { return rsc.namespace }
@@ -0,0 +1,197 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package plugin serves a Manager over the HTTP/JSON contract of pluginapi, to write IPAM provider
+// plugins in Go. The plugins in other languages implement the contract of docs/plugin-api.md
+package plugin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/pluginapi"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+// Params defines the parameters of the plugin handler
+type Params struct {
+	// Name of the plugin
+	Name string
+	// Manager serves the operations, its Inspector and DNSRegistrar are used when it implements them
+	Manager manager.Manager
+	// Labels are the IPAM labels of the plugin, the labels of the Inspector when it is empty
+	Labels []string
+	// Token is the bearer token that FIC sends, the requests are not authenticated when it is empty
+	Token string
+}
+
+// Handler serves the operations of the contract with the Manager
+type Handler struct {
+	name   string
+	mgr    manager.Manager
+	labels []string
+	token  string
+	mux    *http.ServeMux
+}
+
+// resourceMetadata is the Metadata of the requests that come from an IPAM resource
+type resourceMetadata struct {
+	namespace, name string
+}
+
+func (meta resourceMetadata) GetName() string      { return meta.name }
+func (meta resourceMetadata) GetNamespace() string { return meta.namespace }
+
+func NewHandler(params Params) *Handler {
+	h := &Handler{
+		name:   params.Name,
+		mgr:    params.Manager,
+		labels: params.Labels,
+		token:  params.Token,
+		mux:    http.NewServeMux(),
+	}
+	h.mux.HandleFunc(pluginapi.InfoPath, h.serveInfo)
+	h.mux.HandleFunc(pluginapi.GetIPAddressPath, h.serveOperation(func(req ipamspec.IPAMRequest) (interface{}, error) {
+		ipAddr, err := manager.LookupIPAddress(h.mgr, req)
+		return pluginapi.AddressResponse{IPAddr: ipAddr}, err
+	}))
+	h.mux.HandleFunc(pluginapi.AllocateNextIPAddressPath, h.serveOperation(func(req ipamspec.IPAMRequest) (interface{}, error) {
+		return pluginapi.AddressResponse{IPAddr: h.mgr.AllocateNextIPAddress(req)}, nil
+	}))
+	h.mux.HandleFunc(pluginapi.ReserveIPAddressPath, h.serveOperation(func(req ipamspec.IPAMRequest) (interface{}, error) {
+		return pluginapi.ResultResponse{Success: h.mgr.ReserveIPAddress(req)}, nil
+	}))
+	h.mux.HandleFunc(pluginapi.ReleaseIPAddressPath, h.serveOperation(func(req ipamspec.IPAMRequest) (interface{}, error) {
+		return struct{}{}, manager.RemoveIPAddress(h.mgr, req)
+	}))
+	h.mux.HandleFunc(pluginapi.CreateARecordPath, h.serveOperation(func(req ipamspec.IPAMRequest) (interface{}, error) {
+		return pluginapi.ResultResponse{Success: h.mgr.CreateARecord(req)}, nil
+	}))
+	h.mux.HandleFunc(pluginapi.DeleteARecordPath, h.serveOperation(func(req ipamspec.IPAMRequest) (interface{}, error) {
+		return struct{}{}, manager.RemoveARecord(h.mgr, req)
+	}))
+	if insp, ok := h.mgr.(manager.Inspector); ok {
+		h.mux.HandleFunc(pluginapi.LabelUsagePath, func(w http.ResponseWriter, r *http.Request) {
+			usage := []pluginapi.LabelUsage{}
+			for _, labelUsage := range insp.GetLabelUsage() {
+				usage = append(usage, pluginapi.LabelUsage(labelUsage))
+			}
+			writeJSON(w, http.StatusOK, usage)
+		})
+		h.mux.HandleFunc(pluginapi.AllocationsPath, func(w http.ResponseWriter, r *http.Request) {
+			allocations := []pluginapi.Allocation{}
+			for _, alloc := range insp.GetAllocations(r.URL.Query().Get("ipamLabel")) {
+				allocations = append(allocations, pluginapi.Allocation{
+					IPAMLabel: alloc.IPAMLabel,
+					IPAddr:    alloc.IPAddr,
+					Reference: alloc.Reference,
+				})
+			}
+			writeJSON(w, http.StatusOK, allocations)
+		})
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+h.token)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, pluginapi.ErrorResponse{Message: "invalid token"})
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) serveInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, pluginapi.ErrorResponse{Message: "method not allowed"})
+		return
+	}
+	info := pluginapi.Info{
+		APIVersion: pluginapi.Version,
+		Name:       h.name,
+		Labels:     h.getLabels(),
+	}
+	if registrar, ok := h.mgr.(manager.DNSRegistrar); ok {
+		for _, label := range info.Labels {
+			if registrar.IsDNSEnabled(label) {
+				info.DNSLabels = append(info.DNSLabels, label)
+			}
+		}
+	}
+	if _, ok := h.mgr.(manager.Inspector); ok {
+		info.Capabilities = append(info.Capabilities, pluginapi.CapabilityInspect)
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// serveOperation decodes the request of the contract and answers the response of the operation,
+// the errors of the Manager, when it is a ReleaseReporter, are answered with 502
+func (h *Handler) serveOperation(operation func(req ipamspec.IPAMRequest) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, pluginapi.ErrorResponse{Message: "method not allowed"})
+			return
+		}
+		var plReq pluginapi.Request
+		if err := json.NewDecoder(r.Body).Decode(&plReq); err != nil {
+			writeJSON(w, http.StatusBadRequest, pluginapi.ErrorResponse{Message: "invalid request: " + err.Error()})
+			return
+		}
+		req := ipamspec.IPAMRequest{
+			Operation: plReq.Operation,
+			HostName:  plReq.HostName,
+			Key:       plReq.Key,
+			IPAddr:    plReq.IPAddr,
+			IPAMLabel: plReq.IPAMLabel,
+		}
+		if plReq.Namespace != "" || plReq.Name != "" {
+			req.Metadata = resourceMetadata{namespace: plReq.Namespace, name: plReq.Name}
+		}
+		resp, err := operation(req)
+		if err != nil {
+			log.Errorf("[PLGN] Operation %v failed, Error: %v", r.URL.Path, err)
+			writeJSON(w, http.StatusBadGateway, pluginapi.ErrorResponse{Message: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+func (h *Handler) getLabels() []string {
+	if len(h.labels) != 0 {
+		return h.labels
+	}
+	labels := []string{}
+	if insp, ok := h.mgr.(manager.Inspector); ok {
+		for _, labelUsage := range insp.GetLabelUsage() {
+			labels = append(labels, labelUsage.IPAMLabel)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Errorf("[PLGN] Unable to write the response: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package reference is the reference IPAM provider plugin, it allocates the IP addresses of ranges in memory.
+// cmd/ipam-plugin-reference serves it over the plugin contract
+package reference
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+// Manager allocates the IP addresses of the range of each label, e.g. 10.1.0.10-10.1.0.50, to the hostnames/keys
+type Manager struct {
+	mutex  sync.Mutex
+	ranges map[string]string
+	ips    map[string][]string
+	// allocations are the hostnames/keys of the allocated IP addresses by label
+	allocations map[string]map[string]string
+}
+
+// NewManager returns the manager of the JSON of the range of each label, as the ip-range of the f5-ip-provider
+func NewManager(ipRange string) (*Manager, error) {
+	ranges := make(map[string]string)
+	if err := json.Unmarshal([]byte(ipRange), &ranges); err != nil {
+		return nil, err
+	}
+	mgr := &Manager{
+		ranges:      ranges,
+		ips:         make(map[string][]string),
+		allocations: make(map[string]map[string]string),
+	}
+	for label, rng := range ranges {
+		bounds := strings.Split(rng, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid range %v for label %v", rng, label)
+		}
+		start, end := net.ParseIP(bounds[0]), net.ParseIP(bounds[1])
+		if start == nil || end == nil || bytes.Compare(start, end) > 0 {
+			return nil, fmt.Errorf("invalid range %v for label %v", rng, label)
+		}
+		for ip := start; bytes.Compare(ip, end) <= 0; ip = nextIP(ip) {
+			mgr.ips[label] = append(mgr.ips[label], ip.String())
+			if ip.Equal(end) {
+				break
+			}
+		}
+		mgr.allocations[label] = make(map[string]string)
+	}
+	return mgr, nil
+}
+
+// CreateARecord is a no-op, the reference plugin has no DNS
+func (mgr *Manager) CreateARecord(req ipamspec.IPAMRequest) bool {
+	return true
+}
+
+// DeleteARecord is a no-op, the reference plugin has no DNS
+func (mgr *Manager) DeleteARecord(req ipamspec.IPAMRequest) {
+}
+
+// GetIPAddress Gets the IP Address allocated to the hostname/key
+func (mgr *Manager) GetIPAddress(req ipamspec.IPAMRequest) string {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	for ip, ref := range mgr.allocations[req.IPAMLabel] {
+		if ref == reference(req) {
+			return ip
+		}
+	}
+	return ""
+}
+
+// AllocateNextIPAddress Allocates the first free IP address of the range of the label
+func (mgr *Manager) AllocateNextIPAddress(req ipamspec.IPAMRequest) string {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	allocations, ok := mgr.allocations[req.IPAMLabel]
+	if !ok || reference(req) == "" {
+		log.Errorf("[PLGN] Invalid Request to Allocate IP Address: %+v", req)
+		return ""
+	}
+	for _, ip := range mgr.ips[req.IPAMLabel] {
+		if _, ok := allocations[ip]; !ok {
+			allocations[ip] = reference(req)
+			return ip
+		}
+	}
+	log.Errorf("[PLGN] No IP Address available in label %v", req.IPAMLabel)
+	return ""
+}
+
+// ReserveIPAddress Allocates the IP address of the request, when it is in the range and free
+func (mgr *Manager) ReserveIPAddress(req ipamspec.IPAMRequest) bool {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	allocations, ok := mgr.allocations[req.IPAMLabel]
+	if !ok || reference(req) == "" || !mgr.inRange(req.IPAMLabel, req.IPAddr) {
+		return false
+	}
+	if ref, ok := allocations[req.IPAddr]; ok {
+		return ref == reference(req)
+	}
+	allocations[req.IPAddr] = reference(req)
+	return true
+}
+
+// ReleaseIPAddress Releases the IP address
+func (mgr *Manager) ReleaseIPAddress(req ipamspec.IPAMRequest) {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	delete(mgr.allocations[req.IPAMLabel], req.IPAddr)
+}
+
+// GetLabelUsage Gets the IPAM labels along with their utilisation
+func (mgr *Manager) GetLabelUsage() []manager.LabelUsage {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	var usage []manager.LabelUsage
+	for _, label := range mgr.labels() {
+		usage = append(usage, manager.LabelUsage{
+			IPAMLabel: label,
+			Range:     mgr.ranges[label],
+			Total:     len(mgr.ips[label]),
+			Allocated: len(mgr.allocations[label]),
+		})
+	}
+	return usage
+}
+
+// GetAllocations Gets the allocations of the IPAM label, of all labels when it is empty
+func (mgr *Manager) GetAllocations(ipamLabel string) []manager.Allocation {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	var allocations []manager.Allocation
+	for _, label := range mgr.labels() {
+		if ipamLabel != "" && label != ipamLabel {
+			continue
+		}
+		for _, ip := range mgr.ips[label] {
+			if ref, ok := mgr.allocations[label][ip]; ok {
+				allocations = append(allocations, manager.NewAllocation(label, ip, ref))
+			}
+		}
+	}
+	return allocations
+}
+
+func (mgr *Manager) inRange(label, ipAddr string) bool {
+	for _, ip := range mgr.ips[label] {
+		if ip == ipAddr {
+			return true
+		}
+	}
+	return false
+}
+
+func (mgr *Manager) labels() []string {
+	var labels []string
+	for label := range mgr.ranges {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// reference returns the key of the request, or its hostname when it has no key
+func reference(req ipamspec.IPAMRequest) string {
+	if req.Key != "" {
+		return req.Key
+	}
+	return req.HostName
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i]++; next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
@@ -31,14 +31,18 @@ type IPAMProvider struct {
 }
 
 type Params struct {
-	Range string
+	Range  string
+	DBFile string
+	// KeepLabels leaves the labels of the store as they are, only the labels of the Range
+	// that the store holds with the same range are used
+	KeepLabels bool
 }
 
 func NewProvider(params Params) *IPAMProvider {
 	// IPRangeMap := `{"test":"172.16.1.1-172.16.1.5", "prod":"172.16.1.50-172.16.1.55"}`
 
 	prov := &IPAMProvider{
-		store:      sqlite.NewStore(),
+		store:      sqlite.NewStore(params.DBFile),
 		ipamLabels: make(map[string]bool),
 	}
 	if !prov.Init(params) {
@@ -50,6 +54,21 @@ func NewProvider(params Params) *IPAMProvider {
 }
 
 func (prov *IPAMProvider) Init(params Params) bool {
+	if prov.store == nil {
+		log.Error("[PROV] Store not initialized")
+		return false
+	}
+
+	labelMap := prov.store.GetLabelMap()
+
+	// Without an IP range the labels in store are used as they are
+	if params.Range == "" {
+		for ipamLabel := range labelMap {
+			prov.ipamLabels[ipamLabel] = true
+		}
+		return true
+	}
+
 	ipRangeMap := make(map[string]string)
 	err := json.Unmarshal([]byte(params.Range), &ipRangeMap)
 	if err != nil {
@@ -57,13 +76,21 @@ func (prov *IPAMProvider) Init(params Params) bool {
 		return false
 	}
 
-	if prov.store == nil {
-		log.Error("[PROV] Store not initialized")
-		return false
+	if params.KeepLabels {
+		for ipamLabel, ipRange := range ipRangeMap {
+			rng, ok := labelMap[ipamLabel]
+			switch {
+			case !ok:
+				log.Warningf("[PROV] IPAM label %v not found in store, skipping it", ipamLabel)
+			case rng != ipRange:
+				log.Warningf("[PROV] IPAM label %v has range %v in store, skipping it", ipamLabel, rng)
+			default:
+				prov.ipamLabels[ipamLabel] = true
+			}
+		}
+		return true
 	}
 
-	labelMap := prov.store.GetLabelMap()
-
 	for ipamLabel := range labelMap {
 		if _, ok := ipRangeMap[ipamLabel]; !ok {
 			// Remove all those labels from that are not present in the new ipRangeMap
@@ -169,7 +196,38 @@ func (prov *IPAMProvider) AllocateNextIPAddress(ipamLabel, reference string) str
 	return prov.store.AllocateIP(ipamLabel, reference)
 }
 
+// Reserves the given IP address
+func (prov *IPAMProvider) ReserveAddr(ipamLabel, ipAddr, reference string) bool {
+	if _, ok := prov.ipamLabels[ipamLabel]; !ok {
+		log.Debugf("[PROV] Unsupported IPAM LABEL: %v", ipamLabel)
+		return false
+	}
+	return prov.store.ReserveIP(ipamLabel, ipAddr, reference)
+}
+
 // Releases an IP address
 func (prov *IPAMProvider) ReleaseAddr(ipAddr string) {
 	prov.store.ReleaseIP(ipAddr)
 }
+
+// Gets the IP ranges of the supported IPAM labels
+func (prov *IPAMProvider) GetLabelMap() map[string]string {
+	labelMap := make(map[string]string)
+	for ipamLabel, ipRange := range prov.store.GetLabelMap() {
+		if _, ok := prov.ipamLabels[ipamLabel]; ok {
+			labelMap[ipamLabel] = ipRange
+		}
+	}
+	return labelMap
+}
+
+// Gets the IP address records of the IPAM label, records of all supported labels when it is empty
+func (prov *IPAMProvider) GetIPRecords(ipamLabel string) []sqlite.IPRecord {
+	var records []sqlite.IPRecord
+	for _, rec := range prov.store.GetIPRecords(ipamLabel) {
+		if _, ok := prov.ipamLabels[rec.IPAMLabel]; ok {
+			records = append(records, rec)
+		}
+	}
+	return records
+}
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"github.com/F5Networks/f5-ipam-controller/pkg/provider/sqlite"
 	"github.com/F5Networks/f5-ipam-controller/pkg/provider/sqlite/mock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -60,6 +61,24 @@ var _ = Describe("Static IP Provider", func() {
 		Expect(prov.Init(params)).To(BeTrue())
 		Expect(store.Data.CleanUpFlag).To(BeTrue())
 	})
+	It("Keeping the IPAM Labels in store", func() {
+		params := Params{
+			Range:      `{"test":"172.16.1.1-172.16.1.5", "prod":"172.16.1.50-172.16.1.55", "new":"172.16.2.1-172.16.2.5"}`,
+			KeepLabels: true,
+		}
+		ipamMap := make(map[string]string)
+		ipamMap["dev"] = "192.168.1.10-192.168.1.15"
+		ipamMap["test"] = "192.168.1.1-192.168.1.5"
+		ipamMap["prod"] = "172.16.1.50-172.16.1.55"
+		store := mock.NewMockStore(mock.MockData{IPAMLabelMap: ipamMap})
+		prov := &IPAMProvider{
+			store:      store,
+			ipamLabels: make(map[string]bool),
+		}
+		Expect(prov.Init(params)).To(BeTrue())
+		Expect(store.Data.CleanUpFlag).To(BeFalse())
+		Expect(prov.ipamLabels).To(Equal(map[string]bool{"prod": true}))
+	})
 	It("Test store functions", func() {
 		store := mock.NewMockStore(mock.MockData{
 			IPAMLabelMap: make(map[string]string),
@@ -97,6 +116,26 @@ var _ = Describe("Static IP Provider", func() {
 		// get the ipaddress from invalid label
 		Expect(prov.GetIPAddressFromReference("invalid", "")).To(Equal(""))
 	})
+	It("Initialize provider without ip range using labels in store", func() {
+		store := mock.NewMockStore(mock.MockData{
+			IPAMLabelMap: map[string]string{"dev": "10.0.0.1-10.0.0.2"},
+			IPRecords: []sqlite.IPRecord{
+				{IPAddr: "10.0.0.1", Status: sqlite.ALLOCATED, IPAMLabel: "dev", Reference: "foo.com"},
+				{IPAddr: "10.0.0.2", Status: sqlite.AVAILABLE, IPAMLabel: "dev", Reference: "random"},
+				{IPAddr: "10.0.1.1", Status: sqlite.ALLOCATED, IPAMLabel: "stale", Reference: "bar.com"},
+			},
+		})
+		prov := &IPAMProvider{
+			store:      store,
+			ipamLabels: make(map[string]bool),
+		}
+		Expect(prov.Init(Params{})).To(BeTrue())
+		Expect(store.Data.CleanUpFlag).To(BeFalse())
+		Expect(prov.GetLabelMap()).To(Equal(map[string]string{"dev": "10.0.0.1-10.0.0.2"}))
+		// records of the labels that are not in store are skipped
+		Expect(prov.GetIPRecords("")).To(HaveLen(2))
+		Expect(prov.GetIPRecords("stale")).To(BeEmpty())
+	})
 	It("Initialize provider with multiple ranges for same label", func() {
 		ipRangeHelper(`{"test":"172.16.1.1-172.16.1.10,172.16.1.21-172.16.1.30"}`, true)
 	})
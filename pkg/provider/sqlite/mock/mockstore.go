@@ -1,5 +1,7 @@
 package mock
 
+import "github.com/F5Networks/f5-ipam-controller/pkg/provider/sqlite"
+
 type MockDBStore struct {
 	Data MockData
 }
@@ -11,6 +13,7 @@ type MockData struct {
 	IpList       []string
 	index        int
 	LabelData    map[string]string
+	IPRecords    []sqlite.IPRecord
 }
 
 func NewMockStore(data MockData) *MockDBStore {
@@ -27,6 +30,16 @@ func (ms *MockDBStore) InsertIPs(ips []string, ipamLabel string) {
 func (ms *MockDBStore) DisplayIPRecords() {
 }
 
+func (ms *MockDBStore) GetIPRecords(ipamLabel string) []sqlite.IPRecord {
+	var records []sqlite.IPRecord
+	for _, rec := range ms.Data.IPRecords {
+		if ipamLabel == "" || rec.IPAMLabel == ipamLabel {
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
 func (ms *MockDBStore) AllocateIP(ipamLabel, reference string) string {
 	ip := ms.Data.IpList[ms.Data.index]
 	ms.Data.LabelData[ipamLabel] = ip
@@ -34,6 +47,11 @@ func (ms *MockDBStore) AllocateIP(ipamLabel, reference string) string {
 	return ip
 }
 
+func (ms *MockDBStore) ReserveIP(ipamLabel, ip, reference string) bool {
+	ms.Data.LabelData[ipamLabel] = ip
+	return true
+}
+
 func (ms *MockDBStore) ReleaseIP(ip string) {
 	for k, v := range ms.Data.LabelData {
 		if v == ip {
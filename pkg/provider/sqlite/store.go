@@ -30,6 +30,14 @@ type DBStore struct {
 	db *sql.DB
 }
 
+// IPRecord is a row of the ipaddress_range table
+type IPRecord struct {
+	IPAddr    string
+	Status    int
+	IPAMLabel string
+	Reference string
+}
+
 const (
 	ALLOCATED = 0
 	AVAILABLE = 1
@@ -43,8 +51,10 @@ type StoreProvider interface {
 	CreateTables() bool
 	InsertIPs(ips []string, ipamLabel string)
 	DisplayIPRecords()
+	GetIPRecords(ipamLabel string) []IPRecord
 
 	AllocateIP(ipamLabel, reference string) string
+	ReserveIP(ipamLabel, ip, reference string) bool
 	ReleaseIP(ip string)
 	GetIPAddressFromARecord(ipamLabel, hostname string) string
 	GetIPAddressFromReference(ipamLabel, reference string) string
@@ -83,11 +93,15 @@ func fileExists(name string) bool {
 	return true
 }
 
-func NewStore() StoreProvider {
-	if !fileExists(dbFileName) {
+// NewStore opens the IPAM DB file, the default mount path is used when dbFile is empty
+func NewStore(dbFile string) StoreProvider {
+	if dbFile == "" {
+		dbFile = dbFileName
+	}
+	if !fileExists(dbFile) {
 		return nil
 	}
-	dsn := "file:" + dbFileName + "?cache=shared&mode=rw"
+	dsn := "file:" + dbFile + "?cache=shared&mode=rw"
 	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		log.Errorf("[STORE] Unable to Initialise DB, %v", err)
@@ -193,6 +207,32 @@ func (store *DBStore) DisplayIPRecords() {
 	}
 }
 
+// GetIPRecords returns the IP address records of the label, records of all labels when it is empty
+func (store *DBStore) GetIPRecords(ipamLabel string) []IPRecord {
+	queryString := "SELECT ipaddress, status, ipam_label, reference FROM ipaddress_range"
+	var params []interface{}
+	if ipamLabel != "" {
+		queryString += " WHERE ipam_label=?"
+		params = append(params, ipamLabel)
+	}
+	row, err := store.db.Query(queryString+" ORDER BY ipam_label, ipaddress ASC", params...)
+	if err != nil {
+		log.Errorf("[STORE] Unable to fetch rows from Table 'ipaddress_range': %v", err)
+		return nil
+	}
+	defer row.Close()
+
+	var records []IPRecord
+	for row.Next() {
+		var rec IPRecord
+		if err = row.Scan(&rec.IPAddr, &rec.Status, &rec.IPAMLabel, &rec.Reference); err != nil {
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
 func (store *DBStore) AllocateIP(ipamLabel, reference string) string {
 	var ipaddress string
 
@@ -218,6 +258,43 @@ func (store *DBStore) AllocateIP(ipamLabel, reference string) string {
 	return ipaddress
 }
 
+// ReserveIP allocates the given IP address of the label to the reference,
+// it fails if the address is not part of the label or is allocated to another reference
+func (store *DBStore) ReserveIP(ipamLabel, ip, reference string) bool {
+	var status int
+	var ref string
+
+	err := store.db.QueryRow(
+		"SELECT status, reference FROM ipaddress_range where ipaddress=? AND ipam_label=?",
+		ip,
+		ipamLabel,
+	).Scan(&status, &ref)
+	if err != nil {
+		log.Errorf("[STORE] Unable to find IP Address %v in label %v: %v", ip, ipamLabel, err)
+		return false
+	}
+	if status == ALLOCATED {
+		if ref == reference {
+			return true
+		}
+		log.Errorf("[STORE] IP Address %v is already allocated to %v", ip, ref)
+		return false
+	}
+
+	err = store.executeStatement(
+		"UPDATE ipaddress_range set status=?, reference=? WHERE ipaddress=? AND status=?",
+		ALLOCATED,
+		reference,
+		ip,
+		AVAILABLE,
+	)
+	if err != nil {
+		log.Errorf("[STORE] Unable to update row in Table 'ipaddress_range': %v", err)
+		return false
+	}
+	return true
+}
+
 func (store *DBStore) GetIPAddressFromARecord(ipamLabel, hostname string) string {
 	var ipaddress string
 	var status int
@@ -0,0 +1,79 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/ipamspec"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/utils"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+// Validate checks the allocations of the snapshot against the labels configured in the provider,
+// every allocation must belong to a configured label and be in its range
+func (snap *Snapshot) Validate(labels []manager.LabelUsage) error {
+	if snap.Version != Version {
+		return fmt.Errorf("unsupported snapshot version: %v", snap.Version)
+	}
+	ranges := make(map[string]string)
+	for _, lu := range labels {
+		ranges[lu.IPAMLabel] = lu.Range
+	}
+
+	var errs []string
+	ips := make(map[string]bool)
+	refs := make(map[string]bool)
+	for _, alloc := range snap.Allocations {
+		rng, ok := ranges[alloc.IPAMLabel]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Sprintf("%v: label %v is not configured", alloc.IPAddr, alloc.IPAMLabel))
+		case alloc.Reference == "":
+			errs = append(errs, fmt.Sprintf("%v: reference is missing", alloc.IPAddr))
+		case !utils.IsIPInRange(alloc.IPAddr, rng):
+			errs = append(errs, fmt.Sprintf("%v: not in range %v of label %v", alloc.IPAddr, rng, alloc.IPAMLabel))
+		case ips[alloc.IPAddr]:
+			errs = append(errs, fmt.Sprintf("%v: allocated more than once", alloc.IPAddr))
+		case refs[alloc.Reference]:
+			errs = append(errs, fmt.Sprintf("%v: reference %v holds more than one IP address", alloc.IPAddr, alloc.Reference))
+		}
+		ips[alloc.IPAddr] = true
+		refs[alloc.Reference] = true
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid snapshot:\n  %v", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// Restore reserves the IP addresses of the snapshot for their references,
+// it returns the allocations that could not be reserved
+func (snap *Snapshot) Restore(mgr manager.Manager) []manager.Allocation {
+	var failed []manager.Allocation
+	for _, alloc := range snap.Allocations {
+		ok := mgr.ReserveIPAddress(alloc.Request(ipamspec.CREATE))
+		if !ok {
+			log.Errorf("[SNAP] Unable to restore IP address %v of %v in label %v",
+				alloc.IPAddr, alloc.Reference, alloc.IPAMLabel)
+			failed = append(failed, alloc)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,99 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+)
+
+const filePrefix = "ipam-snapshot-"
+
+type SchedulerParams struct {
+	Inspector manager.Inspector
+	Dir       string
+	Interval  time.Duration
+	Format    string
+	// Number of snapshots to keep, all of them are kept when it is 0
+	Retain int
+}
+
+// Scheduler writes snapshots of the allocations to a directory at regular intervals
+type Scheduler struct {
+	inspector manager.Inspector
+	dir       string
+	interval  time.Duration
+	format    string
+	retain    int
+}
+
+func NewScheduler(params SchedulerParams) *Scheduler {
+	return &Scheduler{
+		inspector: params.Inspector,
+		dir:       params.Dir,
+		interval:  params.Interval,
+		format:    params.Format,
+		retain:    params.Retain,
+	}
+}
+
+// Start writes a snapshot immediately and then at every interval until stopCh is closed
+func (sch *Scheduler) Start(stopCh <-chan struct{}) {
+	log.Infof("[SNAP] Writing snapshots to %v every %v", sch.dir, sch.interval)
+	go func() {
+		ticker := time.NewTicker(sch.interval)
+		defer ticker.Stop()
+		for {
+			if _, err := sch.TakeSnapshot(); err != nil {
+				log.Errorf("[SNAP] Unable to write snapshot: %v", err)
+			}
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// TakeSnapshot writes a snapshot to the directory and removes the snapshots beyond the retain count
+func (sch *Scheduler) TakeSnapshot() (string, error) {
+	snap := New(sch.inspector)
+	filename := filepath.Join(sch.dir, filePrefix+snap.CreatedAt.Format("20060102T150405Z")+"."+sch.format)
+	if err := snap.WriteFile(filename); err != nil {
+		return "", err
+	}
+	log.Debugf("[SNAP] Wrote snapshot %v", filename)
+
+	if sch.retain > 0 {
+		files, _ := filepath.Glob(filepath.Join(sch.dir, filePrefix+"*."+sch.format))
+		// Timestamps in the names sort in the order the snapshots were taken
+		sort.Strings(files)
+		for len(files) > sch.retain {
+			if err := os.Remove(files[0]); err != nil {
+				log.Errorf("[SNAP] Unable to remove old snapshot %v: %v", files[0], err)
+			}
+			files = files[1:]
+		}
+	}
+	return filename, nil
+}
@@ -0,0 +1,176 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+
+	// Version of the snapshot format
+	Version = 1
+)
+
+var csvHeader = []string{"ipamLabel", "range", "ip", "reference"}
+
+// Label is an IPAM label along with its IP range or CIDR
+type Label struct {
+	IPAMLabel string `json:"ipamLabel"`
+	Range     string `json:"range"`
+}
+
+// Snapshot is the allocation state of an IPAM provider
+type Snapshot struct {
+	Version     int                  `json:"version"`
+	CreatedAt   time.Time            `json:"createdAt"`
+	Labels      []Label              `json:"labels"`
+	Allocations []manager.Allocation `json:"allocations"`
+}
+
+// New takes a snapshot of the labels and allocations of the provider
+func New(insp manager.Inspector) *Snapshot {
+	snap := &Snapshot{
+		Version:     Version,
+		CreatedAt:   time.Now().UTC(),
+		Labels:      []Label{},
+		Allocations: insp.GetAllocations(""),
+	}
+	for _, lu := range insp.GetLabelUsage() {
+		snap.Labels = append(snap.Labels, Label{IPAMLabel: lu.IPAMLabel, Range: lu.Range})
+	}
+	if snap.Allocations == nil {
+		snap.Allocations = []manager.Allocation{}
+	}
+	return snap
+}
+
+// FormatOf returns the format of the snapshot file from its extension
+func FormatOf(filename string) string {
+	if strings.ToLower(filepath.Ext(filename)) == "."+FormatCSV {
+		return FormatCSV
+	}
+	return FormatJSON
+}
+
+// Write writes the snapshot in the given format
+func (snap *Snapshot) Write(out io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(snap)
+	case FormatCSV:
+		w := csv.NewWriter(out)
+		_ = w.Write(csvHeader)
+		ranges := make(map[string]string)
+		for _, label := range snap.Labels {
+			ranges[label.IPAMLabel] = label.Range
+		}
+		written := make(map[string]bool)
+		for _, alloc := range snap.Allocations {
+			written[alloc.IPAMLabel] = true
+			_ = w.Write([]string{alloc.IPAMLabel, ranges[alloc.IPAMLabel], alloc.IPAddr, alloc.Reference})
+		}
+		// Labels without allocations are written with an empty IP address
+		for _, label := range snap.Labels {
+			if !written[label.IPAMLabel] {
+				_ = w.Write([]string{label.IPAMLabel, label.Range, "", ""})
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+	return fmt.Errorf("unknown snapshot format: %v", format)
+}
+
+// Read reads a snapshot in the given format
+func Read(in io.Reader, format string) (*Snapshot, error) {
+	switch format {
+	case FormatJSON:
+		snap := &Snapshot{}
+		if err := json.NewDecoder(in).Decode(snap); err != nil {
+			return nil, err
+		}
+		return snap, nil
+	case FormatCSV:
+		records, err := csv.NewReader(in).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+			return nil, fmt.Errorf("CSV snapshot must start with the header: %v", strings.Join(csvHeader, ","))
+		}
+		snap := &Snapshot{Version: Version}
+		labels := make(map[string]bool)
+		for _, rec := range records[1:] {
+			if len(rec) != len(csvHeader) {
+				return nil, fmt.Errorf("invalid CSV snapshot row: %v", strings.Join(rec, ","))
+			}
+			if rec[1] != "" && !labels[rec[0]] {
+				labels[rec[0]] = true
+				snap.Labels = append(snap.Labels, Label{IPAMLabel: rec[0], Range: rec[1]})
+			}
+			if rec[2] != "" {
+				snap.Allocations = append(snap.Allocations, manager.NewAllocation(rec[0], rec[2], rec[3]))
+			}
+		}
+		return snap, nil
+	}
+	return nil, fmt.Errorf("unknown snapshot format: %v", format)
+}
+
+// WriteFile writes the snapshot to the file in the format of its extension,
+// the file is replaced only once the snapshot is written completely
+func (snap *Snapshot) WriteFile(filename string) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filename), ".ipam-snapshot-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if err = snap.Write(tmpFile, FormatOf(filename)); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
+
+// ReadFile reads the snapshot from the file in the format of its extension
+func ReadFile(filename string) (*Snapshot, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file, FormatOf(filename))
+}
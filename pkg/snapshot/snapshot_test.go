@@ -0,0 +1,146 @@
+package snapshot_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager"
+	"github.com/F5Networks/f5-ipam-controller/pkg/manager/mock"
+	"github.com/F5Networks/f5-ipam-controller/pkg/snapshot"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSnapshot(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Snapshot Suite")
+}
+
+type fakeInspector struct {
+	labels      []manager.LabelUsage
+	allocations []manager.Allocation
+}
+
+func (fi *fakeInspector) GetLabelUsage() []manager.LabelUsage {
+	return fi.labels
+}
+
+func (fi *fakeInspector) GetAllocations(ipamLabel string) []manager.Allocation {
+	return fi.allocations
+}
+
+var _ = Describe("Snapshot", func() {
+	var insp *fakeInspector
+
+	BeforeEach(func() {
+		insp = &fakeInspector{
+			labels: []manager.LabelUsage{
+				{IPAMLabel: "Dev", Range: "10.1.1.1-10.1.1.5,10.1.2.1-10.1.2.5", Total: 10, Allocated: 2},
+				{IPAMLabel: "Test", Range: "10.2.0.0/24", Total: 254},
+				{IPAMLabel: "Prod", Range: "10.3.1.1-10.3.1.5", Total: 5},
+			},
+			allocations: []manager.Allocation{
+				{IPAMLabel: "Dev", IPAddr: "10.1.1.1", Reference: "foo.com", HostName: true},
+				{IPAMLabel: "Dev", IPAddr: "10.1.2.3", Reference: "ns/svc"},
+				{IPAMLabel: "Test", IPAddr: "10.2.0.7", Reference: "bar.com", HostName: true},
+			},
+		}
+	})
+
+	It("writes and reads snapshots in JSON and CSV formats", func() {
+		snap := snapshot.New(insp)
+		Expect(snap.Version).To(Equal(snapshot.Version))
+		Expect(snap.Labels).To(HaveLen(3))
+
+		for _, format := range []string{snapshot.FormatJSON, snapshot.FormatCSV} {
+			var buf bytes.Buffer
+			Expect(snap.Write(&buf, format)).To(Succeed())
+			read, err := snapshot.Read(&buf, format)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(read.Labels).To(ConsistOf(snap.Labels))
+			Expect(read.Allocations).To(Equal(snap.Allocations))
+		}
+	})
+
+	It("rejects CSV snapshots without the header", func() {
+		_, err := snapshot.Read(bytes.NewBufferString("Dev,,10.1.1.1,foo.com\n"), snapshot.FormatCSV)
+		Expect(err).To(HaveOccurred())
+		_, err = snapshot.Read(bytes.NewBufferString("ipamLabel,range,ip,reference\nDev,10.1.1.1\n"), snapshot.FormatCSV)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("takes the format from the file extension", func() {
+		Expect(snapshot.FormatOf("backup.CSV")).To(Equal(snapshot.FormatCSV))
+		Expect(snapshot.FormatOf("backup.json")).To(Equal(snapshot.FormatJSON))
+		Expect(snapshot.FormatOf("backup")).To(Equal(snapshot.FormatJSON))
+	})
+
+	It("validates the allocations against the configured labels", func() {
+		snap := snapshot.New(insp)
+		Expect(snap.Validate(insp.labels)).To(Succeed())
+
+		// Prod is not configured and Dev has a smaller range
+		err := snap.Validate([]manager.LabelUsage{
+			{IPAMLabel: "Dev", Range: "10.1.1.1-10.1.1.5"},
+			{IPAMLabel: "Prod", Range: "10.3.1.1-10.3.1.5"},
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("10.1.2.3: not in range"))
+		Expect(err.Error()).To(ContainSubstring("10.2.0.7: label Test is not configured"))
+
+		snap.Allocations = append(snap.Allocations,
+			manager.Allocation{IPAMLabel: "Dev", IPAddr: "10.1.1.1", Reference: "baz.com", HostName: true},
+			manager.Allocation{IPAMLabel: "Dev", IPAddr: "10.1.1.2", Reference: "foo.com", HostName: true},
+		)
+		err = snap.Validate(insp.labels)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("10.1.1.1: allocated more than once"))
+		Expect(err.Error()).To(ContainSubstring("10.1.1.2: reference foo.com holds more than one IP address"))
+
+		snap.Version = 0
+		Expect(snap.Validate(insp.labels)).NotTo(Succeed())
+	})
+
+	It("restores the allocations", func() {
+		mgr, _ := mock.NewMockIPAMManager(mock.MockData{})
+		snap := snapshot.New(insp)
+		Expect(snap.Restore(mgr)).To(BeEmpty())
+
+		snap.Allocations = append(snap.Allocations, manager.Allocation{IPAMLabel: "Dev", Reference: "baz.com", HostName: true})
+		Expect(snap.Restore(mgr)).To(Equal([]manager.Allocation{{IPAMLabel: "Dev", Reference: "baz.com", HostName: true}}))
+	})
+
+	It("writes scheduled snapshots and keeps the latest ones", func() {
+		dir, err := ioutil.TempDir("", "snapshots")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		for _, name := range []string{"ipam-snapshot-20200101T000000Z.csv", "ipam-snapshot-20200102T000000Z.csv", "other.csv"} {
+			Expect(ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)).To(Succeed())
+		}
+		sch := snapshot.NewScheduler(snapshot.SchedulerParams{
+			Inspector: insp,
+			Dir:       dir,
+			Interval:  time.Hour,
+			Format:    snapshot.FormatCSV,
+			Retain:    2,
+		})
+		filename, err := sch.TakeSnapshot()
+		Expect(err).NotTo(HaveOccurred())
+
+		snap, err := snapshot.ReadFile(filename)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snap.Allocations).To(HaveLen(3))
+
+		files, _ := filepath.Glob(filepath.Join(dir, "*"))
+		Expect(files).To(ConsistOf(
+			filepath.Join(dir, "ipam-snapshot-20200102T000000Z.csv"),
+			filename,
+			filepath.Join(dir, "other.csv"),
+		))
+	})
+})
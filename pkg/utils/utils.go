@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"bytes"
 	"github.com/google/uuid"
 	"net"
 	"strings"
+	"time"
 )
 
 func IsIPV4Addr(ipAddr string) bool {
@@ -42,6 +44,50 @@ func IsIPAddr(ipAddr string) bool {
 
 	return true
 }
+
+// IsIPInRange checks whether the IP address is in the IP ranges, e.g. 10.1.1.1-10.1.1.5,10.1.2.1-10.1.2.5,
+// or in the CIDRs, e.g. 10.1.0.0/24
+func IsIPInRange(ipAddr, ranges string) bool {
+	ip := net.ParseIP(ipAddr)
+	if ip == nil {
+		return false
+	}
+	for _, rng := range strings.Split(ranges, ",") {
+		rng = strings.TrimSpace(rng)
+		if strings.Contains(rng, "/") {
+			if _, ipNet, err := net.ParseCIDR(rng); err == nil && ipNet.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		bounds := strings.Split(rng, "-")
+		if len(bounds) != 2 {
+			continue
+		}
+		startIP, endIP := net.ParseIP(bounds[0]), net.ParseIP(bounds[1])
+		if startIP == nil || endIP == nil {
+			continue
+		}
+		if bytes.Compare(ip.To16(), startIP.To16()) >= 0 && bytes.Compare(ip.To16(), endIP.To16()) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns the delay before the retry of the attempt, starting at initial and doubled on every
+// attempt up to max
+func Backoff(attempt int, initial, max time.Duration) time.Duration {
+	delay := initial
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
 func RandomString(len int) string {
 	if len > 0 {
 		id := uuid.New()
@@ -4,6 +4,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"testing"
+	"time"
 )
 
 func TestController(t *testing.T) {
@@ -17,6 +18,12 @@ var _ = Describe("Utils function test", func() {
 		Expect(len(RandomString(0))).To(BeEquivalentTo(0))
 		Expect(len(RandomString(-1))).To(BeEquivalentTo(0))
 	})
+	It("Check Backoff", func() {
+		Expect(Backoff(0, time.Second, time.Minute)).To(Equal(time.Second))
+		Expect(Backoff(3, time.Second, time.Minute)).To(Equal(8 * time.Second))
+		Expect(Backoff(10, time.Second, time.Minute)).To(Equal(time.Minute))
+		Expect(Backoff(1000, time.Second, time.Minute)).To(Equal(time.Minute))
+	})
 	It("Check IsIPAddr", func() {
 		Expect(IsIPV4Addr("172.16.1.1")).To(BeTrue())
 		Expect(IsIPV4Addr("300.300.300.300")).To(BeFalse())
@@ -27,4 +34,14 @@ var _ = Describe("Utils function test", func() {
 		Expect(IsIPAddr("")).To(BeFalse())
 		Expect(IsIPAddr("cdaskn")).To(BeFalse())
 	})
+	It("Check IsIPInRange", func() {
+		Expect(IsIPInRange("172.16.1.5", "172.16.1.1-172.16.1.5")).To(BeTrue())
+		Expect(IsIPInRange("172.16.1.6", "172.16.1.1-172.16.1.5")).To(BeFalse())
+		Expect(IsIPInRange("172.16.2.1", "172.16.1.1-172.16.1.5,172.16.2.1-172.16.2.5")).To(BeTrue())
+		Expect(IsIPInRange("172.16.4.9", "172.16.4.0/24")).To(BeTrue())
+		Expect(IsIPInRange("172.16.5.9", "172.16.4.0/24")).To(BeFalse())
+		Expect(IsIPInRange("2001::5", "2001::1-2001::a")).To(BeTrue())
+		Expect(IsIPInRange("invalid", "172.16.4.0/24")).To(BeFalse())
+		Expect(IsIPInRange("172.16.1.1", "invalid")).To(BeFalse())
+	})
 })
@@ -0,0 +1,98 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	ficV1 "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/apis/fic/v1"
+)
+
+// Validator checks IPAM resources against the configured IPAM labels
+type Validator struct {
+	labels          map[string]bool
+	controllerClass string
+}
+
+func NewValidator(labels []string, controllerClass string) *Validator {
+	v := &Validator{
+		labels:          make(map[string]bool),
+		controllerClass: controllerClass,
+	}
+	for _, label := range labels {
+		v.labels[label] = true
+	}
+	return v
+}
+
+// Validate returns all the problems found in the IPAM resource as one error.
+// Resources of other controller classes are not validated.
+func (v *Validator) Validate(ipam *ficV1.IPAM) error {
+	if ipam.Spec.ControllerClass != v.controllerClass {
+		return nil
+	}
+
+	var errs []string
+	hostLabels := make(map[string]string)
+	keyLabels := make(map[string]string)
+	for i, hostSpec := range ipam.Spec.HostSpecs {
+		if hostSpec == nil {
+			continue
+		}
+		field := fmt.Sprintf("spec.hostSpecs[%d]", i)
+		if hostSpec.Host == "" && hostSpec.Key == "" {
+			errs = append(errs, fmt.Sprintf("%s: one of host or key is required", field))
+		}
+		if hostSpec.IPAMLabel == "" {
+			errs = append(errs, fmt.Sprintf("%s: ipamLabel is required", field))
+		} else if !v.labels[hostSpec.IPAMLabel] {
+			errs = append(errs, fmt.Sprintf("%s: ipamLabel %q is not configured, valid labels are: %s",
+				field, hostSpec.IPAMLabel, v.labelList()))
+		}
+		if hostSpec.Host != "" {
+			if label, ok := hostLabels[hostSpec.Host]; ok && label != hostSpec.IPAMLabel {
+				errs = append(errs, fmt.Sprintf("%s: host %q is already requested with ipamLabel %q",
+					field, hostSpec.Host, label))
+			} else {
+				hostLabels[hostSpec.Host] = hostSpec.IPAMLabel
+			}
+		}
+		if hostSpec.Key != "" {
+			if label, ok := keyLabels[hostSpec.Key]; ok && label != hostSpec.IPAMLabel {
+				errs = append(errs, fmt.Sprintf("%s: key %q is already requested with ipamLabel %q",
+					field, hostSpec.Key, label))
+			} else {
+				keyLabels[hostSpec.Key] = hostSpec.IPAMLabel
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (v *Validator) labelList() string {
+	var labels []string
+	for label := range v.labels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return strings.Join(labels, ", ")
+}
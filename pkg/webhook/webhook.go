@@ -0,0 +1,148 @@
+/*-
+ * Copyright (c) 2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	ficV1 "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/apis/fic/v1"
+	log "github.com/F5Networks/f5-ipam-controller/pkg/vlogger"
+	admissionV1 "k8s.io/api/admission/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ValidatePath is the path the ValidatingWebhookConfiguration should point to
+	ValidatePath = "/validate-ipam"
+
+	maxRequestSize = 1 << 20
+)
+
+// Params defines the parameters of the webhook server
+type Params struct {
+	// Port to serve the webhook on
+	Port int
+	// CertFile and KeyFile hold the TLS certificate served to the API server
+	CertFile string
+	KeyFile  string
+	// Labels are the IPAM labels configured on the provider
+	Labels []string
+	// ControllerClass of the IPAM resources this controller validates
+	ControllerClass string
+}
+
+// Webhook serves the validating admission webhook for IPAM resources
+type Webhook struct {
+	server    *http.Server
+	certFile  string
+	keyFile   string
+	validator *Validator
+}
+
+func NewWebhook(params Params) *Webhook {
+	wh := &Webhook{
+		certFile:  params.CertFile,
+		keyFile:   params.KeyFile,
+		validator: NewValidator(params.Labels, params.ControllerClass),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(ValidatePath, wh.serveValidate)
+	wh.server = &http.Server{
+		Addr:    fmt.Sprintf(":%d", params.Port),
+		Handler: mux,
+	}
+	return wh
+}
+
+// Start serves the webhook in the background
+func (wh *Webhook) Start() {
+	go func() {
+		log.Infof("[WHK] Serving validating webhook on %v%v", wh.server.Addr, ValidatePath)
+		err := wh.server.ListenAndServeTLS(wh.certFile, wh.keyFile)
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("[WHK] Unable to serve validating webhook: %v", err)
+		}
+	}()
+}
+
+func (wh *Webhook) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = wh.server.Shutdown(ctx)
+}
+
+func (wh *Webhook) serveValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	review := admissionV1.AdmissionReview{}
+	if err = json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		log.Errorf("[WHK] Invalid AdmissionReview: %v", err)
+		http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = wh.admit(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+
+	resp, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(resp)
+}
+
+func (wh *Webhook) admit(req *admissionV1.AdmissionRequest) *admissionV1.AdmissionResponse {
+	if req.Operation != admissionV1.Create && req.Operation != admissionV1.Update {
+		return &admissionV1.AdmissionResponse{Allowed: true}
+	}
+	ipam := &ficV1.IPAM{}
+	if err := json.Unmarshal(req.Object.Raw, ipam); err != nil {
+		return denied(fmt.Sprintf("unable to decode IPAM: %v", err))
+	}
+	if err := wh.validator.Validate(ipam); err != nil {
+		log.Infof("[WHK] Rejected IPAM: %v/%v, %v", req.Namespace, ipam.Name, err)
+		return denied(err.Error())
+	}
+	return &admissionV1.AdmissionResponse{Allowed: true}
+}
+
+func denied(message string) *admissionV1.AdmissionResponse {
+	return &admissionV1.AdmissionResponse{
+		Allowed: false,
+		Result: &metaV1.Status{
+			Status:  metaV1.StatusFailure,
+			Reason:  metaV1.StatusReasonInvalid,
+			Message: message,
+			Code:    http.StatusUnprocessableEntity,
+		},
+	}
+}
@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ficV1 "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/apis/fic/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionV1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestWebhook(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Webhook Suite")
+}
+
+func ipamWithHostSpecs(hostSpecs ...*ficV1.HostSpec) *ficV1.IPAM {
+	ipam := &ficV1.IPAM{}
+	ipam.Name = "ipam"
+	ipam.Spec.HostSpecs = hostSpecs
+	return ipam
+}
+
+var _ = Describe("IPAM Validator", func() {
+	v := NewValidator([]string{"Dev", "Test"}, "")
+
+	It("accepts a valid IPAM", func() {
+		ipam := ipamWithHostSpecs(
+			&ficV1.HostSpec{Host: "foo.com", IPAMLabel: "Dev"},
+			&ficV1.HostSpec{Key: "ns/svc", IPAMLabel: "Test"},
+		)
+		Expect(v.Validate(ipam)).To(Succeed())
+	})
+	It("rejects an unknown ipamLabel", func() {
+		ipam := ipamWithHostSpecs(&ficV1.HostSpec{Host: "foo.com", IPAMLabel: "Prod"})
+		Expect(v.Validate(ipam)).To(MatchError(
+			`spec.hostSpecs[0]: ipamLabel "Prod" is not configured, valid labels are: Dev, Test`))
+	})
+	It("rejects a hostSpec without host and key", func() {
+		ipam := ipamWithHostSpecs(&ficV1.HostSpec{IPAMLabel: "Dev"})
+		Expect(v.Validate(ipam)).To(MatchError("spec.hostSpecs[0]: one of host or key is required"))
+	})
+	It("rejects the same host with different labels", func() {
+		ipam := ipamWithHostSpecs(
+			&ficV1.HostSpec{Host: "foo.com", IPAMLabel: "Dev"},
+			&ficV1.HostSpec{Host: "foo.com", IPAMLabel: "Test"},
+		)
+		Expect(v.Validate(ipam)).To(MatchError(
+			`spec.hostSpecs[1]: host "foo.com" is already requested with ipamLabel "Dev"`))
+	})
+	It("skips IPAMs of other controller classes", func() {
+		ipam := ipamWithHostSpecs(&ficV1.HostSpec{IPAMLabel: "Prod"})
+		ipam.Spec.ControllerClass = "lab"
+		Expect(v.Validate(ipam)).To(Succeed())
+	})
+})
+
+var _ = Describe("Webhook Server", func() {
+	wh := NewWebhook(Params{Labels: []string{"Dev"}})
+
+	review := func(ipam *ficV1.IPAM) *admissionV1.AdmissionResponse {
+		raw, _ := json.Marshal(ipam)
+		body, _ := json.Marshal(admissionV1.AdmissionReview{
+			Request: &admissionV1.AdmissionRequest{
+				UID:       "1234",
+				Operation: admissionV1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		})
+		rec := httptest.NewRecorder()
+		wh.serveValidate(rec, httptest.NewRequest(http.MethodPost, ValidatePath, bytes.NewReader(body)))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		resp := admissionV1.AdmissionReview{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+		Expect(resp.Response.UID).To(BeEquivalentTo("1234"))
+		return resp.Response
+	}
+
+	It("allows valid IPAMs", func() {
+		resp := review(ipamWithHostSpecs(&ficV1.HostSpec{Host: "foo.com", IPAMLabel: "Dev"}))
+		Expect(resp.Allowed).To(BeTrue())
+	})
+	It("denies invalid IPAMs with a message", func() {
+		resp := review(ipamWithHostSpecs(&ficV1.HostSpec{Host: "foo.com", IPAMLabel: "Test"}))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring(`ipamLabel "Test" is not configured`))
+	})
+	It("rejects malformed requests", func() {
+		rec := httptest.NewRecorder()
+		wh.serveValidate(rec, httptest.NewRequest(http.MethodPost, ValidatePath, bytes.NewReader([]byte("{"))))
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+	})
+})